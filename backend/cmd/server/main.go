@@ -1,37 +1,132 @@
 package main
 
 import (
-	"fmt"
-	"log"
+	"context"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
-	"github.com/joho/godotenv"
-
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/config"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/logging"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/metrics"
 	"github.com/EmmaMartin123/Industrial_Project/backend/internal/routes"
-	"github.com/EmmaMartin123/Industrial_Project/backend/internal/utils"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/saga"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/scheduler"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/store"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/tracing"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/upstream"
 )
 
 func main() {
-	err := godotenv.Load()
+	// reads every setting once and refuses to start if one is missing or invalid
+	cfg, err := config.Load()
+	if err != nil {
+		slog.Error("invalid configuration", "err", err)
+		os.Exit(1)
+	}
+
+	// logs as JSON to stdout unless LOG_FORMAT says otherwise
+	slog.SetDefault(logging.New(os.Stdout, cfg.LogFormat, cfg.LogLevel))
+
+	// exports spans for requests and Supabase calls, or drops them if
+	// TRACING_EXPORTER is none
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Options{
+		Exporter:     cfg.Tracing.Exporter,
+		OTLPEndpoint: cfg.Tracing.OTLPEndpoint,
+		ServiceName:  cfg.Tracing.ServiceName,
+		SampleRatio:  cfg.Tracing.SampleRatio,
+	})
 	if err != nil {
-		log.Printf("No .env file found (skipping): %v", err)
+		slog.Error("failed to set up tracing", "err", err)
+		os.Exit(1)
+	}
+
+	// one client for every call to Supabase, with deadlines, retries and a
+	// circuit breaker per service
+	client := upstream.New(upstream.Options{
+		Timeout:          cfg.Upstream.Timeout,
+		Retries:          cfg.Upstream.Retries,
+		BreakerThreshold: cfg.Upstream.BreakerThreshold,
+		BreakerCooldown:  cfg.Upstream.BreakerCooldown,
+	})
+
+	// times every Supabase call for /metrics
+	db := store.Instrument(store.NewSupabase(cfg.Supabase.URL, cfg.Supabase.ServiceRoleKey, client), metrics.ObserveStore)
+	outbox := saga.NewOutbox(db)
+	pitches := routes.NewPitchIndex(db)
+	router := routes.SetupRouter(cfg, client, db, outbox, pitches)
+
+	// cancelled on SIGINT or SIGTERM to start shutting down
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var workers sync.WaitGroup
+
+	// retries or rolls back sagas left unfinished by a crash or restart
+	workers.Go(func() { outbox.Run(ctx, 30*time.Second) })
+
+	// reloads the pitch search index, picking up changes made through other
+	// instances
+	workers.Go(func() { pitches.Run(ctx, routes.SEARCH_INDEX_REFRESH) })
+
+	// opens and closes pitches on their start and end dates
+	jobs := scheduler.New(db)
+	jobs.Add(routes.PitchJobs(cfg, db)...)
+	workers.Go(func() { jobs.Start(ctx) })
+
+	port := cfg.Port
+
+	// the write timeout leaves room for a distribution run paying out every investor
+	server := &http.Server{
+		Addr:              ":" + port,
+		Handler:           router,
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       15 * time.Second,
+		WriteTimeout:      60 * time.Second,
+		IdleTimeout:       120 * time.Second,
 	}
 
-	if err = utils.InitJWTHS256(os.Getenv("SUPABASE_URL") + "/auth/v1"); err != nil {
-		log.Fatal(err)
+	serveErr := make(chan error, 1)
+	go func() {
+		slog.Info("listening", "port", port)
+		serveErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		slog.Error("server failed", "err", err)
+		stop()
+		workers.Wait()
+		os.Exit(1)
+	case <-ctx.Done():
 	}
 
-	router := routes.SetupRouter()
+	// stops taking connections and lets in-flight investments and
+	// distributions finish before the workers are waited on
+	slog.Info("shutting down", "timeout", cfg.ShutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Warn("in-flight requests did not finish", "err", err)
+	}
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	done := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		slog.Info("shutdown complete")
+	case <-shutdownCtx.Done():
+		slog.Warn("background workers did not finish before the shutdown timeout")
 	}
 
-	fmt.Println("Listening on :" + port)
-	err = http.ListenAndServe(":"+port, router)
-	if err != nil {
-		panic(err)
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		slog.Warn("failed to flush traces", "err", err)
 	}
 }
@@ -0,0 +1,138 @@
+package allocation
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+
+	model "github.com/EmmaMartin123/Industrial_Project/backend/internal/model/common"
+)
+
+// Policy decides who gets the pennies left over once every share has been
+// rounded down to a whole penny
+type Policy string
+
+const (
+	// one penny each to the shares that lost the most to rounding
+	LargestRemainder Policy = "largest_remainder"
+	// every leftover penny to the share with the biggest weight
+	LargestHolder Policy = "largest_holder"
+	// leftover pennies are never paid out and stay with the business
+	Business Policy = "business"
+)
+
+var (
+	ErrInvalidTotal  = errors.New("total to allocate must not be negative")
+	ErrInvalidWeight = errors.New("weights must be finite and not negative")
+	ErrNoWeight      = errors.New("weights must add up to more than zero")
+)
+
+// parses a policy name, an empty name is the default LargestRemainder
+func ParsePolicy(name string) (Policy, error) {
+	switch p := Policy(name); p {
+	case "":
+		return LargestRemainder, nil
+	case LargestRemainder, LargestHolder, Business:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown residue policy %q", name)
+	}
+}
+
+// Result is the split of a total, Amounts[i] belongs to weights[i] and
+// Residue is what the policy kept back. The amounts and residue always add up
+// to the total.
+type Result struct {
+	Amounts []model.Money
+	Residue model.Money
+}
+
+// gets the total of the allocated amounts, which is what should be debited
+func (r Result) Allocated() model.Money {
+	sum := model.NewMoney(0, r.Residue.Currency())
+	for _, a := range r.Amounts {
+		sum = sum.Add(a)
+	}
+	return sum
+}
+
+// splits total in proportion to the weights. Each share is worked out exactly,
+// rounded down to the penny, and the pennies left over are handed out by the
+// policy so no money is made or lost by rounding.
+func Allocate(total model.Money, weights []float64, policy Policy) (Result, error) {
+	if total.IsNegative() {
+		return Result{}, ErrInvalidTotal
+	}
+	policy, err := ParsePolicy(string(policy))
+	if err != nil {
+		return Result{}, err
+	}
+
+	exact := make([]*big.Rat, len(weights))
+	sum := new(big.Rat)
+	for i, w := range weights {
+		if math.IsNaN(w) || math.IsInf(w, 0) || w < 0 {
+			return Result{}, ErrInvalidWeight
+		}
+		exact[i] = new(big.Rat).SetFloat64(w)
+		sum.Add(sum, exact[i])
+	}
+	if sum.Sign() <= 0 {
+		return Result{}, ErrNoWeight
+	}
+
+	pence := make([]int64, len(weights))
+	remainders := make([]*big.Rat, len(weights))
+	left := total.Pence()
+	for i, w := range exact {
+		quota := new(big.Rat).Mul(w, new(big.Rat).SetInt64(total.Pence()))
+		quota.Quo(quota, sum)
+
+		floor := new(big.Int).Quo(quota.Num(), quota.Denom())
+		pence[i] = floor.Int64()
+		remainders[i] = quota.Sub(quota, new(big.Rat).SetInt(floor))
+		left -= pence[i]
+	}
+
+	residue := int64(0)
+	switch policy {
+	case LargestRemainder:
+		// the remainders are each under a penny and add up to left, so there
+		// are always more than left shares with a remainder to give to
+		order := make([]int, len(weights))
+		for i := range order {
+			order[i] = i
+		}
+		sort.SliceStable(order, func(a, b int) bool {
+			i, j := order[a], order[b]
+			if c := remainders[i].Cmp(remainders[j]); c != 0 {
+				return c > 0
+			}
+			return exact[i].Cmp(exact[j]) > 0
+		})
+		for _, i := range order[:left] {
+			pence[i]++
+		}
+	case LargestHolder:
+		largest := 0
+		for i, w := range exact {
+			if w.Cmp(exact[largest]) > 0 {
+				largest = i
+			}
+		}
+		pence[largest] += left
+	case Business:
+		residue = left
+	}
+
+	result := Result{
+		Amounts: make([]model.Money, len(weights)),
+		Residue: model.NewMoney(residue, total.Currency()),
+	}
+	for i, p := range pence {
+		result.Amounts[i] = model.NewMoney(p, total.Currency())
+	}
+	return result, nil
+}
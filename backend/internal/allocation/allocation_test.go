@@ -0,0 +1,134 @@
+package allocation
+
+import (
+	"math/big"
+	"math/rand"
+	"reflect"
+	"testing"
+	"testing/quick"
+
+	model "github.com/EmmaMartin123/Industrial_Project/backend/internal/model/common"
+)
+
+// a random payout, investments of up to £100k at the usual tier multipliers
+type split struct {
+	Total   int64
+	Weights []float64
+}
+
+func (split) Generate(r *rand.Rand, size int) reflect.Value {
+	multipliers := []float64{0, 0.5, 1, 1.1, 1.25, 1.5, 2, 3}
+	s := split{Total: r.Int63n(100_000_000)}
+	n := 1 + r.Intn(size+1)
+	for range n {
+		amount := float64(1+r.Int63n(10_000_000)) / 100
+		s.Weights = append(s.Weights, amount*multipliers[r.Intn(len(multipliers))])
+	}
+	// at least one investment has weight
+	s.Weights[r.Intn(n)] += 1
+	return reflect.ValueOf(s)
+}
+
+func allocate(t *testing.T, s split, policy Policy) Result {
+	t.Helper()
+	result, err := Allocate(model.FromPence(s.Total), s.Weights, policy)
+	if err != nil {
+		t.Fatalf("Allocate failed: %v", err)
+	}
+	return result
+}
+
+func TestAllocationConservesMoney(t *testing.T) {
+	for _, policy := range []Policy{LargestRemainder, LargestHolder, Business} {
+		conserves := func(s split) bool {
+			result := allocate(t, s, policy)
+			return result.Allocated().Add(result.Residue) == model.FromPence(s.Total)
+		}
+		if err := quick.Check(conserves, nil); err != nil {
+			t.Errorf("%s: %v", policy, err)
+		}
+	}
+}
+
+func TestLargestRemainderStaysWithinAPenny(t *testing.T) {
+	fair := func(s split) bool {
+		result := allocate(t, s, LargestRemainder)
+		if !result.Residue.IsZero() {
+			return false
+		}
+
+		sum := new(big.Rat)
+		for _, w := range s.Weights {
+			sum.Add(sum, new(big.Rat).SetFloat64(w))
+		}
+		for i, w := range s.Weights {
+			quota := new(big.Rat).SetFloat64(w)
+			quota.Mul(quota, new(big.Rat).SetInt64(s.Total)).Quo(quota, sum)
+
+			diff := new(big.Rat).Sub(new(big.Rat).SetInt64(result.Amounts[i].Pence()), quota)
+			if diff.Abs(diff).Cmp(big.NewRat(1, 1)) >= 0 {
+				return false
+			}
+			if w == 0 && !result.Amounts[i].IsZero() {
+				return false
+			}
+		}
+		return true
+	}
+	if err := quick.Check(fair, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestBusinessKeepsLessThanAPennyEach(t *testing.T) {
+	bounded := func(s split) bool {
+		result := allocate(t, s, Business)
+		return !result.Residue.IsNegative() && result.Residue.Pence() < int64(len(s.Weights))
+	}
+	if err := quick.Check(bounded, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestResiduePolicies(t *testing.T) {
+	// 5p split 1:2 is 1.67p and 3.33p, leaving a penny once both round down
+	weights := []float64{1, 2}
+	cases := []struct {
+		policy  Policy
+		amounts []int64
+		residue int64
+	}{
+		{LargestRemainder, []int64{2, 3}, 0},
+		{LargestHolder, []int64{1, 4}, 0},
+		{Business, []int64{1, 3}, 1},
+	}
+	for _, c := range cases {
+		result, err := Allocate(model.FromPence(5), weights, c.policy)
+		if err != nil {
+			t.Fatalf("%s: %v", c.policy, err)
+		}
+		for i, want := range c.amounts {
+			if result.Amounts[i].Pence() != want {
+				t.Errorf("%s: share %d got %d pence, expected %d", c.policy, i, result.Amounts[i].Pence(), want)
+			}
+		}
+		if result.Residue.Pence() != c.residue {
+			t.Errorf("%s: residue %d pence, expected %d", c.policy, result.Residue.Pence(), c.residue)
+		}
+	}
+}
+
+func TestAllocateRejectsBadInput(t *testing.T) {
+	if _, err := Allocate(model.FromPounds(1), []float64{0, 0}, LargestRemainder); err != ErrNoWeight {
+		t.Errorf("Expected ErrNoWeight, got %v", err)
+	}
+	if _, err := Allocate(model.FromPounds(1), []float64{1, -1}, LargestRemainder); err != ErrInvalidWeight {
+		t.Errorf("Expected ErrInvalidWeight, got %v", err)
+	}
+	if _, err := Allocate(model.FromPence(-1), []float64{1}, LargestRemainder); err != ErrInvalidTotal {
+		t.Errorf("Expected ErrInvalidTotal, got %v", err)
+	}
+	if _, err := Allocate(model.FromPounds(1), []float64{1}, "random"); err == nil {
+		t.Errorf("Expected an unknown policy to be rejected")
+	}
+}
@@ -0,0 +1,245 @@
+package audit
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/postgrest"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/store"
+)
+
+const table = "audit_log"
+
+// how many entries Verify reads at a time, below PostgREST's max-rows
+const verifyPage = 500
+
+// how many times an append retries when another server takes its place in
+// the chain. Each lost race means another entry went in, so this is only
+// reached when far more servers than this are appending at the same time.
+const appendAttempts = 50
+
+// the actor recorded for changes the scheduler makes on its own
+const SchedulerActor = "system:scheduler"
+
+var (
+	ErrTampered = errors.New("audit log has been tampered with")
+	ErrBusy     = errors.New("audit log is busy, please retry")
+)
+
+// Entry records who did what to which record and what it looked like before
+// and after. Entries are chained, each one's hash covers the hash of the
+// entry before it, so editing or removing an entry breaks every hash after.
+type Entry struct {
+	ID         *int64          `json:"id,omitempty"`
+	Seq        int64           `json:"seq"`
+	ActorID    string          `json:"actor_id"`
+	Action     string          `json:"action"`
+	TargetType string          `json:"target_type"`
+	TargetID   string          `json:"target_id"`
+	Reason     string          `json:"reason,omitempty"`
+	Before     json.RawMessage `json:"before,omitempty"`
+	After      json.RawMessage `json:"after,omitempty"`
+	RequestID  string          `json:"request_id,omitempty"`
+	CreatedAt  string          `json:"created_at"`
+	PrevHash   string          `json:"prev_hash"`
+	Hash       string          `json:"hash"`
+}
+
+// Filter narrows a query of the log, empty fields match every entry
+type Filter struct {
+	ActorID    string
+	TargetType string
+	TargetID   string
+	Limit      int
+	Offset     int
+}
+
+// Log appends entries to the audit_log table, entries are never updated
+type Log struct {
+	db       store.Store
+	now      func() time.Time
+	page     int
+	attempts int
+}
+
+// creates the audit log backed by the data store
+func New(db store.Store) *Log {
+	return &Log{db: db, now: time.Now, page: verifyPage, attempts: appendAttempts}
+}
+
+// appends the entry to the chain, before and after are encoded as JSON if set.
+// The sequence number is unique so two servers appending at once can't both
+// link to the same entry, the loser reads the new head and tries again. Fails
+// with ErrBusy if it keeps losing.
+func (l *Log) Record(e Entry, before any, after any) error {
+	if e.ActorID == "" || e.Action == "" {
+		return errors.New("an audit entry needs an actor and an action")
+	}
+	var err error
+	if e.Before, err = snapshot(before); err != nil {
+		return err
+	}
+	if e.After, err = snapshot(after); err != nil {
+		return err
+	}
+
+	for range l.attempts {
+		head, err := l.head()
+		if err != nil {
+			return err
+		}
+		e.Seq, e.PrevHash = 1, ""
+		if head != nil {
+			e.Seq, e.PrevHash = head.Seq+1, head.Hash
+		}
+		// postgres keeps microseconds, anything finer wouldn't hash the same
+		e.CreatedAt = l.now().UTC().Truncate(time.Microsecond).Format(time.RFC3339Nano)
+		if e.Hash, err = e.digest(); err != nil {
+			return err
+		}
+
+		_, err = l.db.Insert(table, e)
+		if errors.Is(err, store.ErrConflict) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to write audit entry: %w", err)
+		}
+		return nil
+	}
+	return ErrBusy
+}
+
+// gets the entries matching the filter, newest first
+func (l *Log) Query(f Filter) ([]Entry, error) {
+	query := postgrest.New().Order("seq", postgrest.Desc)
+	if f.ActorID != "" {
+		query = query.Eq("actor_id", f.ActorID)
+	}
+	if f.TargetType != "" {
+		query = query.Eq("target_type", f.TargetType)
+	}
+	if f.TargetID != "" {
+		query = query.Eq("target_id", f.TargetID)
+	}
+	if f.Limit > 0 {
+		query = query.Limit(f.Limit)
+	}
+	if f.Offset > 0 {
+		query = query.Offset(f.Offset)
+	}
+	return l.read(query)
+}
+
+// walks the whole chain a page at a time, failing with ErrTampered at the
+// first entry whose hash or link doesn't match. Returns how many entries were
+// checked.
+func (l *Log) Verify() (int, error) {
+	checked, prev := 0, ""
+	for {
+		entries, err := l.read(postgrest.New().Gt("seq", checked).Order("seq", postgrest.Asc).Limit(l.page))
+		if err != nil {
+			return checked, err
+		}
+		for _, e := range entries {
+			if e.Seq != int64(checked+1) {
+				return checked, fmt.Errorf("%w: expected entry %d, found %d", ErrTampered, checked+1, e.Seq)
+			}
+			if e.PrevHash != prev {
+				return checked, fmt.Errorf("%w: entry %d does not link to the entry before it", ErrTampered, e.Seq)
+			}
+			hash, err := e.digest()
+			if err != nil {
+				return checked, err
+			}
+			if hash != e.Hash {
+				return checked, fmt.Errorf("%w: entry %d has been changed", ErrTampered, e.Seq)
+			}
+			prev = e.Hash
+			checked++
+		}
+		if len(entries) < l.page {
+			return checked, nil
+		}
+	}
+}
+
+// gets the newest entry, nil if the log is empty
+func (l *Log) head() (*Entry, error) {
+	entries, err := l.read(postgrest.New().Order("seq", postgrest.Desc).Limit(1))
+	if err != nil || len(entries) == 0 {
+		return nil, err
+	}
+	return &entries[0], nil
+}
+
+func (l *Log) read(query postgrest.Query) ([]Entry, error) {
+	body, err := l.db.Query(table, query.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %w", err)
+	}
+	var entries []Entry
+	if err := json.Unmarshal(body, &entries); err != nil {
+		return nil, fmt.Errorf("failed to decode audit log: %w", err)
+	}
+	return entries, nil
+}
+
+// hashes the entry and the hash it links to. Snapshots and the timestamp are
+// hashed in a canonical form because jsonb and timestamptz columns don't give
+// back the bytes they were given.
+func (e Entry) digest() (string, error) {
+	before, err := canonical(e.Before)
+	if err != nil {
+		return "", err
+	}
+	after, err := canonical(e.After)
+	if err != nil {
+		return "", err
+	}
+	created, err := time.Parse(time.RFC3339Nano, e.CreatedAt)
+	if err != nil {
+		return "", fmt.Errorf("invalid audit timestamp %q: %w", e.CreatedAt, err)
+	}
+	fields := []string{
+		fmt.Sprint(e.Seq), e.PrevHash, e.ActorID, e.Action, e.TargetType, e.TargetID,
+		e.Reason, string(before), string(after), e.RequestID, created.UTC().Format(time.RFC3339Nano),
+	}
+	// length prefixes stop two different entries joining to the same text
+	h := sha256.New()
+	for _, f := range fields {
+		fmt.Fprintf(h, "%d:%s;", len(f), f)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// encodes a snapshot, nil stays empty
+func snapshot(v any) (json.RawMessage, error) {
+	if v == nil {
+		return nil, nil
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode audit snapshot: %w", err)
+	}
+	return canonical(raw)
+}
+
+// re-encodes JSON with sorted keys, keeping numbers as they were written
+func canonical(raw json.RawMessage) (json.RawMessage, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, fmt.Errorf("failed to decode audit snapshot: %w", err)
+	}
+	return json.Marshal(v)
+}
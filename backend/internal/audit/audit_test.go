@@ -0,0 +1,117 @@
+package audit
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/store"
+)
+
+func TestRecordChainsEntries(t *testing.T) {
+	db := store.NewMemory()
+	l := New(db)
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			entry := Entry{ActorID: "user-1", Action: "update_pitch", TargetType: "pitch", TargetID: "1"}
+			if err := l.Record(entry, map[string]any{"status": "Draft"}, map[string]any{"status": "Active"}); err != nil {
+				t.Errorf("Record failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	checked, err := l.Verify()
+	if err != nil {
+		t.Fatalf("Expected an intact chain, got %v", err)
+	}
+	if checked != 10 {
+		t.Fatalf("Expected every entry appended, got %d", checked)
+	}
+
+	entries, err := l.Query(Filter{TargetType: "pitch", TargetID: "1", Limit: 1})
+	if err != nil || len(entries) != 1 || entries[0].Seq != int64(checked) {
+		t.Fatalf("Expected the newest entry first, got %+v (%v)", entries, err)
+	}
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	db := store.NewMemory()
+	l := New(db)
+	for _, action := range []string{"deposit", "withdraw", "deposit"} {
+		if err := l.Record(Entry{ActorID: "user-1", Action: action, TargetType: "profile", TargetID: "user-1"}, nil, map[string]int{"dashboard_balance": 10}); err != nil {
+			t.Fatalf("Record failed: %v", err)
+		}
+	}
+
+	if _, err := db.Update(table, "seq=eq.2", map[string]any{"after": map[string]int{"dashboard_balance": 1000}}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if checked, err := l.Verify(); !errors.Is(err, ErrTampered) || checked != 1 {
+		t.Errorf("Expected the edit to entry 2 to be caught, got %d %v", checked, err)
+	}
+
+	if err := db.DeleteByQuery(table, "seq=eq.2"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := l.Verify(); !errors.Is(err, ErrTampered) {
+		t.Errorf("Expected the removed entry to be caught, got %v", err)
+	}
+}
+
+func TestVerifyPagesThroughTheChain(t *testing.T) {
+	db := store.NewMemory()
+	l := New(db)
+	l.page = 2
+	for range 5 {
+		if err := l.Record(Entry{ActorID: "user-1", Action: "deposit", TargetType: "profile", TargetID: "user-1"}, nil, nil); err != nil {
+			t.Fatalf("Record failed: %v", err)
+		}
+	}
+	if checked, err := l.Verify(); err != nil || checked != 5 {
+		t.Fatalf("Expected all 5 entries checked, got %d %v", checked, err)
+	}
+
+	if _, err := db.Update(table, "seq=eq.4", map[string]any{"target_id": "user-2"}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if checked, err := l.Verify(); !errors.Is(err, ErrTampered) || checked != 3 {
+		t.Errorf("Expected the edit to entry 4 on the second page to be caught, got %d %v", checked, err)
+	}
+}
+
+// a store where another server always appends first
+type racing_store struct {
+	store.Store
+}
+
+func (s racing_store) Insert(table string, data any) ([]byte, error) {
+	raced := Entry{ActorID: "user-2", Action: "deposit", TargetType: "profile", TargetID: "user-2"}
+	l := &Log{db: s.Store, now: time.Now, attempts: 1}
+	if err := l.Record(raced, nil, nil); err != nil {
+		return nil, err
+	}
+	return s.Store.Insert(table, data)
+}
+
+func TestRecordGivesUpWhenItKeepsLosing(t *testing.T) {
+	db := store.NewMemory()
+	l := New(racing_store{db})
+	l.attempts = 3
+
+	err := l.Record(Entry{ActorID: "user-1", Action: "deposit", TargetType: "profile", TargetID: "user-1"}, nil, nil)
+	if !errors.Is(err, ErrBusy) {
+		t.Fatalf("Expected ErrBusy, got %v", err)
+	}
+	if count, _ := db.Count(table, "actor_id=eq.user-1"); count != 0 {
+		t.Errorf("Expected nothing appended, got %d", count)
+	}
+	if checked, err := New(db).Verify(); err != nil || checked != 3 {
+		t.Errorf("Expected the 3 entries that won intact, got %d %v", checked, err)
+	}
+}
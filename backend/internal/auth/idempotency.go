@@ -0,0 +1,285 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/logging"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/postgrest"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/store"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/utils"
+)
+
+const IdempotencyHeader = "Idempotency-Key"
+
+// IdempotencyRecord is what's kept for a key, Status stays zero until the
+// first request has finished
+type IdempotencyRecord struct {
+	Fingerprint string
+	Status      int
+	Header      http.Header
+	Body        []byte
+	ExpiresAt   time.Time
+}
+
+// IdempotencyStore keeps the first response for each key
+type IdempotencyStore interface {
+	// saves rec under key unless an unexpired record is already there, in
+	// which case that record is returned and nothing is saved
+	Reserve(key string, rec IdempotencyRecord) (*IdempotencyRecord, error)
+	// stores the finished response for the key
+	Complete(key string, rec IdempotencyRecord) error
+	// forgets the key so the request can be tried again
+	Release(key string) error
+}
+
+// replays the first response for a repeated Idempotency-Key on POST and PATCH
+// requests. Keys are scoped to the user and route and expire after ttl. Must
+// run after AuthMiddleWare.
+func IdempotencyMiddleware(s IdempotencyStore, ttl time.Duration) MiddlewareFunc {
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(IdempotencyHeader)
+			if key == "" || (r.Method != http.MethodPost && r.Method != http.MethodPatch) {
+				handler.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > 255 {
+				http.Error(w, "Idempotency-Key is too long", http.StatusBadRequest)
+				return
+			}
+
+			uid, ok := utils.UserIDFromCtx(r.Context())
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				http.Error(w, "Failed to read request", http.StatusBadRequest)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			scoped := fmt.Sprintf("%s:%s:%s:%s", uid, r.Method, r.URL.Path, key)
+			fingerprint := request_fingerprint(r, body)
+
+			existing, err := s.Reserve(scoped, IdempotencyRecord{
+				Fingerprint: fingerprint,
+				ExpiresAt:   time.Now().Add(ttl),
+			})
+			if err != nil {
+				logging.FromContext(r.Context()).Warn("idempotency check failed", "err", err)
+				http.Error(w, "Failed to check Idempotency-Key", http.StatusInternalServerError)
+				return
+			}
+
+			if existing != nil {
+				switch {
+				case existing.Fingerprint != fingerprint:
+					http.Error(w, "Idempotency-Key was already used for a different request", http.StatusUnprocessableEntity)
+				case existing.Status == 0:
+					http.Error(w, "A request with this Idempotency-Key is still in progress", http.StatusConflict)
+				default:
+					for k, v := range existing.Header {
+						w.Header()[k] = v
+					}
+					w.Header().Set("Idempotent-Replayed", "true")
+					w.WriteHeader(existing.Status)
+					w.Write(existing.Body)
+				}
+				return
+			}
+
+			rec := &response_recorder{ResponseWriter: w, status: http.StatusOK}
+			handler.ServeHTTP(rec, r)
+
+			// server errors aren't kept so the client can retry them
+			if rec.status >= http.StatusInternalServerError {
+				if err := s.Release(scoped); err != nil {
+					logging.FromContext(r.Context()).Warn("failed to release idempotency key", "err", err)
+				}
+				return
+			}
+
+			err = s.Complete(scoped, IdempotencyRecord{
+				Fingerprint: fingerprint,
+				Status:      rec.status,
+				Header:      http.Header{"Content-Type": w.Header().Values("Content-Type")},
+				Body:        rec.body.Bytes(),
+				ExpiresAt:   time.Now().Add(ttl),
+			})
+			if err != nil {
+				logging.FromContext(r.Context()).Warn("failed to store idempotent response", "err", err)
+			}
+		})
+	}
+}
+
+// hashes the parts of the request that have to match on a replay
+func request_fingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s %s?%s\n", r.Method, r.URL.Path, r.URL.RawQuery)
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// passes the response through while keeping a copy of it
+type response_recorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (r *response_recorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *response_recorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+// MemoryIdempotencyStore keeps keys in memory, for tests and single instances
+type MemoryIdempotencyStore struct {
+	mu      sync.Mutex
+	records map[string]IdempotencyRecord
+}
+
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{records: make(map[string]IdempotencyRecord)}
+}
+
+func (m *MemoryIdempotencyStore) Reserve(key string, rec IdempotencyRecord) (*IdempotencyRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if existing, ok := m.records[key]; ok && time.Now().Before(existing.ExpiresAt) {
+		return &existing, nil
+	}
+	m.records[key] = rec
+	return nil, nil
+}
+
+func (m *MemoryIdempotencyStore) Complete(key string, rec IdempotencyRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.records[key] = rec
+	return nil
+}
+
+func (m *MemoryIdempotencyStore) Release(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.records, key)
+	return nil
+}
+
+// DBIdempotencyStore keeps keys in the idempotency_keys table so they are
+// shared between instances and survive restarts
+type DBIdempotencyStore struct {
+	db store.Store
+}
+
+func NewDBIdempotencyStore(db store.Store) *DBIdempotencyStore {
+	return &DBIdempotencyStore{db: db}
+}
+
+// idempotency_keys row
+type idempotency_row struct {
+	Key         string      `json:"key"`
+	Fingerprint string      `json:"fingerprint"`
+	Status      int         `json:"status"`
+	Header      http.Header `json:"header,omitempty"`
+	Body        []byte      `json:"body,omitempty"`
+	ExpiresAt   string      `json:"expires_at"`
+}
+
+func (d *DBIdempotencyStore) Reserve(key string, rec IdempotencyRecord) (*IdempotencyRecord, error) {
+	existing, err := d.get(key)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		if time.Now().Before(existing.ExpiresAt) {
+			return existing, nil
+		}
+		if err := d.Release(key); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := d.db.Insert("idempotency_keys", to_idempotency_row(key, rec)); err != nil {
+		// the key is unique so a concurrent request may have just reserved it
+		if existing, getErr := d.get(key); getErr == nil && existing != nil {
+			return existing, nil
+		}
+		return nil, err
+	}
+	return nil, nil
+}
+
+func (d *DBIdempotencyStore) Complete(key string, rec IdempotencyRecord) error {
+	_, err := d.db.Update("idempotency_keys", idempotency_key(key), to_idempotency_row(key, rec))
+	return err
+}
+
+func (d *DBIdempotencyStore) Release(key string) error {
+	return d.db.DeleteByQuery("idempotency_keys", idempotency_key(key))
+}
+
+// gets the query for the key's row
+func idempotency_key(key string) string {
+	return postgrest.New().Eq("key", key).String()
+}
+
+func (d *DBIdempotencyStore) get(key string) (*IdempotencyRecord, error) {
+	body, err := d.db.Query("idempotency_keys", idempotency_key(key))
+	if err != nil {
+		return nil, err
+	}
+	var rows []idempotency_row
+	if err := json.Unmarshal(body, &rows); err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	expires, err := time.Parse(time.RFC3339Nano, rows[0].ExpiresAt)
+	if err != nil {
+		return nil, fmt.Errorf("invalid expires_at for idempotency key: %w", err)
+	}
+	return &IdempotencyRecord{
+		Fingerprint: rows[0].Fingerprint,
+		Status:      rows[0].Status,
+		Header:      rows[0].Header,
+		Body:        rows[0].Body,
+		ExpiresAt:   expires,
+	}, nil
+}
+
+func to_idempotency_row(key string, rec IdempotencyRecord) idempotency_row {
+	return idempotency_row{
+		Key:         key,
+		Fingerprint: rec.Fingerprint,
+		Status:      rec.Status,
+		Header:      rec.Header,
+		Body:        rec.Body,
+		ExpiresAt:   rec.ExpiresAt.UTC().Format(time.RFC3339Nano),
+	}
+}
@@ -0,0 +1,138 @@
+package auth
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/store"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/utils"
+)
+
+// builds a handler that counts its calls behind the idempotency middleware,
+// answering with status
+func new_idempotent_handler(s IdempotencyStore, ttl time.Duration, calls *int32, status int) http.Handler {
+	inner := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(calls, 1)
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		fmt.Fprintf(w, `{"call":%d,"body":%q}`, n, body)
+	})
+	return IdempotencyMiddleware(s, ttl)(inner)
+}
+
+func send_idempotent(h http.Handler, uid string, key string, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api/investment", strings.NewReader(body))
+	if key != "" {
+		req.Header.Set(IdempotencyHeader, key)
+	}
+	req = req.WithContext(utils.CtxWithUserID(req.Context(), uid))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestIdempotencyReplaysFirstResponse(t *testing.T) {
+	stores := map[string]IdempotencyStore{
+		"memory": NewMemoryIdempotencyStore(),
+		"db":     NewDBIdempotencyStore(store.NewMemory()),
+	}
+	for name, s := range stores {
+		t.Run(name, func(t *testing.T) {
+			var calls int32
+			h := new_idempotent_handler(s, time.Hour, &calls, http.StatusCreated)
+
+			first := send_idempotent(h, "user-1", "key-1", `{"amount":10}`)
+			second := send_idempotent(h, "user-1", "key-1", `{"amount":10}`)
+
+			if calls != 1 {
+				t.Fatalf("Expected the handler to run once, ran %d times", calls)
+			}
+			if second.Code != http.StatusCreated || second.Body.String() != first.Body.String() {
+				t.Errorf("Expected replay of %d %s, got %d %s", first.Code, first.Body, second.Code, second.Body)
+			}
+			if second.Header().Get("Idempotent-Replayed") != "true" {
+				t.Errorf("Expected replay header on the second response")
+			}
+
+			// keys are scoped to the user
+			send_idempotent(h, "user-2", "key-1", `{"amount":10}`)
+			if calls != 2 {
+				t.Errorf("Expected another user's key to run the handler, ran %d times", calls)
+			}
+
+			if rec := send_idempotent(h, "user-1", "key-1", `{"amount":99}`); rec.Code != http.StatusUnprocessableEntity {
+				t.Errorf("Expected 422 for a reused key with a different body, got %d", rec.Code)
+			}
+		})
+	}
+}
+
+func TestIdempotencyKeysExpire(t *testing.T) {
+	var calls int32
+	h := new_idempotent_handler(NewMemoryIdempotencyStore(), -time.Second, &calls, http.StatusOK)
+
+	send_idempotent(h, "user-1", "key-1", `{}`)
+	send_idempotent(h, "user-1", "key-1", `{}`)
+	if calls != 2 {
+		t.Errorf("Expected an expired key to run the handler again, ran %d times", calls)
+	}
+}
+
+func TestIdempotencyServerErrorsAreNotKept(t *testing.T) {
+	var calls int32
+	h := new_idempotent_handler(NewMemoryIdempotencyStore(), time.Hour, &calls, http.StatusInternalServerError)
+
+	send_idempotent(h, "user-1", "key-1", `{}`)
+	send_idempotent(h, "user-1", "key-1", `{}`)
+	if calls != 2 {
+		t.Errorf("Expected a retry after a server error to run the handler, ran %d times", calls)
+	}
+}
+
+func TestIdempotencyInFlightKeyConflicts(t *testing.T) {
+	s := NewMemoryIdempotencyStore()
+	var calls int32
+	release := make(chan struct{})
+	started := make(chan struct{})
+	h := IdempotencyMiddleware(s, time.Hour)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		close(started)
+		<-release
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	done := make(chan struct{})
+	go func() {
+		send_idempotent(h, "user-1", "key-1", `{}`)
+		close(done)
+	}()
+	<-started
+
+	if rec := send_idempotent(h, "user-1", "key-1", `{}`); rec.Code != http.StatusConflict {
+		t.Errorf("Expected 409 while the first request runs, got %d", rec.Code)
+	}
+	close(release)
+	<-done
+
+	if calls != 1 {
+		t.Errorf("Expected the handler to run once, ran %d times", calls)
+	}
+}
+
+func TestIdempotencyWithoutKeyPassesThrough(t *testing.T) {
+	var calls int32
+	h := new_idempotent_handler(NewMemoryIdempotencyStore(), time.Hour, &calls, http.StatusOK)
+
+	send_idempotent(h, "user-1", "", `{}`)
+	send_idempotent(h, "user-1", "", `{}`)
+	if calls != 2 {
+		t.Errorf("Expected requests without a key to always run, ran %d times", calls)
+	}
+}
@@ -1,9 +1,14 @@
 package auth
 
 import (
-	"log"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
 	"net/http"
+	"time"
 
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/logging"
 	"github.com/EmmaMartin123/Industrial_Project/backend/internal/utils"
 )
 
@@ -21,50 +26,133 @@ func (c Chain) Then(handler http.Handler) http.Handler {
 	return handler
 }
 
-// logs the request method and uri
-func LoggingMiddleware(handler http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		handler.ServeHTTP(w, r)
-		log.Printf("%s %s", r.Method, r.RequestURI)
-	})
+// the header a request id is read from and echoed back on
+const RequestIDHeader = "X-Request-ID"
+
+// what the access log needs to know that is only found out further down the
+// chain
+type access_entry struct {
+	user_id string
 }
 
-// handles CORS requests
-func CORSMiddleware(handler http.Handler) http.Handler {
-	allowlist := utils.CORSAllowlist()
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		origin := r.Header.Get("Origin")
+type access_key struct{}
 
-		if allowlist[origin] {
-			w.Header().Set("Access-Control-Allow-Origin", origin)
-			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-			w.Header().Set("Access-Control-Allow-Credentials", "true")
+// tags the request with the caller's X-Request-ID, or a new one if it didn't
+// send one, gives its handlers a logger carrying the id and writes an access
+// log line with the status, size and latency once it has been served
+func LoggingMiddleware(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		id := r.Header.Get(RequestIDHeader)
+		if id == "" || len(id) > 128 {
+			b := make([]byte, 16)
+			_, _ = rand.Read(b)
+			id = hex.EncodeToString(b)
 		}
+		w.Header().Set(RequestIDHeader, id)
 
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
-		}
+		entry := &access_entry{}
+		ctx := utils.CtxWithRequestID(r.Context(), id)
+		ctx = context.WithValue(ctx, access_key{}, entry)
+		ctx = logging.With(ctx, "request_id", id)
 
-		handler.ServeHTTP(w, r)
-	})
-}
+		rec := &status_recorder{ResponseWriter: w, status: http.StatusOK}
+		handler.ServeHTTP(rec, r.WithContext(ctx))
 
-// authenticates the user
-func AuthMiddleWare(handler http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		tok, err := utils.BearerFromRequest(r)
-		if err != nil {
-			utils.WriteError(w, err, http.StatusUnauthorized)
-			return
+		attrs := []any{
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", rec.status,
+			"bytes", rec.bytes,
+			"duration_ms", time.Since(start).Milliseconds(),
+			"request_id", id,
+		}
+		if entry.user_id != "" {
+			attrs = append(attrs, "user_id", entry.user_id)
 		}
-		uid, err := utils.VerifyJWTHS256(tok)
-		if err != nil {
-			utils.WriteError(w, err, http.StatusUnauthorized)
-			return
+		level := slog.LevelInfo
+		if rec.status >= http.StatusInternalServerError {
+			level = slog.LevelError
 		}
-		ctx := utils.CtxWithUserID(r.Context(), uid)
-		handler.ServeHTTP(w, r.WithContext(ctx))
+		slog.Log(r.Context(), level, "request", attrs...)
 	})
 }
+
+// passes the response through while counting what was written
+type status_recorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int
+	wroteHeader bool
+}
+
+func (r *status_recorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *status_recorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += n
+	return n, err
+}
+
+// lets http.ResponseController reach the underlying writer
+func (r *status_recorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// handles CORS requests, allowing credentials from the listed origins
+func CORSMiddleware(origins []string) MiddlewareFunc {
+	allowlist := make(map[string]bool, len(origins))
+	for _, origin := range origins {
+		allowlist[origin] = true
+	}
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+
+			if allowlist[origin] {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+				w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+				w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, Idempotency-Key, X-Request-ID")
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+
+			if r.Method == "OPTIONS" {
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+
+			handler.ServeHTTP(w, r)
+		})
+	}
+}
+
+// authenticates the user with a token the verifier accepts
+func AuthMiddleWare(verifier *utils.JWTVerifier) MiddlewareFunc {
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tok, err := utils.BearerFromRequest(r)
+			if err != nil {
+				utils.WriteError(w, err, http.StatusUnauthorized)
+				return
+			}
+			uid, err := verifier.Verify(tok)
+			if err != nil {
+				utils.WriteError(w, err, http.StatusUnauthorized)
+				return
+			}
+			if entry, ok := r.Context().Value(access_key{}).(*access_entry); ok {
+				entry.user_id = uid
+			}
+			ctx := utils.CtxWithUserID(r.Context(), uid)
+			ctx = logging.With(ctx, "user_id", uid)
+			handler.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
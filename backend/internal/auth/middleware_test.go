@@ -0,0 +1,93 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/logging"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/utils"
+)
+
+// decodes every JSON log line written to buf
+func log_lines(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var lines []map[string]any
+	for line := range strings.SplitSeq(strings.TrimSpace(buf.String()), "\n") {
+		var entry map[string]any
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("Invalid log line %q: %v", line, err)
+		}
+		lines = append(lines, entry)
+	}
+	return lines
+}
+
+func TestLoggingMiddlewareWritesAccessLog(t *testing.T) {
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(logging.New(&buf, "json", "info"))
+	defer slog.SetDefault(previous)
+
+	verifier := utils.NewJWTHS256("http://localhost/auth/v1", "test-secret")
+
+	// the handler's warning and the access log both carry the request id
+	inner := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logging.FromContext(r.Context()).Warn("something went wrong")
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte("short and stout"))
+	})
+	h := NewChain(LoggingMiddleware).Then(inner)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/pitch?id=1", nil)
+	req.Header.Set(RequestIDHeader, "req-1")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get(RequestIDHeader); got != "req-1" {
+		t.Errorf("Expected the request id to be echoed, got %q", got)
+	}
+	lines := log_lines(t, &buf)
+	if len(lines) != 2 {
+		t.Fatalf("Expected a warning and an access log line, got %v", lines)
+	}
+	if lines[0]["request_id"] != "req-1" || lines[0]["msg"] != "something went wrong" {
+		t.Errorf("Expected the warning to carry the request id, got %v", lines[0])
+	}
+	access := lines[1]
+	if access["status"] != float64(http.StatusTeapot) || access["bytes"] != float64(len("short and stout")) || access["path"] != "/api/pitch" {
+		t.Errorf("Unexpected access log line %v", access)
+	}
+
+	// a request without an id gets one, and the user once they are known
+	buf.Reset()
+	tok, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": "user-1",
+		"iss": "http://localhost/auth/v1",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}).SignedString([]byte("test-secret"))
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v", err)
+	}
+	req = httptest.NewRequest(http.MethodGet, "/api/profile", nil)
+	req.Header.Set("Authorization", "Bearer "+tok)
+	rec = httptest.NewRecorder()
+	NewChain(LoggingMiddleware, AuthMiddleWare(verifier)).Then(inner).ServeHTTP(rec, req)
+
+	id := rec.Header().Get(RequestIDHeader)
+	if id == "" {
+		t.Error("Expected a request id to be generated")
+	}
+	for _, line := range log_lines(t, &buf) {
+		if line["user_id"] != "user-1" || line["request_id"] != id {
+			t.Errorf("Expected every line to carry the user and request id, got %v", line)
+		}
+	}
+}
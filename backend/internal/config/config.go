@@ -0,0 +1,297 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/allocation"
+)
+
+// Config is every setting the server reads, loaded once at startup
+type Config struct {
+	Port     string
+	Supabase Supabase
+	Upstream Upstream
+	Tracing  Tracing
+
+	// origins allowed to make credentialed cross-origin requests
+	CORSAllowlist []string
+	// how long idempotency keys are kept
+	IdempotencyTTL time.Duration
+	// how often scheduled jobs run
+	SchedulerInterval time.Duration
+	// how long in-flight requests and background workers get to finish on shutdown
+	ShutdownTimeout time.Duration
+
+	// who gets the pennies left over when profit is split
+	DistributionResiduePolicy allocation.Policy
+	// what happens to a pitch that ends short of its target: all_or_nothing
+	// refunds its investors, keep_what_raised funds it with what it raised
+	PitchFundingPolicy string
+
+	LogFormat string // json or text
+	LogLevel  string // debug, info, warn or error
+
+	// the bearer token /metrics requires, empty leaves it open
+	MetricsToken string
+}
+
+// Supabase is how to reach the Supabase project
+type Supabase struct {
+	URL            string
+	ServiceRoleKey string
+	AnonKey        string // sent as the storage apikey, the service role key if empty
+	JWTSecret      string
+	S3URL          string
+}
+
+// Upstream tunes the client calls to Supabase are made with
+type Upstream struct {
+	Timeout          time.Duration // per attempt
+	Retries          int           // for GETs that failed, got a 5xx or a 429
+	BreakerThreshold int           // failures in a row before a service fails fast
+	BreakerCooldown  time.Duration // how long it fails fast before a trial call
+}
+
+// Tracing says where OpenTelemetry spans are exported
+type Tracing struct {
+	Exporter     string // none, stdout or otlp
+	OTLPEndpoint string // the collector's URL, the exporter's default if empty
+	ServiceName  string
+	SampleRatio  float64 // the share of new traces kept, from 0 to 1
+}
+
+// gets the issuer user tokens are signed by
+func (s Supabase) JWTIssuer() string {
+	return s.URL + "/auth/v1"
+}
+
+// gets the key storage requests send as their apikey
+func (s Supabase) StorageAPIKey() string {
+	if s.AnonKey != "" {
+		return s.AnonKey
+	}
+	return s.ServiceRoleKey
+}
+
+// the settings a config file or the environment can set, by env var name
+var settings = map[string]func(c *Config, v string) error{
+	"PORT":                        set_string(func(c *Config) *string { return &c.Port }),
+	"SUPABASE_URL":                set_url(func(c *Config) *string { return &c.Supabase.URL }),
+	"SUPABASE_SERVICE_ROLE_KEY":   set_string(func(c *Config) *string { return &c.Supabase.ServiceRoleKey }),
+	"SUPABASE_ANON_KEY":           set_string(func(c *Config) *string { return &c.Supabase.AnonKey }),
+	"SUPABASE_JWT_SECRET":         set_string(func(c *Config) *string { return &c.Supabase.JWTSecret }),
+	"SUPABASE_S3_URL":             set_url(func(c *Config) *string { return &c.Supabase.S3URL }),
+	"UPSTREAM_TIMEOUT":            set_duration(func(c *Config) *time.Duration { return &c.Upstream.Timeout }),
+	"UPSTREAM_RETRIES":            set_int(func(c *Config) *int { return &c.Upstream.Retries }, 0),
+	"UPSTREAM_BREAKER_THRESHOLD":  set_int(func(c *Config) *int { return &c.Upstream.BreakerThreshold }, 1),
+	"UPSTREAM_BREAKER_COOLDOWN":   set_duration(func(c *Config) *time.Duration { return &c.Upstream.BreakerCooldown }),
+	"TRACING_EXPORTER":            set_string(func(c *Config) *string { return &c.Tracing.Exporter }),
+	"TRACING_OTLP_ENDPOINT":       set_url(func(c *Config) *string { return &c.Tracing.OTLPEndpoint }),
+	"TRACING_SERVICE_NAME":        set_string(func(c *Config) *string { return &c.Tracing.ServiceName }),
+	"TRACING_SAMPLE_RATIO":        set_ratio(func(c *Config) *float64 { return &c.Tracing.SampleRatio }),
+	"CORS_ALLOWLIST":              set_list(func(c *Config) *[]string { return &c.CORSAllowlist }),
+	"IDEMPOTENCY_TTL":             set_duration(func(c *Config) *time.Duration { return &c.IdempotencyTTL }),
+	"SCHEDULER_INTERVAL":          set_duration(func(c *Config) *time.Duration { return &c.SchedulerInterval }),
+	"SHUTDOWN_TIMEOUT":            set_duration(func(c *Config) *time.Duration { return &c.ShutdownTimeout }),
+	"DISTRIBUTION_RESIDUE_POLICY": set_residue_policy,
+	"PITCH_FUNDING_POLICY":        set_string(func(c *Config) *string { return &c.PitchFundingPolicy }),
+	"LOG_FORMAT":                  set_string(func(c *Config) *string { return &c.LogFormat }),
+	"LOG_LEVEL":                   set_string(func(c *Config) *string { return &c.LogLevel }),
+	"METRICS_TOKEN":               set_string(func(c *Config) *string { return &c.MetricsToken }),
+}
+
+// gets the config with every default filled in and nothing required set,
+// e.g. for tests to fill in
+func Default() *Config {
+	return &Config{
+		Port: "8080",
+		Upstream: Upstream{
+			Timeout:          10 * time.Second,
+			Retries:          3,
+			BreakerThreshold: 5,
+			BreakerCooldown:  30 * time.Second,
+		},
+		Tracing: Tracing{
+			Exporter:    "none",
+			ServiceName: "industrial-project-backend",
+			SampleRatio: 1,
+		},
+		IdempotencyTTL:            24 * time.Hour,
+		SchedulerInterval:         time.Minute,
+		ShutdownTimeout:           30 * time.Second,
+		DistributionResiduePolicy: allocation.LargestRemainder,
+		PitchFundingPolicy:        "all_or_nothing",
+		LogFormat:                 "json",
+		LogLevel:                  "info",
+	}
+}
+
+// loads the config from, highest first, the environment, a .env file in the
+// working directory and the TOML file named by CONFIG_FILE, then validates it
+func Load() (*Config, error) {
+	dotenv, err := godotenv.Read(".env")
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read .env: %w", err)
+	}
+	lookup := func(name string) (string, bool) {
+		if v, ok := os.LookupEnv(name); ok {
+			return v, true
+		}
+		v, ok := dotenv[name]
+		return v, ok
+	}
+
+	var file map[string]string
+	if path, _ := lookup("CONFIG_FILE"); path != "" {
+		if file, err = ReadFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	return FromLookup(func(name string) (string, bool) {
+		if v, ok := lookup(name); ok {
+			return v, true
+		}
+		v, ok := file[name]
+		return v, ok
+	})
+}
+
+// builds and validates the config from the settings lookup finds, anything
+// it doesn't find keeps its default
+func FromLookup(lookup func(name string) (string, bool)) (*Config, error) {
+	c := Default()
+	var errs []error
+	for _, name := range slices.Sorted(maps.Keys(settings)) {
+		v, ok := lookup(name)
+		if !ok || strings.TrimSpace(v) == "" {
+			continue
+		}
+		if err := settings[name](c, strings.TrimSpace(v)); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// checks every required setting is there and the choices are ones the
+// server knows
+func (c *Config) Validate() error {
+	var errs []error
+	required := map[string]string{
+		"SUPABASE_URL":              c.Supabase.URL,
+		"SUPABASE_SERVICE_ROLE_KEY": c.Supabase.ServiceRoleKey,
+		"SUPABASE_JWT_SECRET":       c.Supabase.JWTSecret,
+		"SUPABASE_S3_URL":           c.Supabase.S3URL,
+	}
+	for _, name := range slices.Sorted(maps.Keys(required)) {
+		if required[name] == "" {
+			errs = append(errs, fmt.Errorf("%s must be set", name))
+		}
+	}
+	if c.PitchFundingPolicy != "all_or_nothing" && c.PitchFundingPolicy != "keep_what_raised" {
+		errs = append(errs, fmt.Errorf("PITCH_FUNDING_POLICY: unknown policy %q", c.PitchFundingPolicy))
+	}
+	switch c.Tracing.Exporter {
+	case "none", "stdout", "otlp":
+	default:
+		errs = append(errs, fmt.Errorf("TRACING_EXPORTER: must be none, stdout or otlp, got %q", c.Tracing.Exporter))
+	}
+	if c.LogFormat != "json" && c.LogFormat != "text" {
+		errs = append(errs, fmt.Errorf("LOG_FORMAT: must be json or text, got %q", c.LogFormat))
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.LogLevel)); err != nil {
+		errs = append(errs, fmt.Errorf("LOG_LEVEL: unknown level %q", c.LogLevel))
+	}
+	return errors.Join(errs...)
+}
+
+func set_string(field func(c *Config) *string) func(c *Config, v string) error {
+	return func(c *Config, v string) error {
+		*field(c) = v
+		return nil
+	}
+}
+
+func set_url(field func(c *Config) *string) func(c *Config, v string) error {
+	return func(c *Config, v string) error {
+		if !strings.HasPrefix(v, "http://") && !strings.HasPrefix(v, "https://") {
+			return fmt.Errorf("must be an http(s) URL, got %q", v)
+		}
+		*field(c) = strings.TrimSuffix(v, "/")
+		return nil
+	}
+}
+
+func set_list(field func(c *Config) *[]string) func(c *Config, v string) error {
+	return func(c *Config, v string) error {
+		var list []string
+		for item := range strings.SplitSeq(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		*field(c) = list
+		return nil
+	}
+}
+
+func set_duration(field func(c *Config) *time.Duration) func(c *Config, v string) error {
+	return func(c *Config, v string) error {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("must be a positive duration such as \"30s\", got %q", v)
+		}
+		*field(c) = d
+		return nil
+	}
+}
+
+func set_int(field func(c *Config) *int, least int) func(c *Config, v string) error {
+	return func(c *Config, v string) error {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < least {
+			return fmt.Errorf("must be a whole number of at least %d, got %q", least, v)
+		}
+		*field(c) = n
+		return nil
+	}
+}
+
+func set_ratio(field func(c *Config) *float64) func(c *Config, v string) error {
+	return func(c *Config, v string) error {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f < 0 || f > 1 {
+			return fmt.Errorf("must be a number from 0 to 1, got %q", v)
+		}
+		*field(c) = f
+		return nil
+	}
+}
+
+func set_residue_policy(c *Config, v string) error {
+	policy, err := allocation.ParsePolicy(v)
+	if err != nil {
+		return err
+	}
+	c.DistributionResiduePolicy = policy
+	return nil
+}
@@ -0,0 +1,130 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/allocation"
+)
+
+// looks settings up in a map
+func from(values map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		v, ok := values[name]
+		return v, ok
+	}
+}
+
+var required = map[string]string{
+	"SUPABASE_URL":              "https://project.supabase.co/",
+	"SUPABASE_SERVICE_ROLE_KEY": "service-key",
+	"SUPABASE_JWT_SECRET":       "secret",
+	"SUPABASE_S3_URL":           "https://project.supabase.co/storage/v1/s3",
+}
+
+func TestFromLookupFillsDefaults(t *testing.T) {
+	cfg, err := FromLookup(from(required))
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Supabase.JWTIssuer() != "https://project.supabase.co/auth/v1" {
+		t.Errorf("Expected the trailing slash to be trimmed, got issuer %s", cfg.Supabase.JWTIssuer())
+	}
+	if cfg.Supabase.StorageAPIKey() != "service-key" {
+		t.Errorf("Expected storage to fall back to the service role key, got %s", cfg.Supabase.StorageAPIKey())
+	}
+	if cfg.Port != "8080" || cfg.IdempotencyTTL != 24*time.Hour || cfg.PitchFundingPolicy != "all_or_nothing" {
+		t.Errorf("Expected the defaults, got %+v", cfg)
+	}
+}
+
+func TestFromLookupReportsEveryProblem(t *testing.T) {
+	_, err := FromLookup(from(map[string]string{
+		"SUPABASE_URL":                "project.supabase.co",
+		"IDEMPOTENCY_TTL":             "a day",
+		"DISTRIBUTION_RESIDUE_POLICY": "charity",
+		"PITCH_FUNDING_POLICY":        "maybe",
+	}))
+	if err == nil {
+		t.Fatal("Expected the config to be refused")
+	}
+	for _, want := range []string{"SUPABASE_URL", "IDEMPOTENCY_TTL", "DISTRIBUTION_RESIDUE_POLICY"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected the error to mention %s, got %v", want, err)
+		}
+	}
+
+	// settings that parse are then validated together
+	values := map[string]string{"PITCH_FUNDING_POLICY": "maybe", "LOG_FORMAT": "xml"}
+	_, err = FromLookup(from(values))
+	for _, want := range []string{"SUPABASE_JWT_SECRET must be set", "PITCH_FUNDING_POLICY", "LOG_FORMAT"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected the error to mention %s, got %v", want, err)
+		}
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	file := `# settings for the test
+port = 9090
+cors_allowlist = ["https://a.example", 'https://b.example']
+
+[supabase]
+url = "https://project.supabase.co" # the project
+jwt_secret = "has # in it"
+
+[distribution]
+residue_policy = "business"
+`
+	if err := os.WriteFile(path, []byte(file), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	values, err := ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	want := map[string]string{
+		"PORT":                        "9090",
+		"CORS_ALLOWLIST":              "https://a.example,https://b.example",
+		"SUPABASE_URL":                "https://project.supabase.co",
+		"SUPABASE_JWT_SECRET":         "has # in it",
+		"DISTRIBUTION_RESIDUE_POLICY": "business",
+	}
+	for name, v := range want {
+		if values[name] != v {
+			t.Errorf("Expected %s to be %q, got %q", name, v, values[name])
+		}
+	}
+
+	// the environment wins over the file
+	env := map[string]string{}
+	for k, v := range required {
+		env[k] = v
+	}
+	env["PORT"] = "7070"
+	cfg, err := FromLookup(func(name string) (string, bool) {
+		if v, ok := env[name]; ok {
+			return v, true
+		}
+		v, ok := values[name]
+		return v, ok
+	})
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Port != "7070" || cfg.DistributionResiduePolicy != allocation.Business || len(cfg.CORSAllowlist) != 2 {
+		t.Errorf("Unexpected config %+v", cfg)
+	}
+
+	if err := os.WriteFile(path, []byte("[supabase]\nurll = \"x\"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadFile(path); err == nil || !strings.Contains(err.Error(), ":2:") {
+		t.Errorf("Expected an unknown setting to be refused with its line, got %v", err)
+	}
+}
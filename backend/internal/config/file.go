@@ -0,0 +1,124 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// reads the settings in a TOML config file, keyed by the env var each one
+// stands for: a key is joined to its table with underscores and upper-cased,
+// so supabase.url or url under [supabase] sets SUPABASE_URL. Only the subset
+// the settings need is understood: tables, strings, bare numbers and bools,
+// and one-line arrays of strings, which become comma separated lists.
+func ReadFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open config file: %w", err)
+	}
+	defer f.Close()
+
+	values := make(map[string]string)
+	table := ""
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(strip_comment(scanner.Text()))
+		if line == "" {
+			continue
+		}
+		fail := func(format string, args ...any) error {
+			return fmt.Errorf("%s:%d: "+format, append([]any{path, n}, args...)...)
+		}
+
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") {
+				return nil, fail("unclosed table header")
+			}
+			table = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+
+		key, raw, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fail("expected key = value")
+		}
+		name := strings.TrimSpace(key)
+		if table != "" {
+			name = table + "." + name
+		}
+		name = strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(name))
+		if _, known := settings[name]; !known {
+			return nil, fail("unknown setting %q", strings.TrimSpace(key))
+		}
+
+		value, err := parse_value(strings.TrimSpace(raw))
+		if err != nil {
+			return nil, fail("%s: %v", strings.TrimSpace(key), err)
+		}
+		values[name] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	return values, nil
+}
+
+// parses a string, bare value or array of strings
+func parse_value(raw string) (string, error) {
+	switch {
+	case raw == "":
+		return "", fmt.Errorf("missing value")
+	case strings.HasPrefix(raw, "["):
+		if !strings.HasSuffix(raw, "]") {
+			return "", fmt.Errorf("arrays must be on one line")
+		}
+		var items []string
+		for item := range strings.SplitSeq(raw[1:len(raw)-1], ",") {
+			if item = strings.TrimSpace(item); item == "" {
+				continue
+			}
+			v, err := parse_string(item)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, v)
+		}
+		return strings.Join(items, ","), nil
+	case strings.HasPrefix(raw, `"`), strings.HasPrefix(raw, "'"):
+		return parse_string(raw)
+	default:
+		return raw, nil
+	}
+}
+
+// parses a basic "string" with escapes or a literal 'string'
+func parse_string(raw string) (string, error) {
+	if len(raw) >= 2 && raw[0] == '\'' && raw[len(raw)-1] == '\'' {
+		return raw[1 : len(raw)-1], nil
+	}
+	v, err := strconv.Unquote(raw)
+	if err != nil || raw[0] != '"' {
+		return "", fmt.Errorf("invalid string %s", raw)
+	}
+	return v, nil
+}
+
+// drops a # comment that isn't inside a string
+func strip_comment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote == 0 && (c == '"' || c == '\''):
+			quote = c
+		case quote != 0 && c == '\\' && quote == '"':
+			i++
+		case c == quote:
+			quote = 0
+		case quote == 0 && c == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
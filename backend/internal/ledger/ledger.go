@@ -0,0 +1,297 @@
+package ledger
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	model "github.com/EmmaMartin123/Industrial_Project/backend/internal/model/common"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/postgrest"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/store"
+)
+
+// Kind is the reason money moved in or out of a wallet
+type Kind string
+
+const (
+	Deposit           Kind = "deposit"            // bank -> wallet
+	Withdraw          Kind = "withdraw"           // wallet -> bank
+	Investment        Kind = "investment"         // investor wallet -> pitch
+	Refund            Kind = "refund"             // pitch -> investor wallet
+	Distribution      Kind = "distribution"       // profit -> investor wallet
+	DistributionDebit Kind = "distribution_debit" // business wallet -> profit
+)
+
+const (
+	entriesTable = "ledger_entries"
+	maxAttempts  = 5
+)
+
+var (
+	ErrInsufficientFunds = errors.New("insufficient funds")
+	ErrConflict          = errors.New("balance changed concurrently, please retry")
+	ErrAlreadyPosted     = errors.New("a posting with this reference is already in the wallet")
+	ErrInvalidAmount     = errors.New("amount must be positive")
+	ErrWalletFrozen      = errors.New("wallet is frozen")
+)
+
+// credits add to the wallet, everything else takes from it
+func (k Kind) sign() int64 {
+	switch k {
+	case Deposit, Refund, Distribution:
+		return 1
+	default:
+		return -1
+	}
+}
+
+// movements the user starts themselves are stopped while their wallet is
+// frozen, refunds and payouts still reach it
+func (k Kind) userInitiated() bool {
+	switch k {
+	case Deposit, Withdraw, Investment, DistributionDebit:
+		return true
+	default:
+		return false
+	}
+}
+
+// Entry is one side of a posting, every transaction writes a wallet entry and
+// a contra entry whose amounts sum to zero. Wallet entries are numbered per
+// account and carry the balance after them, so the latest one is the balance.
+type Entry struct {
+	ID            *int64       `json:"id,omitempty"`
+	TransactionID string       `json:"transaction_id"`
+	Account       string       `json:"account"`
+	Seq           *int64       `json:"seq,omitempty"`
+	Kind          Kind         `json:"kind"`
+	Amount        model.Money  `json:"amount"`
+	BalanceAfter  *model.Money `json:"balance_after,omitempty"`
+	Reference     string       `json:"reference,omitempty"`
+	CreatedAt     string       `json:"created_at,omitempty"`
+}
+
+// Posting moves Amount between a user's wallet and the Counterparty account
+// (e.g. "bank", "pitch:4", "profit:7"); the direction comes from the Kind
+type Posting struct {
+	UserID       string
+	Kind         Kind
+	Amount       model.Money
+	Counterparty string
+	Reference    string
+}
+
+type Ledger struct {
+	db store.Store
+}
+
+func New(db store.Store) *Ledger {
+	return &Ledger{db: db}
+}
+
+// gets the ledger account name for a user's wallet
+func WalletAccount(userID string) string {
+	return "wallet:" + userID
+}
+
+// gets the current wallet balance for the user
+func (l *Ledger) Balance(userID string) (model.Money, error) {
+	balance, _, err := l.latest(userID)
+	return balance, err
+}
+
+// posts the movement and returns the wallet balance after it. Both entries
+// go in with one insert, which is all or nothing, and the wallet entry takes
+// the next number of the wallet so only one of two concurrent postings can
+// follow the same balance. The profile's balance is updated after as a copy.
+// A posting whose reference is already in the wallet fails with
+// ErrAlreadyPosted.
+func (l *Ledger) Post(p Posting) (model.Money, error) {
+	entry, err := l.PostEntry(p)
+	if err != nil {
+		return model.Money{}, err
+	}
+	return *entry.BalanceAfter, nil
+}
+
+// posts the movement like Post and returns the wallet entry it made, whose
+// TransactionID lets the caller refer back to the posting
+func (l *Ledger) PostEntry(p Posting) (Entry, error) {
+	if !p.Amount.IsPositive() {
+		return Entry{}, ErrInvalidAmount
+	}
+	if p.Kind.userInitiated() {
+		profile, err := l.readProfile(p.UserID)
+		if err != nil {
+			return Entry{}, err
+		}
+		if profile.WalletFrozen {
+			return Entry{}, ErrWalletFrozen
+		}
+	}
+
+	delta := p.Amount.Times(p.Kind.sign())
+	for range maxAttempts {
+		current, seq, err := l.latest(p.UserID)
+		if err != nil {
+			return Entry{}, err
+		}
+		balance := current.Add(delta)
+		if balance.IsNegative() && delta.IsNegative() {
+			return Entry{}, ErrInsufficientFunds
+		}
+
+		next := seq + 1
+		txID := newTransactionID()
+		entries := []Entry{
+			{
+				TransactionID: txID,
+				Account:       WalletAccount(p.UserID),
+				Seq:           &next,
+				Kind:          p.Kind,
+				Amount:        delta,
+				BalanceAfter:  &balance,
+				Reference:     p.Reference,
+			},
+			{
+				TransactionID: txID,
+				Account:       p.Counterparty,
+				Kind:          p.Kind,
+				Amount:        delta.Neg(),
+				Reference:     p.Reference,
+			},
+		}
+
+		_, err = l.db.Insert(entriesTable, entries)
+		if errors.Is(err, store.ErrConflict) {
+			// either the reference is taken or another posting took the number
+			if p.Reference != "" {
+				if posted, err := l.Posted(p.UserID, p.Reference); err != nil {
+					return Entry{}, err
+				} else if posted {
+					return Entry{}, ErrAlreadyPosted
+				}
+			}
+			continue
+		}
+		if err != nil {
+			return Entry{}, fmt.Errorf("failed to record ledger entries: %w", err)
+		}
+
+		// the entries are the posting, a copy that fails is put right by the
+		// wallet's next posting
+		_ = l.sync(p.UserID, next, balance)
+		return entries[0], nil
+	}
+	return Entry{}, ErrConflict
+}
+
+// posts the movement unless the reference is already in the wallet, so
+// retried steps never move the money twice, even when they run at once
+func (l *Ledger) PostOnce(p Posting) (model.Money, error) {
+	if p.Reference == "" {
+		return model.Money{}, errors.New("a reference is required")
+	}
+	balance, err := l.Post(p)
+	if errors.Is(err, ErrAlreadyPosted) {
+		return l.Balance(p.UserID)
+	}
+	return balance, err
+}
+
+// checks whether the user's wallet has an entry with the reference
+func (l *Ledger) Posted(userID string, reference string) (bool, error) {
+	if reference == "" {
+		return false, errors.New("a reference is required")
+	}
+
+	query := postgrest.New().Eq("account", WalletAccount(userID)).Eq("reference", reference).Limit(1)
+	body, err := l.db.Query(entriesTable, query.String())
+	if err != nil {
+		return false, err
+	}
+	var existing []Entry
+	if err := json.Unmarshal(body, &existing); err != nil {
+		return false, err
+	}
+	return len(existing) > 0, nil
+}
+
+// gets the ledger entries for the user's wallet, newest first
+func (l *Ledger) Entries(userID string) ([]Entry, error) {
+	query := postgrest.New().Eq("account", WalletAccount(userID)).Order("seq", postgrest.Desc)
+	body, err := l.db.Query(entriesTable, query.String())
+	if err != nil {
+		return nil, err
+	}
+	var entries []Entry
+	if err := json.Unmarshal(body, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// gets the wallet balance and number of the latest wallet entry. A wallet
+// without entries has the balance on its profile, which it opened with.
+func (l *Ledger) latest(userID string) (model.Money, int64, error) {
+	query := postgrest.New().Eq("account", WalletAccount(userID)).Order("seq", postgrest.Desc).Limit(1)
+	body, err := l.db.Query(entriesTable, query.String())
+	if err != nil {
+		return model.Money{}, 0, fmt.Errorf("failed to read ledger entries: %w", err)
+	}
+	var entries []Entry
+	if err := json.Unmarshal(body, &entries); err != nil {
+		return model.Money{}, 0, fmt.Errorf("failed to decode ledger entries: %w", err)
+	}
+	if len(entries) == 1 && entries[0].Seq != nil && entries[0].BalanceAfter != nil {
+		return *entries[0].BalanceAfter, *entries[0].Seq, nil
+	}
+	balance, err := l.readBalance(userID)
+	return balance, 0, err
+}
+
+// copies the balance after the wallet entry numbered seq to the profile,
+// unless a later entry's balance is already there, so copies arriving out of
+// order or not at all are put right by the next posting
+func (l *Ledger) sync(userID string, seq int64, balance model.Money) error {
+	condition := postgrest.New().Eq("id", userID).Or(postgrest.Is("ledger_seq", postgrest.Null), postgrest.Lt("ledger_seq", seq))
+	if _, err := l.db.Update("profile", condition.String(), map[string]any{"dashboard_balance": balance, "ledger_seq": seq}); err != nil {
+		return fmt.Errorf("failed to update balance: %w", err)
+	}
+	return nil
+}
+
+// reads the balance on the profile, zero if it has never been set
+func (l *Ledger) readBalance(userID string) (model.Money, error) {
+	profile, err := l.readProfile(userID)
+	if err != nil {
+		return model.Money{}, err
+	}
+	if profile.DashboardBalance == nil {
+		return model.Money{}, nil
+	}
+	return *profile.DashboardBalance, nil
+}
+
+func (l *Ledger) readProfile(userID string) (model.Profile, error) {
+	body, err := l.db.GetByID("profile", userID)
+	if err != nil {
+		return model.Profile{}, fmt.Errorf("error fetching user profile: %w", err)
+	}
+	var profiles []model.Profile
+	if err := json.Unmarshal(body, &profiles); err != nil {
+		return model.Profile{}, fmt.Errorf("error decoding profile data: %w", err)
+	}
+	if len(profiles) != 1 {
+		return model.Profile{}, fmt.Errorf("profile not found")
+	}
+	return profiles[0], nil
+}
+
+func newTransactionID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,146 @@
+package ledger
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+
+	model "github.com/EmmaMartin123/Industrial_Project/backend/internal/model/common"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/store"
+)
+
+func new_test_ledger(t *testing.T, balance int64) (*Ledger, store.Store) {
+	t.Helper()
+	db := store.NewMemory()
+	if _, err := db.Insert("profile", map[string]any{"id": "user-1", "role": "investor", "dashboard_balance": balance}); err != nil {
+		t.Fatalf("Failed to seed profile: %v", err)
+	}
+	return New(db), db
+}
+
+func TestConcurrentPostingsKeepEveryPenny(t *testing.T) {
+	l, db := new_test_ledger(t, 1000)
+
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if _, err := l.Post(Posting{UserID: "user-1", Kind: Investment, Amount: model.FromPounds(10), Counterparty: "pitch:1"}); err != nil && !errors.Is(err, ErrConflict) {
+				t.Errorf("Investment posting failed: %v", err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if _, err := l.Post(Posting{UserID: "user-1", Kind: Deposit, Amount: model.FromPence(499), Counterparty: "bank"}); err != nil && !errors.Is(err, ErrConflict) {
+				t.Errorf("Deposit posting failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	entries, err := l.Entries("user-1")
+	if err != nil {
+		t.Fatalf("Failed to read entries: %v", err)
+	}
+	posted := model.FromPounds(1000)
+	for _, e := range entries {
+		posted = posted.Add(e.Amount)
+	}
+
+	balance, err := l.Balance("user-1")
+	if err != nil {
+		t.Fatalf("Failed to read balance: %v", err)
+	}
+	if balance != posted {
+		t.Errorf("Balance %s does not match opening balance plus entries %s", balance, posted)
+	}
+
+	body, _ := db.Query(entriesTable, "")
+	var all []Entry
+	if err := json.Unmarshal(body, &all); err != nil {
+		t.Fatalf("Failed to decode entries: %v", err)
+	}
+	var sum model.Money
+	for _, e := range all {
+		sum = sum.Add(e.Amount)
+	}
+	if !sum.IsZero() {
+		t.Errorf("Expected wallet and contra entries to sum to zero, got %s", sum)
+	}
+}
+
+func TestOverdraftIsRejected(t *testing.T) {
+	l, _ := new_test_ledger(t, 100)
+
+	if _, err := l.Post(Posting{UserID: "user-1", Kind: Withdraw, Amount: model.FromPence(10001), Counterparty: "bank"}); !errors.Is(err, ErrInsufficientFunds) {
+		t.Fatalf("Expected ErrInsufficientFunds, got %v", err)
+	}
+
+	balance, err := l.Post(Posting{UserID: "user-1", Kind: Withdraw, Amount: model.FromPounds(100), Counterparty: "bank"})
+	if err != nil {
+		t.Fatalf("Withdrawing the full balance failed: %v", err)
+	}
+	if !balance.IsZero() {
+		t.Errorf("Expected balance 0, got %s", balance)
+	}
+
+	entries, _ := l.Entries("user-1")
+	if len(entries) != 1 || entries[0].Kind != Withdraw || entries[0].Amount != model.FromPounds(-100) {
+		t.Errorf("Expected a single -100 withdraw entry, got %+v", entries)
+	}
+}
+
+func TestConcurrentPostOnceMovesMoneyOnce(t *testing.T) {
+	l, _ := new_test_ledger(t, 0)
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := l.PostOnce(Posting{UserID: "user-1", Kind: Refund, Amount: model.FromPounds(25), Counterparty: "pitch:1", Reference: "investment:1"}); err != nil && !errors.Is(err, ErrConflict) {
+				t.Errorf("Refund posting failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	balance, _ := l.Balance("user-1")
+	entries, _ := l.Entries("user-1")
+	if balance != model.FromPounds(25) || len(entries) != 1 {
+		t.Errorf("Expected one refund of 25, got balance %s from %d entries", balance, len(entries))
+	}
+	if _, err := l.Post(Posting{UserID: "user-1", Kind: Refund, Amount: model.FromPounds(25), Counterparty: "pitch:1", Reference: "investment:1"}); !errors.Is(err, ErrAlreadyPosted) {
+		t.Errorf("Expected ErrAlreadyPosted for a repeated reference, got %v", err)
+	}
+}
+
+// the entries are the balance, the profile only holds a copy of it
+func TestBalanceFollowsEntriesWhenTheProfileCopyIsBehind(t *testing.T) {
+	l, db := new_test_ledger(t, 100)
+	if _, err := l.Post(Posting{UserID: "user-1", Kind: Deposit, Amount: model.FromPounds(50), Counterparty: "bank"}); err != nil {
+		t.Fatalf("Deposit failed: %v", err)
+	}
+
+	// as if the copy to the profile had been lost
+	if _, err := db.UpdateByID("profile", "user-1", map[string]any{"dashboard_balance": 100, "ledger_seq": nil}); err != nil {
+		t.Fatalf("Failed to reset profile: %v", err)
+	}
+	if balance, _ := l.Balance("user-1"); balance != model.FromPounds(150) {
+		t.Errorf("Expected the balance 150 from the entries, got %s", balance)
+	}
+
+	if _, err := l.Post(Posting{UserID: "user-1", Kind: Withdraw, Amount: model.FromPounds(20), Counterparty: "bank"}); err != nil {
+		t.Fatalf("Withdraw failed: %v", err)
+	}
+	body, _ := db.GetByID("profile", "user-1")
+	var profiles []model.Profile
+	if err := json.Unmarshal(body, &profiles); err != nil || len(profiles) != 1 {
+		t.Fatalf("Failed to read profile: %v", err)
+	}
+	if got := profiles[0].DashboardBalance; got == nil || *got != model.FromPounds(130) {
+		t.Errorf("Expected the next posting to copy 130 to the profile, got %v", got)
+	}
+}
@@ -0,0 +1,259 @@
+package lifecycle
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	model "github.com/EmmaMartin123/Industrial_Project/backend/internal/model/common"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/model/database"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/postgrest"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/store"
+)
+
+// State is where a pitch is in its lifecycle
+type State string
+
+const (
+	Draft       State = "Draft"       // being written, not open to investors
+	Active      State = "Active"      // open for investment
+	Funded      State = "Funded"      // raised its target
+	Closed      State = "Closed"      // withdrawn before it was funded
+	Declared    State = "Declared"    // profit declared, waiting to be paid out
+	Distributed State = "Distributed" // declared profit paid out to investors
+	Suspended   State = "Suspended"   // frozen by an admin, e.g. for suspected fraud
+)
+
+// Actor is who is asking for a transition
+type Actor string
+
+const (
+	Owner  Actor = "owner"  // the business that created the pitch
+	System Actor = "system" // the platform itself, e.g. a reservation or payout
+	Admin  Actor = "admin"
+)
+
+var (
+	ErrUnknownState      = errors.New("unknown pitch status")
+	ErrIllegalTransition = errors.New("illegal pitch status transition")
+	ErrNotAllowed        = errors.New("not allowed to make this pitch status transition")
+	ErrStale             = errors.New("pitch status changed concurrently")
+)
+
+// Pitch is what the machine needs to know about a pitch
+type Pitch struct {
+	ID           int64
+	Status       State
+	TargetAmount model.Money
+	RaisedAmount model.Money
+	StartsAt     time.Time // zero if the pitch has no start date
+	EndsAt       time.Time // zero if the pitch has no end date
+	// the state a suspended pitch goes back to
+	SuspendedFrom State
+}
+
+// gets the lifecycle view of a stored pitch
+func Of(p database.Pitch) Pitch {
+	var id int64
+	if p.PitchID != nil {
+		id = *p.PitchID
+	}
+	starts, _ := parse_date(p.InvestmentStartDate, false)
+	ends, _ := parse_date(p.InvestmentEndDate, true)
+	var suspended_from State
+	if p.SuspendedFrom != nil {
+		suspended_from = State(*p.SuspendedFrom)
+	}
+	return Pitch{
+		ID:            id,
+		Status:        State(p.Status),
+		TargetAmount:  p.TargetAmount,
+		RaisedAmount:  p.RaisedAmount,
+		StartsAt:      starts,
+		EndsAt:        ends,
+		SuspendedFrom: suspended_from,
+	}
+}
+
+// checks whether the pitch's investment window has opened by now
+func (p Pitch) Started(now time.Time) bool {
+	return !p.StartsAt.IsZero() && !now.Before(p.StartsAt)
+}
+
+// checks whether the pitch's investment window has closed by now
+func (p Pitch) Ended(now time.Time) bool {
+	return !p.EndsAt.IsZero() && !now.Before(p.EndsAt)
+}
+
+// Transition is one allowed move, Guard (if set) says why it can't happen yet
+type Transition struct {
+	From   State
+	To     State
+	Actors []Actor
+	Guard  func(p Pitch) error
+}
+
+var transitions = []Transition{
+	{From: Draft, To: Active, Actors: []Actor{Owner, System, Admin}},
+	{From: Draft, To: Closed, Actors: []Actor{Owner, Admin}},
+	{From: Active, To: Draft, Actors: []Actor{Owner, Admin}, Guard: nothing_raised},
+	{From: Active, To: Closed, Actors: []Actor{Owner, System, Admin}, Guard: nothing_raised},
+	{From: Active, To: Funded, Actors: []Actor{System}, Guard: funding_over},
+	{From: Funded, To: Declared, Actors: []Actor{Owner}},
+	{From: Distributed, To: Declared, Actors: []Actor{Owner}},
+	{From: Declared, To: Distributed, Actors: []Actor{System}},
+
+	// an admin can suspend a pitch in any open state and later put it back
+	{From: Draft, To: Suspended, Actors: []Actor{Admin}},
+	{From: Active, To: Suspended, Actors: []Actor{Admin}},
+	{From: Funded, To: Suspended, Actors: []Actor{Admin}},
+	{From: Declared, To: Suspended, Actors: []Actor{Admin}},
+	{From: Distributed, To: Suspended, Actors: []Actor{Admin}},
+	{From: Suspended, To: Draft, Actors: []Actor{Admin}, Guard: returns_to(Draft)},
+	{From: Suspended, To: Active, Actors: []Actor{Admin}, Guard: returns_to(Active)},
+	{From: Suspended, To: Funded, Actors: []Actor{Admin}, Guard: returns_to(Funded)},
+	{From: Suspended, To: Declared, Actors: []Actor{Admin}, Guard: returns_to(Declared)},
+	{From: Suspended, To: Distributed, Actors: []Actor{Admin}, Guard: returns_to(Distributed)},
+}
+
+// gets every allowed transition
+func Transitions() []Transition {
+	return slices.Clone(transitions)
+}
+
+// parses a status name
+func Parse(s string) (State, error) {
+	switch state := State(s); state {
+	case Draft, Active, Funded, Closed, Declared, Distributed, Suspended:
+		return state, nil
+	default:
+		return "", fmt.Errorf("%w %q", ErrUnknownState, s)
+	}
+}
+
+// checks a new pitch starts in a state it can be created in, Draft if unset
+func Initial(s string) (State, error) {
+	if s == "" {
+		return Draft, nil
+	}
+	state, err := Parse(s)
+	if err != nil {
+		return "", err
+	}
+	if state != Draft && state != Active {
+		return "", fmt.Errorf("%w: a new pitch can't be %s", ErrIllegalTransition, state)
+	}
+	return state, nil
+}
+
+// checks the actor may move the pitch to the state, staying put is always fine
+func Check(p Pitch, to State, actor Actor) error {
+	if _, err := Parse(string(to)); err != nil {
+		return err
+	}
+	if p.Status == to {
+		return nil
+	}
+
+	for _, t := range transitions {
+		if t.From != p.Status || t.To != to {
+			continue
+		}
+		if !slices.Contains(t.Actors, actor) {
+			return fmt.Errorf("%w: %s can't move a pitch from %s to %s", ErrNotAllowed, actor, p.Status, to)
+		}
+		if t.Guard != nil {
+			if err := t.Guard(p); err != nil {
+				return fmt.Errorf("%w: %s to %s: %v", ErrIllegalTransition, p.Status, to, err)
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("%w: cannot go from %s to %s", ErrIllegalTransition, p.Status, to)
+}
+
+// checks the transition then writes it, only if the pitch is still in the
+// state it was read in (and matches any extra conditions), so two callers
+// can't both move it
+func Apply(db store.Store, p Pitch, to State, actor Actor, conditions ...postgrest.Condition) error {
+	return ApplyWith(db, p, to, actor, nil, conditions...)
+}
+
+// applies the transition like Apply, writing the other fields in the same update
+func ApplyWith(db store.Store, p Pitch, to State, actor Actor, fields map[string]any, conditions ...postgrest.Condition) error {
+	if err := Check(p, to, actor); err != nil {
+		return err
+	}
+	if p.Status == to {
+		return nil
+	}
+
+	condition := postgrest.New().Eq("id", p.ID).Eq("status", p.Status).Where(conditions...)
+	update := map[string]any{"status": to}
+	for k, v := range fields {
+		update[k] = v
+	}
+	body, err := db.Update("pitch", condition.String(), update)
+	if err != nil {
+		return fmt.Errorf("failed to update pitch status: %w", err)
+	}
+	var updated []database.Pitch
+	if err := json.Unmarshal(body, &updated); err != nil {
+		return fmt.Errorf("failed to decode pitch update: %w", err)
+	}
+	if len(updated) != 1 {
+		return ErrStale
+	}
+	return nil
+}
+
+func nothing_raised(p Pitch) error {
+	if !p.RaisedAmount.IsZero() {
+		return errors.New("it already has investments")
+	}
+	return nil
+}
+
+// a suspended pitch only goes back to where it was
+func returns_to(state State) func(p Pitch) error {
+	return func(p Pitch) error {
+		if p.SuspendedFrom != state {
+			return fmt.Errorf("it was suspended from %s", p.SuspendedFrom)
+		}
+		return nil
+	}
+}
+
+// funded at its target, or with what it raised once its end date has passed
+func funding_over(p Pitch) error {
+	if p.RaisedAmount.Cmp(p.TargetAmount) == 0 {
+		return nil
+	}
+	if p.Ended(time.Now()) && p.RaisedAmount.IsPositive() {
+		return nil
+	}
+	return errors.New("it hasn't reached its target")
+}
+
+// parses a pitch date, either a day ("2025-12-31") or a timestamp. A day ends
+// at the end of that day so the end date is the last day open.
+func parse_date(s string, end bool) (time.Time, bool) {
+	if s == "" {
+		return time.Time{}, false
+	}
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999", "2006-01-02 15:04:05.999999"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC(), true
+		}
+	}
+	day, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		return time.Time{}, false
+	}
+	if end {
+		day = day.AddDate(0, 0, 1)
+	}
+	return day, true
+}
@@ -0,0 +1,59 @@
+package lifecycle
+
+import (
+	"errors"
+	"testing"
+
+	model "github.com/EmmaMartin123/Industrial_Project/backend/internal/model/common"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/store"
+)
+
+func TestCheck(t *testing.T) {
+	funded := Pitch{Status: Active, TargetAmount: model.FromPounds(100), RaisedAmount: model.FromPounds(100)}
+	cases := []struct {
+		name  string
+		pitch Pitch
+		to    State
+		actor Actor
+		want  error
+	}{
+		{"owner publishes a draft", Pitch{Status: Draft}, Active, Owner, nil},
+		{"investor money can't be withdrawn by closing", Pitch{Status: Active, RaisedAmount: model.FromPounds(1)}, Closed, Owner, ErrIllegalTransition},
+		{"system marks a full pitch funded", funded, Funded, System, nil},
+		{"owner can't mark a pitch funded", funded, Funded, Owner, ErrNotAllowed},
+		{"a pitch short of its target isn't funded", Pitch{Status: Active, TargetAmount: model.FromPounds(100)}, Funded, System, ErrIllegalTransition},
+		{"cannot go to Declared before Funded", Pitch{Status: Active}, Declared, Owner, ErrIllegalTransition},
+		{"owner declares profit on a funded pitch", Pitch{Status: Funded}, Declared, Owner, nil},
+		{"owner declares the next period's profit", Pitch{Status: Distributed}, Declared, Owner, nil},
+		{"payouts are the system's to finish", Pitch{Status: Declared}, Distributed, Owner, ErrNotAllowed},
+		{"staying put is a no-op", Pitch{Status: Declared}, Declared, Owner, nil},
+		{"admin suspends an active pitch", Pitch{Status: Active}, Suspended, Admin, nil},
+		{"owner can't suspend their pitch", Pitch{Status: Active}, Suspended, Owner, ErrNotAllowed},
+		{"a suspended pitch goes back where it was", Pitch{Status: Suspended, SuspendedFrom: Funded}, Funded, Admin, nil},
+		{"a suspended pitch can't skip ahead", Pitch{Status: Suspended, SuspendedFrom: Active}, Funded, Admin, ErrIllegalTransition},
+		{"unknown states are rejected", Pitch{Status: Draft}, "Live", Owner, ErrUnknownState},
+	}
+
+	for _, c := range cases {
+		err := Check(c.pitch, c.to, c.actor)
+		if c.want == nil && err != nil || c.want != nil && !errors.Is(err, c.want) {
+			t.Errorf("%s: got %v, expected %v", c.name, err, c.want)
+		}
+	}
+}
+
+func TestApplyOnlyMovesFromTheStateRead(t *testing.T) {
+	db := store.NewMemory()
+	if _, err := db.Insert("pitch", map[string]any{"title": "Test", "status": "Draft", "target_amount": 100, "raised_amount": 0}); err != nil {
+		t.Fatalf("Failed to seed pitch: %v", err)
+	}
+
+	draft := Pitch{ID: 1, Status: Draft, TargetAmount: model.FromPounds(100)}
+	if err := Apply(db, draft, Active, Owner); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	// a second caller that also read Draft loses
+	if err := Apply(db, draft, Closed, Owner); !errors.Is(err, ErrStale) {
+		t.Errorf("Expected ErrStale, got %v", err)
+	}
+}
@@ -0,0 +1,88 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Default is the registry /metrics serves
+var Default = NewRegistry()
+
+var (
+	HTTPRequests = Default.NewCounterVec("http_requests_total",
+		"HTTP requests served, by route, method and status.", "route", "method", "status")
+	HTTPDuration = Default.NewHistogramVec("http_request_duration_seconds",
+		"Time taken to serve HTTP requests, by route, method and status.", nil, "route", "method", "status")
+
+	SupabaseDuration = Default.NewHistogramVec("supabase_request_duration_seconds",
+		"Time taken by calls to the Supabase REST API, by table and operation.", nil, "table", "operation")
+	SupabaseErrors = Default.NewCounterVec("supabase_request_errors_total",
+		"Calls to the Supabase REST API that failed, by table and operation.", "table", "operation")
+
+	InvestmentsCreated = Default.NewCounterVec("investments_created_total",
+		"Investments created.")
+	InvestmentsRefunded = Default.NewCounterVec("investments_refunded_total",
+		"Investments refunded to their investor.")
+	DistributionPayouts = Default.NewCounterVec("distribution_payouts_total",
+		"Profit distribution payouts to investors, by result (paid or failed).", "result")
+	WalletMovements = Default.NewCounterVec("wallet_movements_total",
+		"Wallet deposits and withdrawals, by action.", "action")
+	WalletMovedPence = Default.NewCounterVec("wallet_moved_pence_total",
+		"Money moved by wallet deposits and withdrawals in pence, by action.", "action")
+)
+
+// the results a distribution payout is counted under
+const (
+	PayoutPaid   = "paid"
+	PayoutFailed = "failed"
+)
+
+// times a call to the data store, counting it as an error if it failed
+func ObserveStore(table string, operation string, took time.Duration, err error) {
+	SupabaseDuration.Observe(took.Seconds(), table, operation)
+	if err != nil {
+		SupabaseErrors.Inc(table, operation)
+	}
+}
+
+// counts and times the requests served by the route's handler. Route is the
+// pattern it is registered under so ids in the path don't split the series.
+func Middleware(route string) func(http.Handler) http.Handler {
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rec := &status_recorder{ResponseWriter: w, status: http.StatusOK}
+			handler.ServeHTTP(rec, r)
+
+			status := strconv.Itoa(rec.status)
+			HTTPRequests.Inc(route, r.Method, status)
+			HTTPDuration.Observe(time.Since(start).Seconds(), route, r.Method, status)
+		})
+	}
+}
+
+// passes the response through while keeping its status
+type status_recorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (r *status_recorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *status_recorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	return r.ResponseWriter.Write(b)
+}
+
+// lets http.ResponseController reach the underlying writer
+func (r *status_recorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
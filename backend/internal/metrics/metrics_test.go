@@ -0,0 +1,75 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegistryWritesTextFormat(t *testing.T) {
+	reg := NewRegistry()
+	requests := reg.NewCounterVec("requests_total", "Requests served.", "route", "status")
+	latency := reg.NewHistogramVec("latency_seconds", "Request latency.", []float64{0.1, 1}, "route")
+
+	requests.Inc("/api/pitch", "200")
+	requests.Add(2, "/api/pitch", "200")
+	requests.Inc(`/a"b`, "500")
+	latency.Observe(0.05, "/api/pitch")
+	latency.Observe(0.1, "/api/pitch")
+	latency.Observe(3, "/api/pitch")
+
+	var out strings.Builder
+	reg.Write(&out)
+	want := `# HELP requests_total Requests served.
+# TYPE requests_total counter
+requests_total{route="/api/pitch",status="200"} 3
+requests_total{route="/a\"b",status="500"} 1
+# HELP latency_seconds Request latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{route="/api/pitch",le="0.1"} 2
+latency_seconds_bucket{route="/api/pitch",le="1"} 2
+latency_seconds_bucket{route="/api/pitch",le="+Inf"} 3
+latency_seconds_sum{route="/api/pitch"} 3.15
+latency_seconds_count{route="/api/pitch"} 3
+`
+	if out.String() != want {
+		t.Errorf("Unexpected output:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
+
+func TestRegistryRefusesDuplicateNames(t *testing.T) {
+	reg := NewRegistry()
+	reg.NewCounterVec("dup_total", "")
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected registering a name twice to panic")
+		}
+	}()
+	reg.NewCounterVec("dup_total", "")
+}
+
+func TestMiddlewareCountsByRouteAndStatus(t *testing.T) {
+	route := "/test/middleware"
+	handler := Middleware(route)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("fail") != "" {
+			http.Error(w, "nope", http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+
+	for _, url := range []string{route, route, route + "?fail=1"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, url, nil))
+	}
+
+	if n := HTTPRequests.Value(route, http.MethodGet, "200"); n != 2 {
+		t.Errorf("Expected 2 successful requests, got %v", n)
+	}
+	if n := HTTPRequests.Value(route, http.MethodGet, "400"); n != 1 {
+		t.Errorf("Expected 1 failed request, got %v", n)
+	}
+	if n := HTTPDuration.Count(route, http.MethodGet, "200"); n != 2 {
+		t.Errorf("Expected 2 timings, got %v", n)
+	}
+}
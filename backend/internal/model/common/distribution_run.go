@@ -0,0 +1,17 @@
+package model
+
+type DistributionRun struct {
+	ID            *int64 `json:"id,omitempty"`
+	ProfitID      int64  `json:"profit_id"`
+	PitchID       int64  `json:"pitch_id"`
+	BusinessID    string `json:"business_id"`
+	Status        string `json:"status"`
+	TotalAmount   Money  `json:"total_amount"`
+	InvestorCount int    `json:"investor_count"`
+	PaidCount     int    `json:"paid_count"`
+	LastError     string `json:"last_error,omitempty"`
+	LockedUntil   string `json:"locked_until,omitempty"`
+	LockedBy      string `json:"locked_by,omitempty"`
+	CreatedAt     string `json:"created_at,omitempty"`
+	UpdatedAt     string `json:"updated_at,omitempty"`
+}
@@ -5,7 +5,8 @@ type Investment struct {
 	PitchID    *int64 `json:"pitch_id,omitempty"`
 	InvestorID string `json:"investor_id"`
 	TierID     *int64 `json:"tier_id,omitempty"`
-	Amount     int64  `json:"amount"`
+	Amount     Money  `json:"amount"`
 	Refunded   bool   `json:"refunded"`
 	CreatedAt  string `json:"created_at,omitempty"`
+	OutboxID   *int64 `json:"outbox_id,omitempty"`
 }
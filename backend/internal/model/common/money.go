@@ -0,0 +1,195 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// DefaultCurrency is the platform's currency
+const DefaultCurrency = "GBP"
+
+// the platform only holds GBP, so amounts in anything else are refused when
+// they're decoded rather than reaching arithmetic that can't mix currencies
+var ErrUnsupportedCurrency = errors.New("unsupported currency")
+
+// Money is an exact amount held as integer pence (minor units) and a currency
+// code. In JSON it is a decimal number of pounds (e.g. 12.34) so the API and
+// database keep their existing format; amounts in another currency are written
+// as {"amount": 12.34, "currency": "EUR"}, but only GBP is accepted when decoding.
+type Money struct {
+	pence    int64
+	currency string // empty for DefaultCurrency so == works on amounts
+}
+
+// creates an amount of pence in the default currency
+func FromPence(pence int64) Money {
+	return Money{pence: pence}
+}
+
+// creates an amount of whole pounds in the default currency
+func FromPounds(pounds int64) Money {
+	return Money{pence: pounds * 100}
+}
+
+// creates an amount of minor units in the given currency
+func NewMoney(pence int64, currency string) Money {
+	return Money{pence: pence, currency: normalize_currency(currency)}
+}
+
+// parses a decimal amount such as "12.34", rejecting fractions of a penny
+func ParseMoney(s string, currency string) (Money, error) {
+	r, ok := new(big.Rat).SetString(strings.TrimSpace(s))
+	if !ok {
+		return Money{}, fmt.Errorf("invalid amount %q", s)
+	}
+	r.Mul(r, big.NewRat(100, 1))
+	if !r.IsInt() {
+		return Money{}, fmt.Errorf("amount %q has fractions of a penny", s)
+	}
+	if !r.Num().IsInt64() {
+		return Money{}, fmt.Errorf("amount %q is out of range", s)
+	}
+	return NewMoney(r.Num().Int64(), currency), nil
+}
+
+func (m Money) Pence() int64 { return m.pence }
+
+func (m Money) Currency() string {
+	if m.currency == "" {
+		return DefaultCurrency
+	}
+	return m.currency
+}
+
+func (m Money) IsZero() bool     { return m.pence == 0 }
+func (m Money) IsPositive() bool { return m.pence > 0 }
+func (m Money) IsNegative() bool { return m.pence < 0 }
+
+func (m Money) Add(o Money) Money {
+	m.must_match(o)
+	return Money{pence: m.pence + o.pence, currency: m.currency}
+}
+
+func (m Money) Sub(o Money) Money {
+	m.must_match(o)
+	return Money{pence: m.pence - o.pence, currency: m.currency}
+}
+
+func (m Money) Neg() Money {
+	return Money{pence: -m.pence, currency: m.currency}
+}
+
+// multiplies by n, e.g. a sign
+func (m Money) Times(n int64) Money {
+	return Money{pence: m.pence * n, currency: m.currency}
+}
+
+// compares two amounts in the same currency, returning -1, 0 or 1
+func (m Money) Cmp(o Money) int {
+	m.must_match(o)
+	switch {
+	case m.pence < o.pence:
+		return -1
+	case m.pence > o.pence:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// gets the amount in pounds as a float, for ratios like ROI only
+func (m Money) Float64() float64 {
+	return float64(m.pence) / 100
+}
+
+// scales the amount by f, rounding half away from zero to the nearest penny
+func (m Money) Mul(f float64) Money {
+	return Money{pence: int64(math.Round(float64(m.pence) * f)), currency: m.currency}
+}
+
+// formats the amount as a decimal, e.g. "12.34" or "100", as used in queries
+func (m Money) String() string {
+	sign := ""
+	p := m.pence
+	if p < 0 {
+		sign = "-"
+		p = -p
+	}
+	if p%100 == 0 {
+		return sign + strconv.FormatInt(p/100, 10)
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, p/100, p%100)
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	if m.currency == "" {
+		return []byte(m.String()), nil
+	}
+	return json.Marshal(struct {
+		Amount   json.Number `json:"amount"`
+		Currency string      `json:"currency"`
+	}{json.Number(m.String()), m.currency})
+}
+
+func (m *Money) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	switch {
+	case bytes.Equal(data, []byte("null")):
+		return nil
+	case len(data) > 0 && data[0] == '{':
+		var obj struct {
+			Amount   json.Number `json:"amount"`
+			Currency string      `json:"currency"`
+		}
+		if err := json.Unmarshal(data, &obj); err != nil {
+			return fmt.Errorf("invalid money: %w", err)
+		}
+		parsed, err := ParseMoney(obj.Amount.String(), obj.Currency)
+		if err != nil {
+			return err
+		}
+		if parsed.currency != "" {
+			return fmt.Errorf("%w %q", ErrUnsupportedCurrency, obj.Currency)
+		}
+		*m = parsed
+		return nil
+	case len(data) > 0 && data[0] == '"':
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		parsed, err := ParseMoney(s, "")
+		if err != nil {
+			return err
+		}
+		*m = parsed
+		return nil
+	default:
+		parsed, err := ParseMoney(string(data), "")
+		if err != nil {
+			return err
+		}
+		*m = parsed
+		return nil
+	}
+}
+
+func (m Money) must_match(o Money) {
+	if m.currency != o.currency {
+		panic(fmt.Sprintf("money: mixing %s and %s", m.Currency(), o.Currency()))
+	}
+}
+
+func normalize_currency(currency string) string {
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if currency == DefaultCurrency {
+		return ""
+	}
+	return currency
+}
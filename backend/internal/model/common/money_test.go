@@ -0,0 +1,96 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestMoneyJSONRoundTrip(t *testing.T) {
+	cases := []struct {
+		in   string
+		want Money
+		out  string
+	}{
+		{`12.34`, FromPence(1234), `12.34`},
+		{`100`, FromPounds(100), `100`},
+		{`"0.10"`, FromPence(10), `0.1`},
+		{`-5.5`, FromPence(-550), `-5.5`},
+		{`{"amount": 7, "currency": "GBP"}`, FromPounds(7), `7`},
+	}
+
+	for _, c := range cases {
+		var m Money
+		if err := json.Unmarshal([]byte(c.in), &m); err != nil {
+			t.Fatalf("Failed to decode %s: %v", c.in, err)
+		}
+		if m != c.want {
+			t.Errorf("Decoded %s as %d %s, expected %d %s", c.in, m.Pence(), m.Currency(), c.want.Pence(), c.want.Currency())
+		}
+		out, err := json.Marshal(m)
+		if err != nil {
+			t.Fatalf("Failed to encode %s: %v", c.in, err)
+		}
+		var back Money
+		if err := json.Unmarshal(out, &back); err != nil || back != m {
+			t.Errorf("Round trip of %s gave %s", c.in, out)
+		}
+		if !equal_json(out, c.out) {
+			t.Errorf("Encoded %s as %s, expected %s", c.in, out, c.out)
+		}
+	}
+}
+
+func TestMoneyRejectsOtherCurrencies(t *testing.T) {
+	for _, in := range []string{`{"amount": 3.2, "currency": "eur"}`, `{"amount": 1, "currency": "USD"}`} {
+		var m Money
+		if err := json.Unmarshal([]byte(in), &m); !errors.Is(err, ErrUnsupportedCurrency) {
+			t.Errorf("Expected ErrUnsupportedCurrency for %s, got %v", in, err)
+		}
+	}
+
+	// still written out in full, so it's never mistaken for pounds
+	out, _ := json.Marshal(NewMoney(320, "EUR"))
+	if !equal_json(out, `{"amount":3.2,"currency":"EUR"}`) {
+		t.Errorf("Expected EUR written with its currency, got %s", out)
+	}
+}
+
+func TestMoneyRejectsFractionsOfAPenny(t *testing.T) {
+	for _, in := range []string{`0.001`, `"12.345"`, `"abc"`, `1e30`} {
+		var m Money
+		if err := json.Unmarshal([]byte(in), &m); err == nil {
+			t.Errorf("Expected %s to be rejected, got %d pence", in, m.Pence())
+		}
+	}
+}
+
+func TestMoneyArithmetic(t *testing.T) {
+	a := FromPence(1001)
+	if got := a.Mul(1.0 / 3); got != FromPence(334) {
+		t.Errorf("Expected a third of 10.01 to round to 3.34, got %s", got)
+	}
+	if got := a.Add(FromPence(99)).Sub(FromPounds(1)); got != FromPounds(10) {
+		t.Errorf("Expected 10, got %s", got)
+	}
+	if FromPounds(1).Cmp(FromPence(99)) != 1 || FromPence(99).Cmp(FromPounds(1)) != -1 {
+		t.Errorf("Cmp ordered amounts incorrectly")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Expected adding different currencies to panic")
+		}
+	}()
+	FromPounds(1).Add(NewMoney(100, "EUR"))
+}
+
+func equal_json(a []byte, b string) bool {
+	var x, y any
+	if json.Unmarshal(a, &x) != nil || json.Unmarshal([]byte(b), &y) != nil {
+		return false
+	}
+	xb, _ := json.Marshal(x)
+	yb, _ := json.Marshal(y)
+	return string(xb) == string(yb)
+}
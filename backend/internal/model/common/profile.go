@@ -4,7 +4,8 @@ type Profile struct {
 	ID               string `json:"id"`
 	Role             string `json:"role"`
 	DisplayName      string `json:"display_name"`
-	DashboardBalance *int64 `json:"dashboard_balance,omitempty"`
+	DashboardBalance *Money `json:"dashboard_balance,omitempty"`
 	Email            string `json:"email"`
+	WalletFrozen     bool   `json:"wallet_frozen,omitempty"`
 	CreatedAt        string `json:"created_at,omitempty"`
 }
@@ -1,10 +1,12 @@
 package model
 
 type ProfitDistribution struct {
+	ID           *int64  `json:"id,omitempty"`
+	RunID        *int64  `json:"run_id,omitempty"`
 	ProfitID     int64   `json:"profit_id"`
 	InvestmentID int64   `json:"investment_id"`
 	InvestorID   string  `json:"investor_id"`
 	Shares       float64 `json:"shares"`
-	Amount       float64 `json:"amount"`
+	Amount       Money   `json:"amount"`
 	Paid         bool    `json:"paid"`
 }
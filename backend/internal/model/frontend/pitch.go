@@ -9,15 +9,17 @@ type Pitch struct {
 	ProductTitle        string                 `json:"title"`
 	ElevatorPitch       string                 `json:"elevator_pitch"`
 	DetailedPitch       string                 `json:"detailed_pitch"`
-	TargetAmount        uint64                 `json:"target_amount"`
+	TargetAmount        model.Money            `json:"target_amount"`
 	InvestmentEndDate   string                 `json:"investment_end_date"`
 	InvestmentStartDate string                 `json:"investment_start_date"`
 	ProfitSharePercent  float64                `json:"profit_share_percent"`
 	InvestmentTiers     []model.InvestmentTier `json:"investment_tiers"`
 	UserID              *string                `json:"user_id,omitempty"`
-	RaisedAmount        uint64                 `json:"raised_amount,omitempty"`
+	RaisedAmount        model.Money            `json:"raised_amount,omitzero"`
 	Media               []PitchMedia           `json:"media,omitempty"`
 	Tags                []string               `json:"tags,omitempty"`
 	UpdatedAt           *string                `json:"updated_at,omitempty"`
 	Status              string                 `json:"status"`
+	// the fields a search matched, with the matches in <mark> tags
+	Highlights map[string]string `json:"highlights,omitempty"`
 }
@@ -1,5 +1,9 @@
 package frontend
 
+import (
+	model "github.com/EmmaMartin123/Industrial_Project/backend/internal/model/common"
+)
+
 type PortfolioResponse struct {
     InvestorID string          `json:"investor_id"`
     Items      []PortfolioItem `json:"items"`
@@ -9,11 +13,11 @@ type PortfolioItem struct {
 	InvestmentID int64 `json:"investment_id,omitempty"`
 	PitchID       int64 `json:"pitch_id,omitempty"`
 	PitchTitle    string `json:"pitch_title"`
-	TargetAmount  int64 `json:"target_amount"`
-	RaisedAmount  int64 `json:"raised_amount"`
+	TargetAmount  model.Money `json:"target_amount"`
+	RaisedAmount  model.Money `json:"raised_amount"`
 	Status        string `json:"status,omitempty"`
 	Multiplier    float64 `json:"multiplier"`
-	TotalProfit   float64 `json:"total_profit"`
+	TotalProfit   model.Money `json:"total_profit"`
 	ROI           float64 `json:"roi"`
 	CreatedAt     string `json:"created_at,omitempty"`
 }
@@ -21,8 +25,8 @@ type PortfolioItem struct {
 type PitchSlim struct {
 	PitchID int64 `json:"id"`
 	Title string `json:"title"`
-	TargetAmount int64 `json:"target_amount"`
-	RaisedAmount int64 `json:"raised_amount"`
+	TargetAmount model.Money `json:"target_amount"`
+	RaisedAmount model.Money `json:"raised_amount"`
 	Status string `json:"status"`
 }
 type TierSlim struct {
@@ -30,12 +34,12 @@ type TierSlim struct {
 	Multiplier float64 `json:"multiplier"`
 }
 type DistRow struct {
-	Amount float64     `json:"amount"`
+	Amount model.Money `json:"amount"`
 	Paid   bool        `json:"paid"`
 }
 type InvRow struct {
 	ID                  int64     `json:"id"`
-	Amount              int64 	  `json:"amount"`
+	Amount              model.Money `json:"amount"`
 	CreatedAt           string    `json:"created_at"`
 	Pitch               PitchSlim `json:"pitch"`
 	Tier                TierSlim  `json:"tier"`
@@ -1,8 +1,12 @@
 package frontend
 
+import (
+	model "github.com/EmmaMartin123/Industrial_Project/backend/internal/model/common"
+)
+
 type Profit struct {
-	PitchID     int64   `json:"pitch_id"`
-	PeriodStart string  `json:"period_start"`
-	PeriodEnd   string  `json:"period_end"`
-	TotalProfit float64 `json:"total_profit"`
+	PitchID     int64       `json:"pitch_id"`
+	PeriodStart string      `json:"period_start"`
+	PeriodEnd   string      `json:"period_end"`
+	TotalProfit model.Money `json:"total_profit"`
 }
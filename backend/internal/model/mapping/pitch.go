@@ -7,11 +7,6 @@ import (
 )
 
 func Pitch_ToDatabase(p frontend.Pitch, user_id string) database.Pitch {
-	raised_amount := int64(0)
-	if p.RaisedAmount != 0 {
-		raised_amount = int64(p.RaisedAmount)
-	}
-
 	return database.Pitch{
 		PitchID:             p.PitchID,
 		Title:               p.ProductTitle,
@@ -20,7 +15,7 @@ func Pitch_ToDatabase(p frontend.Pitch, user_id string) database.Pitch {
 		TargetAmount:        p.TargetAmount,
 		ProfitSharePercent:  p.ProfitSharePercent,
 		UserID:              user_id,
-		RaisedAmount:        raised_amount,
+		RaisedAmount:        p.RaisedAmount,
 		InvestmentStartDate: p.InvestmentStartDate,
 		InvestmentEndDate:   p.InvestmentEndDate,
 		UpdatedAt:           p.UpdatedAt,
@@ -42,7 +37,7 @@ func Pitch_ToFrontend(p database.Pitch, investment_tiers []model.InvestmentTier,
 		ProfitSharePercent:  p.ProfitSharePercent,
 		UserID:              &userID,
 		InvestmentTiers:     investment_tiers,
-		RaisedAmount:        uint64(p.RaisedAmount),
+		RaisedAmount:        p.RaisedAmount,
 		Media:               media,
 		Tags:                tags,
 		UpdatedAt:           p.UpdatedAt,
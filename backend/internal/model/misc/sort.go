@@ -1,6 +0,0 @@
-package misc
-
-type SortConfig struct {
-	Field     string `json:"field"`
-	Direction string `json:"direction"`
-}
\ No newline at end of file
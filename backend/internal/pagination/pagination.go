@@ -0,0 +1,183 @@
+// Package pagination pages through ordered rows with opaque cursors. A cursor
+// remembers the row a page ended at rather than how many rows came before
+// it, so rows created while someone is paging don't shift the pages along.
+package pagination
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/postgrest"
+)
+
+// the column every order ends with, so rows with equal sort values still
+// have one place in it
+const tiebreak = "id"
+
+var (
+	ErrInvalidSort   = errors.New("invalid sort")
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+// Sort is the order pages are in, e.g. {"field":"raised_amount","direction":"desc"}
+type Sort struct {
+	Field     string              `json:"field"`
+	Direction postgrest.Direction `json:"direction"`
+}
+
+// the order by id, oldest first
+var ByID = Sort{Field: tiebreak, Direction: postgrest.Asc}
+
+// parses a sort as JSON, the field has to be one of the allowed ones and
+// the direction defaults to ascending
+func ParseSort(raw string, allowed []string) (Sort, error) {
+	var s Sort
+	if err := json.Unmarshal([]byte(raw), &s); err != nil {
+		return Sort{}, fmt.Errorf("%w: %v", ErrInvalidSort, err)
+	}
+	if s.Direction == "" {
+		s.Direction = postgrest.Asc
+	}
+	if err := s.check(allowed); err != nil {
+		return Sort{}, err
+	}
+	return s, nil
+}
+
+func (s Sort) check(allowed []string) error {
+	if s.Field != tiebreak && !slices.Contains(allowed, s.Field) {
+		return fmt.Errorf("%w: can't sort by %q", ErrInvalidSort, s.Field)
+	}
+	if s.Direction != postgrest.Asc && s.Direction != postgrest.Desc {
+		return fmt.Errorf("%w: unknown direction %q", ErrInvalidSort, s.Direction)
+	}
+	return nil
+}
+
+// orders the query by the sort then id, or the other way round for reading
+// backwards from a cursor. Nulls sort after every value, last ascending and
+// first descending.
+func (s Sort) Order(q postgrest.Query, backwards bool) postgrest.Query {
+	direction := s.Direction
+	if backwards {
+		direction = flip(direction)
+	}
+	if s.Field != tiebreak {
+		nulls := postgrest.NullsLast
+		if direction == postgrest.Desc {
+			nulls = postgrest.NullsFirst
+		}
+		q = q.OrderNulls(s.Field, direction, nulls)
+	}
+	return q.Order(tiebreak, direction)
+}
+
+// Cursor points at the row a page starts after, or ends before
+type Cursor struct {
+	Sort   Sort    `json:"s"`
+	Value  *string `json:"v"` // the row's sort field, nil if it's null
+	ID     int64   `json:"i"`
+	Before bool    `json:"b,omitempty"`
+}
+
+// encodes the cursor for a URL, clients should treat it as opaque
+func (c Cursor) Encode() string {
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// decodes a cursor made by Encode, its sort has to be one of the allowed ones
+func Decode(s string, allowed []string) (Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+	var c Cursor
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+	if err := c.Sort.check(allowed); err != nil {
+		return Cursor{}, fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+	}
+	return c, nil
+}
+
+// narrows the query to the rows past the cursor's row and orders it the way
+// they're read, backwards for a cursor to the page before
+func (c Cursor) Apply(q postgrest.Query) postgrest.Query {
+	after, upwards := postgrest.Gt, true
+	if (c.Sort.Direction == postgrest.Desc) != c.Before {
+		after, upwards = postgrest.Lt, false
+	}
+	field, null := c.Sort.Field, postgrest.Is(c.Sort.Field, postgrest.Null)
+	switch {
+	case field == tiebreak:
+		q = q.Where(after(tiebreak, c.ID))
+	// nulls sort after every value, so past a null there are only nulls
+	// going up and every value going down
+	case c.Value == nil && upwards:
+		q = q.Where(null, after(tiebreak, c.ID))
+	case c.Value == nil:
+		q = q.Or(postgrest.Not(null), postgrest.And(null, after(tiebreak, c.ID)))
+	default:
+		past := []postgrest.Condition{
+			after(field, *c.Value),
+			postgrest.And(postgrest.Eq(field, *c.Value), after(tiebreak, c.ID)),
+		}
+		if upwards {
+			past = append(past, null)
+		}
+		q = q.Or(past...)
+	}
+	return c.Sort.Order(q, c.Before)
+}
+
+// Page is a page of rows and the cursors of the pages either side of it,
+// empty when there isn't one
+type Page[T any] struct {
+	Rows []T
+	Next string
+	Prev string
+}
+
+// makes the page from the rows read for it, up to limit+1 of them in the
+// order Apply (or Sort.Order for the first page) gives, so the extra row
+// shows whether there's more. key gets a row's sort field, nil if it's null,
+// and id.
+func Paginate[T any](rows []T, limit int, sort Sort, cursor *Cursor, key func(T) (*string, int64)) Page[T] {
+	more := len(rows) > limit
+	if more {
+		rows = rows[:limit]
+	}
+	backwards := cursor != nil && cursor.Before
+	if backwards {
+		slices.Reverse(rows)
+	}
+	page := Page[T]{Rows: rows}
+	if len(rows) == 0 {
+		return page
+	}
+
+	at := func(row T, before bool) string {
+		value, id := key(row)
+		return Cursor{Sort: sort, Value: value, ID: id, Before: before}.Encode()
+	}
+	// whichever way the page was read, there's one on the side it came from
+	if more || backwards {
+		page.Next = at(rows[len(rows)-1], false)
+	}
+	if more && backwards || cursor != nil && !backwards {
+		page.Prev = at(rows[0], true)
+	}
+	return page
+}
+
+func flip(d postgrest.Direction) postgrest.Direction {
+	if d == postgrest.Asc {
+		return postgrest.Desc
+	}
+	return postgrest.Asc
+}
@@ -0,0 +1,178 @@
+package pagination_test
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+	"strconv"
+	"testing"
+
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/pagination"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/postgrest"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/store"
+)
+
+var sortable = []string{"raised"}
+
+type test_row struct {
+	ID     int64  `json:"id"`
+	Raised *int64 `json:"raised"`
+}
+
+func key(r test_row) (*string, int64) {
+	if r.Raised == nil {
+		return nil, r.ID
+	}
+	value := strconv.FormatInt(*r.Raised, 10)
+	return &value, r.ID
+}
+
+// reads the page the cursor points to, or the first page without one
+func read_page(t *testing.T, db store.Store, sort pagination.Sort, cursor string) pagination.Page[test_row] {
+	t.Helper()
+	query := sort.Order(postgrest.New(), false)
+	var c *pagination.Cursor
+	if cursor != "" {
+		decoded, err := pagination.Decode(cursor, sortable)
+		if err != nil {
+			t.Fatalf("Decode failed: %v", err)
+		}
+		c = &decoded
+		query = c.Apply(postgrest.New())
+	}
+
+	body, err := db.Query("rows", query.Limit(3+1).String())
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	var rows []test_row
+	if err := json.Unmarshal(body, &rows); err != nil {
+		t.Fatalf("Failed to decode rows: %v", err)
+	}
+	return pagination.Paginate(rows, 3, sort, c, key)
+}
+
+func ids(rows []test_row) []int64 {
+	var out []int64
+	for _, r := range rows {
+		out = append(out, r.ID)
+	}
+	return out
+}
+
+func TestPagesForwardsAndBackwards(t *testing.T) {
+	db := store.NewMemory()
+	// ids 1 to 8, with ties so the order falls back to id: 5, 1, 8, 7, 3, 6, 4, 2
+	for _, raised := range []int64{50, 10, 30, 10, 50, 20, 30, 40} {
+		if _, err := db.Insert("rows", map[string]any{"raised": raised}); err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+	}
+	sort, err := pagination.ParseSort(`{"field":"raised","direction":"desc"}`, sortable)
+	if err != nil {
+		t.Fatalf("ParseSort failed: %v", err)
+	}
+
+	first := read_page(t, db, sort, "")
+	if got := ids(first.Rows); !slices.Equal(got, []int64{5, 1, 8}) || first.Prev != "" || first.Next == "" {
+		t.Fatalf("Expected the first page 5, 1, 8 with only a next cursor, got %v (prev %q)", got, first.Prev)
+	}
+
+	// a row added ahead of the cursor doesn't push rows onto the next page
+	if _, err := db.Insert("rows", map[string]any{"raised": 60}); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+
+	second := read_page(t, db, sort, first.Next)
+	if got := ids(second.Rows); !slices.Equal(got, []int64{7, 3, 6}) || second.Prev == "" || second.Next == "" {
+		t.Fatalf("Expected the second page 7, 3, 6 with both cursors, got %v", got)
+	}
+	last := read_page(t, db, sort, second.Next)
+	if got := ids(last.Rows); !slices.Equal(got, []int64{4, 2}) || last.Next != "" {
+		t.Fatalf("Expected the last page 4, 2 with no next cursor, got %v (next %q)", got, last.Next)
+	}
+
+	back := read_page(t, db, sort, last.Prev)
+	if got := ids(back.Rows); !slices.Equal(got, []int64{7, 3, 6}) || back.Next == "" || back.Prev == "" {
+		t.Fatalf("Expected to page back to 7, 3, 6, got %v", got)
+	}
+	front := read_page(t, db, sort, back.Prev)
+	if got := ids(front.Rows); !slices.Equal(got, []int64{5, 1, 8}) || front.Prev == "" {
+		t.Fatalf("Expected to page back to 5, 1, 8 with the new row before it, got %v", got)
+	}
+	newest := read_page(t, db, sort, front.Prev)
+	if got := ids(newest.Rows); !slices.Equal(got, []int64{9}) || newest.Prev != "" || newest.Next == "" {
+		t.Fatalf("Expected a page of just the new row, got %v (prev %q)", got, newest.Prev)
+	}
+}
+
+func TestPagesByID(t *testing.T) {
+	db := store.NewMemory()
+	for range 4 {
+		if _, err := db.Insert("rows", map[string]any{"raised": 0}); err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+	}
+	first := read_page(t, db, pagination.ByID, "")
+	second := read_page(t, db, pagination.ByID, first.Next)
+	if got := ids(second.Rows); !slices.Equal(got, []int64{4}) || second.Next != "" {
+		t.Errorf("Expected the second page 4, got %v", got)
+	}
+}
+
+func TestPagesOverNulls(t *testing.T) {
+	db := store.NewMemory()
+	for _, raised := range []any{nil, 10, nil, 20, 10, nil, 30} {
+		if _, err := db.Insert("rows", map[string]any{"raised": raised}); err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+	}
+
+	tests := []struct {
+		direction postgrest.Direction
+		want      []int64
+	}{
+		{postgrest.Asc, []int64{2, 5, 4, 7, 1, 3, 6}},
+		{postgrest.Desc, []int64{6, 3, 1, 7, 4, 5, 2}},
+	}
+	for _, tt := range tests {
+		sort := pagination.Sort{Field: "raised", Direction: tt.direction}
+
+		var forwards []int64
+		page := read_page(t, db, sort, "")
+		for {
+			forwards = append(forwards, ids(page.Rows)...)
+			if page.Next == "" || len(forwards) > len(tt.want) {
+				break
+			}
+			page = read_page(t, db, sort, page.Next)
+		}
+		if !slices.Equal(forwards, tt.want) {
+			t.Errorf("Expected %s pages %v, got %v", tt.direction, tt.want, forwards)
+		}
+
+		var backwards []int64
+		for page.Prev != "" && len(backwards) < len(tt.want) {
+			page = read_page(t, db, sort, page.Prev)
+			backwards = append(ids(page.Rows), backwards...)
+		}
+		if want := tt.want[:len(tt.want)-1]; !slices.Equal(backwards, want) {
+			t.Errorf("Expected %s pages back to %v, got %v", tt.direction, want, backwards)
+		}
+	}
+}
+
+func TestRejectsUnknownSorts(t *testing.T) {
+	for _, raw := range []string{`{"field":"password"}`, `{"field":"raised","direction":"up"}`, `raised`} {
+		if _, err := pagination.ParseSort(raw, sortable); !errors.Is(err, pagination.ErrInvalidSort) {
+			t.Errorf("Expected ErrInvalidSort for %s, got %v", raw, err)
+		}
+	}
+
+	forged := pagination.Cursor{Sort: pagination.Sort{Field: "password", Direction: postgrest.Asc}}.Encode()
+	for _, cursor := range []string{"not a cursor", forged} {
+		if _, err := pagination.Decode(cursor, sortable); !errors.Is(err, pagination.ErrInvalidCursor) {
+			t.Errorf("Expected ErrInvalidCursor for %q, got %v", cursor, err)
+		}
+	}
+}
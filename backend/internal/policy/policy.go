@@ -0,0 +1,148 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/lifecycle"
+	model "github.com/EmmaMartin123/Industrial_Project/backend/internal/model/common"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/model/database"
+)
+
+// the roles a profile can have
+const (
+	Business = "business"
+	Investor = "investor"
+	Admin    = "admin"
+)
+
+var ErrForbidden = errors.New("forbidden")
+
+// Subject is the user making a request
+type Subject struct {
+	UserID string
+	Role   string
+}
+
+// checks the user can create pitches
+func CanCreatePitch(s Subject) error {
+	return has_role(s, Business)
+}
+
+// checks the user can edit the pitch, its owner or an admin
+func CanEditPitch(s Subject, p database.Pitch) error {
+	if s.Role == Admin {
+		return nil
+	}
+	return owns_pitch(s, p)
+}
+
+// checks the user can delete the pitch, its owner or an admin
+func CanDeletePitch(s Subject, p database.Pitch) error {
+	return CanEditPitch(s, p)
+}
+
+// checks the user can change the pitch's status, returning who they are to
+// the lifecycle; the lifecycle then decides which transitions they may make
+func CanChangePitchStatus(s Subject, p database.Pitch) (lifecycle.Actor, error) {
+	if s.Role == Admin {
+		return lifecycle.Admin, nil
+	}
+	if err := owns_pitch(s, p); err != nil {
+		return "", err
+	}
+	return lifecycle.Owner, nil
+}
+
+// checks the user can see the profits declared on the pitch
+func CanViewProfits(s Subject, p database.Pitch) error {
+	if s.Role == Admin {
+		return nil
+	}
+	return owns_pitch(s, p)
+}
+
+// checks the user can declare profit on the pitch, only its owner can
+func CanDeclareProfit(s Subject, p database.Pitch) error {
+	return owns_pitch(s, p)
+}
+
+// checks the user can pay out the pitch's profit from their wallet
+func CanDistributeProfit(s Subject, p database.Pitch) error {
+	return owns_pitch(s, p)
+}
+
+// checks the user can resume the distribution run they started
+func CanResumeDistribution(s Subject, run model.DistributionRun) error {
+	if err := has_role(s, Business); err != nil {
+		return err
+	}
+	if run.BusinessID != s.UserID {
+		return fmt.Errorf("%w: you did not start this distribution", ErrForbidden)
+	}
+	return nil
+}
+
+// checks the user can use the admin moderation routes
+func CanModerate(s Subject) error {
+	return has_role(s, Admin)
+}
+
+// checks the user can read the audit entries about a record owned by the
+// owner, the owner or an admin
+func CanViewAudit(s Subject, owner string) error {
+	if s.Role == Admin {
+		return nil
+	}
+	if owner == "" || owner != s.UserID {
+		return fmt.Errorf("%w: you do not own this record", ErrForbidden)
+	}
+	return nil
+}
+
+// checks the user can invest
+func CanInvest(s Subject) error {
+	return has_role(s, Investor)
+}
+
+// checks the user can see their investments and portfolio
+func CanViewInvestments(s Subject) error {
+	return has_role(s, Investor)
+}
+
+// checks the user can see the investment, only the investor who made it can
+func CanViewInvestment(s Subject, inv model.Investment) error {
+	return owns_investment(s, inv)
+}
+
+// checks the user can refund the investment, only the investor who made it can
+func CanRefund(s Subject, inv model.Investment) error {
+	return owns_investment(s, inv)
+}
+
+func has_role(s Subject, role string) error {
+	if s.Role != role {
+		return fmt.Errorf("%w: only %s users can perform this action", ErrForbidden, role)
+	}
+	return nil
+}
+
+func owns_pitch(s Subject, p database.Pitch) error {
+	if err := has_role(s, Business); err != nil {
+		return err
+	}
+	if p.UserID != s.UserID {
+		return fmt.Errorf("%w: you do not own this pitch", ErrForbidden)
+	}
+	return nil
+}
+
+func owns_investment(s Subject, inv model.Investment) error {
+	if err := has_role(s, Investor); err != nil {
+		return err
+	}
+	if inv.InvestorID != s.UserID {
+		return fmt.Errorf("%w: you don't own this investment", ErrForbidden)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package policy
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/lifecycle"
+	model "github.com/EmmaMartin123/Industrial_Project/backend/internal/model/common"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/model/database"
+)
+
+var (
+	owner    = Subject{UserID: "business-1", Role: Business}
+	business = Subject{UserID: "business-2", Role: Business}
+	investor = Subject{UserID: "investor-1", Role: Investor}
+	other    = Subject{UserID: "investor-2", Role: Investor}
+	admin    = Subject{UserID: "admin-1", Role: Admin}
+	nobody   = Subject{UserID: "user-1"}
+
+	everyone = map[string]Subject{
+		"owner": owner, "business": business, "investor": investor,
+		"other investor": other, "admin": admin, "no role": nobody,
+	}
+)
+
+func TestPolicies(t *testing.T) {
+	pitch := database.Pitch{UserID: owner.UserID}
+	investment := model.Investment{InvestorID: investor.UserID}
+	run := model.DistributionRun{BusinessID: owner.UserID}
+
+	cases := []struct {
+		name    string
+		check   func(Subject) error
+		allowed []string
+	}{
+		{"CanCreatePitch", CanCreatePitch, []string{"owner", "business"}},
+		{"CanEditPitch", func(s Subject) error { return CanEditPitch(s, pitch) }, []string{"owner", "admin"}},
+		{"CanDeletePitch", func(s Subject) error { return CanDeletePitch(s, pitch) }, []string{"owner", "admin"}},
+		{"CanChangePitchStatus", func(s Subject) error { _, err := CanChangePitchStatus(s, pitch); return err }, []string{"owner", "admin"}},
+		{"CanViewProfits", func(s Subject) error { return CanViewProfits(s, pitch) }, []string{"owner", "admin"}},
+		{"CanDeclareProfit", func(s Subject) error { return CanDeclareProfit(s, pitch) }, []string{"owner"}},
+		{"CanDistributeProfit", func(s Subject) error { return CanDistributeProfit(s, pitch) }, []string{"owner"}},
+		{"CanResumeDistribution", func(s Subject) error { return CanResumeDistribution(s, run) }, []string{"owner"}},
+		{"CanModerate", CanModerate, []string{"admin"}},
+		{"CanViewAudit", func(s Subject) error { return CanViewAudit(s, owner.UserID) }, []string{"owner", "admin"}},
+		{"CanInvest", CanInvest, []string{"investor", "other investor"}},
+		{"CanViewInvestments", CanViewInvestments, []string{"investor", "other investor"}},
+		{"CanViewInvestment", func(s Subject) error { return CanViewInvestment(s, investment) }, []string{"investor"}},
+		{"CanRefund", func(s Subject) error { return CanRefund(s, investment) }, []string{"investor"}},
+	}
+
+	for _, c := range cases {
+		for name, s := range everyone {
+			allowed := false
+			for _, a := range c.allowed {
+				allowed = allowed || a == name
+			}
+			err := c.check(s)
+			switch {
+			case allowed && err != nil:
+				t.Errorf("%s: expected %s to be allowed, got %v", c.name, name, err)
+			case !allowed && !errors.Is(err, ErrForbidden):
+				t.Errorf("%s: expected %s to be forbidden, got %v", c.name, name, err)
+			}
+		}
+	}
+}
+
+func TestPitchStatusActor(t *testing.T) {
+	pitch := database.Pitch{UserID: owner.UserID}
+	if actor, _ := CanChangePitchStatus(owner, pitch); actor != lifecycle.Owner {
+		t.Errorf("Expected the owner to act as %s, got %s", lifecycle.Owner, actor)
+	}
+	if actor, _ := CanChangePitchStatus(admin, pitch); actor != lifecycle.Admin {
+		t.Errorf("Expected an admin to act as %s, got %s", lifecycle.Admin, actor)
+	}
+}
@@ -0,0 +1,372 @@
+// Package postgrest builds the query strings the data store takes, e.g.
+//
+//	postgrest.New().Eq("pitch_id", id).Is("refunded", postgrest.False).Order("id", postgrest.Asc)
+//
+// Every value is escaped, so an id or search term from a request can only
+// ever be compared against, never add filters of its own. Column names come
+// from the code and a malformed one panics like a bad regexp would.
+package postgrest
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Direction is the direction a column is ordered in
+type Direction string
+
+const (
+	Asc  Direction = "asc"
+	Desc Direction = "desc"
+)
+
+// Nulls is where an order puts nulls, by default postgres puts them last
+// ascending and first descending
+type Nulls string
+
+const (
+	NullsFirst Nulls = "nullsfirst"
+	NullsLast  Nulls = "nullslast"
+)
+
+// IsValue is a value compared with Is
+type IsValue string
+
+const (
+	Null  IsValue = "null"
+	True  IsValue = "true"
+	False IsValue = "false"
+)
+
+// a column, optionally on an embedded table, e.g. "profit_distributions.paid"
+var column_name = regexp.MustCompile(`^[a-z_][a-z0-9_]*(\.[a-z_][a-z0-9_]*)*$`)
+
+// an item of a select, e.g. "*", "id", "tier:investment_tier(name)"
+var select_item = regexp.MustCompile(`^(\*|([a-z_][a-z0-9_]*:)?[a-z_][a-z0-9_]*(![a-z_]+)?(\(.+\))?)$`)
+
+// Condition is a filter on one column, or an And group of them, used with
+// Where, Or and Not
+type Condition struct {
+	column string
+	op     string
+	value  string
+	list   []string    // the values of an in filter
+	all    []Condition // the conditions of an And group
+	negate bool
+}
+
+// the column equals the value
+func Eq(column string, value any) Condition { return condition(column, "eq", format(value)) }
+
+// the column doesn't equal the value
+func Neq(column string, value any) Condition { return condition(column, "neq", format(value)) }
+
+// the column is greater than the value
+func Gt(column string, value any) Condition { return condition(column, "gt", format(value)) }
+
+// the column is at least the value
+func Gte(column string, value any) Condition { return condition(column, "gte", format(value)) }
+
+// the column is less than the value
+func Lt(column string, value any) Condition { return condition(column, "lt", format(value)) }
+
+// the column is at most the value
+func Lte(column string, value any) Condition { return condition(column, "lte", format(value)) }
+
+// the column matches the pattern ignoring case, * matches anything. Build
+// patterns from user input with Contains so their wildcards are literal.
+func ILike(column string, pattern string) Condition { return condition(column, "ilike", pattern) }
+
+// the column is one of the values, no values matches nothing
+func In(column string, values ...any) Condition {
+	c := condition(column, "in", "")
+	c.list = make([]string, len(values))
+	for i, v := range values {
+		c.list[i] = format(v)
+	}
+	return c
+}
+
+// the column is null, true or false
+func Is(column string, value IsValue) Condition {
+	if value != Null && value != True && value != False {
+		panic(fmt.Sprintf("postgrest: invalid is value %q", value))
+	}
+	return condition(column, "is", string(value))
+}
+
+// the condition doesn't hold
+func Not(c Condition) Condition {
+	if c.all != nil {
+		panic("postgrest: an And group can't be negated")
+	}
+	c.negate = !c.negate
+	return c
+}
+
+// all of the conditions hold, e.g. as one of the alternatives of an Or
+func And(conditions ...Condition) Condition {
+	var all []Condition
+	for _, c := range conditions {
+		if c.all != nil {
+			all = append(all, c.all...)
+		} else {
+			all = append(all, c)
+		}
+	}
+	if len(all) == 0 {
+		panic("postgrest: an And group needs a condition")
+	}
+	return Condition{all: all}
+}
+
+// a pattern for ILike matching values that contain the term, with the
+// term's own wildcard characters matched literally
+func Contains(term string) string {
+	var b strings.Builder
+	b.WriteString("*")
+	for _, r := range term {
+		switch r {
+		case '*':
+			// PostgREST turns every * into a wildcard, so it can't be escaped
+			continue
+		case '%', '_', '\\':
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	b.WriteString("*")
+	return b.String()
+}
+
+func condition(column string, op string, value string) Condition {
+	if !column_name.MatchString(column) {
+		panic(fmt.Sprintf("postgrest: invalid column %q", column))
+	}
+	return Condition{column: column, op: op, value: value}
+}
+
+// the op and value as they follow the column, e.g. "not.eq.5". A value on
+// its own is read as is, in a list or or group it's quoted if it has to be.
+func (c Condition) operand(grouped bool) string {
+	value := c.value
+	switch {
+	case c.op == "in":
+		items := make([]string, len(c.list))
+		for i, item := range c.list {
+			items[i] = quote_if_needed(item)
+		}
+		value = "(" + strings.Join(items, ",") + ")"
+	case grouped:
+		value = quote_if_needed(value)
+	}
+
+	operand := c.op + "." + value
+	if c.negate {
+		operand = "not." + operand
+	}
+	return operand
+}
+
+// the condition as a term of an or or and group, e.g. "id.gt.5"
+func (c Condition) term() string {
+	if c.all != nil {
+		terms := make([]string, len(c.all))
+		for i, inner := range c.all {
+			terms[i] = inner.term()
+		}
+		return "and(" + strings.Join(terms, ",") + ")"
+	}
+	return c.column + "." + c.operand(true)
+}
+
+// Query is a PostgREST query string being built. Its methods return a new
+// query, so a shared base can be extended in different ways.
+type Query struct {
+	params []param
+}
+
+type param struct {
+	key   string
+	value string
+}
+
+// starts an empty query, which matches every row
+func New() Query {
+	return Query{}
+}
+
+// adds the conditions, a row has to meet all of them
+func (q Query) Where(conditions ...Condition) Query {
+	for _, c := range conditions {
+		if c.all != nil {
+			q = q.Where(c.all...)
+			continue
+		}
+		q = q.with(c.column, c.operand(false))
+	}
+	return q
+}
+
+// adds Eq(column, value)
+func (q Query) Eq(column string, value any) Query { return q.Where(Eq(column, value)) }
+
+// adds Neq(column, value)
+func (q Query) Neq(column string, value any) Query { return q.Where(Neq(column, value)) }
+
+// adds Gt(column, value)
+func (q Query) Gt(column string, value any) Query { return q.Where(Gt(column, value)) }
+
+// adds Gte(column, value)
+func (q Query) Gte(column string, value any) Query { return q.Where(Gte(column, value)) }
+
+// adds Lt(column, value)
+func (q Query) Lt(column string, value any) Query { return q.Where(Lt(column, value)) }
+
+// adds Lte(column, value)
+func (q Query) Lte(column string, value any) Query { return q.Where(Lte(column, value)) }
+
+// adds ILike(column, pattern)
+func (q Query) ILike(column string, pattern string) Query { return q.Where(ILike(column, pattern)) }
+
+// adds In(column, values...)
+func (q Query) In(column string, values ...any) Query { return q.Where(In(column, values...)) }
+
+// adds Is(column, value)
+func (q Query) Is(column string, value IsValue) Query { return q.Where(Is(column, value)) }
+
+// adds a group of conditions a row has to meet at least one of
+func (q Query) Or(conditions ...Condition) Query {
+	terms := make([]string, len(conditions))
+	for i, c := range conditions {
+		terms[i] = c.term()
+	}
+	return q.with("or", "("+strings.Join(terms, ",")+")")
+}
+
+// picks the columns returned, embedded tables are added with Embed
+func (q Query) Select(items ...string) Query {
+	for _, item := range items {
+		if !select_item.MatchString(item) {
+			panic(fmt.Sprintf("postgrest: invalid select item %q", item))
+		}
+	}
+	return q.with("select", strings.Join(items, ","))
+}
+
+// orders by the column, after any ordering already added
+func (q Query) Order(column string, direction Direction) Query {
+	return q.order(order_term(column, direction))
+}
+
+// orders by the column with its nulls first or last, after any ordering
+// already added
+func (q Query) OrderNulls(column string, direction Direction, nulls Nulls) Query {
+	if nulls != NullsFirst && nulls != NullsLast {
+		panic(fmt.Sprintf("postgrest: invalid nulls %q", nulls))
+	}
+	return q.order(order_term(column, direction) + "." + string(nulls))
+}
+
+func order_term(column string, direction Direction) string {
+	if !column_name.MatchString(column) {
+		panic(fmt.Sprintf("postgrest: invalid column %q", column))
+	}
+	if direction != Asc && direction != Desc {
+		panic(fmt.Sprintf("postgrest: invalid direction %q", direction))
+	}
+	return column + "." + string(direction)
+}
+
+func (q Query) order(term string) Query {
+	for i, p := range q.params {
+		if p.key == "order" {
+			params := slices.Clone(q.params)
+			params[i].value += "," + term
+			return Query{params: params}
+		}
+	}
+	return q.with("order", term)
+}
+
+// returns at most n rows
+func (q Query) Limit(n int) Query {
+	if n < 0 {
+		panic(fmt.Sprintf("postgrest: negative limit %d", n))
+	}
+	return q.set("limit", strconv.Itoa(n))
+}
+
+// skips the first n rows
+func (q Query) Offset(n int) Query {
+	if n < 0 {
+		panic(fmt.Sprintf("postgrest: negative offset %d", n))
+	}
+	return q.set("offset", strconv.Itoa(n))
+}
+
+// encodes the query for the URL, e.g. "pitch_id=eq.4&order=id.asc"
+func (q Query) String() string {
+	parts := make([]string, len(q.params))
+	for i, p := range q.params {
+		parts[i] = p.key + "=" + url.QueryEscape(p.value)
+	}
+	return strings.Join(parts, "&")
+}
+
+// a table nested in each row for Select, under the alias if it isn't empty
+func Embed(alias string, table string, items ...string) string {
+	if len(items) == 0 {
+		items = []string{"*"}
+	}
+	for _, item := range items {
+		if !select_item.MatchString(item) {
+			panic(fmt.Sprintf("postgrest: invalid select item %q", item))
+		}
+	}
+	embed := table + "(" + strings.Join(items, ",") + ")"
+	if alias != "" {
+		embed = alias + ":" + embed
+	}
+	return embed
+}
+
+// adds a parameter, leaving the query it was called on as it was
+func (q Query) with(key string, value string) Query {
+	return Query{params: append(slices.Clip(q.params), param{key: key, value: value})}
+}
+
+// adds a parameter that appears at most once, replacing any earlier value
+func (q Query) set(key string, value string) Query {
+	params := slices.DeleteFunc(slices.Clone(q.params), func(p param) bool { return p.key == key })
+	return Query{params: append(params, param{key: key, value: value})}
+}
+
+// formats a value the way PostgREST reads it
+func format(v any) string {
+	switch t := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return t
+	case fmt.Stringer:
+		return t.String()
+	default:
+		return fmt.Sprint(t)
+	}
+}
+
+// double quotes a value that contains characters PostgREST treats as syntax
+// inside lists and or groups, escaping quotes and backslashes
+func quote_if_needed(value string) string {
+	if !strings.ContainsAny(value, `,.:()"\ `) && value != "" {
+		return value
+	}
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `"`, `\"`)
+	return `"` + value + `"`
+}
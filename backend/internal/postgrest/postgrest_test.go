@@ -0,0 +1,142 @@
+package postgrest_test
+
+import (
+	"encoding/json"
+	"net/url"
+	"testing"
+
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/postgrest"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/store"
+)
+
+func TestEncodesQueries(t *testing.T) {
+	tests := []struct {
+		name  string
+		query postgrest.Query
+		want  string
+	}{
+		{"empty", postgrest.New(), ""},
+		{"filters", postgrest.New().Eq("pitch_id", 4).Is("refunded", postgrest.False), "pitch_id=eq.4&refunded=is.false"},
+		{"not", postgrest.New().Where(postgrest.Not(postgrest.Eq("status", "Draft"))), "status=not.eq.Draft"},
+		{"order", postgrest.New().Order("created_at", postgrest.Desc).Order("id", postgrest.Asc), "order=created_at.desc%2Cid.asc"},
+		{"nulls", postgrest.New().OrderNulls("investment_end_date", postgrest.Asc, postgrest.NullsLast).Order("id", postgrest.Asc), "order=investment_end_date.asc.nullslast%2Cid.asc"},
+		{"paging", postgrest.New().Limit(10).Offset(20).Limit(5), "offset=20&limit=5"},
+		{"in", postgrest.New().In("id", 1, 2, 3), "id=in.%281%2C2%2C3%29"},
+		{"empty in", postgrest.New().In("id"), "id=in.%28%29"},
+		{"select", postgrest.New().Select("id", postgrest.Embed("tier", "investment_tier", "name")), "select=id%2Ctier%3Ainvestment_tier%28name%29"},
+		{"value with &", postgrest.New().Eq("name", "a&b=c"), "name=eq.a%26b%3Dc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.query.String(); got != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestQuotesListsAndGroups(t *testing.T) {
+	got, _ := url.QueryUnescape(postgrest.New().In("name", "a,b", `say "hi"`, "plain").String())
+	if want := `name=in.("a,b","say \"hi\"",plain)`; got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+
+	got, _ = url.QueryUnescape(postgrest.New().Or(postgrest.Eq("name", "x),id.gt.(0"), postgrest.Is("email", postgrest.Null)).String())
+	if want := `or=(name.eq."x),id.gt.(0",email.is.null)`; got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+
+	got, _ = url.QueryUnescape(postgrest.New().Or(postgrest.Gt("raised", 5), postgrest.And(postgrest.Eq("raised", 5), postgrest.Gt("id", 3))).String())
+	if want := `or=(raised.gt.5,and(raised.eq.5,id.gt.3))`; got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
+
+func TestContainsEscapesWildcards(t *testing.T) {
+	if got, want := postgrest.Contains(`50%_off*\`), `*50\%\_off\\*`; got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
+
+func TestPanicsOnInvalidInput(t *testing.T) {
+	tests := map[string]func(){
+		"column":    func() { postgrest.Eq("id=eq.1&x", 1) },
+		"order":     func() { postgrest.New().Order("id", "sideways") },
+		"nulls":     func() { postgrest.New().OrderNulls("id", postgrest.Asc, "middle") },
+		"is":        func() { postgrest.Is("paid", "maybe") },
+		"limit":     func() { postgrest.New().Limit(-1) },
+		"select":    func() { postgrest.New().Select("id&x=1") },
+		"embed":     func() { postgrest.Embed("", "tier", "name)&x=(") },
+		"or column": func() { postgrest.New().Or(postgrest.Eq("a,b", 1)) },
+		"not and":   func() { postgrest.Not(postgrest.And(postgrest.Eq("id", 1))) },
+	}
+	for name, f := range tests {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("Expected a panic")
+				}
+			}()
+			f()
+		})
+	}
+}
+
+// values that try to add filters of their own only ever match themselves
+func TestValuesCannotInjectFilters(t *testing.T) {
+	db := store.NewMemory()
+	names := []string{"Bronze", "Silver", "Gold", "a,b", "50%", "5_0", "Goldfish"}
+	for _, name := range names {
+		if _, err := db.Insert("tier", map[string]any{"name": name}); err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+	}
+
+	match := func(q postgrest.Query) []string {
+		t.Helper()
+		body, err := db.Query("tier", q.String())
+		if err != nil {
+			t.Fatalf("Query %q failed: %v", q.String(), err)
+		}
+		var rows []struct {
+			Name string `json:"name"`
+		}
+		if err := json.Unmarshal(body, &rows); err != nil {
+			t.Fatalf("Failed to decode rows: %v", err)
+		}
+		var got []string
+		for _, r := range rows {
+			got = append(got, r.Name)
+		}
+		return got
+	}
+
+	tests := []struct {
+		name  string
+		query postgrest.Query
+		want  []string
+	}{
+		{"extra filter", postgrest.New().Eq("name", "Bronze&name=neq.x"), nil},
+		{"or breakout", postgrest.New().Or(postgrest.Eq("name", "x),name.neq.(x")), nil},
+		{"in breakout", postgrest.New().In("name", "x),name.neq.(x"), nil},
+		{"in with comma", postgrest.New().In("name", "a,b"), []string{"a,b"}},
+		{"contains percent", postgrest.New().ILike("name", postgrest.Contains("%")), []string{"50%"}},
+		{"contains underscore", postgrest.New().ILike("name", postgrest.Contains("_")), []string{"5_0"}},
+		{"contains star", postgrest.New().ILike("name", postgrest.Contains("*")), names},
+		{"contains", postgrest.New().ILike("name", postgrest.Contains("GOLD")), []string{"Gold", "Goldfish"}},
+		{"and group", postgrest.New().Or(postgrest.Eq("name", "Bronze"), postgrest.And(postgrest.ILike("name", postgrest.Contains("gold")), postgrest.Neq("name", "Gold"))), []string{"Bronze", "Goldfish"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := match(tt.query)
+			if len(got) != len(tt.want) {
+				t.Fatalf("Expected %v, got %v", tt.want, got)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("Expected %v, got %v", tt.want, got)
+				}
+			}
+		})
+	}
+}
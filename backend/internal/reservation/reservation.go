@@ -0,0 +1,243 @@
+package reservation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/lifecycle"
+	model "github.com/EmmaMartin123/Industrial_Project/backend/internal/model/common"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/postgrest"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/store"
+)
+
+// Every change to a pitch's raised amount first claims the pitch's next
+// version by inserting a pitch_reservations row, the (pitch_id, version) key is
+// unique so only one change can claim it. The pitch row is then moved to that
+// version with a compare-and-swap. Anyone who finds a claimed version the pitch
+// hasn't reached yet applies it themselves, so a crash between the two writes
+// never blocks the pitch or loses a reservation, and a claim is applied exactly
+// once.
+
+const (
+	reservationsTable = "pitch_reservations"
+	maxAttempts       = 20
+)
+
+var (
+	ErrOversubscribed = errors.New("investment would exceed pitch target amount")
+	ErrNotActive      = errors.New("pitch is no longer active")
+	ErrConflict       = errors.New("pitch changed concurrently, please retry")
+	ErrInvalidAmount  = errors.New("amount must be positive")
+)
+
+// Reservation is a claimed change to a pitch's raised amount
+type Reservation struct {
+	ID        *int64      `json:"id,omitempty"`
+	PitchID   int64       `json:"pitch_id"`
+	Version   int64       `json:"version"`
+	Reference string      `json:"reference"`
+	Amount    model.Money `json:"amount"`
+	CreatedAt string      `json:"created_at,omitempty"`
+}
+
+// the pitch columns a reservation reads
+type pitch struct {
+	ID           int64       `json:"id"`
+	TargetAmount model.Money `json:"target_amount"`
+	RaisedAmount model.Money `json:"raised_amount"`
+	Status       string      `json:"status"`
+	Version      *int64      `json:"version"`
+}
+
+func (p pitch) version() int64 {
+	if p.Version == nil {
+		return 0
+	}
+	return *p.Version
+}
+
+type Reservations struct {
+	db store.Store
+}
+
+func New(db store.Store) *Reservations {
+	return &Reservations{db: db}
+}
+
+// adds amount to the pitch's raised amount if the pitch is Active and it
+// stays within the target. Reserving the same reference again does nothing.
+func (r *Reservations) Reserve(pitchID int64, reference string, amount model.Money) error {
+	if !amount.IsPositive() {
+		return ErrInvalidAmount
+	}
+	return r.change(pitchID, reference, amount)
+}
+
+// takes amount back off the pitch's raised amount, e.g. for a refund.
+// Releasing the same reference again does nothing.
+func (r *Reservations) Release(pitchID int64, reference string, amount model.Money) error {
+	if !amount.IsPositive() {
+		return ErrInvalidAmount
+	}
+	return r.change(pitchID, reference, amount.Neg())
+}
+
+// checks whether a change with the reference has been claimed
+func (r *Reservations) Reserved(reference string) (bool, error) {
+	claim, err := r.byReference(reference)
+	return claim != nil, err
+}
+
+// moves the pitch from Active to Funded if it has reached its target, only
+// one caller ever sees true for a pitch
+func (r *Reservations) MarkFunded(pitchID int64) (bool, error) {
+	p, err := r.readPitch(pitchID)
+	if err != nil {
+		return false, err
+	}
+	current := lifecycle.Pitch{ID: p.ID, Status: lifecycle.State(p.Status), TargetAmount: p.TargetAmount, RaisedAmount: p.RaisedAmount}
+	if lifecycle.Check(current, lifecycle.Funded, lifecycle.System) != nil || current.Status == lifecycle.Funded {
+		return false, nil
+	}
+
+	// the raised amount is checked again so a release in between stops it
+	err = lifecycle.Apply(r.db, current, lifecycle.Funded, lifecycle.System, postgrest.Eq("raised_amount", p.TargetAmount))
+	if errors.Is(err, lifecycle.ErrStale) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to mark pitch funded: %w", err)
+	}
+	return true, nil
+}
+
+// claims the pitch's next version for the change and applies it
+func (r *Reservations) change(pitchID int64, reference string, delta model.Money) error {
+	if reference == "" {
+		return errors.New("a reference is required")
+	}
+
+	for range maxAttempts {
+		claim, err := r.byReference(reference)
+		if err != nil {
+			return err
+		}
+		p, err := r.readPitch(pitchID)
+		if err != nil {
+			return err
+		}
+
+		if claim != nil && p.version() >= claim.Version {
+			return nil
+		}
+
+		// finishes whichever claim is next, ours from a run that crashed before
+		// applying it or someone else's, before going any further
+		pending, err := r.atVersion(pitchID, p.version()+1)
+		if err != nil {
+			return err
+		}
+		if pending != nil {
+			if err := r.apply(p, pending); err != nil {
+				return err
+			}
+			if pending.Reference == reference {
+				return nil
+			}
+			continue
+		}
+		if claim != nil {
+			continue
+		}
+
+		raised := p.RaisedAmount.Add(delta)
+		if delta.IsPositive() {
+			if p.Status != string(lifecycle.Active) {
+				return ErrNotActive
+			}
+			if raised.Cmp(p.TargetAmount) > 0 {
+				return ErrOversubscribed
+			}
+		}
+		if raised.IsNegative() {
+			return fmt.Errorf("release of %s would leave pitch %d with a negative raised amount", delta.Neg(), pitchID)
+		}
+
+		next := &Reservation{
+			PitchID:   pitchID,
+			Version:   p.version() + 1,
+			Reference: reference,
+			Amount:    delta,
+		}
+		if _, err := r.db.Insert(reservationsTable, next); err != nil {
+			if errors.Is(err, store.ErrConflict) {
+				// another change claimed the version (or the reference) first
+				continue
+			}
+			return fmt.Errorf("failed to claim pitch version: %w", err)
+		}
+		return r.apply(p, next)
+	}
+	return ErrConflict
+}
+
+// moves the pitch from the version before the claim to the claim's version,
+// doing nothing if someone else already has
+func (r *Reservations) apply(p pitch, claim *Reservation) error {
+	if p.version() != claim.Version-1 {
+		return nil
+	}
+
+	condition := postgrest.New().Eq("id", p.ID).Eq("version", p.version())
+	if p.Version == nil {
+		condition = postgrest.New().Eq("id", p.ID).Is("version", postgrest.Null)
+	}
+	_, err := r.db.Update("pitch", condition.String(), map[string]any{
+		"raised_amount": p.RaisedAmount.Add(claim.Amount),
+		"version":       claim.Version,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update pitch raised amount: %w", err)
+	}
+	return nil
+}
+
+func (r *Reservations) readPitch(pitchID int64) (pitch, error) {
+	body, err := r.db.GetByID("pitch", strconv.FormatInt(pitchID, 10))
+	if err != nil {
+		return pitch{}, fmt.Errorf("error fetching pitch: %w", err)
+	}
+	var pitches []pitch
+	if err := json.Unmarshal(body, &pitches); err != nil {
+		return pitch{}, fmt.Errorf("error decoding pitch data: %w", err)
+	}
+	if len(pitches) != 1 {
+		return pitch{}, fmt.Errorf("pitch %d not found", pitchID)
+	}
+	return pitches[0], nil
+}
+
+func (r *Reservations) byReference(reference string) (*Reservation, error) {
+	return r.first(postgrest.New().Eq("reference", reference))
+}
+
+func (r *Reservations) atVersion(pitchID int64, version int64) (*Reservation, error) {
+	return r.first(postgrest.New().Eq("pitch_id", pitchID).Eq("version", version))
+}
+
+func (r *Reservations) first(query postgrest.Query) (*Reservation, error) {
+	body, err := r.db.Query(reservationsTable, query.Limit(1).String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch pitch reservations: %w", err)
+	}
+	var claims []Reservation
+	if err := json.Unmarshal(body, &claims); err != nil {
+		return nil, fmt.Errorf("failed to decode pitch reservations: %w", err)
+	}
+	if len(claims) == 0 {
+		return nil, nil
+	}
+	return &claims[0], nil
+}
@@ -0,0 +1,104 @@
+package reservation
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	model "github.com/EmmaMartin123/Industrial_Project/backend/internal/model/common"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/store"
+)
+
+func new_test_reservations(t *testing.T, target int64) (*Reservations, store.Store) {
+	t.Helper()
+	db := store.NewMemory()
+	if _, err := db.Insert("pitch", map[string]any{"title": "Test", "target_amount": target, "raised_amount": 0, "status": "Active"}); err != nil {
+		t.Fatalf("Failed to seed pitch: %v", err)
+	}
+	return New(db), db
+}
+
+func TestConcurrentReservationsNeverOversubscribe(t *testing.T) {
+	r, _ := new_test_reservations(t, 100)
+
+	var reserved, funded int64 // reserved in pence
+	var wg sync.WaitGroup
+	for i := range 30 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := r.Reserve(1, fmt.Sprintf("investor-%d", i), model.FromPence(1000))
+			switch {
+			case err == nil:
+				atomic.AddInt64(&reserved, 1000)
+				if ok, err := r.MarkFunded(1); err != nil {
+					t.Errorf("MarkFunded failed: %v", err)
+				} else if ok {
+					atomic.AddInt64(&funded, 1)
+				}
+			case errors.Is(err, ErrOversubscribed), errors.Is(err, ErrNotActive), errors.Is(err, ErrConflict):
+			default:
+				t.Errorf("Reserve failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	p, err := r.readPitch(1)
+	if err != nil {
+		t.Fatalf("Failed to read pitch: %v", err)
+	}
+	if p.RaisedAmount.Pence() != reserved {
+		t.Errorf("Raised amount %s does not match the %d pence reserved", p.RaisedAmount, reserved)
+	}
+	if p.RaisedAmount.Cmp(p.TargetAmount) > 0 {
+		t.Errorf("Raised amount %s exceeds target %s", p.RaisedAmount, p.TargetAmount)
+	}
+	if p.RaisedAmount == p.TargetAmount && (funded != 1 || p.Status != "Funded") {
+		t.Errorf("Expected exactly one Funded transition, got %d (status %s)", funded, p.Status)
+	}
+}
+
+func TestReserveIsIdempotent(t *testing.T) {
+	r, _ := new_test_reservations(t, 100)
+
+	for range 3 {
+		if err := r.Reserve(1, "saga:1", model.FromPounds(40)); err != nil {
+			t.Fatalf("Reserve failed: %v", err)
+		}
+	}
+	if err := r.Release(1, "refund:1", model.FromPounds(40)); err != nil {
+		t.Fatalf("Release failed: %v", err)
+	}
+	if err := r.Release(1, "refund:1", model.FromPounds(40)); err != nil {
+		t.Fatalf("Repeated release failed: %v", err)
+	}
+
+	p, _ := r.readPitch(1)
+	if !p.RaisedAmount.IsZero() || p.version() != 2 {
+		t.Errorf("Expected raised 0 at version 2, got %s at version %d", p.RaisedAmount, p.version())
+	}
+}
+
+func TestUnappliedClaimIsFinished(t *testing.T) {
+	r, db := new_test_reservations(t, 100)
+
+	// a claim left behind by a run that crashed before moving the pitch
+	if _, err := db.Insert(reservationsTable, Reservation{PitchID: 1, Version: 1, Reference: "saga:1", Amount: model.FromPounds(30)}); err != nil {
+		t.Fatalf("Failed to seed claim: %v", err)
+	}
+
+	if err := r.Reserve(1, "saga:2", model.FromPounds(70)); err != nil {
+		t.Fatalf("Reserve failed: %v", err)
+	}
+	if err := r.Reserve(1, "saga:3", model.FromPence(1)); !errors.Is(err, ErrOversubscribed) {
+		t.Errorf("Expected ErrOversubscribed once the crashed claim is applied, got %v", err)
+	}
+
+	p, _ := r.readPitch(1)
+	if p.RaisedAmount != model.FromPounds(100) || p.version() != 2 {
+		t.Errorf("Expected raised 100 at version 2, got %s at version %d", p.RaisedAmount, p.version())
+	}
+}
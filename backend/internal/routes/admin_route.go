@@ -0,0 +1,346 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/audit"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/lifecycle"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/logging"
+	model "github.com/EmmaMartin123/Industrial_Project/backend/internal/model/common"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/model/database"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/policy"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/postgrest"
+	utilsdb "github.com/EmmaMartin123/Industrial_Project/backend/internal/utils/db"
+)
+
+// the most users a search returns in one page
+const ADMIN_USERS_LIMIT = 100
+
+// the body every moderation action takes
+type moderation_request struct {
+	Reason string `json:"reason"`
+}
+
+// gets the admin making the request, writing the error response if the user
+// isn't one
+func (h *handler) admin(w http.ResponseWriter, r *http.Request) (policy.Subject, bool) {
+	subject, ok := h.subject(w, r)
+	if !ok {
+		return policy.Subject{}, false
+	}
+	if !authorize(w, policy.CanModerate(subject)) {
+		return policy.Subject{}, false
+	}
+	return subject, true
+}
+
+// lists users, optionally filtered by role and a search on their name or email
+func (h *handler) admin_users_route(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if _, ok := h.admin(w, r); !ok {
+		return
+	}
+
+	params := r.URL.Query()
+	limit := ADMIN_USERS_LIMIT
+	if s := params.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, ADMIN_USERS_LIMIT)
+	}
+	offset := 0
+	if s := params.Get("offset"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			http.Error(w, "Invalid offset", http.StatusBadRequest)
+			return
+		}
+		offset = n
+	}
+
+	query := postgrest.New().Order("id", postgrest.Asc).Limit(limit).Offset(offset)
+	if role := params.Get("role"); role != "" {
+		query = query.Eq("role", role)
+	}
+	if search := strings.TrimSpace(params.Get("search")); search != "" {
+		pattern := postgrest.Contains(search)
+		query = query.Or(postgrest.ILike("display_name", pattern), postgrest.ILike("email", pattern))
+	}
+
+	body, err := h.db.Query("profile", query.String())
+	if err != nil {
+		http.Error(w, "Failed to fetch profiles", http.StatusInternalServerError)
+		return
+	}
+	var profiles []model.Profile
+	if err := json.Unmarshal(body, &profiles); err != nil {
+		http.Error(w, "Invalid profile data", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(profiles)
+}
+
+// gets any user's profile, including their balance
+func (h *handler) admin_profile_route(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if _, ok := h.admin(w, r); !ok {
+		return
+	}
+
+	user_id := r.URL.Query().Get("id")
+	if user_id == "" {
+		http.Error(w, "User ID is required", http.StatusBadRequest)
+		return
+	}
+	profile, err := utilsdb.GetUserProfile(h.db, user_id)
+	if err != nil {
+		http.Error(w, "Profile not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(profile)
+}
+
+// suspends a pitch, remembering the state it was in so it can go back
+func (h *handler) admin_suspend_pitch_route(w http.ResponseWriter, r *http.Request) {
+	pitch, req, ok := h.read_moderated_pitch(w, r)
+	if !ok {
+		return
+	}
+
+	from := pitch.Status
+	err := lifecycle.ApplyWith(h.db, lifecycle.Of(pitch), lifecycle.Suspended, lifecycle.Admin, map[string]any{
+		"suspended_from":   from,
+		"suspended_reason": req.Reason,
+	})
+	if err != nil {
+		write_pitch_status_error(w, err)
+		return
+	}
+
+	h.record(r, audit.Entry{Action: AUDIT_SUSPEND_PITCH, TargetType: "pitch", TargetID: r.URL.Query().Get("id"), Reason: req.Reason},
+		map[string]string{"status": from},
+		map[string]string{"status": string(lifecycle.Suspended), "suspended_from": from})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Pitch suspended",
+	})
+}
+
+// puts a suspended pitch back in the state it was suspended from
+func (h *handler) admin_unsuspend_pitch_route(w http.ResponseWriter, r *http.Request) {
+	pitch, req, ok := h.read_moderated_pitch(w, r)
+	if !ok {
+		return
+	}
+
+	current := lifecycle.Of(pitch)
+	if current.Status != lifecycle.Suspended {
+		http.Error(w, "Pitch is not suspended", http.StatusConflict)
+		return
+	}
+	err := lifecycle.ApplyWith(h.db, current, current.SuspendedFrom, lifecycle.Admin, map[string]any{
+		"suspended_from":   nil,
+		"suspended_reason": nil,
+	})
+	if err != nil {
+		write_pitch_status_error(w, err)
+		return
+	}
+
+	h.record(r, audit.Entry{Action: AUDIT_UNSUSPEND_PITCH, TargetType: "pitch", TargetID: r.URL.Query().Get("id"), Reason: req.Reason},
+		map[string]string{"status": string(lifecycle.Suspended), "suspended_from": string(current.SuspendedFrom)},
+		map[string]string{"status": string(current.SuspendedFrom)})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Pitch unsuspended",
+	})
+}
+
+// refunds every investment still held by a pitch, whatever state it is in
+func (h *handler) admin_refund_pitch_route(w http.ResponseWriter, r *http.Request) {
+	pitch, req, ok := h.read_moderated_pitch(w, r)
+	if !ok {
+		return
+	}
+
+	refunded, err := h.refund_pitch(r.Context(), *pitch.PitchID)
+	h.record(r, audit.Entry{Action: AUDIT_REFUND_PITCH, TargetType: "pitch", TargetID: r.URL.Query().Get("id"), Reason: req.Reason},
+		map[string]any{"raised_amount": pitch.RaisedAmount},
+		map[string]any{"refunded": refunded, "complete": err == nil})
+	if err != nil {
+		logging.FromContext(r.Context()).Warn("failed to refund pitch", "pitch_id", *pitch.PitchID, "err", err)
+		http.Error(w, "Failed to refund every investment, retry to refund the rest", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"refunded": refunded})
+}
+
+// freezes or unfreezes a user's wallet. A frozen wallet can't deposit,
+// withdraw, invest or pay out profit but still receives refunds and payouts.
+func (h *handler) admin_wallet_route(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPatch {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if _, ok := h.admin(w, r); !ok {
+		return
+	}
+
+	user_id := r.URL.Query().Get("user_id")
+	if user_id == "" {
+		http.Error(w, "User ID is required", http.StatusBadRequest)
+		return
+	}
+	var req struct {
+		Frozen *bool  `json:"frozen"`
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.Frozen == nil || strings.TrimSpace(req.Reason) == "" {
+		http.Error(w, "frozen and reason are required", http.StatusBadRequest)
+		return
+	}
+
+	before, err := utilsdb.GetUserProfile(h.db, user_id)
+	if err != nil {
+		http.Error(w, "Profile not found", http.StatusNotFound)
+		return
+	}
+	body, err := h.db.UpdateByID("profile", user_id, map[string]any{"wallet_frozen": *req.Frozen})
+	if err != nil {
+		http.Error(w, "Failed to update wallet", http.StatusInternalServerError)
+		return
+	}
+	var profiles []model.Profile
+	if err := json.Unmarshal(body, &profiles); err != nil || len(profiles) != 1 {
+		http.Error(w, "Profile not found", http.StatusNotFound)
+		return
+	}
+
+	action := AUDIT_FREEZE_WALLET
+	if !*req.Frozen {
+		action = AUDIT_UNFREEZE_WALLET
+	}
+	h.record(r, audit.Entry{Action: action, TargetType: "profile", TargetID: user_id, Reason: req.Reason},
+		map[string]bool{"wallet_frozen": before.WalletFrozen},
+		map[string]bool{"wallet_frozen": profiles[0].WalletFrozen})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(profiles[0])
+}
+
+// changes a user's role, the only way a user becomes an admin
+func (h *handler) admin_role_route(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPatch {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if _, ok := h.admin(w, r); !ok {
+		return
+	}
+
+	user_id := r.URL.Query().Get("user_id")
+	if user_id == "" {
+		http.Error(w, "User ID is required", http.StatusBadRequest)
+		return
+	}
+	var req struct {
+		Role   string `json:"role"`
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.Role == "" || strings.TrimSpace(req.Reason) == "" {
+		http.Error(w, "role and reason are required", http.StatusBadRequest)
+		return
+	}
+	if req.Role != policy.Investor && req.Role != policy.Business && req.Role != policy.Admin {
+		http.Error(w, "Invalid role", http.StatusBadRequest)
+		return
+	}
+
+	before, err := utilsdb.GetUserProfile(h.db, user_id)
+	if err != nil {
+		http.Error(w, "Profile not found", http.StatusNotFound)
+		return
+	}
+	body, err := h.db.UpdateByID("profile", user_id, map[string]any{"role": req.Role})
+	if err != nil {
+		http.Error(w, "Failed to update role", http.StatusInternalServerError)
+		return
+	}
+	var profiles []model.Profile
+	if err := json.Unmarshal(body, &profiles); err != nil || len(profiles) != 1 {
+		http.Error(w, "Profile not found", http.StatusNotFound)
+		return
+	}
+
+	h.record(r, audit.Entry{Action: AUDIT_CHANGE_ROLE, TargetType: "profile", TargetID: user_id, Reason: req.Reason},
+		map[string]string{"role": before.Role},
+		map[string]string{"role": profiles[0].Role})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(profiles[0])
+}
+
+// reads the pitch and reason for a moderation action on a pitch, writing the
+// error response if the request can't go ahead
+func (h *handler) read_moderated_pitch(w http.ResponseWriter, r *http.Request) (database.Pitch, moderation_request, bool) {
+	var req moderation_request
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return database.Pitch{}, req, false
+	}
+	if _, ok := h.admin(w, r); !ok {
+		return database.Pitch{}, req, false
+	}
+
+	pitch_id := r.URL.Query().Get("id")
+	if _, err := strconv.ParseInt(pitch_id, 10, 64); err != nil {
+		http.Error(w, "Invalid pitch ID", http.StatusBadRequest)
+		return database.Pitch{}, req, false
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return database.Pitch{}, req, false
+	}
+	if strings.TrimSpace(req.Reason) == "" {
+		http.Error(w, "reason is required", http.StatusBadRequest)
+		return database.Pitch{}, req, false
+	}
+
+	body, err := h.db.GetByID("pitch", pitch_id)
+	if err != nil {
+		http.Error(w, "Pitch not found", http.StatusNotFound)
+		return database.Pitch{}, req, false
+	}
+	var pitches []database.Pitch
+	if err := json.Unmarshal(body, &pitches); err != nil || len(pitches) != 1 || pitches[0].PitchID == nil {
+		http.Error(w, "Pitch not found", http.StatusNotFound)
+		return database.Pitch{}, req, false
+	}
+	return pitches[0], req, true
+}
@@ -0,0 +1,183 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/audit"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/logging"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/policy"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/utils"
+)
+
+// the actions written to the audit log
+const (
+	AUDIT_CREATE_PITCH        = "create_pitch"
+	AUDIT_UPDATE_PITCH        = "update_pitch"
+	AUDIT_DELETE_PITCH        = "delete_pitch"
+	AUDIT_CHANGE_PITCH_STATUS = "change_pitch_status"
+	AUDIT_CREATE_PROFILE      = "create_profile"
+	AUDIT_UPDATE_PROFILE      = "update_profile"
+	AUDIT_CREATE_INVESTMENT   = "create_investment"
+	AUDIT_REFUND_INVESTMENT   = "refund_investment"
+	AUDIT_DEPOSIT             = "deposit"
+	AUDIT_WITHDRAW            = "withdraw"
+	AUDIT_CREATE_BANK         = "create_bank_account"
+	AUDIT_UPDATE_BANK         = "update_bank_balance"
+	AUDIT_DECLARE_PROFIT      = "declare_profit"
+	AUDIT_DISTRIBUTE_PROFIT   = "distribute_profit"
+	AUDIT_RESUME_DISTRIBUTION = "resume_distribution"
+	AUDIT_SUSPEND_PITCH       = "suspend_pitch"
+	AUDIT_UNSUSPEND_PITCH     = "unsuspend_pitch"
+	AUDIT_REFUND_PITCH        = "refund_pitch"
+	AUDIT_FREEZE_WALLET       = "freeze_wallet"
+	AUDIT_UNFREEZE_WALLET     = "unfreeze_wallet"
+	AUDIT_CHANGE_ROLE         = "change_role"
+)
+
+// the column holding the owner of each table an audit entry can target, the
+// owner can read the entries about their rows
+var audit_owner_columns = map[string]string{
+	"pitch":             "user_id",
+	"investments":       "investor_id",
+	"profile":           "id",
+	"bank_account":      "user_id",
+	"profits":           "declared_by",
+	"distribution_runs": "business_id",
+}
+
+// the most entries a query returns in one page
+const AUDIT_LIMIT = 100
+
+// writes a change made by the request to the audit log. The change has
+// already happened so a failure is only logged.
+func (h *handler) record(r *http.Request, e audit.Entry, before any, after any) {
+	e.ActorID, _ = utils.UserIDFromCtx(r.Context())
+	e.RequestID = utils.RequestIDFromCtx(r.Context())
+	if err := h.audit.Record(e, before, after); err != nil {
+		logging.FromContext(r.Context()).Warn("failed to write audit entry", "action", e.Action, "target_type", e.TargetType, "target_id", e.TargetID, "err", err)
+	}
+}
+
+// writes a change the scheduler made to the audit log under the scheduler's
+// actor, a failure is only logged like record
+func (h *handler) record_system(ctx context.Context, e audit.Entry, before any, after any) {
+	e.ActorID = audit.SchedulerActor
+	if err := h.audit.Record(e, before, after); err != nil {
+		logging.FromContext(ctx).Warn("failed to write audit entry", "action", e.Action, "target_type", e.TargetType, "target_id", e.TargetID, "err", err)
+	}
+}
+
+// gets audit entries. Admins can query any entries, everyone else can query
+// the entries about a record they own or, with no record given, their own
+// actions.
+func (h *handler) audit_route(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	subject, ok := h.subject(w, r)
+	if !ok {
+		return
+	}
+
+	params := r.URL.Query()
+	filter := audit.Filter{
+		ActorID:    params.Get("actor_id"),
+		TargetType: params.Get("target_type"),
+		TargetID:   params.Get("target_id"),
+		Limit:      AUDIT_LIMIT,
+	}
+	if s := params.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		filter.Limit = min(n, AUDIT_LIMIT)
+	}
+	if s := params.Get("offset"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			http.Error(w, "Invalid offset", http.StatusBadRequest)
+			return
+		}
+		filter.Offset = n
+	}
+	if (filter.TargetType == "") != (filter.TargetID == "") {
+		http.Error(w, "target_type and target_id must be given together", http.StatusBadRequest)
+		return
+	}
+
+	if subject.Role != policy.Admin {
+		if filter.TargetType == "" {
+			if filter.ActorID != "" && filter.ActorID != subject.UserID {
+				authorize(w, policy.CanViewAudit(subject, filter.ActorID))
+				return
+			}
+			filter.ActorID = subject.UserID
+		} else {
+			owner, err := h.audit_target_owner(filter.TargetType, filter.TargetID)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			if !authorize(w, policy.CanViewAudit(subject, owner)) {
+				return
+			}
+		}
+	}
+
+	entries, err := h.audit.Query(filter)
+	if err != nil {
+		http.Error(w, "Failed to fetch audit log", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+// walks the audit chain and reports whether it is intact, admins only
+func (h *handler) audit_verify_route(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if _, ok := h.admin(w, r); !ok {
+		return
+	}
+
+	checked, err := h.audit.Verify()
+	if err != nil && !errors.Is(err, audit.ErrTampered) {
+		http.Error(w, "Failed to verify audit log", http.StatusInternalServerError)
+		return
+	}
+	response := map[string]any{"intact": err == nil, "checked": checked}
+	if err != nil {
+		response["error"] = err.Error()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// gets the user who owns the record an audit query is about
+func (h *handler) audit_target_owner(target_type string, target_id string) (string, error) {
+	column, ok := audit_owner_columns[target_type]
+	if !ok {
+		return "", fmt.Errorf("unknown target_type %q", target_type)
+	}
+	body, err := h.db.GetByID(target_type, target_id)
+	if err != nil {
+		return "", fmt.Errorf("%s %s not found", target_type, target_id)
+	}
+	var rows []map[string]any
+	if err := json.Unmarshal(body, &rows); err != nil || len(rows) != 1 {
+		return "", fmt.Errorf("%s %s not found", target_type, target_id)
+	}
+	owner, _ := rows[0][column].(string)
+	return owner, nil
+}
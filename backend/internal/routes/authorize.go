@@ -0,0 +1,45 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/policy"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/utils"
+	utilsdb "github.com/EmmaMartin123/Industrial_Project/backend/internal/utils/db"
+)
+
+// gets the user making the request and their role, writing the error
+// response if there isn't one
+func (h *handler) subject(w http.ResponseWriter, r *http.Request) (policy.Subject, bool) {
+	user_id, ok := utils.UserIDFromCtx(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return policy.Subject{}, false
+	}
+
+	profile, err := utilsdb.GetUserProfile(h.db, user_id)
+	if err != nil {
+		if err.Error() == "user profile not found" {
+			http.Error(w, "User profile not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Error fetching user profile", http.StatusInternalServerError)
+		}
+		return policy.Subject{}, false
+	}
+	return policy.Subject{UserID: user_id, Role: profile.Role}, true
+}
+
+// writes the response for a policy that refused the request, reporting
+// whether the request may go ahead
+func authorize(w http.ResponseWriter, err error) bool {
+	if err == nil {
+		return true
+	}
+	if errors.Is(err, policy.ErrForbidden) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+	} else {
+		http.Error(w, "Failed to authorize request", http.StatusInternalServerError)
+	}
+	return false
+}
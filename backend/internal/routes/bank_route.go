@@ -2,27 +2,29 @@ package routes
 
 import (
 	"encoding/json"
-	"fmt"
 	"net/http"
 
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/audit"
+	model "github.com/EmmaMartin123/Industrial_Project/backend/internal/model/common"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/postgrest"
 	"github.com/EmmaMartin123/Industrial_Project/backend/internal/utils"
 )
 
-func bank_route(w http.ResponseWriter, r *http.Request) {
+func (h *handler) bank_route(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
-		get_bank_route(w, r)
+		h.get_bank_route(w, r)
 	case http.MethodPost:
-		create_bank_route(w, r)
+		h.create_bank_route(w, r)
 	case http.MethodPatch:
-		patch_bank_route(w, r)
+		h.patch_bank_route(w, r)
 	default:
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 	}
 }
 
 // gets the bank account for the user
-func get_bank_route(w http.ResponseWriter, r *http.Request) {
+func (h *handler) get_bank_route(w http.ResponseWriter, r *http.Request) {
 	user_id, ok := utils.UserIDFromCtx(r.Context())
 	if !ok {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
@@ -30,20 +32,20 @@ func get_bank_route(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// gets the bank account for the user
-	query := fmt.Sprintf("user_id=eq.%s", user_id)
-	body, err := utils.GetDataByQuery("bank_account", query)
+	query := postgrest.New().Eq("user_id", user_id)
+	body, err := h.db.Query("bank_account", query.String())
 	if err != nil {
 		http.Error(w, "No linked bank account", http.StatusNotFound)
 		return
 	}
 	var accounts []struct {
-		ID                string `json:"id"`
-		AccountHolderName string `json:"account_holder_name"`
-		SortCode          string `json:"sort_code"`
-		AccountNumber     string `json:"account_number"`
-		Balance           int64  `json:"balance"`
-		CreatedAt         string `json:"created_at"`
-		UpdatedAt         string `json:"updated_at"`
+		ID                string      `json:"id"`
+		AccountHolderName string      `json:"account_holder_name"`
+		SortCode          string      `json:"sort_code"`
+		AccountNumber     string      `json:"account_number"`
+		Balance           model.Money `json:"balance"`
+		CreatedAt         string      `json:"created_at"`
+		UpdatedAt         string      `json:"updated_at"`
 	}
 	if err := json.Unmarshal(body, &accounts); err != nil || len(accounts) == 0 {
 		http.Error(w, "Invalid bank account data", http.StatusInternalServerError)
@@ -54,17 +56,17 @@ func get_bank_route(w http.ResponseWriter, r *http.Request) {
 }
 
 // creates the bank account for the user
-func create_bank_route(w http.ResponseWriter, r *http.Request) {
+func (h *handler) create_bank_route(w http.ResponseWriter, r *http.Request) {
 	user_id, ok := utils.UserIDFromCtx(r.Context())
 	if !ok {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 	var req struct {
-		AccountHolderName string `json:"account_holder_name"`
-		SortCode          string `json:"sort_code"`
-		AccountNumber     string `json:"account_number"`
-		Balance           int64  `json:"balance"`
+		AccountHolderName string      `json:"account_holder_name"`
+		SortCode          string      `json:"sort_code"`
+		AccountNumber     string      `json:"account_number"`
+		Balance           model.Money `json:"balance"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid JSON", http.StatusBadRequest)
@@ -74,7 +76,7 @@ func create_bank_route(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "account_holder_name, sort_code, and account_number are required", http.StatusBadRequest)
 		return
 	}
-	if req.Balance < 0 {
+	if req.Balance.IsNegative() {
 		http.Error(w, "Balance must be non-negative", http.StatusBadRequest)
 		return
 	}
@@ -85,31 +87,33 @@ func create_bank_route(w http.ResponseWriter, r *http.Request) {
 		"account_number":      req.AccountNumber,
 		"balance":             req.Balance,
 	}
-	result, err := utils.InsertData(payload, "bank_account")
+	result, err := h.db.Insert("bank_account", payload)
 	if err != nil {
 		http.Error(w, "Failed to create bank account", http.StatusInternalServerError)
 		return
 	}
 	var created []struct {
-		ID                string `json:"id"`
-		AccountHolderName string `json:"account_holder_name"`
-		SortCode          string `json:"sort_code"`
-		AccountNumber     string `json:"account_number"`
-		Balance           int64  `json:"balance"`
-		CreatedAt         string `json:"created_at"`
-		UpdatedAt         string `json:"updated_at"`
+		ID                string      `json:"id"`
+		AccountHolderName string      `json:"account_holder_name"`
+		SortCode          string      `json:"sort_code"`
+		AccountNumber     string      `json:"account_number"`
+		Balance           model.Money `json:"balance"`
+		CreatedAt         string      `json:"created_at"`
+		UpdatedAt         string      `json:"updated_at"`
 	}
 	if err := json.Unmarshal([]byte(result), &created); err != nil || len(created) != 1 {
 		http.Error(w, "Invalid bank account creation response", http.StatusInternalServerError)
 		return
 	}
+	h.record(r, audit.Entry{Action: AUDIT_CREATE_BANK, TargetType: "bank_account", TargetID: created[0].ID}, nil, created[0])
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(created[0])
 }
 
 // updates the bank account for the user
-func patch_bank_route(w http.ResponseWriter, r *http.Request) {
+func (h *handler) patch_bank_route(w http.ResponseWriter, r *http.Request) {
 	user_id, ok := utils.UserIDFromCtx(r.Context())
 	if !ok {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
@@ -117,15 +121,15 @@ func patch_bank_route(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// gets the bank account for the user
-	query := fmt.Sprintf("user_id=eq.%s", user_id)
-	body, err := utils.GetDataByQuery("bank_account", query)
+	query := postgrest.New().Eq("user_id", user_id)
+	body, err := h.db.Query("bank_account", query.String())
 	if err != nil {
 		http.Error(w, "No linked bank account", http.StatusNotFound)
 		return
 	}
 	var accounts []struct {
-		ID      string `json:"id"`
-		Balance int64  `json:"balance"`
+		ID      string      `json:"id"`
+		Balance model.Money `json:"balance"`
 	}
 	if err := json.Unmarshal(body, &accounts); err != nil || len(accounts) == 0 {
 		http.Error(w, "Invalid bank account data", http.StatusNotFound)
@@ -134,24 +138,28 @@ func patch_bank_route(w http.ResponseWriter, r *http.Request) {
 
 	bank := accounts[0]
 	var req struct {
-		Balance int64 `json:"balance"`
+		Balance model.Money `json:"balance"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid JSON", http.StatusBadRequest)
 		return
 	}
-	if req.Balance < 0 {
+	if req.Balance.IsNegative() {
 		http.Error(w, "Balance must be non-negative", http.StatusBadRequest)
 		return
 	}
 
 	// updates the bank account for the user
 	payload := map[string]interface{}{"balance": req.Balance}
-	_, err = utils.UpdateByID("bank_account", bank.ID, payload)
+	_, err = h.db.UpdateByID("bank_account", bank.ID, payload)
 	if err != nil {
 		http.Error(w, "Failed to update bank balance", http.StatusInternalServerError)
 		return
 	}
+	h.record(r, audit.Entry{Action: AUDIT_UPDATE_BANK, TargetType: "bank_account", TargetID: bank.ID},
+		map[string]model.Money{"balance": bank.Balance},
+		map[string]model.Money{"balance": req.Balance})
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]int64{"balance": req.Balance})
+	json.NewEncoder(w).Encode(map[string]model.Money{"balance": req.Balance})
 }
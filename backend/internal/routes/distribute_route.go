@@ -1,39 +1,51 @@
 package routes
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"math"
 	"net/http"
 	"strconv"
-
+	"time"
+
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/allocation"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/audit"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/ledger"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/lifecycle"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/logging"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/metrics"
 	model "github.com/EmmaMartin123/Industrial_Project/backend/internal/model/common"
 	"github.com/EmmaMartin123/Industrial_Project/backend/internal/model/database"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/policy"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/postgrest"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/store"
 	"github.com/EmmaMartin123/Industrial_Project/backend/internal/utils"
-	utilsdb "github.com/EmmaMartin123/Industrial_Project/backend/internal/utils/db"
 )
 
-func distribute_route(w http.ResponseWriter, r *http.Request) {
+func (h *handler) distribute_route(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
-		get_distribute_route(w, r)
+		h.get_distribute_route(w, r)
 	case http.MethodPost:
-		post_distribute_route(w, r)
+		h.post_distribute_route(w, r)
 	default:
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 	}
 }
 
 // gets the profit distributions for the user
-func get_distribute_route(w http.ResponseWriter, r *http.Request) {
+func (h *handler) get_distribute_route(w http.ResponseWriter, r *http.Request) {
 	user_id, ok := utils.UserIDFromCtx(r.Context())
 	if !ok {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 
-	query := "investor_id=eq." + user_id
-	body, err := utils.GetDataByQuery("profit_distributions", query)
+	query := postgrest.New().Eq("investor_id", user_id)
+	body, err := h.db.Query("profit_distributions", query.String())
 	if err != nil {
 		http.Error(w, "Failed to fetch profit distributions", http.StatusInternalServerError)
 		return
@@ -50,28 +62,27 @@ func get_distribute_route(w http.ResponseWriter, r *http.Request) {
 }
 
 // distributes the profit to the investors
-func post_distribute_route(w http.ResponseWriter, r *http.Request) {
+func (h *handler) post_distribute_route(w http.ResponseWriter, r *http.Request) {
 	profit_id_str := r.URL.Query().Get("profit_id")
 	if profit_id_str == "" {
 		http.Error(w, "profit_id is required", http.StatusBadRequest)
 		return
 	}
 
-	profit_id, err := strconv.ParseInt(profit_id_str, 10, 64)
-	if err != nil {
+	if _, err := strconv.ParseInt(profit_id_str, 10, 64); err != nil {
 		http.Error(w, "invalid profit_id", http.StatusBadRequest)
 		return
 	}
 
-	// gets the user id from the context
-	user_id, ok := utils.UserIDFromCtx(r.Context())
+	// gets the user making the request
+	subject, ok := h.subject(w, r)
 	if !ok {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
+	user_id := subject.UserID
 
 	// gets the profit for the user
-	profit_body, err := utils.GetDataByID("profits", profit_id_str)
+	profit_body, err := h.db.GetByID("profits", profit_id_str)
 	if err != nil {
 		http.Error(w, "Profit not found", http.StatusNotFound)
 		return
@@ -89,7 +100,7 @@ func post_distribute_route(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// gets the pitch for the user
-	pitch_body, err := utils.GetDataByID("pitch", strconv.FormatInt(profit.PitchID, 10))
+	pitch_body, err := h.db.GetByID("pitch", strconv.FormatInt(profit.PitchID, 10))
 	if err != nil {
 		http.Error(w, "Pitch not found", http.StatusNotFound)
 		return
@@ -101,18 +112,18 @@ func post_distribute_route(w http.ResponseWriter, r *http.Request) {
 	}
 	pitch := pitches[0]
 
-	if pitch.UserID != user_id {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	if !authorize(w, policy.CanDistributeProfit(subject, pitch)) {
 		return
 	}
 
-	if ok, _ := utilsdb.CheckUserRole(w, user_id, "business"); !ok {
-		http.Error(w, "Only businesses can distribute profit", http.StatusUnauthorized)
+	// only declared profit is paid out
+	if err := lifecycle.Check(lifecycle.Of(pitch), lifecycle.Distributed, lifecycle.System); err != nil {
+		write_pitch_status_error(w, err)
 		return
 	}
 
 	// gets the profile for the user
-	profile_body, err := utils.GetDataByID("profile", user_id)
+	profile_body, err := h.db.GetByID("profile", user_id)
 	if err != nil {
 		http.Error(w, "Business profile not found", http.StatusNotFound)
 		return
@@ -129,14 +140,19 @@ func post_distribute_route(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if *business_profile.DashboardBalance < int64(profit.DistributableAmount) {
+	if business_profile.WalletFrozen {
+		http.Error(w, "Wallet is frozen", http.StatusForbidden)
+		return
+	}
+
+	if business_profile.DashboardBalance.Cmp(profit.DistributableAmount) < 0 {
 		http.Error(w, "Insufficient dashboard balance to distribute profit", http.StatusPaymentRequired)
 		return
 	}
 
 	// gets the investments for the user
-	investment_query := fmt.Sprintf("pitch_id=eq.%d&refunded=is.false", profit.PitchID)
-	investment_body, err := utils.GetDataByQuery("investments", investment_query)
+	investment_query := postgrest.New().Eq("pitch_id", profit.PitchID).Is("refunded", postgrest.False)
+	investment_body, err := h.db.Query("investments", investment_query.String())
 	if err != nil {
 		http.Error(w, "Failed to fetch investments", http.StatusInternalServerError)
 		return
@@ -153,8 +169,8 @@ func post_distribute_route(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// gets the investment tiers for the user
-	tier_query := fmt.Sprintf("pitch_id=eq.%d", profit.PitchID)
-	tier_body, err := utils.GetDataByQuery("investment_tier", tier_query)
+	tier_query := postgrest.New().Eq("pitch_id", profit.PitchID)
+	tier_body, err := h.db.Query("investment_tier", tier_query.String())
 	if err != nil {
 		http.Error(w, "Failed to fetch investment tiers", http.StatusInternalServerError)
 		return
@@ -172,7 +188,6 @@ func post_distribute_route(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	var total_shares float64
 	investor_data := make([]struct {
 		investment model.Investment
 		shares     float64
@@ -186,67 +201,342 @@ func post_distribute_route(w http.ResponseWriter, r *http.Request) {
 		if !exists {
 			continue
 		}
-		shares := float64(inv.Amount) * tier.Multiplier
-		total_shares += shares
+		shares := inv.Amount.Float64() * tier.Multiplier
 		investor_data = append(investor_data, struct {
 			investment model.Investment
 			shares     float64
 		}{inv, shares})
 	}
 
-	if total_shares <= 0 {
+	// splits the profit by shares so the payouts add up to exactly what the
+	// business is debited
+	weights := make([]float64, len(investor_data))
+	for i, data := range investor_data {
+		weights[i] = data.shares
+	}
+	split, err := allocation.Allocate(profit.DistributableAmount, weights, h.residue)
+	if err != nil {
 		http.Error(w, "No valid shares to distribute", http.StatusBadRequest)
 		return
 	}
 
-	// updates the balance for the user
-	err = update_balance(business_profile.ID, -int64(profit.DistributableAmount))
+	// plans the run, profit_id is unique so a profit only ever gets one
+	run_body, err := h.db.Insert("distribution_runs", model.DistributionRun{
+		ProfitID:      profit.ID,
+		PitchID:       profit.PitchID,
+		BusinessID:    business_profile.ID,
+		Status:        RUN_PENDING,
+		TotalAmount:   split.Allocated(),
+		InvestorCount: len(investor_data),
+		LockedUntil:   distribution_lease_end(),
+		LockedBy:      new_lease_holder(),
+	})
 	if err != nil {
-		http.Error(w, "Failed to deduct business balance", http.StatusInternalServerError)
+		if errors.Is(err, store.ErrConflict) {
+			http.Error(w, "Profit already has a distribution run, resume it with POST /api/distribute/resume", http.StatusConflict)
+			return
+		}
+		http.Error(w, "Failed to create distribution run", http.StatusInternalServerError)
 		return
 	}
+	var runs []model.DistributionRun
+	if err := json.Unmarshal(run_body, &runs); err != nil || len(runs) != 1 || runs[0].ID == nil {
+		http.Error(w, "Invalid distribution run data", http.StatusInternalServerError)
+		return
+	}
+	run := runs[0]
 
-	// distributes the profit to the investors
-	profit_per_share := profit.DistributableAmount / total_shares
-	for _, data := range investor_data {
-		amount := profit_per_share * data.shares
-		rounded_amount := math.Round(amount*100) / 100
-
-		paid := true
-
-		if err := update_balance(data.investment.InvestorID, int64(rounded_amount)); err != nil {
-			fmt.Printf("Warning: failed to credit investor %s wallet: %v\n", data.investment.InvestorID, err)
-			paid = false
-		}
-
-		distribution := model.ProfitDistribution{
+	// records every payout up front so a resumed run knows who is still owed
+	distributions := make([]model.ProfitDistribution, 0, len(investor_data))
+	for i, data := range investor_data {
+		distributions = append(distributions, model.ProfitDistribution{
+			RunID:        run.ID,
 			ProfitID:     profit.ID,
 			InvestmentID: *data.investment.ID,
 			InvestorID:   data.investment.InvestorID,
 			Shares:       data.shares,
-			Amount:       rounded_amount,
-			Paid:         paid,
+			Amount:       split.Amounts[i],
+			Paid:         false,
+		})
+	}
+	if _, err := h.db.Insert("profit_distributions", distributions); err != nil {
+		// nothing has moved yet so the run is dropped and can be started again
+		_ = h.db.DeleteByID("distribution_runs", strconv.FormatInt(*run.ID, 10))
+		http.Error(w, "Failed to record profit distributions", http.StatusInternalServerError)
+		return
+	}
+
+	// money may have moved even if the run stopped, so it is recorded either way
+	err = h.execute_distribution_run(r.Context(), &run)
+	h.record(r, audit.Entry{Action: AUDIT_DISTRIBUTE_PROFIT, TargetType: "distribution_runs", TargetID: strconv.FormatInt(*run.ID, 10)}, nil, run)
+	if err != nil {
+		write_distribution_run_error(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// resumes a distribution run that stopped part way through
+func (h *handler) resume_distribute_route(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	profit_id_str := r.URL.Query().Get("profit_id")
+	if _, err := strconv.ParseInt(profit_id_str, 10, 64); err != nil {
+		http.Error(w, "invalid profit_id", http.StatusBadRequest)
+		return
+	}
+
+	subject, ok := h.subject(w, r)
+	if !ok {
+		return
+	}
+
+	// gets the run for the profit
+	run_body, err := h.db.Query("distribution_runs", postgrest.New().Eq("profit_id", profit_id_str).String())
+	if err != nil {
+		http.Error(w, "Failed to fetch distribution run", http.StatusInternalServerError)
+		return
+	}
+	var runs []model.DistributionRun
+	if err := json.Unmarshal(run_body, &runs); err != nil || len(runs) != 1 || runs[0].ID == nil {
+		http.Error(w, "Distribution run not found", http.StatusNotFound)
+		return
+	}
+	run := runs[0]
+
+	if !authorize(w, policy.CanResumeDistribution(subject, run)) {
+		return
+	}
+
+	if run.Status != RUN_COMPLETED {
+		// takes the run's lease so two resumes can't pay out at the same time
+		condition := postgrest.New().Eq("id", *run.ID).Lt("locked_until", time.Now().UTC().Format(DISTRIBUTION_TIME_LAYOUT))
+		lease, holder := distribution_lease_end(), new_lease_holder()
+		claimed, err := h.db.Update("distribution_runs", condition.String(), map[string]interface{}{"locked_until": lease, "locked_by": holder})
+		if err != nil {
+			http.Error(w, "Failed to claim distribution run", http.StatusInternalServerError)
+			return
+		}
+		var claimed_runs []model.DistributionRun
+		if err := json.Unmarshal(claimed, &claimed_runs); err != nil || len(claimed_runs) != 1 {
+			http.Error(w, "Distribution run is already in progress", http.StatusConflict)
+			return
 		}
+		run.LockedUntil, run.LockedBy = lease, holder
 
-		_, err := utils.InsertData(distribution, "profit_distributions")
+		before := run
+		err = h.execute_distribution_run(r.Context(), &run)
+		h.record(r, audit.Entry{Action: AUDIT_RESUME_DISTRIBUTION, TargetType: "distribution_runs", TargetID: strconv.FormatInt(*run.ID, 10)}, before, run)
 		if err != nil {
-			fmt.Printf("Warning: failed to insert distribution for investor %s: %v\n", data.investment.InvestorID, err)
+			write_distribution_run_error(w, err)
+			return
 		}
 	}
 
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(run)
+}
+
+const (
+	RUN_PENDING     = "pending"
+	RUN_IN_PROGRESS = "in_progress"
+	RUN_COMPLETED   = "completed"
+	RUN_FAILED      = "failed"
+
+	// how long a run is locked to whoever is paying it out, the lease is
+	// renewed before every payout so it only runs out once they stop
+	DISTRIBUTION_LEASE       = time.Minute
+	DISTRIBUTION_TIME_LAYOUT = "2006-01-02T15:04:05.000000Z"
+)
+
+// debits the business and pays every unpaid investor in the run. Each posting
+// has a reference unique to the run and investment so running it again after
+// a failure never moves money twice.
+func (h *handler) execute_distribution_run(ctx context.Context, run *model.DistributionRun) error {
+	log := logging.FromContext(ctx).With("run_id", *run.ID)
+	profit_account := fmt.Sprintf("profit:%d", run.ProfitID)
+
+	// takes the distributable amount from the business wallet
+	_, err := h.ledger.PostOnce(ledger.Posting{
+		UserID:       run.BusinessID,
+		Kind:         ledger.DistributionDebit,
+		Amount:       run.TotalAmount,
+		Counterparty: profit_account,
+		Reference:    fmt.Sprintf("profit:%d", run.ProfitID),
+	})
+	if err != nil {
+		run.Status = RUN_FAILED
+		run.LastError = err.Error()
+		h.save_distribution_run(ctx, run, true)
+		return err
+	}
+
+	run.Status = RUN_IN_PROGRESS
+	h.save_distribution_run(ctx, run, false)
+
+	// gets the payouts for the run
+	query := postgrest.New().Eq("run_id", *run.ID).Order("id", postgrest.Asc)
+	body, err := h.db.Query("profit_distributions", query.String())
+	if err != nil {
+		run.Status = RUN_FAILED
+		run.LastError = err.Error()
+		h.save_distribution_run(ctx, run, true)
+		return err
+	}
+	var distributions []model.ProfitDistribution
+	if err := json.Unmarshal(body, &distributions); err != nil {
+		run.Status = RUN_FAILED
+		run.LastError = err.Error()
+		h.save_distribution_run(ctx, run, true)
+		return err
+	}
+
+	paid := 0
+	var failed error
+	for _, d := range distributions {
+		if d.Paid {
+			paid++
+			continue
+		}
+
+		// stops if the lease ran out and someone else took the run over
+		if err := h.renew_distribution_lease(run); err != nil {
+			log.Warn("stopped distribution run", "err", err)
+			return err
+		}
+
+		if d.Amount.IsPositive() {
+			_, err := h.ledger.PostOnce(ledger.Posting{
+				UserID:       d.InvestorID,
+				Kind:         ledger.Distribution,
+				Amount:       d.Amount,
+				Counterparty: profit_account,
+				Reference:    fmt.Sprintf("distribution:%d:%d", *run.ID, d.InvestmentID),
+			})
+			if err != nil {
+				log.Warn("failed to credit investor wallet", "investor_id", d.InvestorID, "err", err)
+				metrics.DistributionPayouts.Inc(metrics.PayoutFailed)
+				failed = err
+				continue
+			}
+		}
+
+		_, err := h.db.UpdateByID("profit_distributions", strconv.FormatInt(*d.ID, 10), map[string]interface{}{"paid": true})
+		if err != nil {
+			log.Warn("failed to mark distribution as paid", "distribution_id", *d.ID, "err", err)
+			metrics.DistributionPayouts.Inc(metrics.PayoutFailed)
+			failed = err
+			continue
+		}
+		metrics.DistributionPayouts.Inc(metrics.PayoutPaid)
+		paid++
+	}
+
+	run.PaidCount = paid
+	if failed != nil {
+		run.Status = RUN_FAILED
+		run.LastError = failed.Error()
+		h.save_distribution_run(ctx, run, true)
+		return fmt.Errorf("%d of %d payouts failed: %w", len(distributions)-paid, len(distributions), failed)
+	}
+
 	// updates the profit for the user
 	update_payload := map[string]interface{}{"transferred": true}
-	_, err = utils.UpdateByID("profits", strconv.FormatInt(profit_id, 10), update_payload)
+	_, err = h.db.UpdateByID("profits", strconv.FormatInt(run.ProfitID, 10), update_payload)
 	if err != nil {
-		fmt.Printf("Warning: failed to mark profit %d as transferred: %v\n", profit.ID, err)
+		log.Warn("failed to mark profit as transferred", "profit_id", run.ProfitID, "err", err)
 	}
 
 	// updates the pitch for the user
-	status_update := map[string]interface{}{"status": "Distributed"}
-	_, err = utils.UpdateByID("pitch", strconv.FormatInt(*pitch.PitchID, 10), status_update)
+	if err := h.move_pitch(run.PitchID, lifecycle.Distributed, lifecycle.System); err != nil {
+		log.Warn("failed to move pitch to Distributed", "pitch_id", run.PitchID, "err", err)
+	}
+
+	run.Status = RUN_COMPLETED
+	run.LastError = ""
+	h.save_distribution_run(ctx, run, true)
+	return nil
+}
+
+// records the run's progress, releasing its lease once it has stopped. Only
+// the lease holder's progress is recorded.
+func (h *handler) save_distribution_run(ctx context.Context, run *model.DistributionRun, release bool) {
+	run.LockedUntil = distribution_lease_end()
+	if release {
+		run.LockedUntil = time.Now().UTC().Format(DISTRIBUTION_TIME_LAYOUT)
+	}
+
+	payload := map[string]interface{}{
+		"status":       run.Status,
+		"paid_count":   run.PaidCount,
+		"last_error":   run.LastError,
+		"locked_until": run.LockedUntil,
+		"updated_at":   "now()",
+	}
+	saved, err := h.db.Update("distribution_runs", held_distribution_run(run).String(), payload)
+	if err != nil {
+		logging.FromContext(ctx).Warn("failed to save distribution run", "run_id", *run.ID, "err", err)
+		return
+	}
+	var runs []model.DistributionRun
+	if json.Unmarshal(saved, &runs) == nil && len(runs) == 0 {
+		logging.FromContext(ctx).Warn("distribution run not saved, its lease was taken over", "run_id", *run.ID)
+	}
+}
+
+// pushes the run's lease back, failing with errDistributionLeaseLost if
+// someone else holds it now
+func (h *handler) renew_distribution_lease(run *model.DistributionRun) error {
+	lease := distribution_lease_end()
+	body, err := h.db.Update("distribution_runs", held_distribution_run(run).String(), map[string]interface{}{"locked_until": lease})
 	if err != nil {
-		fmt.Printf("Warning: failed to update pitch %d status to 'Declared': %v\n", *pitch.PitchID, err)
+		return fmt.Errorf("failed to renew distribution lease: %w", err)
+	}
+	var runs []model.DistributionRun
+	if err := json.Unmarshal(body, &runs); err != nil {
+		return fmt.Errorf("failed to decode distribution run: %w", err)
 	}
+	if len(runs) != 1 {
+		return errDistributionLeaseLost
+	}
+	run.LockedUntil = lease
+	return nil
+}
 
-	w.WriteHeader(http.StatusNoContent)
+var errDistributionLeaseLost = errors.New("distribution run lease was taken over")
+
+// the condition matching the run while its lease is still ours
+func held_distribution_run(run *model.DistributionRun) postgrest.Query {
+	return postgrest.New().Eq("id", *run.ID).Eq("locked_by", run.LockedBy)
+}
+
+func distribution_lease_end() string {
+	return time.Now().Add(DISTRIBUTION_LEASE).UTC().Format(DISTRIBUTION_TIME_LAYOUT)
+}
+
+func new_lease_holder() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// writes the response for a run that stopped before paying everyone
+func write_distribution_run_error(w http.ResponseWriter, err error) {
+	if errors.Is(err, ledger.ErrInsufficientFunds) {
+		http.Error(w, "Insufficient dashboard balance to distribute profit", http.StatusPaymentRequired)
+		return
+	}
+	if errors.Is(err, ledger.ErrWalletFrozen) {
+		http.Error(w, "Wallet is frozen, resume the run once it is unfrozen", http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, errDistributionLeaseLost) {
+		http.Error(w, "Distribution run was taken over by another resume", http.StatusConflict)
+		return
+	}
+	http.Error(w, "Distribution run incomplete, resume it with POST /api/distribute/resume", http.StatusInternalServerError)
 }
@@ -0,0 +1,81 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/logging"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/postgrest"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/store"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/utils"
+)
+
+// how long each readiness check gets before it counts as failed
+const READY_CHECK_TIMEOUT = 3 * time.Second
+
+// a dependency the server needs before it can take traffic
+type ready_check struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+// the dependencies /readyz checks
+func (h *handler) ready_checks() []ready_check {
+	return []ready_check{
+		{"supabase_rest", h.ping_db},
+		{"storage", func(ctx context.Context) error { return utils.PingStorage(ctx, h.upstream, h.cfg.Supabase) }},
+		{"jwt", func(context.Context) error { return h.jwt.Configured() }},
+	}
+}
+
+// checks the data store answers a query
+func (h *handler) ping_db(ctx context.Context) error {
+	_, err := store.WithContext(ctx, h.db).Query("profile", postgrest.New().Select("id").Limit(1).String())
+	return err
+}
+
+// reports the process is up, it does no other checks so a slow dependency
+// never gets the server restarted
+func healthz_route(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// reports whether the server can take traffic, i.e. Supabase REST and
+// storage can be reached and the JWT config is loaded
+func (h *handler) readyz_route(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ready := true
+	checks := make(map[string]string)
+	for _, c := range h.ready_checks() {
+		ctx, cancel := context.WithTimeout(r.Context(), READY_CHECK_TIMEOUT)
+		err := c.check(ctx)
+		cancel()
+		if err != nil {
+			// the reason is only logged since the endpoint is unauthenticated
+			logging.FromContext(r.Context()).Warn("readiness check failed", "check", c.name, "err", err)
+			checks[c.name] = "failing"
+			ready = false
+			continue
+		}
+		checks[c.name] = "ok"
+	}
+
+	status, code := "ready", http.StatusOK
+	if !ready {
+		status, code = "not_ready", http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]any{"status": status, "checks": checks})
+}
@@ -2,84 +2,62 @@ package routes
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/audit"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/ledger"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/lifecycle"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/logging"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/metrics"
 	model "github.com/EmmaMartin123/Industrial_Project/backend/internal/model/common"
 	"github.com/EmmaMartin123/Industrial_Project/backend/internal/model/database"
-	"github.com/EmmaMartin123/Industrial_Project/backend/internal/utils"
-	utilsdb "github.com/EmmaMartin123/Industrial_Project/backend/internal/utils/db"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/policy"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/postgrest"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/reservation"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/saga"
 )
 
-func investment_route(w http.ResponseWriter, r *http.Request) {
+func (h *handler) investment_route(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodPost:
-		create_investment_route(w, r)
+		h.create_investment_route(w, r)
 	case http.MethodGet:
-		get_investment_route(w, r)
+		h.get_investment_route(w, r)
 	case http.MethodPatch:
-		update_investment_route(w, r)
+		h.update_investment_route(w, r)
 	default:
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 	}
 }
 
-// updates the balance for the user
-func update_balance(user_id string, amount_pounds int64) error {
-	profile, err := utilsdb.GetUserProfile(user_id)
-	if err != nil {
-		return fmt.Errorf("profile not found")
-	}
-
-	current_balance := int64(0)
-	if profile.DashboardBalance != nil {
-		current_balance = int64(*profile.DashboardBalance)
-	}
-	new_balance := current_balance + amount_pounds
-
-	if new_balance < 0 && amount_pounds < 0 {
-		return fmt.Errorf("insufficient funds")
-	}
-
-	payload := map[string]interface{}{
-		"dashboard_balance": int(new_balance),
-	}
-	_, err = utils.UpdateByID("profile", user_id, payload)
-	if err != nil {
-		return fmt.Errorf("failed to update balance: %w", err)
-	}
-	return nil
-}
-
 // creates the investment for the user
-func create_investment_route(w http.ResponseWriter, r *http.Request) {
-	user_id, ok := utils.UserIDFromCtx(r.Context())
-	if !ok {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
-
-	if ok, _ := utilsdb.CheckUserRole(w, user_id, "investor"); !ok {
+func (h *handler) create_investment_route(w http.ResponseWriter, r *http.Request) {
+	subject, ok := h.subject(w, r)
+	if !ok || !authorize(w, policy.CanInvest(subject)) {
 		return
 	}
+	user_id := subject.UserID
 
 	var req struct {
-		PitchID int64 `json:"pitch_id"`
-		Amount  int64 `json:"amount"`
+		PitchID int64       `json:"pitch_id"`
+		Amount  model.Money `json:"amount"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid JSON", http.StatusBadRequest)
 		return
 	}
 
-	if req.Amount <= 0 {
+	if !req.Amount.IsPositive() {
 		http.Error(w, "Amount must be positive", http.StatusBadRequest)
 		return
 	}
 
 	// gets the pitch for the user
-	pitch_body, err := utils.GetDataByID("pitch", strconv.FormatInt(req.PitchID, 10))
+	pitch_body, err := h.db.GetByID("pitch", strconv.FormatInt(req.PitchID, 10))
 	if err != nil {
 		http.Error(w, "Pitch not found", http.StatusNotFound)
 		return
@@ -91,19 +69,22 @@ func create_investment_route(w http.ResponseWriter, r *http.Request) {
 	}
 	pitch := pitches[0]
 
-	if pitch.Status != "Active" {
+	// the deadline job closes the pitch soon after its end date, until then
+	// the end date itself keeps late investments out
+	if pitch.Status != string(lifecycle.Active) || lifecycle.Of(pitch).Ended(time.Now()) {
 		http.Error(w, "Pitch is no longer active", http.StatusBadRequest)
 		return
 	}
 
-	new_raised := pitch.RaisedAmount + req.Amount
-	if uint64(new_raised) > pitch.TargetAmount {
+	// quick check, the reservation in the saga is what actually guarantees it
+	new_raised := pitch.RaisedAmount.Add(req.Amount)
+	if new_raised.Cmp(pitch.TargetAmount) > 0 {
 		http.Error(w, "Investment would exceed pitch target amount", http.StatusBadRequest)
 		return
 	}
 
-	tier_query := fmt.Sprintf("pitch_id=eq.%d", req.PitchID)
-	tier_body, err := utils.GetDataByQuery("investment_tier", tier_query)
+	tier_query := postgrest.New().Eq("pitch_id", req.PitchID)
+	tier_body, err := h.db.Query("investment_tier", tier_query.String())
 	if err != nil {
 		http.Error(w, "Failed to fetch investment tiers", http.StatusInternalServerError)
 		return
@@ -116,9 +97,9 @@ func create_investment_route(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var matched_tier_id *int64
-	var currentMatch uint64 = 0
+	var currentMatch model.Money
 	for _, tier := range tiers {
-		if uint64(req.Amount) >= tier.MinAmount && tier.MinAmount > currentMatch {
+		if req.Amount.Cmp(tier.MinAmount) >= 0 && tier.MinAmount.Cmp(currentMatch) > 0 {
 			matched_tier_id = tier.ID
 			currentMatch = tier.MinAmount
 		}
@@ -129,75 +110,187 @@ func create_investment_route(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// updates the balance for the user
-	if err := update_balance(user_id, -req.Amount); err != nil {
-		if err.Error() == "insufficient funds" {
-			http.Error(w, "Insufficient funds", http.StatusPaymentRequired)
-		} else {
-			http.Error(w, "Failed to deduct funds", http.StatusInternalServerError)
-		}
-		fmt.Printf("Balance update failed for user %s: %v\n", user_id, err)
-		return
-	}
-
-	investment := model.Investment{
-		PitchID:    &req.PitchID,
+	state := investment_saga_state{
 		InvestorID: user_id,
-		TierID:     matched_tier_id,
+		PitchID:    req.PitchID,
+		TierID:     *matched_tier_id,
 		Amount:     req.Amount,
-		Refunded:   false,
 	}
 
-	// creates the investment for the user
-	result, err := utils.InsertData(investment, "investments")
+	// runs the debit, insert and pitch total update as a saga so a failure
+	// part way through is rolled back instead of leaving money or totals adrift
+	err = h.investment_saga().Run(h.outbox, &state)
+	var unfinished *saga.UnfinishedError
 	if err != nil {
-		_ = update_balance(user_id, req.Amount)
-		http.Error(w, "Failed to create investment", http.StatusInternalServerError)
-		return
+		switch {
+		case errors.Is(err, saga.ErrRetry) && state.Investment != nil:
+			// the investment is recorded, the outbox worker finishes the funded check
+			logging.FromContext(r.Context()).Warn("funded check deferred", "investment_id", *state.Investment.ID, "err", err)
+		case errors.As(err, &unfinished):
+			// the wallet may already be debited, so the request is accepted
+			// rather than failed, which would let a retry invest a second time.
+			// The outbox worker finishes or undoes it.
+			logging.FromContext(r.Context()).Warn("investment saga unfinished", "outbox_id", unfinished.ID, "status", unfinished.Status, "err", err)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusAccepted)
+			json.NewEncoder(w).Encode(map[string]any{"outbox_id": unfinished.ID, "status": unfinished.Status})
+			return
+		case errors.Is(err, ledger.ErrInsufficientFunds):
+			http.Error(w, "Insufficient funds", http.StatusPaymentRequired)
+			return
+		case errors.Is(err, ledger.ErrWalletFrozen):
+			http.Error(w, "Wallet is frozen", http.StatusForbidden)
+			return
+		case errors.Is(err, reservation.ErrOversubscribed):
+			http.Error(w, "Investment would exceed pitch target amount", http.StatusBadRequest)
+			return
+		case errors.Is(err, reservation.ErrNotActive):
+			http.Error(w, "Pitch is no longer active", http.StatusBadRequest)
+			return
+		default:
+			logging.FromContext(r.Context()).Error("investment saga failed", "err", err)
+			http.Error(w, "Failed to create investment", http.StatusInternalServerError)
+			return
+		}
 	}
 
-	var inserted []model.Investment
-	if err := json.Unmarshal([]byte(result), &inserted); err != nil || len(inserted) == 0 {
-		_ = update_balance(user_id, req.Amount)
-		http.Error(w, "Failed to decode created investment", http.StatusInternalServerError)
-		return
-	}
-
-	update_payload := map[string]interface{}{"raised_amount": new_raised}
-	if uint64(new_raised) == pitch.TargetAmount {
-		update_payload["status"] = "Funded"
-	}
-	// updates the pitch for the user
-	_, err = utils.UpdateByID("pitch", strconv.FormatInt(req.PitchID, 10), update_payload)
-	if err != nil {
-		fmt.Printf("Warning: failed to update pitch raised_amount: %v\n", err)
+	metrics.InvestmentsCreated.Inc()
+	if state.Investment != nil && state.Investment.ID != nil {
+		h.record(r, audit.Entry{Action: AUDIT_CREATE_INVESTMENT, TargetType: "investments", TargetID: strconv.FormatInt(*state.Investment.ID, 10)}, nil, state.Investment)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(inserted[0])
+	json.NewEncoder(w).Encode(state.Investment)
+}
+
+// investment_saga_state is the outbox payload for an investment
+type investment_saga_state struct {
+	InvestorID string            `json:"investor_id"`
+	PitchID    int64             `json:"pitch_id"`
+	TierID     int64             `json:"tier_id"`
+	Amount     model.Money       `json:"amount"`
+	Investment *model.Investment `json:"investment,omitempty"`
+}
+
+// gets the saga that creates an investment, every step uses the outbox id as
+// its idempotency reference so the worker can safely repeat it
+func (h *handler) investment_saga() saga.Definition[investment_saga_state] {
+	return saga.Definition[investment_saga_state]{
+		Kind: "investment",
+		Steps: []saga.Step[investment_saga_state]{
+			{
+				Name: "debit_wallet",
+				Do: func(id int64, s *investment_saga_state) error {
+					_, err := h.ledger.PostOnce(ledger.Posting{
+						UserID:       s.InvestorID,
+						Kind:         ledger.Investment,
+						Amount:       s.Amount,
+						Counterparty: fmt.Sprintf("pitch:%d", s.PitchID),
+						Reference:    fmt.Sprintf("saga:%d:debit", id),
+					})
+					return err
+				},
+				Undo: func(id int64, s *investment_saga_state) error {
+					// only refunds money that was actually taken
+					debited, err := h.ledger.Posted(s.InvestorID, fmt.Sprintf("saga:%d:debit", id))
+					if err != nil || !debited {
+						return err
+					}
+					_, err = h.ledger.PostOnce(ledger.Posting{
+						UserID:       s.InvestorID,
+						Kind:         ledger.Refund,
+						Amount:       s.Amount,
+						Counterparty: fmt.Sprintf("pitch:%d", s.PitchID),
+						Reference:    fmt.Sprintf("saga:%d:refund", id),
+					})
+					return err
+				},
+			},
+			{
+				Name: "reserve_pitch",
+				Do: func(id int64, s *investment_saga_state) error {
+					err := h.reservations.Reserve(s.PitchID, fmt.Sprintf("saga:%d", id), s.Amount)
+					if errors.Is(err, reservation.ErrConflict) {
+						return fmt.Errorf("%w: %v", saga.ErrRetry, err)
+					}
+					return err
+				},
+				Undo: func(id int64, s *investment_saga_state) error {
+					// only releases what was actually reserved
+					reserved, err := h.reservations.Reserved(fmt.Sprintf("saga:%d", id))
+					if err != nil || !reserved {
+						return err
+					}
+					return h.reservations.Release(s.PitchID, fmt.Sprintf("saga:%d:release", id), s.Amount)
+				},
+			},
+			{
+				Name: "record_investment",
+				Do: func(id int64, s *investment_saga_state) error {
+					existing, err := h.db.Query("investments", postgrest.New().Eq("outbox_id", id).String())
+					if err != nil {
+						return err
+					}
+					var found []model.Investment
+					if err := json.Unmarshal(existing, &found); err != nil {
+						return err
+					}
+					if len(found) > 0 {
+						s.Investment = &found[0]
+						return nil
+					}
+
+					result, err := h.db.Insert("investments", model.Investment{
+						PitchID:    &s.PitchID,
+						InvestorID: s.InvestorID,
+						TierID:     &s.TierID,
+						Amount:     s.Amount,
+						Refunded:   false,
+						OutboxID:   &id,
+					})
+					if err != nil {
+						return err
+					}
+					var inserted []model.Investment
+					if err := json.Unmarshal(result, &inserted); err != nil || len(inserted) != 1 {
+						return fmt.Errorf("invalid investment returned: %s", string(result))
+					}
+					s.Investment = &inserted[0]
+					return nil
+				},
+				Undo: func(id int64, s *investment_saga_state) error {
+					s.Investment = nil
+					return h.db.DeleteByQuery("investments", postgrest.New().Eq("outbox_id", id).String())
+				},
+			},
+			{
+				Name: "mark_funded",
+				Do: func(id int64, s *investment_saga_state) error {
+					if _, err := h.reservations.MarkFunded(s.PitchID); err != nil {
+						return fmt.Errorf("%w: %v", saga.ErrRetry, err)
+					}
+					return nil
+				},
+			},
+		},
+	}
 }
 
 // gets the investments for the user
-func get_investment_route(w http.ResponseWriter, r *http.Request) {
+func (h *handler) get_investment_route(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	id_str := r.URL.Query().Get("id")
-	user_id, ok := utils.UserIDFromCtx(r.Context())
-	if !ok {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
-
-	// verifies the user has an investor role
-	if ok, _ := utilsdb.CheckUserRole(w, user_id, "investor"); !ok {
-		http.Error(w, "Forbidden", http.StatusForbidden)
+	subject, ok := h.subject(w, r)
+	if !ok || !authorize(w, policy.CanViewInvestments(subject)) {
 		return
 	}
+	user_id := subject.UserID
 
 	// gets the investment for the user
 	if id_str != "" {
-		result, err := utils.GetDataByID("investments", id_str)
+		result, err := h.db.GetByID("investments", id_str)
 		if err != nil {
 			http.Error(w, "Investment not found", http.StatusNotFound)
 			return
@@ -210,8 +303,7 @@ func get_investment_route(w http.ResponseWriter, r *http.Request) {
 		}
 
 		investment := investments[0]
-		if investment.InvestorID != user_id {
-			http.Error(w, "Forbidden", http.StatusForbidden)
+		if !authorize(w, policy.CanViewInvestment(subject, investment)) {
 			return
 		}
 
@@ -220,8 +312,8 @@ func get_investment_route(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	query := fmt.Sprintf("investor_id=eq.%s", user_id)
-	result, err := utils.GetDataByQuery("investments", query)
+	query := postgrest.New().Eq("investor_id", user_id)
+	result, err := h.db.Query("investments", query.String())
 	if err != nil {
 		http.Error(w, "Failed to fetch investments", http.StatusInternalServerError)
 		return
@@ -238,25 +330,20 @@ func get_investment_route(w http.ResponseWriter, r *http.Request) {
 }
 
 // updates the investment for the user
-func update_investment_route(w http.ResponseWriter, r *http.Request) {
+func (h *handler) update_investment_route(w http.ResponseWriter, r *http.Request) {
 	id_str := r.URL.Query().Get("id")
 	if id_str == "" {
 		http.Error(w, "Investment ID required", http.StatusBadRequest)
 		return
 	}
 
-	user_id, ok := utils.UserIDFromCtx(r.Context())
+	subject, ok := h.subject(w, r)
 	if !ok {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
-
-	if ok, _ := utilsdb.CheckUserRole(w, user_id, "investor"); !ok {
 		return
 	}
 
 	// gets the investment for the user
-	result, err := utils.GetDataByID("investments", id_str)
+	result, err := h.db.GetByID("investments", id_str)
 	if err != nil {
 		http.Error(w, "Investment not found", http.StatusNotFound)
 		return
@@ -269,8 +356,7 @@ func update_investment_route(w http.ResponseWriter, r *http.Request) {
 	}
 
 	investment := investments[0]
-	if investment.InvestorID != user_id {
-		http.Error(w, "Forbidden: You don't own this investment", http.StatusForbidden)
+	if !authorize(w, policy.CanRefund(subject, investment)) {
 		return
 	}
 
@@ -293,7 +379,7 @@ func update_investment_route(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// gets the pitch for the user
-	pitch_body, err := utils.GetDataByID("pitch", strconv.FormatInt(*investment.PitchID, 10))
+	pitch_body, err := h.db.GetByID("pitch", strconv.FormatInt(*investment.PitchID, 10))
 	if err != nil {
 		http.Error(w, "Associated pitch not found", http.StatusNotFound)
 		return
@@ -305,39 +391,19 @@ func update_investment_route(w http.ResponseWriter, r *http.Request) {
 	}
 	pitch := pitches[0]
 
-	if pitch.Status != "Active" {
+	if pitch.Status != string(lifecycle.Active) {
 		http.Error(w, "Can only refund on Active pitches", http.StatusBadRequest)
 		return
 	}
 
-	new_raised := pitch.RaisedAmount - investment.Amount
-	if new_raised < 0 {
-		new_raised = 0
-	}
-
-	update_payload := map[string]interface{}{"raised_amount": new_raised}
-
-	// updates the pitch for the user
-	_, err = utils.UpdateByID("pitch", strconv.FormatInt(*investment.PitchID, 10), update_payload)
-	if err != nil {
-		fmt.Printf("Warning: failed to update pitch after refund: %v\n", err)
-	}
-
-	// updates the investment for the user
-	payload := map[string]interface{}{"refunded": true}
-	_, err = utils.UpdateByID("investments", id_str, payload)
-	if err != nil {
-		http.Error(w, "Failed to update investment", http.StatusInternalServerError)
+	if err := h.refund_investment(investment); err != nil {
+		logging.FromContext(r.Context()).Warn("failed to refund investment", "err", err)
+		http.Error(w, "Failed to refund investment", http.StatusInternalServerError)
 		return
 	}
 
-	// updates the balance for the user
-	if err := update_balance(user_id, investment.Amount); err != nil {
-		fmt.Printf("Warning: failed to refund investor balance: %v\n", err)
-	}
-
 	// gets the investment for the user
-	updated_result, err := utils.GetDataByID("investments", id_str)
+	updated_result, err := h.db.GetByID("investments", id_str)
 	if err != nil {
 		http.Error(w, "Investment missing after update", http.StatusNotFound)
 		return
@@ -348,7 +414,44 @@ func update_investment_route(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid updated investment", http.StatusInternalServerError)
 		return
 	}
+	h.record(r, audit.Entry{Action: AUDIT_REFUND_INVESTMENT, TargetType: "investments", TargetID: id_str}, investment, updated[0])
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(updated[0])
 }
+
+// gives the investor their money back and takes it off the pitch. Every step
+// is keyed by the investment so a retry after a failure never refunds twice,
+// and the investment is only marked refunded once the money has moved.
+func (h *handler) refund_investment(investment model.Investment) error {
+	if investment.ID == nil || investment.PitchID == nil {
+		return fmt.Errorf("investment is missing its id or pitch")
+	}
+	id_str := strconv.FormatInt(*investment.ID, 10)
+	fail := func(format string, err error) error {
+		return fmt.Errorf("investment %s: "+format+": %w", id_str, err)
+	}
+
+	// takes the refund off the pitch's raised amount
+	if err := h.reservations.Release(*investment.PitchID, "refund:investment:"+id_str, investment.Amount); err != nil {
+		return fail("failed to update pitch after refund", err)
+	}
+
+	// returns the funds to the investor's wallet
+	_, err := h.ledger.PostOnce(ledger.Posting{
+		UserID:       investment.InvestorID,
+		Kind:         ledger.Refund,
+		Amount:       investment.Amount,
+		Counterparty: fmt.Sprintf("pitch:%d", *investment.PitchID),
+		Reference:    "investment:" + id_str,
+	})
+	if err != nil {
+		return fail("failed to refund investor balance", err)
+	}
+
+	if _, err := h.db.UpdateByID("investments", id_str, map[string]interface{}{"refunded": true}); err != nil {
+		return fail("failed to mark investment refunded", err)
+	}
+	metrics.InvestmentsRefunded.Inc()
+	return nil
+}
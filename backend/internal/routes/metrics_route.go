@@ -0,0 +1,28 @@
+package routes
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/metrics"
+)
+
+// serves the registry in the Prometheus text format, requiring the token as
+// a bearer if one is set
+func metrics_route(reg *metrics.Registry, token string) http.Handler {
+	serve := reg.Handler()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if token != "" {
+			got := r.Header.Get("Authorization")
+			if subtle.ConstantTimeCompare([]byte(got), []byte("Bearer "+token)) != 1 {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+		serve.ServeHTTP(w, r)
+	})
+}
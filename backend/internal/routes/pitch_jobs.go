@@ -0,0 +1,179 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/audit"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/config"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/lifecycle"
+	model "github.com/EmmaMartin123/Industrial_Project/backend/internal/model/common"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/model/database"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/postgrest"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/scheduler"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/store"
+)
+
+// what happens to a pitch that reaches its end date short of its target
+const (
+	FUNDING_ALL_OR_NOTHING   = "all_or_nothing"   // investors are refunded and the pitch closes
+	FUNDING_KEEP_WHAT_RAISED = "keep_what_raised" // the pitch is funded with what it raised
+)
+
+// gets the scheduled jobs that act on pitch start and end dates, run every
+// SchedulerInterval
+func PitchJobs(cfg *config.Config, db store.Store) []scheduler.Job {
+	h := new_handler(cfg, nil, db, nil, nil)
+	every := cfg.SchedulerInterval
+
+	// closing a pitch can refund its investors so, like the routes that move
+	// money, it isn't cut off part way when the scheduler stops
+	return []scheduler.Job{
+		{Name: "activate_started_pitches", Every: every, Run: func(ctx context.Context) error {
+			return h.with(ctx).activate_started_pitches(ctx)
+		}},
+		{Name: "close_expired_pitches", Every: every, Run: func(ctx context.Context) error {
+			return h.with(context.WithoutCancel(ctx)).close_expired_pitches(ctx, cfg.PitchFundingPolicy)
+		}},
+	}
+}
+
+// opens draft pitches whose start date has arrived
+func (h *handler) activate_started_pitches(ctx context.Context) error {
+	pitches, err := h.pitches_in(lifecycle.Draft)
+	if err != nil {
+		return err
+	}
+
+	var failed []error
+	for _, p := range pitches {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		current := lifecycle.Of(p)
+		if !current.Started(time.Now()) {
+			continue
+		}
+		err := lifecycle.Apply(h.db, current, lifecycle.Active, lifecycle.System)
+		if err == nil {
+			h.record_status_change(ctx, current, lifecycle.Active, "investment start date reached")
+		} else if !errors.Is(err, lifecycle.ErrStale) {
+			failed = append(failed, fmt.Errorf("pitch %d: %w", current.ID, err))
+		}
+	}
+	return errors.Join(failed...)
+}
+
+// ends active pitches whose end date has passed. A pitch that raised nothing
+// closes, one that raised its target is funded and one in between follows the
+// funding policy. Anything that fails is tried again on the next run.
+func (h *handler) close_expired_pitches(ctx context.Context, policy string) error {
+	pitches, err := h.pitches_in(lifecycle.Active)
+	if err != nil {
+		return err
+	}
+
+	var failed []error
+	for _, p := range pitches {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		current := lifecycle.Of(p)
+		if !current.Ended(time.Now()) {
+			continue
+		}
+
+		// the state the pitch moved to, left empty when it didn't move
+		var moved lifecycle.State
+		switch {
+		case current.RaisedAmount.IsZero():
+			if err = lifecycle.Apply(h.db, current, lifecycle.Closed, lifecycle.System); err == nil {
+				moved = lifecycle.Closed
+			}
+		case current.RaisedAmount.Cmp(current.TargetAmount) >= 0:
+			var funded bool
+			if funded, err = h.reservations.MarkFunded(current.ID); funded {
+				moved = lifecycle.Funded
+			}
+		case policy == FUNDING_KEEP_WHAT_RAISED:
+			if err = lifecycle.Apply(h.db, current, lifecycle.Funded, lifecycle.System, postgrest.Eq("raised_amount", current.RaisedAmount)); err == nil {
+				moved = lifecycle.Funded
+			}
+		default:
+			var refunded int
+			refunded, err = h.refund_pitch(ctx, current.ID)
+			if refunded > 0 {
+				h.record_system(ctx, audit.Entry{Action: AUDIT_REFUND_PITCH, TargetType: "pitch", TargetID: strconv.FormatInt(current.ID, 10), Reason: "ended short of its target"},
+					map[string]any{"raised_amount": current.RaisedAmount},
+					map[string]any{"refunded": refunded, "complete": err == nil})
+			}
+			if errors.Is(err, scheduler.ErrLeaseLost) {
+				return err
+			}
+			if err == nil {
+				if err = h.move_pitch(current.ID, lifecycle.Closed, lifecycle.System); err == nil {
+					moved = lifecycle.Closed
+				}
+			}
+		}
+		if moved != "" {
+			h.record_status_change(ctx, current, moved, "investment end date passed")
+		}
+		if err != nil && !errors.Is(err, lifecycle.ErrStale) {
+			failed = append(failed, fmt.Errorf("pitch %d: %w", current.ID, err))
+		}
+	}
+	return errors.Join(failed...)
+}
+
+// refunds every investment still held by the pitch, returning how many were
+// refunded. Run by the scheduler, it stops if another server takes the job
+// over.
+func (h *handler) refund_pitch(ctx context.Context, pitch_id int64) (int, error) {
+	body, err := h.db.Query("investments", postgrest.New().Eq("pitch_id", pitch_id).Is("refunded", postgrest.False).String())
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch investments: %w", err)
+	}
+	var investments []model.Investment
+	if err := json.Unmarshal(body, &investments); err != nil {
+		return 0, fmt.Errorf("failed to decode investments: %w", err)
+	}
+
+	refunded := 0
+	var failed []error
+	for _, investment := range investments {
+		if err := scheduler.Renew(ctx); err != nil {
+			return refunded, errors.Join(append(failed, err)...)
+		}
+		if err := h.refund_investment(investment); err != nil {
+			failed = append(failed, err)
+			continue
+		}
+		refunded++
+	}
+	return refunded, errors.Join(failed...)
+}
+
+// records a pitch the scheduler moved to a new state
+func (h *handler) record_status_change(ctx context.Context, p lifecycle.Pitch, to lifecycle.State, reason string) {
+	h.record_system(ctx, audit.Entry{Action: AUDIT_CHANGE_PITCH_STATUS, TargetType: "pitch", TargetID: strconv.FormatInt(p.ID, 10), Reason: reason},
+		map[string]string{"status": string(p.Status)},
+		map[string]string{"status": string(to)})
+}
+
+// gets the pitches in the state
+func (h *handler) pitches_in(state lifecycle.State) ([]database.Pitch, error) {
+	body, err := h.db.Query("pitch", postgrest.New().Eq("status", state).Order("id", postgrest.Asc).String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s pitches: %w", state, err)
+	}
+	var pitches []database.Pitch
+	if err := json.Unmarshal(body, &pitches); err != nil {
+		return nil, fmt.Errorf("failed to decode pitches: %w", err)
+	}
+	return pitches, nil
+}
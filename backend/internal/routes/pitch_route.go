@@ -2,36 +2,40 @@ package routes
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
-	"math"
 	"net/http"
-	"net/url"
-	"os"
 	"path/filepath"
-	"sort"
 	"strconv"
 	"strings"
 
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/audit"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/lifecycle"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/logging"
 	model "github.com/EmmaMartin123/Industrial_Project/backend/internal/model/common"
 	"github.com/EmmaMartin123/Industrial_Project/backend/internal/model/database"
 	"github.com/EmmaMartin123/Industrial_Project/backend/internal/model/frontend"
 	mapping "github.com/EmmaMartin123/Industrial_Project/backend/internal/model/mapping"
-	"github.com/EmmaMartin123/Industrial_Project/backend/internal/model/misc"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/pagination"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/policy"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/postgrest"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/store"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/tracing"
 	"github.com/EmmaMartin123/Industrial_Project/backend/internal/utils"
-	utilsdb "github.com/EmmaMartin123/Industrial_Project/backend/internal/utils/db"
 )
 
-func pitch_route(w http.ResponseWriter, r *http.Request) {
+func (h *handler) pitch_route(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodPost:
-		create_pitch_route(w, r)
+		h.create_pitch_route(w, r)
 	case http.MethodGet:
-		get_pitch_route(w, r)
+		h.get_pitch_route(w, r)
 	case http.MethodPatch:
-		update_pitch_route(w, r)
+		h.update_pitch_route(w, r)
 	case http.MethodDelete:
-		delete_pitch_route(w, r)
+		h.delete_pitch_route(w, r)
 	default:
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 	}
@@ -40,7 +44,7 @@ func pitch_route(w http.ResponseWriter, r *http.Request) {
 const SOFT_MAX_MEDIA_RAM = 50 << 20
 
 // deletes the pitch for the user
-func delete_pitch_route(w http.ResponseWriter, r *http.Request) {
+func (h *handler) delete_pitch_route(w http.ResponseWriter, r *http.Request) {
 	pitch_id_str := r.URL.Query().Get("id")
 	if pitch_id_str == "" {
 		http.Error(w, "Pitch ID is required", http.StatusBadRequest)
@@ -48,7 +52,7 @@ func delete_pitch_route(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// gets the pitch for the user
-	result, err := utils.GetDataByID("pitch", pitch_id_str)
+	result, err := h.db.GetByID("pitch", pitch_id_str)
 	if err != nil {
 		http.Error(w, "Pitch not found", http.StatusNotFound)
 		return
@@ -66,18 +70,13 @@ func delete_pitch_route(w http.ResponseWriter, r *http.Request) {
 	}
 
 	pitch := pitches[0]
-	userID, ok := utils.UserIDFromCtx(r.Context())
-	if !ok || userID != pitch.UserID {
-		http.Error(w, "Unauthorised", http.StatusUnauthorized)
-		return
-	}
-
-	if ok, _ := utilsdb.CheckUserRole(w, userID, "business"); !ok {
+	subject, ok := h.subject(w, r)
+	if !ok || !authorize(w, policy.CanDeletePitch(subject, pitch)) {
 		return
 	}
 
 	// gets the investment tiers for the user
-	investmentTiers, err := get_investment_tiers(pitch)
+	investmentTiers, err := h.get_investment_tiers(pitch)
 	if err != nil {
 		http.Error(w, "Failed to fetch investment tiers", http.StatusInternalServerError)
 		return
@@ -87,83 +86,102 @@ func delete_pitch_route(w http.ResponseWriter, r *http.Request) {
 		if tier.ID == nil {
 			continue
 		}
-		if err := utils.DeleteByID("investment_tier", strconv.Itoa(int(*tier.ID))); err != nil {
-			fmt.Printf("Warning: failed to delete investment tier %d: %v\n", *tier.ID, err)
+		if err := h.db.DeleteByID("investment_tier", strconv.Itoa(int(*tier.ID))); err != nil {
+			logging.FromContext(r.Context()).Warn("failed to delete investment tier", "tier_id", *tier.ID, "err", err)
 		}
 	}
 
 	// gets the media for the pitch
-	media, media_err := utils.GetPitchMedia(*pitch.PitchID)
+	media, media_err := utils.GetPitchMedia(h.db, *pitch.PitchID)
 	if media_err != nil {
-		fmt.Printf("Warning: failed to fetch media for pitch %d: %v\n", *pitch.PitchID, media_err)
+		logging.FromContext(r.Context()).Warn("failed to fetch pitch media", "pitch_id", *pitch.PitchID, "err", media_err)
 	} else {
 		for _, item := range media {
-			if err := utils.DeleteFileFromS3(item.URL); err != nil {
-				fmt.Printf("Warning: failed to delete file from S3: %v\n", err)
+			if err := utils.DeleteFileFromS3(r.Context(), h.upstream, h.cfg.Supabase, item.URL); err != nil {
+				logging.FromContext(r.Context()).Warn("failed to delete file from S3", "url", item.URL, "err", err)
 			}
 
 			if item.ID != nil {
-				if err := utils.DeleteByID("pitch_media", strconv.Itoa(int(*item.ID))); err != nil {
-					fmt.Printf("Warning: failed to delete media %d from database: %v\n", *item.ID, err)
+				if err := h.db.DeleteByID("pitch_media", strconv.Itoa(int(*item.ID))); err != nil {
+					logging.FromContext(r.Context()).Warn("failed to delete pitch media", "media_id", *item.ID, "err", err)
 				}
 			}
 		}
 	}
 
 	// deletes the pitch for the user
-	if err := utils.DeleteByID("pitch", pitch_id_str); err != nil {
+	if err := h.db.DeleteByID("pitch", pitch_id_str); err != nil {
 		http.Error(w, "Failed to delete pitch", http.StatusInternalServerError)
 		return
 	}
+	h.search.Remove(*pitch.PitchID)
+	h.record(r, audit.Entry{Action: AUDIT_DELETE_PITCH, TargetType: "pitch", TargetID: pitch_id_str}, pitch, nil)
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
 // creates the pitch for the user
-func create_pitch_route(w http.ResponseWriter, r *http.Request) {
+func (h *handler) create_pitch_route(w http.ResponseWriter, r *http.Request) {
 	contentType := r.Header.Get("Content-Type")
 	var pitch frontend.Pitch
 	var err error
+	_, span := tracing.Start(r.Context(), "create_pitch.parse_body")
 	if strings.HasPrefix(contentType, "multipart/form-data") {
 		if err := r.ParseMultipartForm(SOFT_MAX_MEDIA_RAM); err != nil {
+			tracing.End(span, err)
 			http.Error(w, "Error parsing form", http.StatusBadRequest)
 			return
 		}
 		pitchData := r.FormValue("pitch")
 		if pitchData == "" {
+			span.End()
 			http.Error(w, "No pitch data provided", http.StatusBadRequest)
 			return
 		}
 		if err := json.Unmarshal([]byte(pitchData), &pitch); err != nil {
+			tracing.End(span, err)
 			http.Error(w, "Invalid pitch data", http.StatusBadRequest)
 			return
 		}
 	} else {
 		if err := json.NewDecoder(r.Body).Decode(&pitch); err != nil {
+			tracing.End(span, err)
 			http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
 			return
 		}
 		defer r.Body.Close()
 	}
+	span.End()
 
-	// gets the user id from the context
-	uid, ok := utils.UserIDFromCtx(r.Context())
-	if !ok {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	// gets the user making the request
+	subject, ok := h.subject(w, r)
+	if !ok || !authorize(w, policy.CanCreatePitch(subject)) {
 		return
 	}
-	if ok, _ := utilsdb.CheckUserRole(w, uid, "business"); !ok {
+	uid := subject.UserID
+
+	// a new pitch starts as a draft or goes straight to active
+	initial, err := lifecycle.Initial(pitch.Status)
+	if err != nil {
+		write_pitch_status_error(w, err)
 		return
 	}
 
+	// a new pitch has raised nothing, raised_amount only changes through
+	// investment reservations, and the store gives it its id
 	db_pitch := mapping.Pitch_ToDatabase(pitch, uid)
+	db_pitch.PitchID = nil
+	db_pitch.RaisedAmount = model.Money{}
+	db_pitch.Status = string(initial)
 	db_pitch.CreatedAt = "now()"
 	db_pitch.UpdatedAt = &db_pitch.CreatedAt
 
 	// inserts the pitch for the user
-	result, err := utils.InsertData(db_pitch, "pitch")
+	ctx, span := tracing.Start(r.Context(), "create_pitch.insert_pitch")
+	result, err := store.WithContext(ctx, h.db).Insert("pitch", db_pitch)
+	tracing.End(span, err)
 	if err != nil {
-		fmt.Printf("Error inserting pitch: %v\n", err)
+		logging.FromContext(r.Context()).Error("failed to insert pitch", "err", err)
 		http.Error(w, "Error creating pitch", http.StatusInternalServerError)
 		return
 	}
@@ -175,22 +193,27 @@ func create_pitch_route(w http.ResponseWriter, r *http.Request) {
 	}
 	pitch_id := ids[0].ID
 
+	ctx, span = tracing.Start(r.Context(), "create_pitch.insert_tiers", attribute.Int("tiers", len(pitch.InvestmentTiers)))
+	db := store.WithContext(ctx, h.db)
 	for _, tier := range pitch.InvestmentTiers {
 		tier.PitchID = pitch_id
-		_, invest_err := utils.InsertData(tier, "investment_tier")
+		_, invest_err := db.Insert("investment_tier", tier)
 		if invest_err != nil {
-			fmt.Printf("Warning: failed to insert investment tier: %v\n", invest_err)
+			logging.FromContext(r.Context()).Warn("failed to insert investment tier", "pitch_id", pitch_id, "err", invest_err)
 		}
 	}
+	span.End()
 
 	// deals with the media for the pitch
+	ctx, span = tracing.Start(r.Context(), "create_pitch.media")
+	db = store.WithContext(ctx, h.db)
 	var media_files []frontend.PitchMedia
 	if strings.HasPrefix(contentType, "multipart/form-data") {
 		files := r.MultipartForm.File["media"]
 		for i, fileHeader := range files {
 			file, err := fileHeader.Open()
 			if err != nil {
-				fmt.Printf("Error opening file: %v\n", err)
+				logging.FromContext(r.Context()).Warn("failed to open uploaded file", "file", fileHeader.Filename, "err", err)
 				continue
 			}
 			ext := filepath.Ext(fileHeader.Filename)
@@ -199,10 +222,10 @@ func create_pitch_route(w http.ResponseWriter, r *http.Request) {
 				mediaType = contentTypes[0]
 			}
 			fileName := utils.GenerateUniqueFileName(fmt.Sprintf("pitch_%d", pitch_id), ext)
-			fileURL, err := utils.UploadFileToS3(file, fileName, mediaType)
+			fileURL, err := utils.UploadFileToS3(ctx, h.upstream, h.cfg.Supabase, file, fileName, mediaType)
 			file.Close()
 			if err != nil {
-				fmt.Printf("Error uploading file: %v\n", err)
+				logging.FromContext(r.Context()).Warn("failed to upload file", "file", fileHeader.Filename, "err", err)
 				continue
 			}
 			mediaEntry := frontend.PitchMedia{
@@ -212,9 +235,9 @@ func create_pitch_route(w http.ResponseWriter, r *http.Request) {
 				OrderInDescription: int64(i + 1),
 			}
 			dbMedia := mapping.PitchMedia_ToDatabase(mediaEntry, pitch_id)
-			_, err = utils.InsertData(dbMedia, "pitch_media")
+			_, err = db.Insert("pitch_media", dbMedia)
 			if err != nil {
-				fmt.Printf("Error saving media metadata: %v\n", err)
+				logging.FromContext(r.Context()).Warn("failed to save pitch media", "pitch_id", pitch_id, "err", err)
 				continue
 			}
 			media_files = append(media_files, mediaEntry)
@@ -229,23 +252,28 @@ func create_pitch_route(w http.ResponseWriter, r *http.Request) {
 			}
 			media.PitchID = &pitch_id
 			dbMedia := mapping.PitchMedia_ToDatabase(media, pitch_id)
-			_, err = utils.InsertData(dbMedia, "pitch_media")
+			_, err = db.Insert("pitch_media", dbMedia)
 			if err != nil {
-				fmt.Printf("Error saving media metadata: %v\n", err)
+				logging.FromContext(r.Context()).Warn("failed to save pitch media", "pitch_id", pitch_id, "err", err)
 				continue
 			}
 			media_files = append(media_files, media)
 		}
 	}
 
+	span.SetAttributes(attribute.Int("media", len(media_files)))
+	span.End()
+
 	// deals with the tags for the pitch
+	ctx, span = tracing.Start(r.Context(), "create_pitch.tags", attribute.Int("tags", len(pitch.Tags)))
+	db = store.WithContext(ctx, h.db)
 	for _, tagName := range pitch.Tags {
 		tagName = strings.TrimSpace(tagName)
 		if tagName == "" {
 			continue
 		}
-		tagQuery := fmt.Sprintf("name=eq.%s", url.QueryEscape(tagName))
-		tagRes, err := utils.GetDataByQuery("tags", tagQuery)
+		tagQuery := postgrest.New().Eq("name", tagName)
+		tagRes, err := db.Query("tags", tagQuery.String())
 		var tagID int64
 		if err == nil && len(tagRes) > 2 {
 			var tags []struct {
@@ -256,9 +284,9 @@ func create_pitch_route(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 		if tagID == 0 {
-			createRes, err := utils.InsertData(map[string]interface{}{"name": tagName}, "tags")
+			createRes, err := db.Insert("tags", map[string]interface{}{"name": tagName})
 			if err != nil {
-				fmt.Printf("Failed to create tag '%s': %v\n", tagName, err)
+				logging.FromContext(r.Context()).Warn("failed to create tag", "tag", tagName, "err", err)
 				continue
 			}
 			var newTags []struct {
@@ -270,84 +298,131 @@ func create_pitch_route(w http.ResponseWriter, r *http.Request) {
 				continue
 			}
 		}
-		_, err = utils.InsertData(map[string]interface{}{
+		_, err = db.Insert("pitch_tags", map[string]interface{}{
 			"pitch_id": pitch_id,
 			"tag_id":   tagID,
-		}, "pitch_tags")
+		})
 		if err != nil {
-			fmt.Printf("Failed to link pitch %d to tag %d: %v\n", pitch_id, tagID, err)
+			logging.FromContext(r.Context()).Warn("failed to link pitch to tag", "pitch_id", pitch_id, "tag_id", tagID, "err", err)
 		}
 	}
 
+	span.End()
+
 	pitch.PitchID = &pitch_id
 	pitch.Media = media_files
+	h.index_pitch(pitch)
+	h.record(r, audit.Entry{Action: AUDIT_CREATE_PITCH, TargetType: "pitch", TargetID: strconv.FormatInt(pitch_id, 10)}, nil, pitch)
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(pitch)
 }
 
 // gets the investment tiers for the pitch
-func get_investment_tiers(db_pitch database.Pitch) ([]model.InvestmentTier, error) {
+func (h *handler) get_investment_tiers(db_pitch database.Pitch) ([]model.InvestmentTier, error) {
 	var investment_tiers []model.InvestmentTier
-	query := fmt.Sprintf("pitch_id=eq.%d", *db_pitch.PitchID)
-	body, err := utils.GetDataByQuery("investment_tier", query)
+	query := postgrest.New().Eq("pitch_id", *db_pitch.PitchID)
+	body, err := h.db.Query("investment_tier", query.String())
 	if err != nil {
-		fmt.Printf("error fetching data from Supabase: %v\n", err)
-		return nil, err
+		return nil, fmt.Errorf("failed to fetch investment tiers: %w", err)
 	}
 
 	if err = json.Unmarshal([]byte(body), &investment_tiers); err != nil {
-		fmt.Printf("error unmarshaling investment_tiers: %v\nbody: %s\n", err, string(body))
-		return nil, err
+		return nil, fmt.Errorf("failed to decode investment tiers: %w", err)
 	}
 
 	return investment_tiers, nil
 }
 
-// gets the row count for the table
-func GetRowCount(table string, queryParams []string) (int, error) {
-	supabaseURL := os.Getenv("SUPABASE_URL")
-	apiKey := os.Getenv("SUPABASE_SERVICE_ROLE_KEY")
+// a pitch row with its tiers, media and tags embedded, so a page of pitches
+// is read in one round trip
+type pitch_row struct {
+	database.Pitch
+	InvestmentTiers []model.InvestmentTier `json:"investment_tier"`
+	Media           []frontend.PitchMedia  `json:"pitch_media"`
+	Tags            []database.Tag         `json:"tags"`
+}
 
-	query := strings.Join(queryParams, "&")
-	url := fmt.Sprintf("%s/rest/v1/%s?%s", supabaseURL, table, query)
+// the columns of a pitch_row, plus any extra select items like filter embeds
+func pitch_row_select(extra ...string) []string {
+	return append([]string{
+		"*",
+		postgrest.Embed("", "investment_tier"),
+		postgrest.Embed("", "pitch_media"),
+		postgrest.Embed("", "tags", "name"),
+	}, extra...)
+}
 
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return 0, err
-	}
+// the fields pitch lists can be sorted by, besides id
+var PITCH_SORT_FIELDS = []string{
+	"title",
+	"target_amount",
+	"raised_amount",
+	"profit_share_percent",
+	"investment_start_date",
+	"investment_end_date",
+	"created_at",
+}
 
-	req.Header.Set("apikey", apiKey)
-	req.Header.Set("Authorization", "Bearer "+apiKey)
-	req.Header.Set("Prefer", "count=exact")
+// the page size when paging with a cursor and no limit
+const PITCH_PAGE_LIMIT = 20
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return 0, err
+// gets a pitch's value of the sort field and its id, for its cursor. A date
+// that isn't set is null in the database, so its value is nil.
+func pitch_sort_key(field string) func(pitch_row) (*string, int64) {
+	return func(p pitch_row) (*string, int64) {
+		var value string
+		switch field {
+		case "title":
+			value = p.Title
+		case "target_amount":
+			value = p.TargetAmount.String()
+		case "raised_amount":
+			value = p.RaisedAmount.String()
+		case "profit_share_percent":
+			value = strconv.FormatFloat(p.ProfitSharePercent, 'f', -1, 64)
+		case "investment_start_date":
+			value = p.InvestmentStartDate
+		case "investment_end_date":
+			value = p.InvestmentEndDate
+		case "created_at":
+			value = p.CreatedAt
+		}
+		if value == "" && field != "title" {
+			return nil, *p.PitchID
+		}
+		return &value, *p.PitchID
 	}
-	defer resp.Body.Close()
+}
 
-	contentRange := resp.Header.Get("Content-Range")
-	if contentRange == "" {
-		return 0, fmt.Errorf("missing Content-Range header")
+func (p pitch_row) to_frontend() frontend.Pitch {
+	var tag_names []string
+	for _, tag := range p.Tags {
+		tag_names = append(tag_names, tag.Name)
 	}
+	return mapping.Pitch_ToFrontend(p.Pitch, p.InvestmentTiers, p.Media, tag_names)
+}
 
-	parts := strings.Split(contentRange, "/")
-	if len(parts) != 2 {
-		return 0, fmt.Errorf("invalid Content-Range header: %s", contentRange)
-	}
+// reads the pitches matching the query with everything embedded
+func (h *handler) read_pitches(query postgrest.Query) ([]pitch_row, error) {
+	return query_pitches(h.db, query)
+}
 
-	total, err := strconv.Atoi(parts[1])
+func query_pitches(db store.Store, query postgrest.Query) ([]pitch_row, error) {
+	body, err := db.Query("pitch", query.String())
 	if err != nil {
-		return 0, err
+		return nil, fmt.Errorf("error fetching pitches: %w", err)
 	}
-
-	return total, nil
+	var pitches []pitch_row
+	if err := json.Unmarshal(body, &pitches); err != nil {
+		return nil, fmt.Errorf("error decoding pitches: %w", err)
+	}
+	return pitches, nil
 }
 
 // gets the pitch for the user
-func get_pitch_route(w http.ResponseWriter, r *http.Request) {
+func (h *handler) get_pitch_route(w http.ResponseWriter, r *http.Request) {
 	pitchID := r.URL.Query().Get("id")
 	user_id := r.URL.Query().Get("user_id")
 	search := r.URL.Query().Get("search")
@@ -359,352 +434,239 @@ func get_pitch_route(w http.ResponseWriter, r *http.Request) {
 	offset := r.URL.Query().Get("offset")
 	status := r.URL.Query().Get("status")
 	orderBy := r.URL.Query().Get("orderBy")
+	cursor := r.URL.Query().Get("cursor")
 
 	if pitchID == "" {
-		var queryParams []string
+		filters := postgrest.New()
 
+		// a search narrows the list to the pitches matching it, which come
+		// best first unless another order is asked for
+		var matches *pitch_matches
 		if search != "" {
-			queryParams = append(queryParams, fmt.Sprintf("title=ilike.*%s*", url.QueryEscape(search)))
+			found, err := h.search_pitches(search)
+			if err != nil {
+				logging.FromContext(r.Context()).Error("failed to search pitches", "err", err)
+				http.Error(w, "Error searching pitches", http.StatusInternalServerError)
+				return
+			}
+			if len(found.ids) == 0 {
+				w.Header().Set("X-Total-Count", "0")
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode([]frontend.Pitch{})
+				return
+			}
+			matches = &found
 		}
 
 		if user_id != "" {
-			queryParams = append(queryParams, fmt.Sprintf("user_id=eq.%s", user_id))
+			filters = filters.Eq("user_id", user_id)
 		}
 
 		if target_amount != "" {
-			queryParams = append(queryParams, fmt.Sprintf("target_amount=eq.%s", target_amount))
+			filters = filters.Eq("target_amount", target_amount)
 		}
 
 		if profit_share_percent != "" {
-			queryParams = append(queryParams, fmt.Sprintf("profit_share_percent=eq.%s", profit_share_percent))
+			filters = filters.Eq("profit_share_percent", profit_share_percent)
 		}
 
 		if investment_end_date != "" {
-			queryParams = append(queryParams, fmt.Sprintf("investment_end_date=eq.%s", investment_end_date))
+			filters = filters.Eq("investment_end_date", investment_end_date)
 		}
 
 		if status != "" {
-			queryParams = append(queryParams, fmt.Sprintf("status=eq.%s", status))
+			filters = filters.Eq("status", status)
 		}
 
-		limitValue := 0
-		if limit != "" && orderBy == "" { // Only apply limit at DB level if not sorting
-			if val, err := strconv.Atoi(limit); err == nil && val > 0 {
-				limitValue = val
-				queryParams = append(queryParams, fmt.Sprintf("limit=%d", limitValue))
+		// pitches with any of the tags, matched through a second inner embed
+		// of tags so the tags embedded in the result are still all of them
+		var tag_filter []string
+		if tags != "" {
+			var names []any
+			for _, name := range strings.Split(tags, ",") {
+				if name = strings.TrimSpace(name); name != "" {
+					names = append(names, name)
+				}
 			}
+			if len(names) == 0 {
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode([]frontend.Pitch{})
+				return
+			}
+			tag_filter = append(tag_filter, postgrest.Embed("tag_filter", "tags!inner", "id"))
+			filters = filters.In("tag_filter.name", names...)
 		}
 
-		if offset != "" {
-			offsetValue, err := strconv.Atoi(offset)
-			if err == nil && offsetValue > 0 {
-				queryParams = append(queryParams, fmt.Sprintf("offset=%d", offsetValue))
+		// the other filters are checked against every match, then a database
+		// order is given the best matches that fit in its query
+		if matches != nil {
+			if err := matches.narrow(h.db, filters, tag_filter); err != nil {
+				logging.FromContext(r.Context()).Error("failed to filter search matches", "err", err)
+				http.Error(w, "Error searching pitches", http.StatusInternalServerError)
+				return
 			}
+			if len(matches.ids) == 0 {
+				w.Header().Set("X-Total-Count", "0")
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode([]frontend.Pitch{})
+				return
+			}
+			filters = filters.In("id", matches.ids[:min(SEARCH_IDS_PER_QUERY, len(matches.ids))]...)
 		}
 
-		if tags != "" {
-			tagList := strings.Split(tags, ",")
-			for i := range tagList {
-				tagList[i] = strings.TrimSpace(tagList[i])
+		sort := pagination.ByID
+		if orderBy != "" {
+			parsed, err := pagination.ParseSort(orderBy, PITCH_SORT_FIELDS)
+			if err != nil {
+				http.Error(w, "Invalid orderBy", http.StatusBadRequest)
+				return
 			}
+			sort = parsed
+		}
 
-			var validTagIDs []string
-			for _, name := range tagList {
-				if name == "" {
-					continue
-				}
-				q := fmt.Sprintf("name=eq.%s", url.QueryEscape(name))
-				res, err := utils.GetDataByQuery("tags", q)
-				if err != nil {
-					continue
-				}
-				var t []struct {
-					ID int64 `json:"id"`
-				}
-				if json.Unmarshal(res, &t) == nil && len(t) > 0 {
-					validTagIDs = append(validTagIDs, strconv.FormatInt(t[0].ID, 10))
-				}
-			}
+		page_size := 0
+		if val, err := strconv.Atoi(limit); err == nil && val > 0 {
+			page_size = val
+		}
+		skip := 0
+		if val, err := strconv.Atoi(offset); err == nil && val > 0 {
+			skip = val
+		}
 
-			if len(validTagIDs) > 0 {
-				var pitchIDs []string
-				for _, tid := range validTagIDs {
-					linkRes, err := utils.GetDataByQuery("pitch_tags", "tag_id=eq."+tid)
-					if err != nil {
-						continue
-					}
-					var links []struct {
-						PitchID int64 `json:"pitch_id"`
-					}
-					if json.Unmarshal(linkRes, &links) == nil {
-						for _, l := range links {
-							pitchIDs = append(pitchIDs, strconv.FormatInt(l.PitchID, 10))
-						}
-					}
-				}
+		// matches in relevance order are paged here rather than in the
+		// database, only the page's pitches are read
+		by_relevance := matches != nil && orderBy == "" && cursor == ""
+		capped := matches != nil && !by_relevance && len(matches.ids) > SEARCH_IDS_PER_QUERY
 
-				if len(pitchIDs) == 0 {
-					w.Header().Set("Content-Type", "application/json")
-					json.NewEncoder(w).Encode([]frontend.Pitch{})
-					return
-				}
+		query := filters.Select(pitch_row_select(tag_filter...)...)
+		if by_relevance {
+			ids := matches.ids[min(skip, len(matches.ids)):]
+			if page_size > 0 {
+				ids = ids[:min(page_size, len(ids))]
+			}
+			ids = ids[:min(SEARCH_IDS_PER_QUERY, len(ids))]
+			query = postgrest.New().In("id", ids...).Select(pitch_row_select()...)
+		}
 
-				seen := make(map[string]bool)
-				var unique []string
-				for _, id := range pitchIDs {
-					if !seen[id] {
-						seen[id] = true
-						unique = append(unique, id)
-					}
-				}
-				queryParams = append(queryParams, "id=in.("+strings.Join(unique, ",")+")")
-			} else {
-				w.Header().Set("Content-Type", "application/json")
-				json.NewEncoder(w).Encode([]frontend.Pitch{})
+		// a cursor picks up after (or before) the row the last page ended
+		// at, in the order that page was in
+		var after *pagination.Cursor
+		if cursor != "" {
+			c, err := pagination.Decode(cursor, PITCH_SORT_FIELDS)
+			if err != nil {
+				http.Error(w, "Invalid cursor", http.StatusBadRequest)
+				return
+			}
+			if orderBy != "" && c.Sort != sort {
+				http.Error(w, "Cursor doesn't match orderBy", http.StatusBadRequest)
+				return
+			}
+			if offset != "" {
+				http.Error(w, "Use either cursor or offset", http.StatusBadRequest)
 				return
 			}
+			after, sort = &c, c.Sort
+			if page_size == 0 {
+				page_size = PITCH_PAGE_LIMIT
+			}
+			query = c.Apply(query)
+		} else if !by_relevance {
+			query = sort.Order(query, false)
+			if skip > 0 {
+				query = query.Offset(skip)
+			}
 		}
 
-		var result []byte
-		var err error
-
-		if len(queryParams) > 0 {
-			query := strings.Join(queryParams, "&")
-			result, err = utils.GetDataByQuery("pitch", query)
-		} else {
-			result, err = utils.GetAllData("pitch")
+		// one row past the page shows whether there's a next one
+		if page_size > 0 && !by_relevance {
+			query = query.Limit(page_size + 1)
 		}
 
+		filtered_pitches, err := h.read_pitches(query)
 		if err != nil {
+			logging.FromContext(r.Context()).Error("failed to read pitches", "err", err)
 			http.Error(w, "Error fetching pitches", http.StatusInternalServerError)
 			return
 		}
 
-		var filtered_pitches []database.Pitch
-		if err := json.Unmarshal(result, &filtered_pitches); err != nil {
-			http.Error(w, "Error decoding pitches", http.StatusInternalServerError)
-			return
-		}
-
-		totalCount, countErr := GetRowCount("pitch", queryParams)
-		if countErr != nil {
-			fmt.Printf("Warning: failed to count pitches: %v\n", countErr)
-			totalCount = len(filtered_pitches)
-		}
+		var page pagination.Page[pitch_row]
+		var totalCount int
+		if by_relevance {
+			matches.sort(filtered_pitches)
+			totalCount = len(matches.ids)
+			page.Rows = filtered_pitches
+		} else {
+			if page_size > 0 {
+				page = pagination.Paginate(filtered_pitches, page_size, sort, after, pitch_sort_key(sort.Field))
+			} else {
+				page.Rows = filtered_pitches
+			}
 
-		var pitchIDs []string
-		pitchIDMap := make(map[int64]database.Pitch)
-		for _, pitch := range filtered_pitches {
-			if pitch.PitchID != nil {
-				pitchIDs = append(pitchIDs, strconv.FormatInt(*pitch.PitchID, 10))
-				pitchIDMap[*pitch.PitchID] = pitch
+			var countErr error
+			totalCount, countErr = h.db.Count("pitch", filters.Select(append([]string{"id"}, tag_filter...)...).Limit(1).String())
+			if countErr != nil {
+				logging.FromContext(r.Context()).Warn("failed to count pitches", "err", countErr)
+				totalCount = len(page.Rows)
 			}
 		}
+		w.Header().Set("X-Total-Count", strconv.Itoa(totalCount))
+		// only the best matches could be put in the database's order
+		if capped {
+			w.Header().Set("X-Total-Count-Capped", "true")
+		}
 
-		if len(pitchIDs) == 0 {
+		if len(page.Rows) == 0 {
 			w.Header().Set("Content-Type", "application/json")
 			json.NewEncoder(w).Encode([]frontend.Pitch{})
 			return
 		}
 
-		investmentTiersMap := make(map[int64][]model.InvestmentTier)
-		if len(pitchIDs) > 0 {
-			query := fmt.Sprintf("pitch_id=in.(%s)", strings.Join(pitchIDs, ","))
-			tiersData, err := utils.GetDataByQuery("investment_tier", query)
-			if err == nil {
-				var allTiers []model.InvestmentTier
-				if json.Unmarshal(tiersData, &allTiers) == nil {
-					for _, tier := range allTiers {
-						investmentTiersMap[tier.PitchID] = append(investmentTiersMap[tier.PitchID], tier)
-					}
-				}
+		var pitches_to_send []frontend.Pitch
+		for _, pitch := range page.Rows {
+			to_send := pitch.to_frontend()
+			if matches != nil {
+				to_send.Highlights = matches.highlights[*pitch.PitchID]
 			}
+			pitches_to_send = append(pitches_to_send, to_send)
 		}
 
-		// gets the media for the pitch
-		mediaMap := make(map[int64][]frontend.PitchMedia)
-		if len(pitchIDs) > 0 {
-			query := fmt.Sprintf("pitch_id=in.(%s)", strings.Join(pitchIDs, ","))
-			mediaData, err := utils.GetDataByQuery("pitch_media", query)
-			if err == nil {
-				var allMedia []frontend.PitchMedia
-				if json.Unmarshal(mediaData, &allMedia) == nil {
-					for _, media := range allMedia {
-						if media.PitchID != nil {
-							mediaMap[*media.PitchID] = append(mediaMap[*media.PitchID], media)
-						}
-					}
-				}
-			}
+		response := map[string]interface{}{
+			"totalCount": totalCount,
+			"pitches":    pitches_to_send,
 		}
-
-		tagMap := make(map[int64][]string)
-		tagIDsMap := make(map[int64][]int64) // pitch_id -> []tag_id
-
-		// gets the tags for the pitch
-		if len(pitchIDs) > 0 {
-			query := fmt.Sprintf("pitch_id=in.(%s)", strings.Join(pitchIDs, ","))
-			tagLinksData, err := utils.GetDataByQuery("pitch_tags", query)
-			if err == nil {
-				var links []struct {
-					PitchID int64 `json:"pitch_id"`
-					TagID   int64 `json:"tag_id"`
-				}
-
-				if json.Unmarshal(tagLinksData, &links) == nil {
-					// Collect all tag IDs
-					var tagIDs []string
-					tagIDSet := make(map[int64]bool)
-
-					for _, link := range links {
-						tagIDsMap[link.PitchID] = append(tagIDsMap[link.PitchID], link.TagID)
-						if !tagIDSet[link.TagID] {
-							tagIDSet[link.TagID] = true
-							tagIDs = append(tagIDs, strconv.FormatInt(link.TagID, 10))
-						}
-					}
-
-					if len(tagIDs) > 0 {
-						query = fmt.Sprintf("id=in.(%s)", strings.Join(tagIDs, ","))
-						tagsData, err := utils.GetDataByQuery("tags", query)
-						if err == nil {
-							var allTags []struct {
-								ID   int64  `json:"id"`
-								Name string `json:"name"`
-							}
-
-							if json.Unmarshal(tagsData, &allTags) == nil {
-								tagNameMap := make(map[int64]string)
-								for _, tag := range allTags {
-									tagNameMap[tag.ID] = tag.Name
-								}
-
-								for pitchID, tagIDs := range tagIDsMap {
-									for _, tagID := range tagIDs {
-										if name, ok := tagNameMap[tagID]; ok {
-											tagMap[pitchID] = append(tagMap[pitchID], name)
-										}
-									}
-								}
-							}
-						}
-					}
-				}
-			}
+		if capped {
+			response["totalCountCapped"] = true
 		}
-
-		var pitches_to_send []frontend.Pitch
-		for _, pitch := range filtered_pitches {
-			if pitch.PitchID == nil {
-				continue
-			}
-
-			pitchID := *pitch.PitchID
-			investment_tiers := investmentTiersMap[pitchID]
-			media := mediaMap[pitchID]
-			tagNames := tagMap[pitchID]
-
-			front := mapping.Pitch_ToFrontend(pitch, investment_tiers, media, tagNames)
-			pitches_to_send = append(pitches_to_send, front)
+		if page.Next != "" {
+			response["nextCursor"] = page.Next
 		}
-
-		// sorts the pitches
-		if orderBy != "" {
-			var sortConfig misc.SortConfig
-			if err := json.Unmarshal([]byte(orderBy), &sortConfig); err == nil {
-				sortPitchesByField(pitches_to_send, sortConfig.Field, sortConfig.Direction == "desc")
-
-				if limit != "" {
-					if val, err := strconv.Atoi(limit); err == nil && val > 0 && val < len(pitches_to_send) {
-						pitches_to_send = pitches_to_send[:val]
-					}
-				}
-			} else {
-				fmt.Printf("Error parsing orderBy: %v\n", err)
-			}
+		if page.Prev != "" {
+			response["prevCursor"] = page.Prev
 		}
 
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"totalCount": totalCount,
-			"pitches":    pitches_to_send,
-		})
+		json.NewEncoder(w).Encode(response)
 		return
 	}
 
 	// gets the pitch for the user
-	result, err := utils.GetDataByID("pitch", pitchID)
+	pitches, err := h.read_pitches(postgrest.New().Select(pitch_row_select()...).Eq("id", pitchID))
 	if err != nil {
 		http.Error(w, "Pitch not found", http.StatusNotFound)
 		return
 	}
 
-	var pitches []database.Pitch
-	if err := json.Unmarshal([]byte(result), &pitches); err != nil {
-		http.Error(w, "Error decoding pitch", http.StatusInternalServerError)
-		fmt.Println("Body: ", string(result))
-		return
-	}
-
 	if len(pitches) != 1 {
 		http.Error(w, "Pitch not found", http.StatusNotFound)
 		return
 	}
 
-	pitch := pitches[0]
-
-	investment_tiers, invest_err := get_investment_tiers(pitch)
-	if invest_err != nil {
-		http.Error(w, "Error decoding investment tiers", http.StatusInternalServerError)
-		return
-	}
-
-	media, media_err := utils.GetPitchMedia(*pitch.PitchID)
-	if media_err != nil {
-		fmt.Printf("Warning: failed to fetch media for pitch %d: %v\n", *pitch.PitchID, media_err)
-		media = []frontend.PitchMedia{}
-	}
-
-	tagLinkRes, _ := utils.GetDataByQuery("pitch_tags", fmt.Sprintf("pitch_id=eq.%d", *pitch.PitchID))
-	var links []struct {
-		TagID int64 `json:"tag_id"`
-	}
-	json.Unmarshal(tagLinkRes, &links)
-	var tag_names []string
-	for _, l := range links {
-		tag_res, _ := utils.GetDataByID("tags", strconv.FormatInt(l.TagID, 10))
-		var tags []struct {
-			Name string `json:"name"`
-		}
-		if json.Unmarshal(tag_res, &tags) == nil && len(tags) > 0 {
-			tag_names = append(tag_names, tags[0].Name)
-		}
-	}
-
-	pitch_to_send := mapping.Pitch_ToFrontend(pitch, investment_tiers, media, tag_names)
-
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(pitch_to_send)
-}
-
-func getMinimumTierPrice(tiers []model.InvestmentTier) float64 {
-	if len(tiers) == 0 {
-		return math.MaxFloat64
-	}
-
-	minPrice := math.MaxFloat64
-	for _, tier := range tiers {
-		price := float64(tier.MinAmount)
-		if price < minPrice {
-			minPrice = price
-		}
-	}
-
-	return minPrice
+	json.NewEncoder(w).Encode(pitches[0].to_frontend())
 }
 
 // updates the pitch for the user
-func update_pitch_route(w http.ResponseWriter, r *http.Request) {
+func (h *handler) update_pitch_route(w http.ResponseWriter, r *http.Request) {
 	pitchIDStr := r.URL.Query().Get("id")
 	if pitchIDStr == "" {
 		http.Error(w, "Pitch not specified", http.StatusBadRequest)
@@ -716,7 +678,7 @@ func update_pitch_route(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	result, err := utils.GetDataByID("pitch", pitchIDStr)
+	result, err := h.db.GetByID("pitch", pitchIDStr)
 	if err != nil {
 		http.Error(w, "Pitch not found", http.StatusNotFound)
 		return
@@ -724,24 +686,19 @@ func update_pitch_route(w http.ResponseWriter, r *http.Request) {
 	var pitches []database.Pitch
 	if err := json.Unmarshal([]byte(result), &pitches); err != nil || len(pitches) != 1 {
 		http.Error(w, "Error decoding pitch", http.StatusInternalServerError)
-		fmt.Println("Body: ", string(result))
 		return
 	}
-	fmt.Println("Pitches: ", pitches)
 
 	// gets the old pitch for the user
 	old_pitch := pitches[0]
-	user_id, ok := utils.UserIDFromCtx(r.Context())
-	if !ok || user_id != old_pitch.UserID {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	subject, ok := h.subject(w, r)
+	if !ok || !authorize(w, policy.CanEditPitch(subject, old_pitch)) {
 		return
 	}
+	actor, _ := policy.CanChangePitchStatus(subject, old_pitch)
 
-	// checks if the user has the business role
-	fmt.Println("User ID: ", user_id)
-	if ok, _ := utilsdb.CheckUserRole(w, user_id, "business"); !ok {
-		return
-	}
+	// the pitch stays with its owner even when an admin edits it
+	user_id := old_pitch.UserID
 
 	// parses the new pitch data
 	contentType := r.Header.Get("Content-Type")
@@ -764,55 +721,78 @@ func update_pitch_route(w http.ResponseWriter, r *http.Request) {
 		defer r.Body.Close()
 	}
 
+	// a status change in the edit goes through the lifecycle like any other
+	new_status := lifecycle.State(new_pitch.Status)
+	if new_status == "" {
+		new_status = lifecycle.State(old_pitch.Status)
+	}
+	if err := lifecycle.Check(lifecycle.Of(old_pitch), new_status, actor); err != nil {
+		write_pitch_status_error(w, err)
+		return
+	}
+
 	// gets the old investment tiers for the pitch
-	if old_pitch.Status != "Draft" {
-		old_tiers, _ := get_investment_tiers(old_pitch)
+	if old_pitch.Status != string(lifecycle.Draft) {
+		old_tiers, _ := h.get_investment_tiers(old_pitch)
 		new_pitch.InvestmentTiers = old_tiers
 		new_pitch.TargetAmount = old_pitch.TargetAmount
 		new_pitch.ProfitSharePercent = old_pitch.ProfitSharePercent
 	}
 
 	// gets the old media for the pitch
-	old_tiers, _ := get_investment_tiers(old_pitch)
-	old_media, _ := utils.GetPitchMedia(pitchID)
+	old_tiers, _ := h.get_investment_tiers(old_pitch)
+	old_media, _ := utils.GetPitchMedia(h.db, pitchID)
 
-	//fmt.Println("Old pitch: ", old_pitch)
 	// creates the new pitch for the user
 
 	to_db := mapping.Pitch_ToDatabase(new_pitch, user_id)
 	to_db.PitchID = nil
 	to_db.CreatedAt = "now()"
 	to_db.UpdatedAt = &to_db.CreatedAt
-	//fmt.Println("To db: ", to_db)
-	_, err = utils.UpdateByID("pitch", pitchIDStr, to_db)
+
+	// raised_amount only changes through investment reservations, so an edit
+	// must never write it back
+	var payload map[string]interface{}
+	raw, _ := json.Marshal(to_db)
+	if err := json.Unmarshal(raw, &payload); err != nil {
+		http.Error(w, "Failed to encode pitch", http.StatusInternalServerError)
+		return
+	}
+	delete(payload, "raised_amount")
+	delete(payload, "status")
+	if err := lifecycle.Apply(h.db, lifecycle.Of(old_pitch), new_status, actor); err != nil {
+		write_pitch_status_error(w, err)
+		return
+	}
+	_, err = h.db.UpdateByID("pitch", pitchIDStr, payload)
 	if err != nil {
 		http.Error(w, "Failed to update pitch", http.StatusInternalServerError)
 		return
 	}
 
 	// deletes the old investment tiers for the pitch
-	if old_pitch.Status == "Draft" {
+	if old_pitch.Status == string(lifecycle.Draft) {
 		for _, t := range old_tiers {
 			if t.ID != nil {
-				utils.DeleteByID("investment_tier", strconv.FormatInt(*t.ID, 10))
+				h.db.DeleteByID("investment_tier", strconv.FormatInt(*t.ID, 10))
 			}
 		}
 		// creates the new investment tiers for the pitch
 		for _, tier := range new_pitch.InvestmentTiers {
 			tier.PitchID = pitchID
-			utils.InsertData(tier, "investment_tier")
+			h.db.Insert("investment_tier", tier)
 		}
 	}
 
 	// deletes the old tags for the pitch
-	utils.DeletePitchTags(pitchID)
+	h.db.DeleteByQuery("pitch_tags", postgrest.New().Eq("pitch_id", pitchID).String())
 	for _, tagName := range new_pitch.Tags {
 		tagName = strings.TrimSpace(tagName)
 		if tagName == "" {
 			continue
 		}
-		tagQuery := fmt.Sprintf("name=eq.%s", url.QueryEscape(tagName))
-		tagRes, err := utils.GetDataByQuery("tags", tagQuery)
+		tagQuery := postgrest.New().Eq("name", tagName)
+		tagRes, err := h.db.Query("tags", tagQuery.String())
 		var tagID int64
 		if err == nil && len(tagRes) > 2 {
 			var tags []struct {
@@ -823,7 +803,7 @@ func update_pitch_route(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 		if tagID == 0 {
-			createRes, err := utils.InsertData(map[string]interface{}{"name": tagName}, "tags")
+			createRes, err := h.db.Insert("tags", map[string]interface{}{"name": tagName})
 			if err != nil {
 				continue
 			}
@@ -836,10 +816,10 @@ func update_pitch_route(w http.ResponseWriter, r *http.Request) {
 				continue
 			}
 		}
-		utils.InsertData(map[string]interface{}{
+		h.db.Insert("pitch_tags", map[string]interface{}{
 			"pitch_id": pitchID,
 			"tag_id":   tagID,
-		}, "pitch_tags")
+		})
 	}
 
 	keep_media_ids := make(map[int64]bool)
@@ -852,8 +832,8 @@ func update_pitch_route(w http.ResponseWriter, r *http.Request) {
 	// deletes the old media for the pitch
 	for _, m := range old_media {
 		if m.ID != nil && !keep_media_ids[*m.ID] {
-			utils.DeleteFileFromS3(m.URL)
-			utils.DeleteByID("pitch_media", strconv.FormatInt(*m.ID, 10))
+			utils.DeleteFileFromS3(r.Context(), h.upstream, h.cfg.Supabase, m.URL)
+			h.db.DeleteByID("pitch_media", strconv.FormatInt(*m.ID, 10))
 		}
 	}
 
@@ -869,7 +849,7 @@ func update_pitch_route(w http.ResponseWriter, r *http.Request) {
 				mediaType = ct[0]
 			}
 			fileName := utils.GenerateUniqueFileName(fmt.Sprintf("pitch_%d", pitchID), ext)
-			url, _ := utils.UploadFileToS3(file, fileName, mediaType)
+			url, _ := utils.UploadFileToS3(r.Context(), h.upstream, h.cfg.Supabase, file, fileName, mediaType)
 			file.Close()
 			entry := frontend.PitchMedia{
 				PitchID:            &pitchID,
@@ -877,7 +857,7 @@ func update_pitch_route(w http.ResponseWriter, r *http.Request) {
 				MediaType:          mediaType,
 				OrderInDescription: int64(i + 1),
 			}
-			utils.InsertData(mapping.PitchMedia_ToDatabase(entry, pitchID), "pitch_media")
+			h.db.Insert("pitch_media", mapping.PitchMedia_ToDatabase(entry, pitchID))
 			media_files = append(media_files, entry)
 		}
 	}
@@ -895,7 +875,7 @@ func update_pitch_route(w http.ResponseWriter, r *http.Request) {
 			m.OrderInDescription = int64(i + 1)
 		}
 		m.PitchID = &pitchID
-		res, _ := utils.InsertData(mapping.PitchMedia_ToDatabase(m, pitchID), "pitch_media")
+		res, _ := h.db.Insert("pitch_media", mapping.PitchMedia_ToDatabase(m, pitchID))
 		var ids []model.ID
 		if json.Unmarshal([]byte(res), &ids) == nil && len(ids) > 0 {
 			m.ID = &ids[0].ID
@@ -903,19 +883,11 @@ func update_pitch_route(w http.ResponseWriter, r *http.Request) {
 		media_files = append(media_files, m)
 	}
 
-	tagLinkRes, _ := utils.GetDataByQuery("pitch_tags", fmt.Sprintf("pitch_id=eq.%d", pitchID))
-	var links []struct {
-		TagID int64 `json:"tag_id"`
-	}
-	json.Unmarshal(tagLinkRes, &links)
 	var tagNames []string
-	for _, l := range links {
-		tagRes, _ := utils.GetDataByID("tags", strconv.FormatInt(l.TagID, 10))
-		var tags []struct {
-			Name string `json:"name"`
-		}
-		if json.Unmarshal(tagRes, &tags) == nil && len(tags) > 0 {
-			tagNames = append(tagNames, tags[0].Name)
+	updated, _ := h.read_pitches(postgrest.New().Select(postgrest.Embed("", "tags", "name")).Eq("id", pitchID))
+	if len(updated) == 1 {
+		for _, tag := range updated[0].Tags {
+			tagNames = append(tagNames, tag.Name)
 		}
 	}
 
@@ -923,13 +895,15 @@ func update_pitch_route(w http.ResponseWriter, r *http.Request) {
 	response.PitchID = &pitchID
 	response.Media = media_files
 	response.Tags = tagNames
+	h.index_pitch(response)
+	h.record(r, audit.Entry{Action: AUDIT_UPDATE_PITCH, TargetType: "pitch", TargetID: pitchIDStr}, old_pitch, response)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
 // updates the pitch status for the user
-func update_pitch_status_route(w http.ResponseWriter, r *http.Request) {
+func (h *handler) update_pitch_status_route(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPatch {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
@@ -956,28 +930,35 @@ func update_pitch_status_route(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// gets the user id from the context
-	userID, ok := utils.UserIDFromCtx(r.Context())
-	if !ok {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	// gets the pitch for the user
+	result, err := h.db.GetByID("pitch", pitchIDStr)
+	if err != nil {
+		http.Error(w, "Pitch not found", http.StatusNotFound)
 		return
 	}
-
-	// checks if the user has the business role
-	if ok, _ := utilsdb.CheckUserRole(w, userID, "business"); !ok {
+	var pitches []database.Pitch
+	if err := json.Unmarshal(result, &pitches); err != nil || len(pitches) != 1 {
+		http.Error(w, "Pitch not found", http.StatusNotFound)
 		return
 	}
 
-	updateData := map[string]interface{}{
-		"status": payload.Status,
+	subject, ok := h.subject(w, r)
+	if !ok {
+		return
+	}
+	actor, err := policy.CanChangePitchStatus(subject, pitches[0])
+	if !authorize(w, err) {
+		return
 	}
 
-	// updates the pitch status for the user
-	_, err := utils.UpdateByID("pitch", pitchIDStr, updateData)
-	if err != nil {
-		http.Error(w, "Failed to update status", http.StatusInternalServerError)
+	// moves the pitch through the lifecycle, rejecting illegal transitions
+	if err := lifecycle.Apply(h.db, lifecycle.Of(pitches[0]), lifecycle.State(payload.Status), actor); err != nil {
+		write_pitch_status_error(w, err)
 		return
 	}
+	h.record(r, audit.Entry{Action: AUDIT_CHANGE_PITCH_STATUS, TargetType: "pitch", TargetID: pitchIDStr},
+		map[string]string{"status": pitches[0].Status},
+		map[string]string{"status": payload.Status})
 
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{
@@ -985,57 +966,32 @@ func update_pitch_status_route(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// deletes the pitch tags for the pitch
-func DeletePitchTags(pitchID int64) error {
-	query := fmt.Sprintf("pitch_id=eq.%d", pitchID)
-	url := fmt.Sprintf("%s/rest/v1/pitch_tags?%s", os.Getenv("SUPABASE_URL"), query)
-	req, err := http.NewRequest("DELETE", url, nil)
+// moves the pitch to the state as the actor, reading its current state first
+func (h *handler) move_pitch(pitch_id int64, to lifecycle.State, actor lifecycle.Actor) error {
+	body, err := h.db.GetByID("pitch", strconv.FormatInt(pitch_id, 10))
 	if err != nil {
 		return err
 	}
-	key := os.Getenv("SUPABASE_SERVICE_ROLE_KEY")
-	req.Header.Set("apikey", key)
-	req.Header.Set("Authorization", "Bearer "+key)
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
+	var pitches []database.Pitch
+	if err := json.Unmarshal(body, &pitches); err != nil {
 		return err
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusNoContent {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("delete pitch_tags failed: %d, body: %s", resp.StatusCode, string(body))
+	if len(pitches) != 1 {
+		return fmt.Errorf("pitch %d not found", pitch_id)
 	}
-	return nil
+	return lifecycle.Apply(h.db, lifecycle.Of(pitches[0]), to, actor)
 }
 
-// sorts the pitches by field
-func sortPitchesByField(pitches []frontend.Pitch, field string, descending bool) {
-	sort.Slice(pitches, func(i, j int) bool {
-		var result bool
-
-		switch field {
-		case "title":
-			result = pitches[i].ProductTitle < pitches[j].ProductTitle
-		case "target_amount":
-			result = pitches[i].TargetAmount < pitches[j].TargetAmount
-		case "profit_share_percent":
-			result = pitches[i].ProfitSharePercent < pitches[j].ProfitSharePercent
-		case "raised_amount":
-			result = pitches[i].RaisedAmount < pitches[j].RaisedAmount
-		case "investment_start_date":
-			result = pitches[i].InvestmentStartDate < pitches[j].InvestmentStartDate
-		case "investment_end_date":
-			result = pitches[i].InvestmentEndDate < pitches[j].InvestmentEndDate
-		case "price":
-			result = getMinimumTierPrice(pitches[i].InvestmentTiers) < getMinimumTierPrice(pitches[j].InvestmentTiers)
-		default:
-			return false
-		}
-
-		if descending {
-			return !result
-		}
-		return result
-	})
+// writes the response for a pitch status change the lifecycle refused
+func write_pitch_status_error(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, lifecycle.ErrUnknownState):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, lifecycle.ErrNotAllowed):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, lifecycle.ErrIllegalTransition), errors.Is(err, lifecycle.ErrStale):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, "Failed to update status", http.StatusInternalServerError)
+	}
 }
@@ -0,0 +1,158 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/model/frontend"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/postgrest"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/search"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/store"
+)
+
+// how often the search index is reloaded from the database in the
+// background, picking up pitches changed through other instances or other
+// than through the pitch routes
+const SEARCH_INDEX_REFRESH = 30 * time.Second
+
+// the most search matches put in one query's id filter, which has to fit in
+// the URL
+const SEARCH_IDS_PER_QUERY = 500
+
+// the pitch fields searched and how much a match in each counts
+var PITCH_SEARCH_FIELDS = []search.Field{
+	{Name: "title", Weight: 3},
+	{Name: "tags", Weight: 2},
+	{Name: "elevator_pitch", Weight: 1.5},
+	{Name: "detailed_pitch", Weight: 1},
+}
+
+// PitchIndex is the search index of the pitches. The pitch routes keep it up
+// to date with their own changes and Run reloads it for everyone else's.
+type PitchIndex struct {
+	*search.Index
+	db store.Store
+}
+
+// creates an empty index of the pitches in the data store, it's loaded by
+// the first search or by Run
+func NewPitchIndex(db store.Store) *PitchIndex {
+	return &PitchIndex{Index: search.New(PITCH_SEARCH_FIELDS...), db: db}
+}
+
+// reloads the index every interval until ctx is done
+func (x *PitchIndex) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := x.Refresh(0, x.documents); err != nil {
+			slog.Warn("search index reload failed", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// the pitches a search matched
+type pitch_matches struct {
+	ids        []any // best first
+	rank       map[int64]int
+	highlights map[int64]map[string]string
+}
+
+func pitch_document(id int64, title, elevator_pitch, detailed_pitch string, tags []string) search.Document {
+	return search.Document{ID: id, Fields: map[string]string{
+		"title":          title,
+		"tags":           strings.Join(tags, ", "),
+		"elevator_pitch": elevator_pitch,
+		"detailed_pitch": detailed_pitch,
+	}}
+}
+
+// adds the pitch to the search index, or updates it there
+func (h *handler) index_pitch(pitch frontend.Pitch) {
+	if pitch.PitchID == nil {
+		return
+	}
+	h.search.Put(pitch_document(*pitch.PitchID, pitch.ProductTitle, pitch.ElevatorPitch, pitch.DetailedPitch, pitch.Tags))
+}
+
+// reads every pitch's searched fields for the search index
+func (x *PitchIndex) documents() ([]search.Document, error) {
+	pitches, err := query_pitches(x.db, postgrest.New().Select("id", "title", "elevator_pitch", "detailed_pitch", postgrest.Embed("", "tags", "name")))
+	if err != nil {
+		return nil, err
+	}
+	docs := make([]search.Document, 0, len(pitches))
+	for _, p := range pitches {
+		var tags []string
+		for _, tag := range p.Tags {
+			tags = append(tags, tag.Name)
+		}
+		docs = append(docs, pitch_document(*p.PitchID, p.Title, p.ElevatorPitch, p.DetailedPitch, tags))
+	}
+	return docs, nil
+}
+
+// finds every pitch matching the search text, loading the index first if
+// nothing has yet. Text without any words in it matches nothing.
+func (h *handler) search_pitches(text string) (pitch_matches, error) {
+	if !h.search.Loaded() {
+		if err := h.search.Refresh(SEARCH_INDEX_REFRESH, h.search.documents); err != nil {
+			return pitch_matches{}, err
+		}
+	}
+	hits, err := h.search.Search(text, 0)
+	if errors.Is(err, search.ErrEmptyQuery) {
+		return pitch_matches{}, nil
+	}
+	if err != nil {
+		return pitch_matches{}, err
+	}
+
+	matches := pitch_matches{
+		rank:       make(map[int64]int, len(hits)),
+		highlights: make(map[int64]map[string]string, len(hits)),
+	}
+	for i, hit := range hits {
+		matches.ids = append(matches.ids, hit.ID)
+		matches.rank[hit.ID] = i
+		matches.highlights[hit.ID] = hit.Highlights
+	}
+	return matches, nil
+}
+
+// drops the matches the filters rule out, keeping the rest in order. The
+// filters are checked on a chunk of ids at a time so each query stays short.
+func (m *pitch_matches) narrow(db store.Store, filters postgrest.Query, extra_select []string) error {
+	if filters.String() == "" {
+		return nil
+	}
+	kept := make(map[any]bool, len(m.ids))
+	for chunk := range slices.Chunk(m.ids, SEARCH_IDS_PER_QUERY) {
+		rows, err := query_pitches(db, filters.In("id", chunk...).Select(append([]string{"id"}, extra_select...)...))
+		if err != nil {
+			return err
+		}
+		for _, p := range rows {
+			kept[*p.PitchID] = true
+		}
+	}
+	m.ids = slices.DeleteFunc(m.ids, func(id any) bool { return !kept[id] })
+	return nil
+}
+
+// puts the pitches in the order of the matches, best first
+func (m pitch_matches) sort(pitches []pitch_row) {
+	slices.SortFunc(pitches, func(a, b pitch_row) int {
+		return m.rank[*a.PitchID] - m.rank[*b.PitchID]
+	})
+}
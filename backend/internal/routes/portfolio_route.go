@@ -2,69 +2,70 @@ package routes
 
 import (
 	"encoding/json"
-	"fmt"
-	"log"
 	"net/http"
 
+	model "github.com/EmmaMartin123/Industrial_Project/backend/internal/model/common"
 	"github.com/EmmaMartin123/Industrial_Project/backend/internal/model/frontend"
-	"github.com/EmmaMartin123/Industrial_Project/backend/internal/utils"
-	utilsdb "github.com/EmmaMartin123/Industrial_Project/backend/internal/utils/db"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/policy"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/postgrest"
 )
 
-func portfolio_route(w http.ResponseWriter, r *http.Request) {
+func (h *handler) portfolio_route(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
-		get_portfolio_route(w, r)
+		h.get_portfolio_route(w, r)
 	default:
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 	}
 }
 
 // gets the portfolio for the user
-func get_portfolio_route(w http.ResponseWriter, r *http.Request) {
+func (h *handler) get_portfolio_route(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	user_id, ok := utils.UserIDFromCtx(r.Context())
-	if !ok {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}	
-
 	// checks if the user has the investor role
-	if ok, _ := utilsdb.CheckUserRole(w, user_id, "investor"); !ok {
+	subject, ok := h.subject(w, r)
+	if !ok || !authorize(w, policy.CanViewInvestments(subject)) {
 		return
 	}
+	user_id := subject.UserID
 
 	// gets the portfolio for the user
-	query := fmt.Sprintf("select=id,amount,created_at,pitch:pitch(id,title,target_amount,raised_amount,status),tier:investment_tier(name,multiplier),profit_distributions(amount,paid)&investor_id=eq.%s&refunded=is.false&profit_distributions.investor_id=eq.%s&order=created_at.desc", user_id, user_id)
-
-	body, err := utils.GetDataByQuery("investments", query)
+	query := postgrest.New().
+		Select("id", "amount", "created_at",
+			postgrest.Embed("pitch", "pitch", "id", "title", "target_amount", "raised_amount", "status"),
+			postgrest.Embed("tier", "investment_tier", "name", "multiplier"),
+			postgrest.Embed("", "profit_distributions", "amount", "paid")).
+		Eq("investor_id", user_id).
+		Is("refunded", postgrest.False).
+		Eq("profit_distributions.investor_id", user_id).
+		Order("created_at", postgrest.Desc).
+		String()
+
+	body, err := h.db.Query("investments", query)
 	if err != nil {
 		http.Error(w, "Failed to fetch portfolio data", http.StatusInternalServerError)
 		return
 	}
 
-	log.Println("RAW RESPONSE: ", string(body))
 	var rawData []frontend.InvRow
 	if err := json.Unmarshal(body, &rawData); err != nil {
 		http.Error(w, "Failed to parse portfolio data", http.StatusInternalServerError)
 		return
 	}
-	log.Println(rawData)
 
 	portfolioItems := make([]frontend.PortfolioItem, 0, len(rawData))
 
 	for _, item := range rawData {
-		amount := float64(item.Amount)
-		var total_profit float64
+		var total_profit model.Money
 
 		for _, profit := range item.ProfitDistributions {
-			total_profit += float64(profit.Amount)
+			total_profit = total_profit.Add(profit.Amount)
 		}
 
 		var roi float64
-		if amount > 0 {
-			roi = total_profit / amount
+		if item.Amount.IsPositive() {
+			roi = total_profit.Float64() / item.Amount.Float64()
 		}
 
 		portfolioItems = append(portfolioItems, frontend.PortfolioItem{
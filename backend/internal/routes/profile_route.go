@@ -2,29 +2,32 @@ package routes
 
 import (
 	"encoding/json"
-	"fmt"
 	"net/http"
 	"strings"
 
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/audit"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/logging"
 	model "github.com/EmmaMartin123/Industrial_Project/backend/internal/model/common"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/policy"
 	"github.com/EmmaMartin123/Industrial_Project/backend/internal/utils"
+	utilsdb "github.com/EmmaMartin123/Industrial_Project/backend/internal/utils/db"
 )
 
-func profile_route(w http.ResponseWriter, r *http.Request) {
+func (h *handler) profile_route(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
-		get_profile_route(w, r)
+		h.get_profile_route(w, r)
 	case http.MethodPost:
-		create_profile_route(w, r)
+		h.create_profile_route(w, r)
 	case http.MethodPatch:
-		update_profile_route(w, r)
+		h.update_profile_route(w, r)
 	default:
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 	}
 }
 
 // creates the profile for the user
-func create_profile_route(w http.ResponseWriter, r *http.Request) {
+func (h *handler) create_profile_route(w http.ResponseWriter, r *http.Request) {
 	user_id, ok := utils.UserIDFromCtx(r.Context())
 	if !ok {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
@@ -45,15 +48,20 @@ func create_profile_route(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "display_name and role are required", http.StatusBadRequest)
 		return
 	}
+	// admins are only made through the admin role route
+	if req.Role != policy.Investor && req.Role != policy.Business {
+		http.Error(w, "role must be investor or business", http.StatusBadRequest)
+		return
+	}
 
-	email, err := utils.GetAuthUserEmail(user_id)
+	email, err := utils.GetAuthUserEmail(r.Context(), h.upstream, h.cfg.Supabase, user_id)
 	if err != nil {
-		fmt.Printf("Error fetching email for user %s: %v\n", user_id, err)
+		logging.FromContext(r.Context()).Error("failed to fetch user email", "err", err)
 		http.Error(w, "Failed to fetch user email from auth", http.StatusInternalServerError)
 		return
 	}
 
-	balance := int64(0)
+	balance := model.Money{}
 	profile := model.Profile{
 		ID:               user_id,
 		Email:            email,
@@ -62,24 +70,26 @@ func create_profile_route(w http.ResponseWriter, r *http.Request) {
 		DashboardBalance: &balance,
 	}
 
-	_, err = utils.InsertData(profile, "profile")
+	_, err = h.db.Insert("profile", profile)
 	if err != nil {
 		if strings.Contains(err.Error(), "duplicate") || strings.Contains(err.Error(), "409") {
 			http.Error(w, "Profile already exists", http.StatusConflict)
 			return
 		}
+		logging.FromContext(r.Context()).Error("failed to create profile", "err", err)
 		http.Error(w, "Failed to create profile", http.StatusInternalServerError)
-		fmt.Printf("Error creating profile user %s: %v\n", user_id, err)
 		return
 	}
 
+	h.record(r, audit.Entry{Action: AUDIT_CREATE_PROFILE, TargetType: "profile", TargetID: user_id}, nil, profile)
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(profile)
 }
 
 // gets the profile for the user
-func get_profile_route(w http.ResponseWriter, r *http.Request) {
+func (h *handler) get_profile_route(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	auth_user_id, ok := utils.UserIDFromCtx(r.Context())
@@ -91,7 +101,7 @@ func get_profile_route(w http.ResponseWriter, r *http.Request) {
 	requested_id := r.URL.Query().Get("id")
 
 	if requested_id == "" {
-		body, err := utils.GetAllData("profile")
+		body, err := h.db.Query("profile", "")
 		if err != nil {
 			http.Error(w, "Failed to fetch profiles", http.StatusInternalServerError)
 			return
@@ -111,7 +121,7 @@ func get_profile_route(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	body, err := utils.GetDataByID("profile", requested_id)
+	body, err := h.db.GetByID("profile", requested_id)
 	if err != nil {
 		http.Error(w, "Profile not found", http.StatusNotFound)
 		return
@@ -132,7 +142,7 @@ func get_profile_route(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(profile)
 }
 
-func update_profile_route(w http.ResponseWriter, r *http.Request) {
+func (h *handler) update_profile_route(w http.ResponseWriter, r *http.Request) {
 	user_id, ok := utils.UserIDFromCtx(r.Context())
 	if !ok {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
@@ -158,13 +168,19 @@ func update_profile_route(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err := utils.UpdateByID("profile", user_id, payload)
+	before, err := utilsdb.GetUserProfile(h.db, user_id)
+	if err != nil {
+		http.Error(w, "Profile not found", http.StatusNotFound)
+		return
+	}
+
+	_, err = h.db.UpdateByID("profile", user_id, payload)
 	if err != nil {
 		http.Error(w, "Failed to update profile", http.StatusInternalServerError)
 		return
 	}
 
-	body, err := utils.GetDataByID("profile", user_id)
+	body, err := h.db.GetByID("profile", user_id)
 	if err != nil {
 		http.Error(w, "Profile missing after update", http.StatusNotFound)
 		return
@@ -176,6 +192,8 @@ func update_profile_route(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	h.record(r, audit.Entry{Action: AUDIT_UPDATE_PROFILE, TargetType: "profile", TargetID: user_id}, before, profiles[0])
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(profiles[0])
 }
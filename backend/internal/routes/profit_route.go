@@ -5,26 +5,30 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
-	"strings"
 
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/audit"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/lifecycle"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/logging"
 	"github.com/EmmaMartin123/Industrial_Project/backend/internal/model/database"
 	"github.com/EmmaMartin123/Industrial_Project/backend/internal/model/frontend"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/policy"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/postgrest"
 	"github.com/EmmaMartin123/Industrial_Project/backend/internal/utils"
 )
 
-func profit_route(w http.ResponseWriter, r *http.Request) {
+func (h *handler) profit_route(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodPost:
-		declare_profit_route(w, r)
+		h.declare_profit_route(w, r)
 	case http.MethodGet:
-		get_profit_route(w, r)
+		h.get_profit_route(w, r)
 	default:
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 	}
 }
 
 // declares the profit for the user
-func declare_profit_route(w http.ResponseWriter, r *http.Request) {
+func (h *handler) declare_profit_route(w http.ResponseWriter, r *http.Request) {
 	var req frontend.Profit
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -33,18 +37,18 @@ func declare_profit_route(w http.ResponseWriter, r *http.Request) {
 	}
 	defer r.Body.Close()
 
-	if req.PitchID <= 0 || req.TotalProfit <= 0 {
+	if req.PitchID <= 0 || !req.TotalProfit.IsPositive() {
 		http.Error(w, "pitch_id and total_profit must be positive", http.StatusBadRequest)
 		return
 	}
 
-	user_id, ok := utils.UserIDFromCtx(r.Context())
+	subject, ok := h.subject(w, r)
 	if !ok {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
+	user_id := subject.UserID
 
-	pitch_body, err := utils.GetDataByID("pitch", strconv.FormatInt(req.PitchID, 10))
+	pitch_body, err := h.db.GetByID("pitch", strconv.FormatInt(req.PitchID, 10))
 	if err != nil {
 		http.Error(w, "Pitch not found", http.StatusNotFound)
 		return
@@ -54,12 +58,17 @@ func declare_profit_route(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Pitch not found", http.StatusNotFound)
 		return
 	}
-	if pitches[0].UserID != user_id {
-		http.Error(w, "Unauthorized: you do not own this pitch", http.StatusUnauthorized)
+	if !authorize(w, policy.CanDeclareProfit(subject, pitches[0])) {
 		return
 	}
 
-	distributable_amount := req.TotalProfit * (pitches[0].ProfitSharePercent / 100.0)
+	// profit can only be declared once the pitch is funded
+	if err := lifecycle.Check(lifecycle.Of(pitches[0]), lifecycle.Declared, lifecycle.Owner); err != nil {
+		write_pitch_status_error(w, err)
+		return
+	}
+
+	distributable_amount := req.TotalProfit.Mul(pitches[0].ProfitSharePercent / 100.0)
 
 	profit := database.Profit{
 		PitchID:             req.PitchID,
@@ -71,16 +80,19 @@ func declare_profit_route(w http.ResponseWriter, r *http.Request) {
 		Transferred:         false,
 	}
 
-	result, err := utils.InsertData(profit, "profits")
+	result, err := h.db.Insert("profits", profit)
 	if err != nil {
 		utils.WriteError(w, fmt.Errorf("failed to declare profit: %w", err), http.StatusInternalServerError)
 		return
 	}
 
-	status_update := map[string]interface{}{"status": "Declared"}
-	_, err = utils.UpdateByID("pitch", strconv.FormatInt(req.PitchID, 10), status_update)
-	if err != nil {
-		fmt.Printf("Warning: failed to update pitch %d status to 'Declared': %v\n", req.PitchID, err)
+	var declared []database.Profit
+	if err := json.Unmarshal(result, &declared); err == nil && len(declared) == 1 {
+		h.record(r, audit.Entry{Action: AUDIT_DECLARE_PROFIT, TargetType: "profits", TargetID: strconv.FormatInt(declared[0].ID, 10)}, nil, declared[0])
+	}
+
+	if err := h.move_pitch(req.PitchID, lifecycle.Declared, lifecycle.Owner); err != nil {
+		logging.FromContext(r.Context()).Warn("failed to move pitch to Declared", "pitch_id", req.PitchID, "err", err)
 		// Don't fail request just cause status can't be updated
 	}
 
@@ -90,18 +102,18 @@ func declare_profit_route(w http.ResponseWriter, r *http.Request) {
 }
 
 // gets the profit for the user
-func get_profit_route(w http.ResponseWriter, r *http.Request) {
-	user_id, ok := utils.UserIDFromCtx(r.Context())
+func (h *handler) get_profit_route(w http.ResponseWriter, r *http.Request) {
+	subject, ok := h.subject(w, r)
 	if !ok {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
+	user_id := subject.UserID
 
 	profit_id := r.URL.Query().Get("id")
 	pitch_id_str := r.URL.Query().Get("pitch_id")
 
 	if profit_id != "" {
-		body, err := utils.GetDataByID("profits", profit_id)
+		body, err := h.db.GetByID("profits", profit_id)
 		if err != nil {
 			http.Error(w, "Profit not found", http.StatusNotFound)
 			return
@@ -113,7 +125,7 @@ func get_profit_route(w http.ResponseWriter, r *http.Request) {
 		}
 		profit := profits[0]
 
-		pitch_body, err := utils.GetDataByID("pitch", strconv.FormatInt(profit.PitchID, 10))
+		pitch_body, err := h.db.GetByID("pitch", strconv.FormatInt(profit.PitchID, 10))
 		if err != nil {
 			http.Error(w, "Associated pitch not found", http.StatusNotFound)
 			return
@@ -123,8 +135,7 @@ func get_profit_route(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "Associated pitch not found", http.StatusNotFound)
 			return
 		}
-		if pitches[0].UserID != user_id {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		if !authorize(w, policy.CanViewProfits(subject, pitches[0])) {
 			return
 		}
 
@@ -134,7 +145,7 @@ func get_profit_route(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if pitch_id_str != "" {
-		pitch_body, err := utils.GetDataByID("pitch", pitch_id_str)
+		pitch_body, err := h.db.GetByID("pitch", pitch_id_str)
 		if err != nil {
 			http.Error(w, "Pitch not found", http.StatusNotFound)
 			return
@@ -144,12 +155,11 @@ func get_profit_route(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "Pitch not found", http.StatusNotFound)
 			return
 		}
-		if pitches[0].UserID != user_id {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		if !authorize(w, policy.CanViewProfits(subject, pitches[0])) {
 			return
 		}
 
-		body, err := utils.GetDataByQuery("profits", "pitch_id=eq."+pitch_id_str)
+		body, err := h.db.Query("profits", postgrest.New().Eq("pitch_id", pitch_id_str).String())
 		if err != nil {
 			utils.WriteError(w, fmt.Errorf("failed to fetch profits: %w", err), http.StatusInternalServerError)
 			return
@@ -159,7 +169,7 @@ func get_profit_route(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	pitch_body, err := utils.GetDataByQuery("pitch", "user_id=eq."+user_id)
+	pitch_body, err := h.db.Query("pitch", postgrest.New().Eq("user_id", user_id).String())
 	if err != nil {
 		utils.WriteError(w, fmt.Errorf("failed to fetch user pitches: %w", err), http.StatusInternalServerError)
 		return
@@ -176,14 +186,13 @@ func get_profit_route(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var pitch_ids []string
+	var pitch_ids []any
 	for _, p := range user_pitches {
-		pitch_ids = append(pitch_ids, strconv.FormatInt(*p.PitchID, 10))
+		pitch_ids = append(pitch_ids, *p.PitchID)
 	}
-	pitch_id_list := strings.Join(pitch_ids, ",")
-	query := "pitch_id=in.(" + pitch_id_list + ")"
+	query := postgrest.New().In("pitch_id", pitch_ids...)
 
-	body, err := utils.GetDataByQuery("profits", query)
+	body, err := h.db.Query("profits", query.String())
 	if err != nil {
 		utils.WriteError(w, fmt.Errorf("failed to fetch profits: %w", err), http.StatusInternalServerError)
 		return
@@ -1,33 +1,135 @@
 package routes
 
 import (
-	"fmt"
+	"context"
+	"log/slog"
 	"net/http"
 
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/allocation"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/audit"
 	"github.com/EmmaMartin123/Industrial_Project/backend/internal/auth"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/config"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/ledger"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/metrics"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/reservation"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/saga"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/store"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/tracing"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/upstream"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/utils"
 )
 
-func SetupRouter() http.Handler {
+// holds the dependencies shared by the route handlers
+type handler struct {
+	cfg          *config.Config
+	upstream     *upstream.Client
+	db           store.Store
+	audit        *audit.Log
+	ledger       *ledger.Ledger
+	outbox       *saga.Outbox
+	reservations *reservation.Reservations
+	residue      allocation.Policy
+	search       *PitchIndex
+	jwt          *utils.JWTVerifier
+}
+
+// creates the handler for the given config and data store, calling storage and
+// auth through the upstream client
+func new_handler(cfg *config.Config, client *upstream.Client, db store.Store, outbox *saga.Outbox, pitches *PitchIndex) *handler {
+	return &handler{
+		cfg:          cfg,
+		upstream:     client,
+		db:           db,
+		audit:        audit.New(db),
+		ledger:       ledger.New(db),
+		outbox:       outbox,
+		reservations: reservation.New(db),
+		residue:      cfg.DistributionResiduePolicy,
+		search:       pitches,
+		jwt:          utils.NewJWTHS256(cfg.Supabase.JWTIssuer(), cfg.Supabase.JWTSecret),
+	}
+}
+
+// gets a copy of the handler whose data store calls run under ctx, so they
+// are cancelled when the caller goes away. The audit log ignores the
+// cancellation as it records changes that have already been made.
+func (h *handler) with(ctx context.Context) *handler {
+	scoped := *h
+	scoped.db = store.WithContext(ctx, h.db)
+	scoped.audit = audit.New(store.WithContext(context.WithoutCancel(ctx), h.db))
+	scoped.ledger = ledger.New(scoped.db)
+	scoped.reservations = reservation.New(scoped.db)
+	return &scoped
+}
+
+// sets up the router with the given config, upstream client and data store,
+// registering the sagas the outbox worker resumes and searching the pitches
+// in the index
+func SetupRouter(cfg *config.Config, client *upstream.Client, db store.Store, outbox *saga.Outbox, pitches *PitchIndex) http.Handler {
+	h := new_handler(cfg, client, db, outbox, pitches)
+	h.investment_saga().Register(outbox)
+
 	base := auth.NewChain(
 		auth.LoggingMiddleware,
-		auth.CORSMiddleware,
+		auth.CORSMiddleware(cfg.CORSAllowlist),
 	)
 
 	protected := auth.NewChain(
-		auth.AuthMiddleWare,
+		auth.AuthMiddleWare(h.jwt),
+	)
+
+	// routes that move money replay the first response for a repeated Idempotency-Key
+	money := auth.NewChain(
+		auth.AuthMiddleWare(h.jwt),
+		auth.IdempotencyMiddleware(auth.NewDBIdempotencyStore(db), cfg.IdempotencyTTL),
 	)
 
 	mux := http.NewServeMux()
-	mux.Handle("/api/pitch", protected.Then(http.HandlerFunc(pitch_route)))
-	mux.Handle("/api/pitch/status", protected.Then(http.HandlerFunc(update_pitch_status_route)))
-	mux.Handle("/api/profile", protected.Then(http.HandlerFunc(profile_route)))
-	mux.Handle("/api/investment", protected.Then(http.HandlerFunc(investment_route)))
-	mux.Handle("/api/wallet", protected.Then(http.HandlerFunc(wallet_route)))
-	mux.Handle("/api/bank", protected.Then(http.HandlerFunc(bank_route)))
-	mux.Handle("/api/profit", protected.Then(http.HandlerFunc(profit_route)))
-	mux.Handle("/api/distribute", protected.Then(http.HandlerFunc(distribute_route)))
-	mux.Handle("/api/portfolio", protected.Then(http.HandlerFunc(portfolio_route)))
-
-	fmt.Println("Router setup complete")
+	// traces, counts and times each route under the pattern it is registered with
+	handle := func(pattern string, chain auth.Chain, route http.HandlerFunc) {
+		mux.Handle(pattern, tracing.Middleware(pattern)(metrics.Middleware(pattern)(chain.Then(route))))
+	}
+	// runs the route with a handler whose store calls follow the request context
+	scoped := func(route func(*handler, http.ResponseWriter, *http.Request)) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			route(h.with(r.Context()), w, r)
+		}
+	}
+	// runs a route that moves money with a handler that carries on if the
+	// caller goes away, so a transfer is never cut off part way
+	detached := func(route func(*handler, http.ResponseWriter, *http.Request)) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			route(h.with(context.WithoutCancel(r.Context())), w, r)
+		}
+	}
+	handle("/api/pitch", protected, scoped((*handler).pitch_route))
+	handle("/api/pitch/status", protected, scoped((*handler).update_pitch_status_route))
+	handle("/api/profile", protected, scoped((*handler).profile_route))
+	handle("/api/investment", money, detached((*handler).investment_route))
+	handle("/api/wallet", money, detached((*handler).wallet_route))
+	handle("/api/bank", protected, scoped((*handler).bank_route))
+	handle("/api/profit", protected, scoped((*handler).profit_route))
+	handle("/api/distribute", money, detached((*handler).distribute_route))
+	handle("/api/distribute/resume", money, detached((*handler).resume_distribute_route))
+	handle("/api/portfolio", protected, scoped((*handler).portfolio_route))
+	handle("/api/audit", protected, scoped((*handler).audit_route))
+	handle("/api/audit/verify", protected, scoped((*handler).audit_verify_route))
+
+	// moderation routes, each handler checks the user is an admin
+	handle("/api/admin/users", protected, scoped((*handler).admin_users_route))
+	handle("/api/admin/profile", protected, scoped((*handler).admin_profile_route))
+	handle("/api/admin/pitch/suspend", protected, scoped((*handler).admin_suspend_pitch_route))
+	handle("/api/admin/pitch/unsuspend", protected, scoped((*handler).admin_unsuspend_pitch_route))
+	handle("/api/admin/pitch/refund", money, detached((*handler).admin_refund_pitch_route))
+	handle("/api/admin/wallet", protected, scoped((*handler).admin_wallet_route))
+	handle("/api/admin/role", protected, scoped((*handler).admin_role_route))
+
+	mux.Handle("/metrics", metrics_route(metrics.Default, cfg.MetricsToken))
+
+	// probes for the orchestrator, unauthenticated like /metrics
+	mux.HandleFunc("/healthz", healthz_route)
+	mux.HandleFunc("/readyz", scoped((*handler).readyz_route))
+
+	slog.Info("router setup complete")
 	return base.Then(mux)
 }
@@ -2,51 +2,48 @@ package routes
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/audit"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/ledger"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/logging"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/metrics"
 	model "github.com/EmmaMartin123/Industrial_Project/backend/internal/model/common"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/postgrest"
 	"github.com/EmmaMartin123/Industrial_Project/backend/internal/utils"
 )
 
-func wallet_route(w http.ResponseWriter, r *http.Request) {
+func (h *handler) wallet_route(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
-		get_wallet_route(w, r)
+		h.get_wallet_route(w, r)
 	case http.MethodPatch:
-		patch_wallet_route(w, r)
+		h.patch_wallet_route(w, r)
 	default:
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 	}
 }
 
 // gets the wallet for the user
-func get_wallet_route(w http.ResponseWriter, r *http.Request) {
+func (h *handler) get_wallet_route(w http.ResponseWriter, r *http.Request) {
 	user_id, ok := utils.UserIDFromCtx(r.Context())
 	if !ok {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
-	body, err := utils.GetDataByID("profile", user_id)
+	balance, err := h.ledger.Balance(user_id)
 	if err != nil {
 		http.Error(w, "Profile not found", http.StatusNotFound)
 		return
 	}
-	var profiles []model.Profile
-	if err := json.Unmarshal(body, &profiles); err != nil || len(profiles) != 1 {
-		http.Error(w, "Invalid profile data", http.StatusInternalServerError)
-		return
-	}
-	balance := int64(0)
-	if profiles[0].DashboardBalance != nil {
-		balance = *profiles[0].DashboardBalance
-	}
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]int64{"dashboard_balance": balance})
+	json.NewEncoder(w).Encode(map[string]model.Money{"dashboard_balance": balance})
 }
 
 // patches the wallet for the user
-func patch_wallet_route(w http.ResponseWriter, r *http.Request) {
+func (h *handler) patch_wallet_route(w http.ResponseWriter, r *http.Request) {
 	user_id, ok := utils.UserIDFromCtx(r.Context())
 	if !ok {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
@@ -54,123 +51,146 @@ func patch_wallet_route(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req struct {
-		Action string `json:"action"`
-		Amount int64  `json:"amount"`
+		Action string      `json:"action"`
+		Amount model.Money `json:"amount"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid JSON", http.StatusBadRequest)
 		return
 	}
 
-	if req.Amount <= 0 {
+	if !req.Amount.IsPositive() {
 		http.Error(w, "Amount must be positive", http.StatusBadRequest)
 		return
 	}
 
+	if req.Action != "deposit" && req.Action != "withdraw" {
+		http.Error(w, "Invalid action. Use 'deposit' or 'withdraw'", http.StatusBadRequest)
+		return
+	}
+
+	bank_query := postgrest.New().Eq("user_id", user_id)
+	bank_body, err := h.db.Query("bank_account", bank_query.String())
+	if err != nil {
+		http.Error(w, "No linked bank account", http.StatusNotFound)
+		return
+	}
+	var banks []struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(bank_body, &banks); err != nil || len(banks) == 0 {
+		http.Error(w, "Invalid bank account data", http.StatusNotFound)
+		return
+	}
+	bank := banks[0]
+
+	var balance model.Money
 	switch req.Action {
 	case "deposit":
-		bank_query := fmt.Sprintf("user_id=eq.%s", user_id)
-		bank_body, err := utils.GetDataByQuery("bank_account", bank_query)
-		if err != nil {
-			http.Error(w, "No linked bank account", http.StatusNotFound)
+		if err := h.adjust_bank_balance(bank.ID, req.Amount.Neg()); err != nil {
+			if errors.Is(err, ledger.ErrInsufficientFunds) {
+				http.Error(w, "Insufficient funds in bank account", http.StatusPaymentRequired)
+			} else {
+				http.Error(w, "Failed to debit bank account", http.StatusInternalServerError)
+			}
 			return
 		}
-		var banks []struct {
-			ID      string `json:"id"`
-			Balance int64  `json:"balance"`
-		}
-		if err := json.Unmarshal(bank_body, &banks); err != nil || len(banks) == 0 {
-			http.Error(w, "Invalid bank account data", http.StatusNotFound)
-			return
-		}
-		bank := banks[0]
-		if bank.Balance < req.Amount {
-			http.Error(w, "Insufficient funds in bank account", http.StatusPaymentRequired)
-			return
-		}
-		new_bank_balance := bank.Balance - req.Amount
-		bank_payload := map[string]interface{}{"balance": new_bank_balance}
-		_, err = utils.UpdateByID("bank_account", bank.ID, bank_payload)
-		if err != nil {
-			http.Error(w, "Failed to debit bank account", http.StatusInternalServerError)
-			return
-		}
-		err = update_balance(user_id, req.Amount)
+		balance, err = h.ledger.Post(ledger.Posting{
+			UserID:       user_id,
+			Kind:         ledger.Deposit,
+			Amount:       req.Amount,
+			Counterparty: "bank:" + bank.ID,
+		})
 		if err != nil {
-			http.Error(w, "Failed to credit wallet", http.StatusInternalServerError)
+			if undoErr := h.adjust_bank_balance(bank.ID, req.Amount); undoErr != nil {
+				logging.FromContext(r.Context()).Warn("failed to return deposit to bank account", "bank_account_id", bank.ID, "amount", req.Amount, "err", undoErr)
+			}
+			if errors.Is(err, ledger.ErrWalletFrozen) {
+				http.Error(w, "Wallet is frozen", http.StatusForbidden)
+			} else {
+				http.Error(w, "Failed to credit wallet", http.StatusInternalServerError)
+			}
 			return
 		}
 
 	case "withdraw":
-		profile_body, err := utils.GetDataByID("profile", user_id)
-		if err != nil {
-			http.Error(w, "Profile not found", http.StatusNotFound)
-			return
+		withdrawal := ledger.Posting{
+			UserID:       user_id,
+			Kind:         ledger.Withdraw,
+			Amount:       req.Amount,
+			Counterparty: "bank:" + bank.ID,
 		}
-		var profiles []model.Profile
-		if err := json.Unmarshal(profile_body, &profiles); err != nil || len(profiles) == 0 {
-			http.Error(w, "Invalid profile", http.StatusInternalServerError)
+		entry, err := h.ledger.PostEntry(withdrawal)
+		if err != nil {
+			if errors.Is(err, ledger.ErrInsufficientFunds) {
+				http.Error(w, "Insufficient wallet balance", http.StatusPaymentRequired)
+			} else if errors.Is(err, ledger.ErrWalletFrozen) {
+				http.Error(w, "Wallet is frozen", http.StatusForbidden)
+			} else {
+				http.Error(w, "Failed to debit wallet", http.StatusInternalServerError)
+			}
 			return
 		}
-		wallet_balance := int64(0)
-		if profiles[0].DashboardBalance != nil {
-			wallet_balance = *profiles[0].DashboardBalance
-		}
-		if wallet_balance < req.Amount {
-			http.Error(w, "Insufficient wallet balance", http.StatusPaymentRequired)
+		balance = *entry.BalanceAfter
+		if err := h.adjust_bank_balance(bank.ID, req.Amount); err != nil {
+			// reverses the withdrawal since the money never reached the bank,
+			// under a reference of its own so every failed withdrawal is
+			// reversed once
+			withdrawal.Kind = ledger.Deposit
+			withdrawal.Reference = "withdrawal:" + entry.TransactionID + ":reversal"
+			if _, undoErr := h.ledger.PostOnce(withdrawal); undoErr != nil {
+				logging.FromContext(r.Context()).Error("failed to reverse withdrawal", "transaction_id", entry.TransactionID, "amount", req.Amount, "err", undoErr)
+				http.Error(w, "Failed to reverse withdrawal", http.StatusInternalServerError)
+				return
+			}
+			http.Error(w, "Failed to credit bank account", http.StatusInternalServerError)
 			return
 		}
+	}
 
-		bank_query := fmt.Sprintf("user_id=eq.%s", user_id)
-		bank_body, err := utils.GetDataByQuery("bank_account", bank_query)
+	action, before := AUDIT_DEPOSIT, balance.Add(req.Amount.Neg())
+	if req.Action == "withdraw" {
+		action, before = AUDIT_WITHDRAW, balance.Add(req.Amount)
+	}
+	metrics.WalletMovements.Inc(req.Action)
+	metrics.WalletMovedPence.Add(float64(req.Amount.Pence()), req.Action)
+	h.record(r, audit.Entry{Action: action, TargetType: "profile", TargetID: user_id},
+		map[string]model.Money{"dashboard_balance": before},
+		map[string]any{"dashboard_balance": balance, "amount": req.Amount, "bank_account_id": bank.ID})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]model.Money{"dashboard_balance": balance})
+}
+
+// adds delta to the bank account balance with a compare-and-swap so
+// concurrent deposits and withdrawals can't overwrite each other
+func (h *handler) adjust_bank_balance(bank_id string, delta model.Money) error {
+	for range 5 {
+		body, err := h.db.GetByID("bank_account", bank_id)
 		if err != nil {
-			http.Error(w, "No linked bank account", http.StatusNotFound)
-			return
+			return err
 		}
 		var banks []struct {
-			ID string `json:"id"`
+			Balance model.Money `json:"balance"`
 		}
-		if err := json.Unmarshal(bank_body, &banks); err != nil || len(banks) == 0 {
-			http.Error(w, "Invalid bank account", http.StatusNotFound)
-			return
+		if err := json.Unmarshal(body, &banks); err != nil || len(banks) != 1 {
+			return fmt.Errorf("invalid bank account data")
 		}
-		bank := banks[0]
 
-		err = update_balance(user_id, -req.Amount)
-		if err != nil {
-			http.Error(w, "Failed to debit wallet", http.StatusInternalServerError)
-			return
+		current := banks[0].Balance
+		if current.Add(delta).IsNegative() {
+			return ledger.ErrInsufficientFunds
 		}
 
-		var current_bank struct {
-			Balance int64 `json:"balance"`
-		}
-		if err := json.Unmarshal(bank_body, &current_bank); err != nil {
-			update_balance(user_id, req.Amount)
-			http.Error(w, "Failed to read bank balance", http.StatusInternalServerError)
-			return
-		}
-		new_bank_balance := current_bank.Balance + req.Amount
-		bank_payload := map[string]interface{}{"balance": new_bank_balance}
-		_, err = utils.UpdateByID("bank_account", bank.ID, bank_payload)
+		condition := postgrest.New().Eq("id", bank_id).Eq("balance", current)
+		updated, err := h.db.Update("bank_account", condition.String(), map[string]interface{}{"balance": current.Add(delta)})
 		if err != nil {
-			update_balance(user_id, req.Amount)
-			http.Error(w, "Failed to credit bank account", http.StatusInternalServerError)
-			return
+			return err
+		}
+		var rows []struct{}
+		if json.Unmarshal(updated, &rows) == nil && len(rows) == 1 {
+			return nil
 		}
-
-	default:
-		http.Error(w, "Invalid action. Use 'deposit' or 'withdraw'", http.StatusBadRequest)
-		return
-	}
-
-	profile_body, _ := utils.GetDataByID("profile", user_id)
-	var profiles []model.Profile
-	json.Unmarshal(profile_body, &profiles)
-	balance := int64(0)
-	if len(profiles) > 0 && profiles[0].DashboardBalance != nil {
-		balance = *profiles[0].DashboardBalance
 	}
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]int64{"dashboard_balance": balance})
+	return ledger.ErrConflict
 }
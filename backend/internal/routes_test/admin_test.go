@@ -0,0 +1,137 @@
+package routes_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/ledger"
+	model "github.com/EmmaMartin123/Industrial_Project/backend/internal/model/common"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/routes"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/saga"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/upstream"
+)
+
+func TestAdminModeration(t *testing.T) {
+	cfg := new_test_config()
+	db := seed_authorization_store(t)
+	router := routes.SetupRouter(cfg, upstream.New(upstream.Options{}), db, saga.NewOutbox(db), routes.NewPitchIndex(db))
+
+	send := func(user_id string, method string, url string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+sign_test_token(t, user_id))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// only admins can moderate
+	if rec := send("business-1", http.MethodGet, "/api/admin/users", ""); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected a business to be refused, got %d", rec.Code)
+	}
+	if rec := send("admin-1", http.MethodPost, "/api/admin/pitch/suspend?id=1", `{}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected a suspension without a reason to be refused, got %d", rec.Code)
+	}
+
+	// searches users by role
+	rec := send("admin-1", http.MethodGet, "/api/admin/users?role=investor", "")
+	var users []model.Profile
+	if err := json.Unmarshal(rec.Body.Bytes(), &users); err != nil || len(users) != 2 {
+		t.Errorf("Expected the two investors, got %d %s", rec.Code, rec.Body)
+	}
+
+	// a suspended pitch goes back to the state it was in
+	if rec := send("admin-1", http.MethodPost, "/api/admin/pitch/suspend?id=1", `{"reason":"fraud report"}`); rec.Code != http.StatusOK {
+		t.Fatalf("Suspend failed: %d %s", rec.Code, rec.Body)
+	}
+	if status := pitch_status(t, db, "1"); status != "Suspended" {
+		t.Errorf("Expected the pitch to be Suspended, got %s", status)
+	}
+	if rec := send("admin-1", http.MethodPost, "/api/admin/pitch/unsuspend?id=1", `{"reason":"cleared"}`); rec.Code != http.StatusOK {
+		t.Fatalf("Unsuspend failed: %d %s", rec.Code, rec.Body)
+	}
+	if status := pitch_status(t, db, "1"); status != "Active" {
+		t.Errorf("Expected the pitch to be Active again, got %s", status)
+	}
+
+	// a frozen wallet can't invest but still receives a forced refund
+	if rec := send("admin-1", http.MethodPatch, "/api/admin/wallet?user_id=investor-1", `{"frozen":true,"reason":"chargeback"}`); rec.Code != http.StatusOK {
+		t.Fatalf("Freeze failed: %d %s", rec.Code, rec.Body)
+	}
+	if _, err := ledger.New(db).Post(ledger.Posting{UserID: "investor-1", Kind: ledger.Withdraw, Amount: model.FromPounds(1)}); !errors.Is(err, ledger.ErrWalletFrozen) {
+		t.Errorf("Expected a frozen wallet to refuse a withdrawal, got %v", err)
+	}
+	// a retried refund replays the first response
+	refund := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/admin/pitch/refund?id=1", strings.NewReader(`{"reason":"fraud confirmed"}`))
+		req.Header.Set("Authorization", "Bearer "+sign_test_token(t, "admin-1"))
+		req.Header.Set("Idempotency-Key", "refund-once")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+	if rec := refund(); rec.Code != http.StatusOK {
+		t.Fatalf("Refund failed: %d %s", rec.Code, rec.Body)
+	}
+	if rec := refund(); rec.Code != http.StatusOK || rec.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("Expected the retried refund to be replayed, got %d %s", rec.Code, rec.Body)
+	}
+	if balance, _ := ledger.New(db).Balance("investor-1"); balance.Cmp(model.FromPounds(1100)) != 0 {
+		t.Errorf("Expected the investor to be refunded to 1100, got %s", balance)
+	}
+
+	// every action is in the audit log
+	count, err := db.Count("audit_log", "actor_id=eq.admin-1")
+	if err != nil || count != 4 {
+		t.Errorf("Expected 4 audit entries, got %d (%v)", count, err)
+	}
+}
+
+func TestOnlyAdminsGrantTheAdminRole(t *testing.T) {
+	cfg := new_test_config()
+	db := seed_authorization_store(t)
+	router := routes.SetupRouter(cfg, upstream.New(upstream.Options{}), db, saga.NewOutbox(db), routes.NewPitchIndex(db))
+
+	send := func(user_id string, method string, url string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+sign_test_token(t, user_id))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// a new user can't sign up as an admin
+	for _, role := range []string{"admin", "superuser"} {
+		if rec := send("new-user", http.MethodPost, "/api/profile", `{"display_name":"Mallory","role":"`+role+`"}`); rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected signing up as %s to be refused, got %d", role, rec.Code)
+		}
+	}
+	if count, _ := db.Count("profile", "id=eq.new-user"); count != 0 {
+		t.Errorf("Expected no profile to be created, got %d", count)
+	}
+
+	// nor can anyone but an admin grant it
+	if rec := send("business-1", http.MethodPatch, "/api/admin/role?user_id=business-1", `{"role":"admin","reason":"promotion"}`); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected a business to be refused, got %d", rec.Code)
+	}
+	if rec := send("admin-1", http.MethodPatch, "/api/admin/role?user_id=business-1", `{"role":"owner","reason":"promotion"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected an unknown role to be refused, got %d", rec.Code)
+	}
+	rec := send("admin-1", http.MethodPatch, "/api/admin/role?user_id=business-1", `{"role":"admin","reason":"promotion"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Granting admin failed: %d %s", rec.Code, rec.Body)
+	}
+	var profile model.Profile
+	if err := json.Unmarshal(rec.Body.Bytes(), &profile); err != nil || profile.Role != "admin" {
+		t.Errorf("Expected business-1 to be an admin, got %+v (%v)", profile, err)
+	}
+	if rec := send("business-1", http.MethodGet, "/api/admin/users", ""); rec.Code != http.StatusOK {
+		t.Errorf("Expected the new admin to moderate, got %d", rec.Code)
+	}
+	if count, err := db.Count("audit_log", "action=eq.change_role"); err != nil || count != 1 {
+		t.Errorf("Expected the role change to be audited, got %d (%v)", count, err)
+	}
+}
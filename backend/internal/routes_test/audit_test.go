@@ -0,0 +1,83 @@
+package routes_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/audit"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/routes"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/saga"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/upstream"
+)
+
+func TestAuditLog(t *testing.T) {
+	cfg := new_test_config()
+	db := seed_authorization_store(t)
+	router := routes.SetupRouter(cfg, upstream.New(upstream.Options{}), db, saga.NewOutbox(db), routes.NewPitchIndex(db))
+
+	send := func(user_id string, method string, url string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+sign_test_token(t, user_id))
+		req.Header.Set("X-Request-ID", "req-"+user_id)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := send("business-1", http.MethodPatch, "/api/profile", `{"display_name":"Acme"}`); rec.Code != http.StatusOK {
+		t.Fatalf("Profile update failed: %d %s", rec.Code, rec.Body)
+	}
+	if rec := send("admin-1", http.MethodPost, "/api/admin/pitch/suspend?id=1", `{"reason":"fraud report"}`); rec.Code != http.StatusOK {
+		t.Fatalf("Suspend failed: %d %s", rec.Code, rec.Body)
+	}
+
+	query := func(user_id string, url string) (int, []audit.Entry) {
+		rec := send(user_id, http.MethodGet, url, "")
+		var entries []audit.Entry
+		if rec.Code == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &entries); err != nil {
+				t.Fatalf("Failed to decode audit entries: %v", err)
+			}
+		}
+		return rec.Code, entries
+	}
+
+	// the owner sees what happened to their pitch, other users don't
+	code, entries := query("business-1", "/api/audit?target_type=pitch&target_id=1")
+	if code != http.StatusOK || len(entries) != 1 {
+		t.Fatalf("Expected the owner to see the suspension, got %d %+v", code, entries)
+	}
+	e := entries[0]
+	if e.Action != "suspend_pitch" || e.ActorID != "admin-1" || e.RequestID != "req-admin-1" || e.Reason != "fraud report" || !strings.Contains(string(e.After), "Suspended") {
+		t.Errorf("Unexpected audit entry %+v", e)
+	}
+	if code, _ := query("investor-1", "/api/audit?target_type=pitch&target_id=1"); code != http.StatusForbidden {
+		t.Errorf("Expected another user to be refused, got %d", code)
+	}
+	if code, _ := query("investor-1", "/api/audit?actor_id=business-1"); code != http.StatusForbidden {
+		t.Errorf("Expected another user's actions to be refused, got %d", code)
+	}
+
+	// with nothing given a user gets their own actions
+	if code, entries := query("business-1", "/api/audit"); code != http.StatusOK || len(entries) != 1 || entries[0].Action != "update_profile" {
+		t.Errorf("Expected the owner's profile update, got %d %+v", code, entries)
+	}
+	if code, entries := query("admin-1", "/api/audit"); code != http.StatusOK || len(entries) != 2 {
+		t.Errorf("Expected an admin to see every entry, got %d %+v", code, entries)
+	}
+
+	rec := send("admin-1", http.MethodGet, "/api/audit/verify", "")
+	var verified struct {
+		Intact  bool `json:"intact"`
+		Checked int  `json:"checked"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &verified); err != nil || !verified.Intact || verified.Checked != 2 {
+		t.Errorf("Expected an intact chain of 2, got %s", rec.Body)
+	}
+	if rec := send("business-1", http.MethodGet, "/api/audit/verify", ""); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected only admins to verify the chain, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,114 @@
+package routes_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/routes"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/saga"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/store"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/upstream"
+)
+
+// a store with a pitch owned by business-1, funded by investor-1 and with a
+// declared profit
+func seed_authorization_store(t *testing.T) store.Store {
+	t.Helper()
+	db := store.NewMemory()
+	rows := []struct {
+		table string
+		data  map[string]any
+	}{
+		{"profile", map[string]any{"id": "business-1", "role": "business", "dashboard_balance": 1000}},
+		{"profile", map[string]any{"id": "business-2", "role": "business", "dashboard_balance": 1000}},
+		{"profile", map[string]any{"id": "investor-1", "role": "investor", "dashboard_balance": 1000}},
+		{"profile", map[string]any{"id": "investor-2", "role": "investor", "dashboard_balance": 1000}},
+		{"profile", map[string]any{"id": "admin-1", "role": "admin", "dashboard_balance": 0}},
+		{"pitch", map[string]any{"title": "Test", "user_id": "business-1", "target_amount": 200, "raised_amount": 100, "status": "Active", "profit_share_percent": 10}},
+		{"investment_tier", map[string]any{"name": "Bronze", "min_amount": 1, "multiplier": 1.0, "pitch_id": 1}},
+		{"investments", map[string]any{"pitch_id": 1, "investor_id": "investor-1", "tier_id": 1, "amount": 100, "refunded": false}},
+		{"profits", map[string]any{"pitch_id": 1, "declared_by": "business-1", "total_profit": 100, "distributable_amount": 10, "transferred": false}},
+		{"distribution_runs", map[string]any{"profit_id": 1, "pitch_id": 1, "business_id": "business-1", "status": "completed", "total_amount": 10}},
+	}
+	for _, row := range rows {
+		if _, err := db.Insert(row.table, row.data); err != nil {
+			t.Fatalf("Failed to seed %s: %v", row.table, err)
+		}
+	}
+	return db
+}
+
+func TestRouteAuthorization(t *testing.T) {
+	cfg := new_test_config()
+	users := []string{"business-1", "business-2", "investor-1", "investor-2", "admin-1"}
+	cases := []struct {
+		method  string
+		path    string
+		body    string
+		allowed []string
+	}{
+		{http.MethodPost, "/api/pitch", `{"title":"New","target_amount":100}`, []string{"business-1", "business-2"}},
+		{http.MethodPatch, "/api/pitch?id=1", `{"title":"Edited"}`, []string{"business-1", "admin-1"}},
+		{http.MethodDelete, "/api/pitch?id=1", ``, []string{"business-1", "admin-1"}},
+		{http.MethodPatch, "/api/pitch/status?id=1", `{"status":"Active"}`, []string{"business-1", "admin-1"}},
+		{http.MethodPost, "/api/profit", `{"pitch_id":1,"total_profit":100}`, []string{"business-1"}},
+		{http.MethodGet, "/api/profit?pitch_id=1", ``, []string{"business-1", "admin-1"}},
+		{http.MethodGet, "/api/profit?id=1", ``, []string{"business-1", "admin-1"}},
+		{http.MethodPost, "/api/distribute?profit_id=1", ``, []string{"business-1"}},
+		{http.MethodPost, "/api/distribute/resume?profit_id=1", ``, []string{"business-1"}},
+		{http.MethodPost, "/api/investment", `{"pitch_id":1,"tier_id":1,"amount":10}`, []string{"investor-1", "investor-2"}},
+		{http.MethodGet, "/api/investment", ``, []string{"investor-1", "investor-2"}},
+		{http.MethodGet, "/api/investment?id=1", ``, []string{"investor-1"}},
+		{http.MethodPatch, "/api/investment?id=1", `{"refunded":true}`, []string{"investor-1"}},
+		{http.MethodGet, "/api/portfolio", ``, []string{"investor-1", "investor-2"}},
+	}
+
+	for _, c := range cases {
+		for _, user := range users {
+			// a fresh store each time so an allowed request can't change the next
+			db := seed_authorization_store(t)
+			router := routes.SetupRouter(cfg, upstream.New(upstream.Options{}), db, saga.NewOutbox(db), routes.NewPitchIndex(db))
+
+			req := httptest.NewRequest(c.method, c.path, strings.NewReader(c.body))
+			req.Header.Set("Authorization", "Bearer "+sign_test_token(t, user))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			denied := rec.Code == http.StatusForbidden || rec.Code == http.StatusUnauthorized
+			if allowed := slices.Contains(c.allowed, user); allowed == denied {
+				t.Errorf("%s %s as %s: got %d %s", c.method, c.path, user, rec.Code, strings.TrimSpace(rec.Body.String()))
+			}
+		}
+	}
+}
+
+func TestEachRouterVerifiesTokensWithItsOwnSecret(t *testing.T) {
+	cfg := new_test_config()
+	other := new_test_config()
+	other.Supabase.JWTSecret = "another-secret"
+
+	db := seed_authorization_store(t)
+	ours := routes.SetupRouter(cfg, upstream.New(upstream.Options{}), db, saga.NewOutbox(db), routes.NewPitchIndex(db))
+	theirs := routes.SetupRouter(other, upstream.New(upstream.Options{}), db, saga.NewOutbox(db), routes.NewPitchIndex(db))
+
+	for _, c := range []struct {
+		router http.Handler
+		want   int
+	}{
+		{ours, http.StatusOK},
+		{theirs, http.StatusUnauthorized},
+		{ours, http.StatusOK},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/api/admin/users", nil)
+		req.Header.Set("Authorization", "Bearer "+sign_test_token(t, "admin-1"))
+		rec := httptest.NewRecorder()
+		c.router.ServeHTTP(rec, req)
+		if rec.Code != c.want {
+			t.Errorf("Expected %d, got %d %s", c.want, rec.Code, rec.Body)
+		}
+	}
+}
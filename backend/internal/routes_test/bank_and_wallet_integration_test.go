@@ -2,60 +2,43 @@ package routes_test
 
 import (
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
 	"net/http/httptest"
-	"os"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/ledger"
+	model "github.com/EmmaMartin123/Industrial_Project/backend/internal/model/common"
 	"github.com/EmmaMartin123/Industrial_Project/backend/internal/routes"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/saga"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/store"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/upstream"
 	"github.com/EmmaMartin123/Industrial_Project/backend/internal/utils"
 )
 
 func TestBankAndWalletIntegration(t *testing.T) {
-	if err := load_dot_env(); err != nil {
-		t.Logf("Warning: failed to load .env: %v", err)
-	}
-
-	required := []string{
-		"SUPABASE_URL",
-		"SUPABASE_ANON_KEY",
-		"SUPABASE_SERVICE_ROLE_KEY",
-		"TEST_INVESTOR_EMAIL",
-		"TEST_INVESTOR_PASSWORD",
-		"TEST_BUSINESS_EMAIL",
-		"TEST_BUSINESS_PASSWORD",
-	}
-	for _, key := range required {
-		if os.Getenv(key) == "" {
-			t.Skipf("Skipping: %s not set", key)
-		}
-	}
-
-	if err := utils.InitJWTHS256(os.Getenv("SUPABASE_URL") + "/auth/v1"); err != nil {
-		t.Fatalf("Failed to initialize JWT: %v", err)
-	}
+	cfg := start_test_supabase(t)
+	db := new_test_store(cfg)
 
-	access_token, err := login_to_supabase(
-		os.Getenv("TEST_INVESTOR_EMAIL"),
-		os.Getenv("TEST_INVESTOR_PASSWORD"),
-	)
+	access_token, err := login_to_supabase(cfg, test_investor_email, test_password)
 	if err != nil {
 		t.Fatalf("Failed to log in to Supabase: %v", err)
 	}
 
-	user_id, err := utils.VerifyJWTHS256(access_token)
+	user_id, err := utils.NewJWTHS256(cfg.Supabase.JWTIssuer(), cfg.Supabase.JWTSecret).Verify(access_token)
 	if err != nil {
 		t.Fatalf("Failed to extract user ID: %v", err)
 	}
 
-	_, err = utils.UpdateByID("profile", user_id, map[string]interface{}{"dashboard_balance": 0})
+	_, err = db.UpdateByID("profile", user_id, map[string]interface{}{"dashboard_balance": 0})
 	if err != nil {
 		t.Fatalf("Failed to reset wallet balance: %v", err)
 	}
 
-	router := routes.SetupRouter()
+	router := routes.SetupRouter(cfg, upstream.New(upstream.Options{}), db, saga.NewOutbox(db), routes.NewPitchIndex(db))
 	server := httptest.NewServer(router)
 	defer server.Close()
 	client := &http.Client{Timeout: 10 * time.Second}
@@ -88,7 +71,7 @@ func TestBankAndWalletIntegration(t *testing.T) {
 	}
 
 	defer func() {
-		utils.DeleteByID("bank_account", bank_id)
+		db.DeleteByID("bank_account", bank_id)
 	}()
 
 	resp, err = make_request(client, "GET", server.URL+"/api/bank", nil, access_token)
@@ -132,7 +115,7 @@ func TestBankAndWalletIntegration(t *testing.T) {
 		t.Errorf("Expected wallet balance 0, got %d", wallet_balance)
 	}
 
-	topup_payload := map[string]interface{}{"amount": int64(2000)}
+	topup_payload := map[string]interface{}{"action": "deposit", "amount": int64(2000)}
 	topup_body, _ := json.Marshal(topup_payload)
 
 	resp, err = make_request(client, "PATCH", server.URL+"/api/wallet", topup_body, access_token)
@@ -161,7 +144,7 @@ func TestBankAndWalletIntegration(t *testing.T) {
 		t.Errorf("Expected bank balance 5500 after £2000 top-up, got %d", final_bank_balance)
 	}
 
-	invalid_topup := map[string]interface{}{"amount": int64(10000)}
+	invalid_topup := map[string]interface{}{"action": "deposit", "amount": int64(10000)}
 	invalid_body, _ := json.Marshal(invalid_topup)
 
 	resp, err = make_request(client, "PATCH", server.URL+"/api/wallet", invalid_body, access_token)
@@ -175,3 +158,43 @@ func TestBankAndWalletIntegration(t *testing.T) {
 
 	t.Log("Bank and Wallet integration test passed")
 }
+
+// a store whose bank accounts can't be updated, so every withdrawal fails
+// after the wallet is debited
+type stuck_bank_store struct {
+	store.Store
+}
+
+func (s stuck_bank_store) Update(table string, query string, data any) ([]byte, error) {
+	if table == "bank_account" {
+		return nil, errors.New("bank unavailable")
+	}
+	return s.Store.Update(table, query, data)
+}
+
+func TestEveryFailedWithdrawalIsReversed(t *testing.T) {
+	cfg := new_test_config()
+	mem := store.NewMemory()
+	if _, err := mem.Insert("profile", map[string]any{"id": "investor-1", "role": "investor", "dashboard_balance": 1000}); err != nil {
+		t.Fatalf("Failed to seed profile: %v", err)
+	}
+	if _, err := mem.Insert("bank_account", map[string]any{"user_id": "investor-1", "balance": 0}); err != nil {
+		t.Fatalf("Failed to seed bank account: %v", err)
+	}
+	db := stuck_bank_store{mem}
+	router := routes.SetupRouter(cfg, upstream.New(upstream.Options{}), db, saga.NewOutbox(db), routes.NewPitchIndex(db))
+
+	for i := range 2 {
+		req := httptest.NewRequest(http.MethodPatch, "/api/wallet", strings.NewReader(`{"action":"withdraw","amount":100}`))
+		req.Header.Set("Authorization", "Bearer "+sign_test_token(t, "investor-1"))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != http.StatusInternalServerError {
+			t.Errorf("Expected withdrawal %d to fail, got %d %s", i+1, rec.Code, rec.Body)
+		}
+	}
+
+	if balance, err := ledger.New(mem).Balance("investor-1"); err != nil || balance.Cmp(model.FromPounds(1000)) != 0 {
+		t.Errorf("Expected both withdrawals to be reversed back to 1000, got %s (%v)", balance, err)
+	}
+}
@@ -0,0 +1,259 @@
+package routes_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/config"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/ledger"
+	model "github.com/EmmaMartin123/Industrial_Project/backend/internal/model/common"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/routes"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/saga"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/store"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/upstream"
+)
+
+const test_issuer = "http://localhost/auth/v1"
+
+// gets a config for the in-memory tests, whose tokens are signed by
+// test_issuer with "test-secret"
+func new_test_config() *config.Config {
+	cfg := config.Default()
+	cfg.Supabase = config.Supabase{
+		URL:            "http://localhost",
+		ServiceRoleKey: "service-key",
+		JWTSecret:      "test-secret",
+		S3URL:          "http://localhost/storage/v1/s3",
+	}
+	return cfg
+}
+
+// signs a token the auth middleware accepts for the user
+func sign_test_token(t *testing.T, user_id string) string {
+	t.Helper()
+	tok := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": user_id,
+		"iss": test_issuer,
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+	signed, err := tok.SignedString([]byte("test-secret"))
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v", err)
+	}
+	return signed
+}
+
+// fails wallet postings for one user while fail is set
+type failing_store struct {
+	store.Store
+	user string
+	fail atomic.Bool
+}
+
+func (s *failing_store) Insert(table string, data any) ([]byte, error) {
+	if table == "ledger_entries" && s.fail.Load() {
+		raw, _ := json.Marshal(data)
+		if strings.Contains(string(raw), `"wallet:`+s.user+`"`) {
+			return nil, errors.New("connection reset")
+		}
+	}
+	return s.Store.Insert(table, data)
+}
+
+func TestDistributionRunResumes(t *testing.T) {
+	cfg := new_test_config()
+	mem := store.NewMemory()
+	db := &failing_store{Store: mem, user: "investor-2"}
+	router := routes.SetupRouter(cfg, upstream.New(upstream.Options{}), db, saga.NewOutbox(db), routes.NewPitchIndex(db))
+
+	seed := func(table string, data any) {
+		if _, err := mem.Insert(table, data); err != nil {
+			t.Fatalf("Failed to seed %s: %v", table, err)
+		}
+	}
+	seed("profile", map[string]any{"id": "business-1", "role": "business", "dashboard_balance": 1000})
+	seed("profile", map[string]any{"id": "investor-1", "role": "investor", "dashboard_balance": 0})
+	seed("profile", map[string]any{"id": "investor-2", "role": "investor", "dashboard_balance": 0})
+	seed("pitch", map[string]any{"title": "Test", "user_id": "business-1", "target_amount": 200, "raised_amount": 200, "status": "Declared"})
+	seed("investment_tier", map[string]any{"name": "Bronze", "min_amount": 1, "multiplier": 1.0, "pitch_id": 1})
+	seed("investments", map[string]any{"pitch_id": 1, "investor_id": "investor-1", "tier_id": 1, "amount": 100, "refunded": false})
+	seed("investments", map[string]any{"pitch_id": 1, "investor_id": "investor-2", "tier_id": 1, "amount": 100, "refunded": false})
+	seed("profits", map[string]any{"pitch_id": 1, "declared_by": "business-1", "total_profit": 500, "distributable_amount": 500, "transferred": false})
+
+	token := sign_test_token(t, "business-1")
+	send := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+	balance := func(user_id string) int64 {
+		b, err := ledger.New(mem).Balance(user_id)
+		if err != nil {
+			t.Fatalf("Failed to read balance: %v", err)
+		}
+		return b.Pence()
+	}
+
+	// the second investor's credit fails part way through
+	db.fail.Store(true)
+	if rec := send("/api/distribute?profit_id=1"); rec.Code != http.StatusInternalServerError {
+		t.Fatalf("Expected the partial run to fail, got %d: %s", rec.Code, rec.Body)
+	}
+	if rec := send("/api/distribute?profit_id=1"); rec.Code != http.StatusConflict {
+		t.Errorf("Expected a second distribution of the profit to conflict, got %d", rec.Code)
+	}
+	if balance("business-1") != 50000 || balance("investor-1") != 25000 || balance("investor-2") != 0 {
+		t.Fatalf("Unexpected balances after partial run: %d %d %d", balance("business-1"), balance("investor-1"), balance("investor-2"))
+	}
+
+	db.fail.Store(false)
+	for range 2 {
+		rec := send("/api/distribute/resume?profit_id=1")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected resume to succeed, got %d: %s", rec.Code, rec.Body)
+		}
+		var run model.DistributionRun
+		if err := json.Unmarshal(rec.Body.Bytes(), &run); err != nil {
+			t.Fatalf("Failed to decode run: %v", err)
+		}
+		if run.Status != "completed" || run.PaidCount != 2 {
+			t.Errorf("Expected a completed run with 2 payouts, got %s with %d", run.Status, run.PaidCount)
+		}
+	}
+
+	// nobody is paid twice and the business is only debited once
+	if balance("business-1") != 50000 || balance("investor-1") != 25000 || balance("investor-2") != 25000 {
+		t.Errorf("Unexpected balances after resume: %d %d %d", balance("business-1"), balance("investor-1"), balance("investor-2"))
+	}
+}
+
+// runs hook once, just before the first ledger posting to the user's wallet
+type takeover_store struct {
+	store.Store
+	user string
+	ran  atomic.Bool
+	hook func()
+}
+
+func (s *takeover_store) Insert(table string, data any) ([]byte, error) {
+	if table == "ledger_entries" {
+		raw, _ := json.Marshal(data)
+		if strings.Contains(string(raw), `"wallet:`+s.user+`"`) {
+			if s.ran.CompareAndSwap(false, true) {
+				s.hook()
+			}
+		}
+	}
+	return s.Store.Insert(table, data)
+}
+
+// seeds a run for three investors whose server stopped before paying anyone,
+// its lease long gone, and returns a resume request for it
+func seed_stopped_distribution_run(t *testing.T, mem *store.Memory, db store.Store) func() *httptest.ResponseRecorder {
+	t.Helper()
+	cfg := new_test_config()
+	router := routes.SetupRouter(cfg, upstream.New(upstream.Options{}), db, saga.NewOutbox(db), routes.NewPitchIndex(db))
+
+	seed := func(table string, data any) {
+		if _, err := mem.Insert(table, data); err != nil {
+			t.Fatalf("Failed to seed %s: %v", table, err)
+		}
+	}
+	seed("profile", map[string]any{"id": "business-1", "role": "business", "dashboard_balance": 1000})
+	seed("pitch", map[string]any{"title": "Test", "user_id": "business-1", "target_amount": 300, "raised_amount": 300, "status": "Declared"})
+	seed("profits", map[string]any{"pitch_id": 1, "declared_by": "business-1", "total_profit": 300, "distributable_amount": 300, "transferred": false})
+	seed("distribution_runs", map[string]any{"profit_id": 1, "pitch_id": 1, "business_id": "business-1", "status": "in_progress", "total_amount": 300, "investor_count": 3, "locked_until": "2020-01-01T00:00:00.000000Z", "locked_by": "crashed"})
+	for i := 1; i <= 3; i++ {
+		investor := fmt.Sprintf("investor-%d", i)
+		seed("profile", map[string]any{"id": investor, "role": "investor", "dashboard_balance": 0})
+		seed("profit_distributions", map[string]any{"run_id": 1, "profit_id": 1, "investment_id": i, "investor_id": investor, "shares": 100, "amount": 100, "paid": false})
+	}
+
+	token := sign_test_token(t, "business-1")
+	return func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/distribute/resume?profit_id=1", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+}
+
+// checks every investor was paid and the business debited exactly once
+func expect_distributed_once(t *testing.T, mem *store.Memory) {
+	t.Helper()
+	for _, user := range []string{"investor-1", "investor-2", "investor-3"} {
+		b, err := ledger.New(mem).Balance(user)
+		if err != nil {
+			t.Fatalf("Failed to read balance: %v", err)
+		}
+		if b != model.FromPounds(100) {
+			t.Errorf("Expected %s paid 100 once, got %s", user, b)
+		}
+	}
+	if b, _ := ledger.New(mem).Balance("business-1"); b != model.FromPounds(700) {
+		t.Errorf("Expected the business debited 300 once, got %s", b)
+	}
+}
+
+func TestDistributionRunStopsWhenItsLeaseIsTakenOver(t *testing.T) {
+	mem := store.NewMemory()
+	db := &takeover_store{Store: mem, user: "investor-2"}
+	send := seed_stopped_distribution_run(t, mem, db)
+
+	// the first resume stalls on the second payout until its lease runs out,
+	// and a second resume takes the run over and finishes it
+	var takeover *httptest.ResponseRecorder
+	db.hook = func() {
+		if _, err := mem.Update("distribution_runs", "id=eq.1", map[string]any{"locked_until": "2020-01-01T00:00:00.000000Z"}); err != nil {
+			t.Errorf("Failed to expire lease: %v", err)
+		}
+		takeover = send()
+	}
+	if rec := send(); rec.Code != http.StatusConflict {
+		t.Errorf("Expected the run that lost its lease to stop with 409, got %d: %s", rec.Code, rec.Body)
+	}
+	if takeover == nil || takeover.Code != http.StatusOK {
+		t.Fatalf("Expected the takeover to finish the run, got %v", takeover)
+	}
+	expect_distributed_once(t, mem)
+
+	body, _ := mem.GetByID("distribution_runs", "1")
+	var runs []model.DistributionRun
+	if err := json.Unmarshal(body, &runs); err != nil || len(runs) != 1 {
+		t.Fatalf("Failed to read run: %v", err)
+	}
+	if runs[0].Status != routes.RUN_COMPLETED || runs[0].PaidCount != 3 {
+		t.Errorf("Expected the run completed with 3 paid, got %s with %d", runs[0].Status, runs[0].PaidCount)
+	}
+}
+
+func TestConcurrentResumesOfAnExpiredRunPayOnce(t *testing.T) {
+	mem := store.NewMemory()
+	send := seed_stopped_distribution_run(t, mem, mem)
+
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if rec := send(); rec.Code != http.StatusOK && rec.Code != http.StatusConflict {
+				t.Errorf("Expected 200 or 409, got %d: %s", rec.Code, rec.Body)
+			}
+		}()
+	}
+	wg.Wait()
+	expect_distributed_once(t, mem)
+}
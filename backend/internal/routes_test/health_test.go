@@ -0,0 +1,64 @@
+package routes_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/routes"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/saga"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/upstream"
+)
+
+func TestHealthAndReadiness(t *testing.T) {
+	cfg := new_test_config()
+	var storage_up atomic.Bool
+	storage_up.Store(true)
+	storage := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !storage_up.Load() || r.URL.Path != "/storage/v1/bucket/pitch_files" {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"id":"pitch_files"}`))
+	}))
+	defer storage.Close()
+	cfg.Supabase.S3URL = storage.URL + "/storage/v1/s3"
+
+	db := seed_authorization_store(t)
+	router := routes.SetupRouter(cfg, upstream.New(upstream.Options{}), db, saga.NewOutbox(db), routes.NewPitchIndex(db))
+
+	get := func(url string) (int, map[string]any) {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+		var body map[string]any
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("Invalid %s response: %s", url, rec.Body)
+		}
+		return rec.Code, body
+	}
+
+	if code, _ := get("/healthz"); code != http.StatusOK {
+		t.Errorf("Expected /healthz to be OK, got %d", code)
+	}
+
+	code, body := get("/readyz")
+	if code != http.StatusOK || body["status"] != "ready" {
+		t.Errorf("Expected /readyz to be ready, got %d %v", code, body)
+	}
+
+	// a dependency going down takes the server out of rotation but leaves it alive
+	storage_up.Store(false)
+	code, body = get("/readyz")
+	if code != http.StatusServiceUnavailable {
+		t.Errorf("Expected /readyz to be unavailable, got %d", code)
+	}
+	checks, _ := body["checks"].(map[string]any)
+	if checks["storage"] != "failing" || checks["supabase_rest"] != "ok" || checks["jwt"] != "ok" {
+		t.Errorf("Expected only storage to be failing, got %v", checks)
+	}
+	if code, _ := get("/healthz"); code != http.StatusOK {
+		t.Errorf("Expected /healthz to stay OK, got %d", code)
+	}
+}
@@ -5,57 +5,44 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
-	"os"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/ledger"
+	model "github.com/EmmaMartin123/Industrial_Project/backend/internal/model/common"
 	"github.com/EmmaMartin123/Industrial_Project/backend/internal/routes"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/saga"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/store"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/upstream"
 	"github.com/EmmaMartin123/Industrial_Project/backend/internal/utils"
 )
 
 func TestInvestmentCRU(t *testing.T) {
-	if err := load_dot_env(); err != nil {
-		t.Logf("Warning: failed to load .env: %v", err)
-	}
-
-	required := []string{
-		"SUPABASE_URL",
-		"SUPABASE_ANON_KEY",
-		"SUPABASE_SERVICE_ROLE_KEY",
-		"TEST_INVESTOR_EMAIL",
-		"TEST_INVESTOR_PASSWORD",
-		"TEST_BUSINESS_EMAIL",
-		"TEST_BUSINESS_PASSWORD",
-	}
-	for _, key := range required {
-		if os.Getenv(key) == "" {
-			t.Skipf("Skipping: %s not set", key)
-		}
-	}
-
-	if err := utils.InitJWTHS256(os.Getenv("SUPABASE_URL") + "/auth/v1"); err != nil {
-		t.Fatalf("Failed to initialize JWT: %v", err)
-	}
+	cfg := start_test_supabase(t)
+	db := new_test_store(cfg)
 
 	// Login as business to create pitch
-	business_token, err := login_to_supabase(
-		os.Getenv("TEST_BUSINESS_EMAIL"),
-		os.Getenv("TEST_BUSINESS_PASSWORD"),
-	)
+	business_token, err := login_to_supabase(cfg, test_business_email, test_password)
 	if err != nil {
 		t.Fatalf("Failed to log in as business: %v", err)
 	}
 
 	// Login as investor to invest
-	investor_token, err := login_to_supabase(
-		os.Getenv("TEST_INVESTOR_EMAIL"),
-		os.Getenv("TEST_INVESTOR_PASSWORD"),
-	)
+	investor_token, err := login_to_supabase(cfg, test_investor_email, test_password)
 	if err != nil {
 		t.Fatalf("Failed to log in as investor: %v", err)
 	}
+	investor_id, err := utils.NewJWTHS256(cfg.Supabase.JWTIssuer(), cfg.Supabase.JWTSecret).Verify(investor_token)
+	if err != nil {
+		t.Fatalf("Failed to extract investor user ID: %v", err)
+	}
+	_, err = db.UpdateByID("profile", investor_id, map[string]interface{}{"dashboard_balance": 5000})
+	if err != nil {
+		t.Fatalf("Failed to set investor balance: %v", err)
+	}
 
-	router := routes.SetupRouter()
+	router := routes.SetupRouter(cfg, upstream.New(upstream.Options{}), db, saga.NewOutbox(db), routes.NewPitchIndex(db))
 	server := httptest.NewServer(router)
 	defer server.Close()
 	client := &http.Client{Timeout: 10 * time.Second}
@@ -66,7 +53,8 @@ func TestInvestmentCRU(t *testing.T) {
 		"detailed_pitch":        "Detailed description for investment test",
 		"target_amount":         10000,
 		"investment_start_date": "2025-01-01",
-		"investment_end_date":   "2025-12-31",
+		"investment_end_date":   time.Now().AddDate(1, 0, 0).Format("2006-01-02"),
+		"status":                "Active",
 		"profit_share_percent":  10.0,
 		"investment_tiers": []map[string]interface{}{
 			{"name": "Basic", "min_amount": 100, "multiplier": 1.1, "max_amount": 999},
@@ -197,3 +185,112 @@ func TestInvestmentCRU(t *testing.T) {
 
 	t.Logf("Investment CRU test passed: created=%d, refunded successfully", investment_id)
 }
+
+// amounts in a currency other than GBP are refused before they reach any
+// arithmetic, on every route that takes one
+func TestRejectsOtherCurrencies(t *testing.T) {
+	cfg := start_test_supabase(t)
+	db := new_test_store(cfg)
+
+	investor_token, err := login_to_supabase(cfg, test_investor_email, test_password)
+	if err != nil {
+		t.Fatalf("Failed to log in as investor: %v", err)
+	}
+	business_token, err := login_to_supabase(cfg, test_business_email, test_password)
+	if err != nil {
+		t.Fatalf("Failed to log in as business: %v", err)
+	}
+
+	router := routes.SetupRouter(cfg, upstream.New(upstream.Options{}), db, saga.NewOutbox(db), routes.NewPitchIndex(db))
+	server := httptest.NewServer(router)
+	defer server.Close()
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	euros := map[string]interface{}{"amount": 100, "currency": "EUR"}
+	tests := []struct {
+		method, path, token string
+		payload             map[string]interface{}
+	}{
+		{"POST", "/api/investment", investor_token, map[string]interface{}{"pitch_id": 1, "amount": euros}},
+		{"PATCH", "/api/wallet", investor_token, map[string]interface{}{"amount": euros}},
+		{"POST", "/api/bank", investor_token, map[string]interface{}{"account_holder_name": "Test User", "sort_code": "123456", "account_number": "12345678", "balance": euros}},
+		{"POST", "/api/profit", business_token, map[string]interface{}{"pitch_id": 1, "total_profit": euros}},
+		{"POST", "/api/pitch", business_token, map[string]interface{}{"title": "Euro pitch", "target_amount": euros}},
+	}
+	for _, tt := range tests {
+		body, _ := json.Marshal(tt.payload)
+		resp, err := make_request(client, tt.method, server.URL+tt.path, body, tt.token)
+		if err != nil {
+			t.Fatalf("%s %s failed: %v", tt.method, tt.path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %s %s in EUR, got %d", tt.method, tt.path, resp.StatusCode)
+		}
+	}
+}
+
+// fails every pitch reservation with a conflict, as if other investments
+// kept beating this one to the pitch
+type contended_store struct {
+	store.Store
+}
+
+func (s contended_store) Insert(table string, data any) ([]byte, error) {
+	if table == "pitch_reservations" {
+		return nil, fmt.Errorf("failed to insert: %w", store.ErrConflict)
+	}
+	return s.Store.Insert(table, data)
+}
+
+// an investment whose saga is still running after the wallet was debited is
+// accepted, not failed, so a retry with the same key can't invest again
+func TestUnfinishedInvestmentKeepsItsIdempotencyKey(t *testing.T) {
+	cfg := new_test_config()
+	mem := store.NewMemory()
+	db := contended_store{Store: mem}
+	router := routes.SetupRouter(cfg, upstream.New(upstream.Options{}), db, saga.NewOutbox(db), routes.NewPitchIndex(db))
+
+	seed := []struct {
+		table string
+		data  map[string]any
+	}{
+		{"profile", map[string]any{"id": "business-1", "role": "business", "dashboard_balance": 0}},
+		{"profile", map[string]any{"id": "investor-1", "role": "investor", "dashboard_balance": 1000}},
+		{"pitch", map[string]any{"title": "Test", "user_id": "business-1", "target_amount": 1000, "raised_amount": 0, "status": "Active", "investment_start_date": "2025-01-01", "investment_end_date": time.Now().AddDate(1, 0, 0).Format("2006-01-02")}},
+		{"investment_tier", map[string]any{"name": "Bronze", "min_amount": 1, "multiplier": 1.0, "pitch_id": 1}},
+	}
+	for _, s := range seed {
+		if _, err := mem.Insert(s.table, s.data); err != nil {
+			t.Fatalf("Failed to seed %s: %v", s.table, err)
+		}
+	}
+
+	token := sign_test_token(t, "investor-1")
+	for i := range 2 {
+		req := httptest.NewRequest(http.MethodPost, "/api/investment", strings.NewReader(`{"pitch_id": 1, "amount": 100}`))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Idempotency-Key", "invest-once")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusAccepted {
+			t.Fatalf("Expected attempt %d to be accepted, got %d: %s", i+1, rec.Code, rec.Body)
+		}
+		var body struct {
+			OutboxID int64  `json:"outbox_id"`
+			Status   string `json:"status"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body.OutboxID != 1 || body.Status != "pending" {
+			t.Errorf("Expected saga 1 pending, got %s", rec.Body)
+		}
+	}
+
+	balance, err := ledger.New(mem).Balance("investor-1")
+	if err != nil {
+		t.Fatalf("Failed to read balance: %v", err)
+	}
+	if balance != model.FromPounds(900) {
+		t.Errorf("Expected the wallet debited once to 900, got %s", balance)
+	}
+}
@@ -0,0 +1,54 @@
+package routes_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/routes"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/saga"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/upstream"
+)
+
+func TestMetricsEndpoint(t *testing.T) {
+	cfg := new_test_config()
+	cfg.MetricsToken = "scrape-me"
+	db := seed_authorization_store(t)
+	router := routes.SetupRouter(cfg, upstream.New(upstream.Options{}), db, saga.NewOutbox(db), routes.NewPitchIndex(db))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/pitch?id=1", nil)
+	req.Header.Set("Authorization", "Bearer "+sign_test_token(t, "investor-1"))
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	// the token is required
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected a scrape without the token to be refused, got %d", rec.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Authorization", "Bearer scrape-me")
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Scrape failed: %d %s", rec.Code, rec.Body)
+	}
+	if !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Errorf("Unexpected content type %q", rec.Header().Get("Content-Type"))
+	}
+
+	// the pitch request is counted under its route pattern, not its query
+	body := rec.Body.String()
+	for _, want := range []string{
+		`http_requests_total{route="/api/pitch",method="GET",status="200"}`,
+		`http_request_duration_seconds_count{route="/api/pitch",method="GET",status="200"}`,
+		"# TYPE investments_created_total counter",
+		"# TYPE supabase_request_duration_seconds histogram",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected the metrics to contain %s", want)
+		}
+	}
+}
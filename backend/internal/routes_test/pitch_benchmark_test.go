@@ -0,0 +1,150 @@
+package routes_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/routes"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/saga"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/supabasetest"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/upstream"
+)
+
+// seeds n active pitches, each with three tiers, two media items and two of
+// the tags, straight into the stand-in's tables
+func seed_pitches(t testing.TB, supabase *supabasetest.Server, n int) {
+	t.Helper()
+	tag_names := []string{"Technology", "Sustainability", "Health", "Finance"}
+	for _, name := range tag_names {
+		if _, err := supabase.DB.Insert("tags", map[string]any{"name": name}); err != nil {
+			t.Fatalf("Failed to seed tag: %v", err)
+		}
+	}
+
+	for i := 1; i <= n; i++ {
+		pitch := map[string]any{
+			"title":                 fmt.Sprintf("Pitch %d", i),
+			"elevator_pitch":        "Seeded pitch",
+			"detailed_pitch":        "Seeded pitch for the read path",
+			"target_amount":         10000,
+			"raised_amount":         0,
+			"profit_share_percent":  10,
+			"user_id":               "business-1",
+			"investment_start_date": "2025-01-01",
+			"investment_end_date":   "2030-01-01",
+			"status":                "Active",
+		}
+		if _, err := supabase.DB.Insert("pitch", pitch); err != nil {
+			t.Fatalf("Failed to seed pitch: %v", err)
+		}
+		for j, name := range []string{"Bronze", "Silver", "Gold"} {
+			tier := map[string]any{"pitch_id": i, "name": name, "min_amount": 100 * (j + 1), "multiplier": 1 + float64(j)/10}
+			if _, err := supabase.DB.Insert("investment_tier", tier); err != nil {
+				t.Fatalf("Failed to seed tier: %v", err)
+			}
+		}
+		for j := 1; j <= 2; j++ {
+			media := map[string]any{"pitch_id": i, "url": fmt.Sprintf("https://example.com/%d/%d.png", i, j), "media_type": "image/png", "order_in_description": j}
+			if _, err := supabase.DB.Insert("pitch_media", media); err != nil {
+				t.Fatalf("Failed to seed media: %v", err)
+			}
+		}
+		for _, tag_id := range []int{i%len(tag_names) + 1, (i+1)%len(tag_names) + 1} {
+			if _, err := supabase.DB.Insert("pitch_tags", map[string]any{"pitch_id": i, "tag_id": tag_id}); err != nil {
+				t.Fatalf("Failed to seed pitch tag: %v", err)
+			}
+		}
+	}
+}
+
+type pitch_page struct {
+	TotalCount int    `json:"totalCount"`
+	NextCursor string `json:"nextCursor"`
+	PrevCursor string `json:"prevCursor"`
+	Pitches    []struct {
+		ID              int64    `json:"id"`
+		Tags            []string `json:"tags"`
+		Media           []any    `json:"media"`
+		InvestmentTiers []any    `json:"investment_tiers"`
+	} `json:"pitches"`
+}
+
+// lists pitches, returning the page and how many upstream calls it took
+func list_pitches(t testing.TB, supabase *supabasetest.Server, server_url string, token string, query string) (pitch_page, int64) {
+	t.Helper()
+	client := &http.Client{Timeout: 10 * time.Second}
+	before := supabase.Requests()
+	resp, err := make_request(client, "GET", server_url+"/api/pitch?"+query, nil, token)
+	if err != nil {
+		t.Fatalf("List pitches failed: %v", err)
+	}
+	var page pitch_page
+	if err := decode_json_response(resp, &page); err != nil {
+		t.Fatalf("List pitches response error: %v", err)
+	}
+	return page, supabase.Requests() - before
+}
+
+func start_pitch_server(t testing.TB, n int) (*supabasetest.Server, string, string) {
+	t.Helper()
+	supabase := start_test_supabase_server(t)
+	seed_pitches(t, supabase, n)
+	cfg := supabase.Config()
+	token, err := login_to_supabase(cfg, test_investor_email, test_password)
+	if err != nil {
+		t.Fatalf("Failed to log in as investor: %v", err)
+	}
+	db := new_test_store(cfg)
+	server := httptest.NewServer(routes.SetupRouter(cfg, upstream.New(upstream.Options{}), db, saga.NewOutbox(db), routes.NewPitchIndex(db)))
+	t.Cleanup(server.Close)
+	return supabase, server.URL, token
+}
+
+func TestPitchListRoundTrips(t *testing.T) {
+	supabase, server_url, token := start_pitch_server(t, 20)
+
+	one, one_calls := list_pitches(t, supabase, server_url, token, "limit=1")
+	page, page_calls := list_pitches(t, supabase, server_url, token, "limit=20")
+	if len(one.Pitches) != 1 || len(page.Pitches) != 20 {
+		t.Fatalf("Expected pages of 1 and 20 pitches, got %d and %d", len(one.Pitches), len(page.Pitches))
+	}
+	if page_calls != one_calls {
+		t.Errorf("Expected the same upstream calls for 1 and 20 pitches, got %d and %d", one_calls, page_calls)
+	}
+	for _, p := range page.Pitches {
+		if len(p.InvestmentTiers) != 3 || len(p.Media) != 2 || len(p.Tags) != 2 {
+			t.Errorf("Expected pitch %d with 3 tiers, 2 media and 2 tags, got %d, %d and %v", p.ID, len(p.InvestmentTiers), len(p.Media), p.Tags)
+		}
+	}
+
+	// pitch i has tags i%4+1 and (i+1)%4+1, so Health (3) is on half of them
+	tagged, _ := list_pitches(t, supabase, server_url, token, "tags=Health")
+	if tagged.TotalCount != 10 || len(tagged.Pitches) != 10 {
+		t.Errorf("Expected 10 pitches tagged Health, got %d (total %d)", len(tagged.Pitches), tagged.TotalCount)
+	}
+	for _, p := range tagged.Pitches {
+		if len(p.Tags) != 2 {
+			t.Errorf("Expected the tag filter to leave pitch %d's tags alone, got %v", p.ID, p.Tags)
+		}
+	}
+}
+
+// reports the upstream calls a page of pitches costs as the page grows
+func BenchmarkPitchList(b *testing.B) {
+	for _, n := range []int{1, 20, 100} {
+		b.Run(fmt.Sprintf("pitches=%d", n), func(b *testing.B) {
+			supabase, server_url, token := start_pitch_server(b, n)
+			query := fmt.Sprintf("limit=%d", n)
+
+			var calls int64
+			for b.Loop() {
+				_, c := list_pitches(b, supabase, server_url, token, query)
+				calls += c
+			}
+			b.ReportMetric(float64(calls)/float64(b.N), "upstream-calls/op")
+		})
+	}
+}
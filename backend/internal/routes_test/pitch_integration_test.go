@@ -15,36 +15,57 @@ import (
 	"testing"
 	"time"
 
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/config"
 	"github.com/EmmaMartin123/Industrial_Project/backend/internal/routes"
-	"github.com/EmmaMartin123/Industrial_Project/backend/internal/utils"
-	"github.com/joho/godotenv"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/saga"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/store"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/supabasetest"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/upstream"
 )
 
-func load_dot_env() error {
-	dir, err := os.Getwd()
-	if err != nil {
-		return err
-	}
+const (
+	test_business_email = "business@example.com"
+	test_investor_email = "investor@example.com"
+	test_password       = "password"
+)
 
-	for {
-		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
-			return godotenv.Load(filepath.Join(dir, ".env"))
-		}
-		parent := filepath.Dir(dir)
-		if parent == dir {
-			break
+// starts a stand-in Supabase project with a business and an investor account
+// and gets a config pointing at it, whose tokens the auth middleware accepts
+func start_test_supabase(t *testing.T) *config.Config {
+	t.Helper()
+	return start_test_supabase_server(t).Config()
+}
+
+// starts the stand-in like start_test_supabase, for tests that use the
+// server itself
+func start_test_supabase_server(t testing.TB) *supabasetest.Server {
+	t.Helper()
+	supabase := supabasetest.New()
+	t.Cleanup(supabase.Close)
+
+	accounts := []struct{ email, role, name string }{
+		{test_business_email, "business", "Test Business"},
+		{test_investor_email, "investor", "Test Investor"},
+	}
+	for _, account := range accounts {
+		profile := map[string]any{"role": account.role, "display_name": account.name, "dashboard_balance": 0}
+		if _, err := supabase.CreateUser(account.email, test_password, profile); err != nil {
+			t.Fatalf("Failed to create %s: %v", account.email, err)
 		}
-		dir = parent
 	}
-	return godotenv.Load()
+	return supabase
+}
+
+func new_test_store(cfg *config.Config) store.Store {
+	return store.NewSupabase(cfg.Supabase.URL, cfg.Supabase.ServiceRoleKey, upstream.New(upstream.Options{}))
 }
 
 type supabase_login_response struct {
 	AccessToken string `json:"access_token"`
 }
 
-func login_to_supabase(email, password string) (string, error) {
-	login_url := os.Getenv("SUPABASE_URL") + "/auth/v1/token?grant_type=password"
+func login_to_supabase(cfg *config.Config, email, password string) (string, error) {
+	login_url := cfg.Supabase.URL + "/auth/v1/token?grant_type=password"
 	payload := map[string]string{
 		"email":    email,
 		"password": password,
@@ -53,7 +74,7 @@ func login_to_supabase(email, password string) (string, error) {
 	body, _ := json.Marshal(payload)
 	req, _ := http.NewRequest("POST", login_url, bytes.NewBuffer(body))
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("apikey", os.Getenv("SUPABASE_ANON_KEY"))
+	req.Header.Set("apikey", cfg.Supabase.AnonKey)
 
 	client := &http.Client{Timeout: 10 * time.Second}
 	resp, err := client.Do(req)
@@ -109,36 +130,15 @@ func decode_json_response(resp *http.Response, target interface{}) error {
 }
 
 func TestPitchCRUD(t *testing.T) {
-	if err := load_dot_env(); err != nil {
-		t.Logf("Warning: failed to load .env: %v", err)
-	}
-
-	required := []string{
-		"SUPABASE_URL",
-		"SUPABASE_ANON_KEY",
-		"SUPABASE_SERVICE_ROLE_KEY",
-		"TEST_BUSINESS_EMAIL",
-		"TEST_BUSINESS_PASSWORD",
-	}
-	for _, key := range required {
-		if os.Getenv(key) == "" {
-			t.Skipf("Skipping: %s not set", key)
-		}
-	}
-
-	if err := utils.InitJWTHS256(os.Getenv("SUPABASE_URL") + "/auth/v1"); err != nil {
-		t.Fatalf("Failed to initialize JWT: %v", err)
-	}
+	cfg := start_test_supabase(t)
+	db := new_test_store(cfg)
 
-	access_token, err := login_to_supabase(
-		os.Getenv("TEST_BUSINESS_EMAIL"),
-		os.Getenv("TEST_BUSINESS_PASSWORD"),
-	)
+	access_token, err := login_to_supabase(cfg, test_business_email, test_password)
 	if err != nil {
 		t.Fatalf("Failed to log in to Supabase: %v", err)
 	}
 
-	router := routes.SetupRouter()
+	router := routes.SetupRouter(cfg, upstream.New(upstream.Options{}), db, saga.NewOutbox(db), routes.NewPitchIndex(db))
 	server := httptest.NewServer(router)
 	defer server.Close()
 
@@ -371,36 +371,15 @@ func find_project_root() (string, error) {
 }
 
 func TestPitchCRUDWithMedia(t *testing.T) {
-	if err := load_dot_env(); err != nil {
-		t.Logf("Warning: failed to load .env: %v", err)
-	}
-
-	required := []string{
-		"SUPABASE_URL",
-		"SUPABASE_ANON_KEY",
-		"SUPABASE_SERVICE_ROLE_KEY",
-		"TEST_BUSINESS_EMAIL",
-		"TEST_BUSINESS_PASSWORD",
-	}
-	for _, key := range required {
-		if os.Getenv(key) == "" {
-			t.Skipf("Skipping: %s not set", key)
-		}
-	}
-
-	if err := utils.InitJWTHS256(os.Getenv("SUPABASE_URL") + "/auth/v1"); err != nil {
-		t.Fatalf("Failed to initialize JWT: %v", err)
-	}
+	cfg := start_test_supabase(t)
+	db := new_test_store(cfg)
 
-	access_token, err := login_to_supabase(
-		os.Getenv("TEST_BUSINESS_EMAIL"),
-		os.Getenv("TEST_BUSINESS_PASSWORD"),
-	)
+	access_token, err := login_to_supabase(cfg, test_business_email, test_password)
 	if err != nil {
 		t.Fatalf("Failed to log in to Supabase: %v", err)
 	}
 
-	router := routes.SetupRouter()
+	router := routes.SetupRouter(cfg, upstream.New(upstream.Options{}), db, saga.NewOutbox(db), routes.NewPitchIndex(db))
 	server := httptest.NewServer(router)
 	defer server.Close()
 
@@ -613,3 +592,35 @@ func TestPitchCRUDWithMedia(t *testing.T) {
 
 	t.Logf("Media upload and retrieval successful with tags")
 }
+
+func TestNewPitchStartsWithNothingRaised(t *testing.T) {
+	cfg := new_test_config()
+	db := store.NewMemory()
+	if _, err := db.Insert("profile", map[string]any{"id": "business-1", "role": "business"}); err != nil {
+		t.Fatalf("Failed to seed profile: %v", err)
+	}
+	router := routes.SetupRouter(cfg, upstream.New(upstream.Options{}), db, saga.NewOutbox(db), routes.NewPitchIndex(db))
+
+	// a client can't create a pitch that already looks funded
+	body := []byte(`{"id":77,"title":"Funded","target_amount":100,"raised_amount":100,"version":9,"status":"Draft"}`)
+	req := httptest.NewRequest(http.MethodPost, "/api/pitch", bytes.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+sign_test_token(t, "business-1"))
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected the pitch to be created, got %d %s", rec.Code, rec.Body)
+	}
+
+	stored, _ := db.Query("pitch", "")
+	var pitches []struct {
+		ID           int64   `json:"id"`
+		RaisedAmount float64 `json:"raised_amount"`
+		Version      *int64  `json:"version"`
+	}
+	if err := json.Unmarshal(stored, &pitches); err != nil || len(pitches) != 1 {
+		t.Fatalf("Expected one pitch, got %s", stored)
+	}
+	if p := pitches[0]; p.ID != 1 || p.RaisedAmount != 0 || (p.Version != nil && *p.Version != 0) {
+		t.Errorf("Expected pitch 1 with nothing raised at version 0, got %s", stored)
+	}
+}
@@ -0,0 +1,135 @@
+package routes_test
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/audit"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/config"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/ledger"
+	model "github.com/EmmaMartin123/Industrial_Project/backend/internal/model/common"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/routes"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/store"
+)
+
+// runs each pitch job once
+func run_pitch_jobs(t *testing.T, cfg *config.Config, db store.Store) {
+	t.Helper()
+	for _, job := range routes.PitchJobs(cfg, db) {
+		if err := job.Run(context.Background()); err != nil {
+			t.Fatalf("%s failed: %v", job.Name, err)
+		}
+	}
+}
+
+// seeds pitches owned by business-1 with a target of 100
+func seed_dated_pitches(t *testing.T, db store.Store, pitches []map[string]any) {
+	t.Helper()
+	for _, p := range pitches {
+		row := map[string]any{"title": "Test", "user_id": "business-1", "target_amount": 100}
+		for k, v := range p {
+			row[k] = v
+		}
+		if _, err := db.Insert("pitch", row); err != nil {
+			t.Fatalf("Failed to seed pitch: %v", err)
+		}
+	}
+}
+
+func pitch_status(t *testing.T, db store.Store, id string) string {
+	t.Helper()
+	body, err := db.GetByID("pitch", id)
+	if err != nil {
+		t.Fatalf("Failed to read pitch: %v", err)
+	}
+	var pitches []struct {
+		Status string `json:"status"`
+	}
+	if err := json.Unmarshal(body, &pitches); err != nil || len(pitches) != 1 {
+		t.Fatalf("Failed to decode pitch %s: %s", id, body)
+	}
+	return pitches[0].Status
+}
+
+func TestPitchJobsFollowDeadlines(t *testing.T) {
+	cfg := new_test_config()
+	yesterday := time.Now().AddDate(0, 0, -1).Format(time.DateOnly)
+	tomorrow := time.Now().AddDate(0, 0, 1).Format(time.DateOnly)
+
+	db := store.NewMemory()
+	if _, err := db.Insert("profile", map[string]any{"id": "investor-1", "role": "investor", "dashboard_balance": 0}); err != nil {
+		t.Fatalf("Failed to seed profile: %v", err)
+	}
+	seed_dated_pitches(t, db, []map[string]any{
+		{"status": "Draft", "raised_amount": 0, "investment_start_date": yesterday, "investment_end_date": tomorrow},
+		{"status": "Draft", "raised_amount": 0, "investment_start_date": tomorrow, "investment_end_date": tomorrow},
+		{"status": "Active", "raised_amount": 0, "investment_end_date": yesterday},
+		{"status": "Active", "raised_amount": 60, "investment_end_date": yesterday},
+		{"status": "Active", "raised_amount": 60, "investment_end_date": tomorrow},
+		{"status": "Active", "raised_amount": 100, "investment_end_date": yesterday},
+	})
+	for _, amount := range []int{40, 20} {
+		if _, err := db.Insert("investments", map[string]any{"pitch_id": 4, "investor_id": "investor-1", "tier_id": 1, "amount": amount, "refunded": false}); err != nil {
+			t.Fatalf("Failed to seed investment: %v", err)
+		}
+	}
+
+	// running twice changes nothing the second time
+	run_pitch_jobs(t, cfg, db)
+	run_pitch_jobs(t, cfg, db)
+
+	want := []string{"Active", "Draft", "Closed", "Closed", "Active", "Funded"}
+	for i, status := range want {
+		if got := pitch_status(t, db, strconv.Itoa(i+1)); got != status {
+			t.Errorf("Pitch %d: got %s, expected %s", i+1, got, status)
+		}
+	}
+
+	// the under-funded pitch gave its investor everything back, once
+	balance, err := ledger.New(db).Balance("investor-1")
+	if err != nil {
+		t.Fatalf("Failed to read balance: %v", err)
+	}
+	if balance != model.FromPounds(60) {
+		t.Errorf("Expected the investor to be refunded 60, got %s", balance)
+	}
+	body, _ := db.Query("investments", "refunded=is.false")
+	if string(body) != "[]" {
+		t.Errorf("Expected every investment to be refunded, got %s", body)
+	}
+
+	// every change is audited under the scheduler, once
+	entries, err := audit.New(db).Query(audit.Filter{ActorID: audit.SchedulerActor})
+	if err != nil {
+		t.Fatalf("Failed to read audit log: %v", err)
+	}
+	var got []string
+	for _, e := range entries {
+		got = append(got, e.Action+" "+e.TargetID)
+	}
+	slices.Sort(got)
+	want_entries := []string{"change_pitch_status 1", "change_pitch_status 3", "change_pitch_status 4", "change_pitch_status 6", "refund_pitch 4"}
+	if !slices.Equal(got, want_entries) {
+		t.Errorf("Expected audit entries %v, got %v", want_entries, got)
+	}
+}
+
+func TestPitchJobsKeepWhatWasRaised(t *testing.T) {
+	cfg := new_test_config()
+	cfg.PitchFundingPolicy = "keep_what_raised"
+
+	db := store.NewMemory()
+	seed_dated_pitches(t, db, []map[string]any{
+		{"status": "Active", "raised_amount": 60, "investment_end_date": time.Now().AddDate(0, 0, -1).Format(time.DateOnly)},
+	})
+
+	run_pitch_jobs(t, cfg, db)
+
+	if got := pitch_status(t, db, "1"); got != "Funded" {
+		t.Errorf("Expected the pitch to be funded with what it raised, got %s", got)
+	}
+}
@@ -0,0 +1,134 @@
+package routes_test
+
+import (
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func page_ids(page pitch_page) []int64 {
+	var ids []int64
+	for _, p := range page.Pitches {
+		ids = append(ids, p.ID)
+	}
+	return ids
+}
+
+func TestPitchListSortsAndPages(t *testing.T) {
+	supabase, server_url, token := start_pitch_server(t, 7)
+	// raised 0, 100 or 200 by id, so the sort needs the id to break ties
+	for id := 1; id <= 7; id++ {
+		if _, err := supabase.DB.UpdateByID("pitch", strconv.Itoa(id), map[string]any{"raised_amount": (id % 3) * 100}); err != nil {
+			t.Fatalf("Failed to set raised amount: %v", err)
+		}
+	}
+	by_raised := url.Values{"orderBy": {`{"field":"raised_amount","direction":"desc"}`}, "limit": {"3"}}
+
+	first, _ := list_pitches(t, supabase, server_url, token, by_raised.Encode())
+	if got := page_ids(first); !slices.Equal(got, []int64{5, 2, 7}) || first.TotalCount != 7 || first.PrevCursor != "" {
+		t.Fatalf("Expected the first page 5, 2, 7 of 7 with no prev cursor, got %v of %d", got, first.TotalCount)
+	}
+
+	// the page the frontend asks for with an offset is the same one
+	with_offset := url.Values{"orderBy": by_raised["orderBy"], "limit": {"3"}, "offset": {"3"}}
+	offset_page, _ := list_pitches(t, supabase, server_url, token, with_offset.Encode())
+	if got := page_ids(offset_page); !slices.Equal(got, []int64{4, 1, 6}) {
+		t.Errorf("Expected the offset page 4, 1, 6, got %v", got)
+	}
+
+	// a pitch created on the first page doesn't repeat a row on the next
+	if _, err := supabase.DB.Insert("pitch", map[string]any{"title": "New", "raised_amount": 500, "status": "Active"}); err != nil {
+		t.Fatalf("Failed to create pitch: %v", err)
+	}
+
+	next := url.Values{"cursor": {first.NextCursor}, "limit": {"3"}}
+	second, _ := list_pitches(t, supabase, server_url, token, next.Encode())
+	if got := page_ids(second); !slices.Equal(got, []int64{4, 1, 6}) || second.TotalCount != 8 {
+		t.Fatalf("Expected the second page 4, 1, 6 of 8, got %v of %d", got, second.TotalCount)
+	}
+	next = url.Values{"cursor": {second.NextCursor}, "limit": {"3"}}
+	last, _ := list_pitches(t, supabase, server_url, token, next.Encode())
+	if got := page_ids(last); !slices.Equal(got, []int64{3}) || last.NextCursor != "" {
+		t.Fatalf("Expected the last page 3 with no next cursor, got %v", got)
+	}
+
+	prev := url.Values{"cursor": {second.PrevCursor}, "limit": {"3"}}
+	back, _ := list_pitches(t, supabase, server_url, token, prev.Encode())
+	if got := page_ids(back); !slices.Equal(got, []int64{5, 2, 7}) || back.PrevCursor == "" {
+		t.Errorf("Expected to page back to 5, 2, 7 with the new pitch before it, got %v", got)
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := make_request(client, "GET", server_url+"/api/pitch?"+by_raised.Encode(), nil, token)
+	if err != nil {
+		t.Fatalf("List pitches failed: %v", err)
+	}
+	resp.Body.Close()
+	if got := resp.Header.Get("X-Total-Count"); got != "8" {
+		t.Errorf("Expected X-Total-Count 8, got %q", got)
+	}
+
+	bad := []url.Values{
+		{"orderBy": {`{"field":"user_id"}`}},
+		{"orderBy": {`{"field":"title","direction":"sideways"}`}},
+		{"cursor": {"not-a-cursor"}},
+		{"cursor": {first.NextCursor}, "offset": {"3"}},
+		{"cursor": {first.NextCursor}, "orderBy": {`{"field":"title"}`}},
+	}
+	for _, query := range bad {
+		resp, err := make_request(client, "GET", server_url+"/api/pitch?"+query.Encode(), nil, token)
+		if err != nil {
+			t.Fatalf("List pitches failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %s, got %d", query.Encode(), resp.StatusCode)
+		}
+	}
+}
+
+func TestPitchListPagesOverNullDates(t *testing.T) {
+	supabase, server_url, token := start_pitch_server(t, 6)
+	// pitches 2, 4 and 5 have no end date
+	end_dates := map[int]any{1: "2031-01-01", 2: nil, 3: "2030-06-01", 4: nil, 5: nil, 6: "2030-06-01"}
+	for id, end := range end_dates {
+		if _, err := supabase.DB.UpdateByID("pitch", strconv.Itoa(id), map[string]any{"investment_end_date": end}); err != nil {
+			t.Fatalf("Failed to set end date: %v", err)
+		}
+	}
+
+	tests := []struct {
+		direction string
+		want      []int64
+	}{
+		// nulls sort after every date
+		{"asc", []int64{3, 6, 1, 2, 4, 5}},
+		{"desc", []int64{5, 4, 2, 1, 6, 3}},
+	}
+	for _, tt := range tests {
+		query := url.Values{"orderBy": {`{"field":"investment_end_date","direction":"` + tt.direction + `"}`}, "limit": {"2"}}
+		page, _ := list_pitches(t, supabase, server_url, token, query.Encode())
+		got := page_ids(page)
+		for page.NextCursor != "" && len(got) < len(tt.want) {
+			next := url.Values{"cursor": {page.NextCursor}, "limit": {"2"}}
+			page, _ = list_pitches(t, supabase, server_url, token, next.Encode())
+			got = append(got, page_ids(page)...)
+		}
+		if !slices.Equal(got, tt.want) || page.NextCursor != "" {
+			t.Errorf("Expected %s pages %v, got %v", tt.direction, tt.want, got)
+		}
+
+		var back []int64
+		for page.PrevCursor != "" && len(back) < len(tt.want) {
+			prev := url.Values{"cursor": {page.PrevCursor}, "limit": {"2"}}
+			page, _ = list_pitches(t, supabase, server_url, token, prev.Encode())
+			back = append(page_ids(page), back...)
+		}
+		if want := tt.want[:4]; !slices.Equal(back, want) {
+			t.Errorf("Expected %s pages back to %v, got %v", tt.direction, want, back)
+		}
+	}
+}
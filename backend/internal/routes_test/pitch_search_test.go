@@ -0,0 +1,230 @@
+package routes_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/routes"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/saga"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/upstream"
+)
+
+type search_page struct {
+	TotalCount       int  `json:"totalCount"`
+	TotalCountCapped bool `json:"totalCountCapped"`
+	Pitches          []struct {
+		ID         int64             `json:"id"`
+		Highlights map[string]string `json:"highlights"`
+	} `json:"pitches"`
+}
+
+// searches the pitches, an empty result comes back as a bare []
+func search_pitches(t *testing.T, server_url string, token string, query url.Values) search_page {
+	t.Helper()
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := make_request(client, "GET", server_url+"/api/pitch?"+query.Encode(), nil, token)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200 for %s, got %d: %s", query.Encode(), resp.StatusCode, body)
+	}
+	var page search_page
+	if bytes.HasPrefix(body, []byte("[")) {
+		return page
+	}
+	if err := json.Unmarshal(body, &page); err != nil {
+		t.Fatalf("Failed to decode search results: %v", err)
+	}
+	return page
+}
+
+func search_ids(page search_page) []int64 {
+	var ids []int64
+	for _, p := range page.Pitches {
+		ids = append(ids, p.ID)
+	}
+	return ids
+}
+
+func TestPitchSearch(t *testing.T) {
+	supabase := start_test_supabase_server(t)
+	seeded := []struct{ title, elevator_pitch, detailed_pitch string }{
+		{"Solar farm", "Panels on every roof in the valley", "A co-op selling power to the grid"},
+		{"Wind turbines", "Cheaper than solar panels", "Small turbines for farms"},
+		{"Roof gardens", "Green roofs for the city", "Moss beds kept wet by solar powered pumps"},
+		{"Solarium", "A glass room for winter", "Sunlight all year"},
+	}
+	for _, p := range seeded {
+		pitch := map[string]any{
+			"title":                 p.title,
+			"elevator_pitch":        p.elevator_pitch,
+			"detailed_pitch":        p.detailed_pitch,
+			"target_amount":         10000,
+			"profit_share_percent":  10,
+			"user_id":               "business-1",
+			"investment_start_date": "2025-01-01",
+			"investment_end_date":   "2030-01-01",
+			"status":                "Active",
+		}
+		if _, err := supabase.DB.Insert("pitch", pitch); err != nil {
+			t.Fatalf("Failed to seed pitch: %v", err)
+		}
+	}
+	if _, err := supabase.DB.Insert("tags", map[string]any{"name": "Agritech"}); err != nil {
+		t.Fatalf("Failed to seed tag: %v", err)
+	}
+	if _, err := supabase.DB.Insert("pitch_tags", map[string]any{"pitch_id": 3, "tag_id": 1}); err != nil {
+		t.Fatalf("Failed to seed pitch tag: %v", err)
+	}
+
+	cfg := supabase.Config()
+	token, err := login_to_supabase(cfg, test_business_email, test_password)
+	if err != nil {
+		t.Fatalf("Failed to log in as business: %v", err)
+	}
+	db := new_test_store(cfg)
+	server := httptest.NewServer(routes.SetupRouter(cfg, upstream.New(upstream.Options{}), db, saga.NewOutbox(db), routes.NewPitchIndex(db)))
+	defer server.Close()
+
+	tests := []struct {
+		search string
+		want   []int64
+	}{
+		// a title match counts for more than one in the pitch text
+		{"solar", []int64{1, 2, 3}},
+		{"sol*", []int64{1, 4, 2, 3}},
+		{`"solar panels"`, []int64{2}},
+		{"roof solar", []int64{1, 3}},
+		{"agritech", []int64{3}},
+		{"hydrogen", nil},
+		{"!!!", nil},
+	}
+	for _, tt := range tests {
+		page := search_pitches(t, server.URL, token, url.Values{"search": {tt.search}})
+		if got := search_ids(page); !slices.Equal(got, tt.want) || page.TotalCount != len(tt.want) {
+			t.Errorf("Expected %v for %q, got %v of %d", tt.want, tt.search, got, page.TotalCount)
+		}
+	}
+
+	page := search_pitches(t, server.URL, token, url.Values{"search": {"solar"}})
+	if got, want := page.Pitches[0].Highlights["title"], "<mark>Solar</mark> farm"; got != want {
+		t.Errorf("Expected the title highlighted as %q, got %q", want, got)
+	}
+	if got, want := page.Pitches[1].Highlights["elevator_pitch"], "Cheaper than <mark>solar</mark> panels"; got != want {
+		t.Errorf("Expected the elevator pitch highlighted as %q, got %q", want, got)
+	}
+
+	// relevance order is paged by offset, another order by the database
+	paged := search_pitches(t, server.URL, token, url.Values{"search": {"solar"}, "limit": {"1"}, "offset": {"1"}})
+	if got := search_ids(paged); !slices.Equal(got, []int64{2}) || paged.TotalCount != 3 {
+		t.Errorf("Expected the second best match 2 of 3, got %v of %d", got, paged.TotalCount)
+	}
+	by_title := search_pitches(t, server.URL, token, url.Values{"search": {"solar"}, "orderBy": {`{"field":"title"}`}})
+	if got := search_ids(by_title); !slices.Equal(got, []int64{3, 1, 2}) {
+		t.Errorf("Expected the matches by title 3, 1, 2, got %v", got)
+	}
+
+	// the index follows pitches created, edited and deleted
+	client := &http.Client{Timeout: 10 * time.Second}
+	pitch := map[string]any{
+		"title":                 "Tidal lagoon",
+		"elevator_pitch":        "Power from the tide",
+		"detailed_pitch":        "Turbines in a sea wall",
+		"target_amount":         10000,
+		"investment_start_date": "2025-01-01",
+		"investment_end_date":   "2030-01-01",
+		"profit_share_percent":  10,
+		"tags":                  []string{"Energy"},
+	}
+	body, _ := json.Marshal(pitch)
+	resp, err := make_request(client, "POST", server.URL+"/api/pitch", body, token)
+	if err != nil {
+		t.Fatalf("Create request failed: %v", err)
+	}
+	var created struct {
+		ID int64 `json:"id"`
+	}
+	if err := decode_json_response(resp, &created); err != nil {
+		t.Fatalf("Create response error: %v", err)
+	}
+	if got := search_ids(search_pitches(t, server.URL, token, url.Values{"search": {"tidal energy"}})); !slices.Equal(got, []int64{created.ID}) {
+		t.Errorf("Expected the new pitch %d, got %v", created.ID, got)
+	}
+
+	pitch_url := fmt.Sprintf("%s/api/pitch?id=%d", server.URL, created.ID)
+	pitch["title"] = "Wave farm"
+	body, _ = json.Marshal(pitch)
+	resp, err = make_request(client, "PATCH", pitch_url, body, token)
+	if err != nil {
+		t.Fatalf("Update request failed: %v", err)
+	}
+	resp.Body.Close()
+	if got := search_ids(search_pitches(t, server.URL, token, url.Values{"search": {"tidal"}})); got != nil {
+		t.Errorf("Expected the old title to be gone, got %v", got)
+	}
+	if got := search_ids(search_pitches(t, server.URL, token, url.Values{"search": {"wave"}})); !slices.Equal(got, []int64{created.ID}) {
+		t.Errorf("Expected the edited pitch %d, got %v", created.ID, got)
+	}
+
+	resp, err = make_request(client, "DELETE", pitch_url, nil, token)
+	if err != nil {
+		t.Fatalf("Delete request failed: %v", err)
+	}
+	resp.Body.Close()
+	if got := search_ids(search_pitches(t, server.URL, token, url.Values{"search": {"wave"}})); got != nil {
+		t.Errorf("Expected the deleted pitch to be gone, got %v", got)
+	}
+}
+
+func TestPitchSearchFiltersEveryMatch(t *testing.T) {
+	supabase := start_test_supabase_server(t)
+	// more matches than fit in one query, only the last few of them Funded
+	n := routes.SEARCH_IDS_PER_QUERY + 10
+	for i := 1; i <= n; i++ {
+		status := "Active"
+		if i > n-5 {
+			status = "Funded"
+		}
+		pitch := map[string]any{"title": fmt.Sprintf("Solar farm %d", i), "user_id": "business-1", "status": status}
+		if _, err := supabase.DB.Insert("pitch", pitch); err != nil {
+			t.Fatalf("Failed to seed pitch: %v", err)
+		}
+	}
+
+	cfg := supabase.Config()
+	token, err := login_to_supabase(cfg, test_business_email, test_password)
+	if err != nil {
+		t.Fatalf("Failed to log in as business: %v", err)
+	}
+	db := new_test_store(cfg)
+	server := httptest.NewServer(routes.SetupRouter(cfg, upstream.New(upstream.Options{}), db, saga.NewOutbox(db), routes.NewPitchIndex(db)))
+	defer server.Close()
+
+	all := search_pitches(t, server.URL, token, url.Values{"search": {"solar"}, "limit": {"10"}})
+	if all.TotalCount != n || all.TotalCountCapped || len(all.Pitches) != 10 {
+		t.Errorf("Expected the first 10 of %d matches, got %d of %d (capped %v)", n, len(all.Pitches), all.TotalCount, all.TotalCountCapped)
+	}
+
+	funded := search_pitches(t, server.URL, token, url.Values{"search": {"solar"}, "status": {"Funded"}})
+	want := []int64{int64(n - 4), int64(n - 3), int64(n - 2), int64(n - 1), int64(n)}
+	if got := search_ids(funded); !slices.Equal(got, want) || funded.TotalCount != 5 {
+		t.Errorf("Expected the funded matches %v, got %v of %d", want, got, funded.TotalCount)
+	}
+
+	// a database order only gets the best matches, and says so
+	by_title := search_pitches(t, server.URL, token, url.Values{"search": {"solar"}, "orderBy": {`{"field":"title"}`}, "limit": {"10"}})
+	if !by_title.TotalCountCapped {
+		t.Errorf("Expected the count of %d matches in title order to be capped, got %d", n, by_title.TotalCount)
+	}
+}
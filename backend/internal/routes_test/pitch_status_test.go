@@ -0,0 +1,66 @@
+package routes_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/routes"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/saga"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/store"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/upstream"
+)
+
+func TestPitchStatusFollowsLifecycle(t *testing.T) {
+	cfg := new_test_config()
+	db := store.NewMemory()
+	router := routes.SetupRouter(cfg, upstream.New(upstream.Options{}), db, saga.NewOutbox(db), routes.NewPitchIndex(db))
+	for _, row := range []map[string]any{
+		{"id": "business-1", "role": "business"},
+		{"id": "business-2", "role": "business"},
+	} {
+		if _, err := db.Insert("profile", row); err != nil {
+			t.Fatalf("Failed to seed profile: %v", err)
+		}
+	}
+	if _, err := db.Insert("pitch", map[string]any{"title": "Test", "user_id": "business-1", "target_amount": 100, "raised_amount": 0, "status": "Draft"}); err != nil {
+		t.Fatalf("Failed to seed pitch: %v", err)
+	}
+
+	set_status := func(user_id string, status string) int {
+		req := httptest.NewRequest(http.MethodPatch, "/api/pitch/status?id=1", strings.NewReader(`{"status":"`+status+`"}`))
+		req.Header.Set("Authorization", "Bearer "+sign_test_token(t, user_id))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	cases := []struct {
+		user   string
+		status string
+		want   int
+	}{
+		{"business-2", "Active", http.StatusForbidden},
+		{"business-1", "Live", http.StatusBadRequest},
+		{"business-1", "Declared", http.StatusConflict},
+		{"business-1", "Active", http.StatusOK},
+		{"business-1", "Active", http.StatusOK},
+		{"business-1", "Funded", http.StatusForbidden},
+		{"business-1", "Distributed", http.StatusConflict},
+	}
+	for _, c := range cases {
+		if got := set_status(c.user, c.status); got != c.want {
+			t.Errorf("%s moving the pitch to %s: got %d, expected %d", c.user, c.status, got, c.want)
+		}
+	}
+
+	body, _ := db.GetByID("pitch", "1")
+	var pitches []struct {
+		Status string `json:"status"`
+	}
+	if err := json.Unmarshal(body, &pitches); err != nil || len(pitches) != 1 || pitches[0].Status != "Active" {
+		t.Errorf("Expected the pitch to be Active, got %s", body)
+	}
+}
@@ -6,65 +6,43 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
-	"os"
 	"testing"
 	"time"
 
 	"github.com/EmmaMartin123/Industrial_Project/backend/internal/routes"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/saga"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/upstream"
 	"github.com/EmmaMartin123/Industrial_Project/backend/internal/utils"
 )
 
 func TestProfitDeclarationAndDistribution(t *testing.T) {
-	if err := load_dot_env(); err != nil {
-		t.Logf("Warning: failed to load .env: %v", err)
-	}
-	required := []string{
-		"SUPABASE_URL",
-		"SUPABASE_ANON_KEY",
-		"SUPABASE_SERVICE_ROLE_KEY",
-		"TEST_INVESTOR_EMAIL",
-		"TEST_INVESTOR_PASSWORD",
-		"TEST_BUSINESS_EMAIL",
-		"TEST_BUSINESS_PASSWORD",
-	}
-	for _, key := range required {
-		if os.Getenv(key) == "" {
-			t.Skipf("Skipping: %s not set", key)
-		}
-	}
-	if err := utils.InitJWTHS256(os.Getenv("SUPABASE_URL") + "/auth/v1"); err != nil {
-		t.Fatalf("Failed to initialize JWT: %v", err)
-	}
+	cfg := start_test_supabase(t)
+	db := new_test_store(cfg)
+	verifier := utils.NewJWTHS256(cfg.Supabase.JWTIssuer(), cfg.Supabase.JWTSecret)
 	// Login as business
-	business_token, err := login_to_supabase(
-		os.Getenv("TEST_BUSINESS_EMAIL"),
-		os.Getenv("TEST_BUSINESS_PASSWORD"),
-	)
+	business_token, err := login_to_supabase(cfg, test_business_email, test_password)
 	if err != nil {
 		t.Fatalf("Failed to log in as business: %v", err)
 	}
-	business_id, err := utils.VerifyJWTHS256(business_token)
+	business_id, err := verifier.Verify(business_token)
 	if err != nil {
 		t.Fatalf("Failed to extract business user ID: %v", err)
 	}
 	// Login as investor
-	investor_token, err := login_to_supabase(
-		os.Getenv("TEST_INVESTOR_EMAIL"),
-		os.Getenv("TEST_INVESTOR_PASSWORD"),
-	)
+	investor_token, err := login_to_supabase(cfg, test_investor_email, test_password)
 	if err != nil {
 		t.Fatalf("Failed to log in as investor: %v", err)
 	}
-	investor_id, err := utils.VerifyJWTHS256(investor_token)
+	investor_id, err := verifier.Verify(investor_token)
 	if err != nil {
 		t.Fatalf("Failed to extract investor user ID: %v", err)
 	}
-	_, err = utils.UpdateByID("profile", investor_id, map[string]interface{}{"dashboard_balance": 5000})
+	_, err = db.UpdateByID("profile", investor_id, map[string]interface{}{"dashboard_balance": 5000})
 	if err != nil {
 		t.Fatalf("Failed to set investor balance: %v", err)
 	}
 
-	router := routes.SetupRouter()
+	router := routes.SetupRouter(cfg, upstream.New(upstream.Options{}), db, saga.NewOutbox(db), routes.NewPitchIndex(db))
 	server := httptest.NewServer(router)
 	defer server.Close()
 	client := &http.Client{Timeout: 10 * time.Second}
@@ -73,9 +51,10 @@ func TestProfitDeclarationAndDistribution(t *testing.T) {
 		"title":                 "Profit Test Pitch",
 		"elevator_pitch":        "Test pitch for profit distribution",
 		"detailed_pitch":        "Detailed description",
-		"target_amount":         10000,
+		"target_amount":         1000, // the investment funds it
 		"investment_start_date": "2025-01-01",
-		"investment_end_date":   "2025-12-31",
+		"investment_end_date":   time.Now().AddDate(1, 0, 0).Format("2006-01-02"),
+		"status":                "Active",
 		"profit_share_percent":  20.0,
 		"investment_tiers": []map[string]interface{}{
 			{"name": "Basic", "min_amount": 100, "multiplier": 1.0},
@@ -137,7 +116,7 @@ func TestProfitDeclarationAndDistribution(t *testing.T) {
 		t.Errorf("Expected ~2000 distributable, got %f", distributable)
 	}
 
-	_, err = utils.UpdateByID("profile", business_id, map[string]interface{}{"dashboard_balance": 3000})
+	_, err = db.UpdateByID("profile", business_id, map[string]interface{}{"dashboard_balance": 3000})
 	if err != nil {
 		t.Fatalf("Failed to fund business wallet: %v", err)
 	}
@@ -0,0 +1,200 @@
+package saga
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/postgrest"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/store"
+)
+
+const (
+	outboxTable = "outbox"
+	// fixed width so timestamps compare correctly as text too
+	timeLayout = "2006-01-02T15:04:05.000000Z"
+)
+
+// Record is a saga's row in the outbox table
+type Record struct {
+	ID          *int64          `json:"id,omitempty"`
+	Kind        string          `json:"kind"`
+	Payload     json.RawMessage `json:"payload"`
+	Status      Status          `json:"status"`
+	Step        int             `json:"step"`
+	Attempts    int             `json:"attempts"`
+	LastError   string          `json:"last_error,omitempty"`
+	LockedUntil string          `json:"locked_until"`
+	CreatedAt   string          `json:"created_at,omitempty"`
+	UpdatedAt   string          `json:"updated_at,omitempty"`
+}
+
+// Outbox persists saga progress and resumes sagas that were interrupted by a
+// failure, crash or restart
+type Outbox struct {
+	db          store.Store
+	lease       time.Duration
+	maxAttempts int
+
+	mu       sync.RWMutex
+	resumers map[string]func(*Record) error
+}
+
+// creates an outbox stored in the given data store
+func NewOutbox(db store.Store) *Outbox {
+	return &Outbox{
+		db:          db,
+		lease:       time.Minute,
+		maxAttempts: 5,
+		resumers:    make(map[string]func(*Record) error),
+	}
+}
+
+func (o *Outbox) register(kind string, resume func(*Record) error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.resumers[kind] = resume
+}
+
+// inserts a new pending record, locked so the worker leaves it to the caller
+func (o *Outbox) create(kind string, state any) (*Record, error) {
+	payload, err := json.Marshal(state)
+	if err != nil {
+		return nil, err
+	}
+
+	rec := Record{
+		Kind:        kind,
+		Payload:     payload,
+		Status:      Pending,
+		LockedUntil: o.leaseEnd(),
+	}
+	body, err := o.db.Insert(outboxTable, rec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create outbox record: %w", err)
+	}
+
+	var inserted []Record
+	if err := json.Unmarshal(body, &inserted); err != nil || len(inserted) != 1 || inserted[0].ID == nil {
+		return nil, fmt.Errorf("invalid outbox record returned: %s", string(body))
+	}
+	return &inserted[0], nil
+}
+
+// records the saga's progress and state, extending the lock while it runs
+func (o *Outbox) save(id string, rec *Record, state any) error {
+	payload, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	rec.Payload = payload
+	rec.LockedUntil = o.leaseEnd()
+
+	_, err = o.db.UpdateByID(outboxTable, id, map[string]interface{}{
+		"payload":      rec.Payload,
+		"status":       rec.Status,
+		"step":         rec.Step,
+		"attempts":     rec.Attempts,
+		"last_error":   rec.LastError,
+		"locked_until": rec.LockedUntil,
+		"updated_at":   "now()",
+	})
+	return err
+}
+
+// resumes due sagas every interval until the context is cancelled
+func (o *Outbox) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := o.ProcessDue(); err != nil {
+			slog.Warn("outbox run failed", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// resumes every pending or compensating saga whose lock has expired and
+// returns how many were picked up
+func (o *Outbox) ProcessDue() (int, error) {
+	now := time.Now().UTC().Format(timeLayout)
+	query := postgrest.New().In("status", Pending, Compensating).Lt("locked_until", now).Order("id", postgrest.Asc).Limit(50)
+	body, err := o.db.Query(outboxTable, query.String())
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch due sagas: %w", err)
+	}
+
+	var due []Record
+	if err := json.Unmarshal(body, &due); err != nil {
+		return 0, fmt.Errorf("failed to decode due sagas: %w", err)
+	}
+
+	processed := 0
+	for i := range due {
+		rec := &due[i]
+		if rec.ID == nil || !o.claim(rec) {
+			continue
+		}
+
+		o.mu.RLock()
+		resume, ok := o.resumers[rec.Kind]
+		o.mu.RUnlock()
+		if !ok {
+			slog.Warn("outbox: no saga registered", "kind", rec.Kind, "record_id", *rec.ID)
+			continue
+		}
+
+		processed++
+		if err := resume(rec); err != nil {
+			slog.Warn("outbox: saga failed", "kind", rec.Kind, "record_id", *rec.ID, "err", err)
+		}
+	}
+	return processed, nil
+}
+
+// takes the lock on a record, failing if another worker got there first
+func (o *Outbox) claim(rec *Record) bool {
+	next := o.leaseEnd()
+	condition := postgrest.New().Eq("id", *rec.ID).Eq("locked_until", rec.LockedUntil)
+	body, err := o.db.Update(outboxTable, condition.String(), map[string]interface{}{"locked_until": next})
+	if err != nil {
+		slog.Warn("outbox: failed to claim record", "record_id", *rec.ID, "err", err)
+		return false
+	}
+
+	var claimed []Record
+	if json.Unmarshal(body, &claimed) != nil || len(claimed) != 1 {
+		return false
+	}
+	rec.LockedUntil = next
+	return true
+}
+
+// gets the outbox record by id
+func (o *Outbox) Get(id int64) (*Record, error) {
+	body, err := o.db.GetByID(outboxTable, strconv.FormatInt(id, 10))
+	if err != nil {
+		return nil, err
+	}
+	var recs []Record
+	if err := json.Unmarshal(body, &recs); err != nil {
+		return nil, err
+	}
+	if len(recs) != 1 {
+		return nil, fmt.Errorf("outbox record %d not found", id)
+	}
+	return &recs[0], nil
+}
+
+func (o *Outbox) leaseEnd() string {
+	return time.Now().Add(o.lease).UTC().Format(timeLayout)
+}
@@ -0,0 +1,163 @@
+package saga
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// Status is where a saga is in its lifecycle
+type Status string
+
+const (
+	Pending      Status = "pending"      // running forward
+	Compensating Status = "compensating" // undoing completed steps
+	Completed    Status = "completed"
+	Compensated  Status = "compensated"
+	Failed       Status = "failed" // compensation gave up, needs a person
+)
+
+// Step is one action of a saga with the action that undoes it. Both get the
+// saga's outbox id to use as an idempotency reference and should be safe to
+// repeat, since a crash can happen after a step ran but before its progress
+// was recorded.
+type Step[S any] struct {
+	Name string
+	Do   func(id int64, state *S) error
+	Undo func(id int64, state *S) error
+}
+
+// Definition is an ordered list of steps that run against a state of type S;
+// the state is stored as JSON in the outbox so the worker can pick it back up
+type Definition[S any] struct {
+	Kind  string
+	Steps []Step[S]
+}
+
+// StepError reports which step a saga failed on
+type StepError struct {
+	Step string
+	Err  error
+}
+
+func (e *StepError) Error() string {
+	return fmt.Sprintf("saga step %s failed: %v", e.Step, e.Err)
+}
+
+func (e *StepError) Unwrap() error { return e.Err }
+
+// UnfinishedError reports a saga that stopped without either completing or
+// being undone, so some of its steps may have happened. The outbox worker
+// carries pending and compensating sagas on, failed ones need a person.
+type UnfinishedError struct {
+	ID     int64
+	Status Status
+	Err    error
+}
+
+func (e *UnfinishedError) Error() string {
+	return fmt.Sprintf("saga %d is %s: %v", e.ID, e.Status, e.Err)
+}
+
+func (e *UnfinishedError) Unwrap() error { return e.Err }
+
+// registers the definition so the outbox worker can resume it after a restart
+func (d Definition[S]) Register(o *Outbox) {
+	o.register(d.Kind, func(rec *Record) error {
+		var state S
+		if err := json.Unmarshal(rec.Payload, &state); err != nil {
+			return fmt.Errorf("invalid %s payload: %w", d.Kind, err)
+		}
+		return d.resume(o, rec, &state)
+	})
+}
+
+// runs the saga from the start, recording progress in the outbox. If a step
+// fails the completed steps are undone before returning the step's error,
+// and if they can't be the error is an *UnfinishedError.
+func (d Definition[S]) Run(o *Outbox, state *S) error {
+	rec, err := o.create(d.Kind, state)
+	if err != nil {
+		return err
+	}
+	if err := d.resume(o, rec, state); err != nil {
+		if rec.Status != Compensated {
+			return &UnfinishedError{ID: *rec.ID, Status: rec.Status, Err: err}
+		}
+		return err
+	}
+	return nil
+}
+
+// carries the saga on from wherever the record says it stopped
+func (d Definition[S]) resume(o *Outbox, rec *Record, state *S) error {
+	id := strconv.FormatInt(*rec.ID, 10)
+
+	if rec.Status == Pending {
+		for rec.Step < len(d.Steps) {
+			step := d.Steps[rec.Step]
+			if err := step.Do(*rec.ID, state); err != nil {
+				rec.LastError = err.Error()
+				rec.Attempts++
+				if rec.Attempts < o.maxAttempts && errors.Is(err, ErrRetry) {
+					// leaves it pending for the worker to try again later
+					_ = o.save(id, rec, state)
+					return &StepError{Step: step.Name, Err: err}
+				}
+				// the failed step may have half happened (e.g. a timeout after the
+				// write landed) so its undo runs too
+				rec.Step++
+				rec.Status = Compensating
+				if saveErr := o.save(id, rec, state); saveErr != nil {
+					return fmt.Errorf("%w (and failed to record it: %v)", &StepError{Step: step.Name, Err: err}, saveErr)
+				}
+				if undoErr := d.compensate(o, id, rec, state); undoErr != nil {
+					return fmt.Errorf("%w (compensation incomplete: %v)", &StepError{Step: step.Name, Err: err}, undoErr)
+				}
+				return &StepError{Step: step.Name, Err: err}
+			}
+			rec.Step++
+			rec.Attempts = 0
+			if err := o.save(id, rec, state); err != nil {
+				return fmt.Errorf("failed to record saga progress: %w", err)
+			}
+		}
+		rec.Status = Completed
+		return o.save(id, rec, state)
+	}
+
+	if rec.Status == Compensating {
+		return d.compensate(o, id, rec, state)
+	}
+	return nil
+}
+
+// undoes completed steps in reverse order
+func (d Definition[S]) compensate(o *Outbox, id string, rec *Record, state *S) error {
+	for rec.Step > 0 {
+		step := d.Steps[rec.Step-1]
+		if step.Undo != nil {
+			if err := step.Undo(*rec.ID, state); err != nil {
+				rec.LastError = fmt.Sprintf("undo %s: %v", step.Name, err)
+				rec.Attempts++
+				if rec.Attempts >= o.maxAttempts {
+					rec.Status = Failed
+				}
+				_ = o.save(id, rec, state)
+				return err
+			}
+		}
+		rec.Step--
+		rec.Attempts = 0
+		if err := o.save(id, rec, state); err != nil {
+			return fmt.Errorf("failed to record saga progress: %w", err)
+		}
+	}
+	rec.Status = Compensated
+	return o.save(id, rec, state)
+}
+
+// ErrRetry marks a step failure as temporary, the saga stays pending and the
+// worker retries the step instead of compensating straight away
+var ErrRetry = errors.New("temporary failure")
@@ -0,0 +1,160 @@
+package saga
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/store"
+)
+
+type test_state struct {
+	Done []string `json:"done"`
+}
+
+// builds a saga whose steps record themselves in the state and in log, with
+// fail deciding whether a step errors
+func new_test_saga(log *[]string, fail func(step string) error) Definition[test_state] {
+	step := func(name string) Step[test_state] {
+		return Step[test_state]{
+			Name: name,
+			Do: func(id int64, s *test_state) error {
+				if err := fail(name); err != nil {
+					return err
+				}
+				s.Done = append(s.Done, name)
+				*log = append(*log, "do "+name)
+				return nil
+			},
+			Undo: func(id int64, s *test_state) error {
+				*log = append(*log, "undo "+name)
+				return nil
+			},
+		}
+	}
+	return Definition[test_state]{Kind: "test", Steps: []Step[test_state]{step("a"), step("b"), step("c")}}
+}
+
+func TestSagaCompletes(t *testing.T) {
+	o := NewOutbox(store.NewMemory())
+	var log []string
+	d := new_test_saga(&log, func(string) error { return nil })
+
+	state := test_state{}
+	if err := d.Run(o, &state); err != nil {
+		t.Fatalf("Saga failed: %v", err)
+	}
+	if len(state.Done) != 3 {
+		t.Errorf("Expected 3 steps done, got %v", state.Done)
+	}
+
+	rec, err := o.Get(1)
+	if err != nil {
+		t.Fatalf("Failed to get record: %v", err)
+	}
+	if rec.Status != Completed || rec.Step != 3 {
+		t.Errorf("Expected completed at step 3, got %s at %d", rec.Status, rec.Step)
+	}
+}
+
+func TestSagaCompensatesInReverse(t *testing.T) {
+	o := NewOutbox(store.NewMemory())
+	var log []string
+	boom := errors.New("boom")
+	d := new_test_saga(&log, func(step string) error {
+		if step == "c" {
+			return boom
+		}
+		return nil
+	})
+
+	err := d.Run(o, &test_state{})
+	var stepErr *StepError
+	if !errors.As(err, &stepErr) || stepErr.Step != "c" || !errors.Is(err, boom) {
+		t.Fatalf("Expected step c to fail with boom, got %v", err)
+	}
+	var unfinished *UnfinishedError
+	if errors.As(err, &unfinished) {
+		t.Errorf("Expected a fully undone saga not to be reported unfinished")
+	}
+
+	want := "[do a do b undo c undo b undo a]"
+	if got := fmt.Sprint(log); got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+
+	rec, _ := o.Get(1)
+	if rec.Status != Compensated || rec.Step != 0 {
+		t.Errorf("Expected compensated at step 0, got %s at %d", rec.Status, rec.Step)
+	}
+}
+
+func TestWorkerResumesRetriedStep(t *testing.T) {
+	o := NewOutbox(store.NewMemory())
+	o.lease = -time.Second // every record is due straight away
+
+	var log []string
+	down := true
+	d := new_test_saga(&log, func(step string) error {
+		if step == "b" && down {
+			return fmt.Errorf("%w: upstream unavailable", ErrRetry)
+		}
+		return nil
+	})
+	d.Register(o)
+
+	err := d.Run(o, &test_state{})
+	var unfinished *UnfinishedError
+	if !errors.Is(err, ErrRetry) || !errors.As(err, &unfinished) || unfinished.ID != 1 || unfinished.Status != Pending {
+		t.Fatalf("Expected saga 1 left pending after a retryable failure, got %v", err)
+	}
+	rec, _ := o.Get(1)
+	if rec.Status != Pending || rec.Step != 1 || rec.Attempts != 1 {
+		t.Fatalf("Expected pending at step 1 after one attempt, got %s at %d (%d attempts)", rec.Status, rec.Step, rec.Attempts)
+	}
+
+	down = false
+	n, err := o.ProcessDue()
+	if err != nil || n != 1 {
+		t.Fatalf("Expected the worker to resume 1 saga, got %d (%v)", n, err)
+	}
+
+	rec, _ = o.Get(1)
+	if rec.Status != Completed {
+		t.Errorf("Expected completed after resume, got %s", rec.Status)
+	}
+	want := "[do a do b do c]"
+	if got := fmt.Sprint(log); got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+}
+
+func TestWorkerGivesUpAndCompensates(t *testing.T) {
+	o := NewOutbox(store.NewMemory())
+	o.lease = -time.Second
+
+	var log []string
+	d := new_test_saga(&log, func(step string) error {
+		if step == "b" {
+			return ErrRetry
+		}
+		return nil
+	})
+	d.Register(o)
+
+	_ = d.Run(o, &test_state{})
+	for range o.maxAttempts {
+		if _, err := o.ProcessDue(); err != nil {
+			t.Fatalf("Worker failed: %v", err)
+		}
+	}
+
+	rec, _ := o.Get(1)
+	if rec.Status != Compensated {
+		t.Errorf("Expected compensated after %d attempts, got %s", o.maxAttempts, rec.Status)
+	}
+	if got := fmt.Sprint(log); got != "[do a undo b undo a]" {
+		t.Errorf("Unexpected step log %s", got)
+	}
+}
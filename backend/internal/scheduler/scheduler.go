@@ -0,0 +1,216 @@
+package scheduler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/postgrest"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/store"
+)
+
+const (
+	locksTable = "job_locks"
+	// fixed width so timestamps compare correctly as text too
+	timeLayout = "2006-01-02T15:04:05.000000Z"
+)
+
+var ErrLeaseLost = errors.New("another server has taken over the job")
+
+// Job is work run every Every, by one server at a time
+type Job struct {
+	Name  string
+	Every time.Duration
+	Run   func(ctx context.Context) error
+}
+
+// the job's row in the job_locks table, a server runs the job only while it
+// holds the row's lease
+type lock struct {
+	Name        string `json:"name"`
+	Owner       string `json:"owner"`
+	LockedUntil string `json:"locked_until"`
+	LastRunAt   string `json:"last_run_at,omitempty"`
+	LastError   string `json:"last_error"`
+}
+
+// Scheduler runs jobs in the background. Every server can run one, each run of
+// a job first takes the job's lease so only one of them does it per interval.
+type Scheduler struct {
+	db    store.Store
+	owner string
+
+	mu   sync.Mutex
+	jobs []Job
+}
+
+// creates a scheduler that keeps its locks in the given data store
+func New(db store.Store) *Scheduler {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return &Scheduler{db: db, owner: hex.EncodeToString(b)}
+}
+
+// adds a job, it starts running on the next call to Start
+func (s *Scheduler) Add(jobs ...Job) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs = append(s.jobs, jobs...)
+}
+
+// runs every job on its interval until ctx is cancelled
+func (s *Scheduler) Start(ctx context.Context) {
+	s.mu.Lock()
+	jobs := append([]Job(nil), s.jobs...)
+	s.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, job := range jobs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ticker := time.NewTicker(job.Every)
+			defer ticker.Stop()
+			for {
+				if _, err := s.RunDue(ctx, job); err != nil {
+					slog.Warn("scheduler: job failed", "job", job.Name, "err", err)
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// the job a context was given to by RunDue
+type running struct {
+	s   *Scheduler
+	job Job
+}
+
+type runningKey struct{}
+
+// runs the job if no server has run it this interval, reporting whether this
+// server was the one that ran it. The lease is renewed while the job runs and
+// its context is cancelled with ErrLeaseLost if another server takes it over.
+func (s *Scheduler) RunDue(ctx context.Context, job Job) (bool, error) {
+	acquired, err := s.acquire(job)
+	if err != nil || !acquired {
+		return false, err
+	}
+
+	runCtx, cancel := context.WithCancelCause(context.WithValue(ctx, runningKey{}, running{s: s, job: job}))
+	defer cancel(nil)
+	if job.Every > 0 {
+		go s.keep(runCtx, job, cancel)
+	}
+
+	runErr := job.Run(runCtx)
+
+	// the lease is kept until it runs out so the job isn't run again early
+	record := map[string]any{"last_run_at": now(), "last_error": ""}
+	if runErr != nil {
+		record["last_error"] = runErr.Error()
+	}
+	if _, err := s.db.Update(locksTable, s.held(job), record); err != nil {
+		slog.Warn("scheduler: failed to record run", "job", job.Name, "err", err)
+	}
+	return true, runErr
+}
+
+// renews the job's lease a few times an interval until ctx is done, so it
+// doesn't run out under a run that takes longer than the interval
+func (s *Scheduler) keep(ctx context.Context, job Job, cancel context.CancelCauseFunc) {
+	ticker := time.NewTicker(job.Every / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := s.renew(job); err != nil {
+			slog.Warn("scheduler: failed to renew lease", "job", job.Name, "err", err)
+			if errors.Is(err, ErrLeaseLost) {
+				cancel(err)
+				return
+			}
+		}
+	}
+}
+
+// renews the lease of the job running under ctx, returning ErrLeaseLost if
+// another server has taken it over. Jobs that carry on past cancellation
+// check it before each step that mustn't be run by two servers, outside a
+// job it does nothing.
+func Renew(ctx context.Context) error {
+	r, ok := ctx.Value(runningKey{}).(running)
+	if !ok {
+		return nil
+	}
+	return r.s.renew(r.job)
+}
+
+// pushes the job's lease back a whole interval if this scheduler still holds it
+func (s *Scheduler) renew(job Job) error {
+	until := time.Now().UTC().Add(job.Every).Format(timeLayout)
+	body, err := s.db.Update(locksTable, s.held(job), map[string]any{"locked_until": until})
+	if err != nil {
+		return fmt.Errorf("failed to renew lock: %w", err)
+	}
+	var updated []lock
+	if err := json.Unmarshal(body, &updated); err != nil {
+		return fmt.Errorf("failed to decode lock: %w", err)
+	}
+	if len(updated) == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+// takes the job's lease if it has run out, creating the lock the first time
+func (s *Scheduler) acquire(job Job) (bool, error) {
+	until := time.Now().UTC().Add(job.Every).Format(timeLayout)
+
+	condition := postgrest.New().Eq("name", job.Name).Lt("locked_until", now())
+	body, err := s.db.Update(locksTable, condition.String(), map[string]any{"owner": s.owner, "locked_until": until})
+	if err != nil {
+		return false, fmt.Errorf("failed to take lock: %w", err)
+	}
+	var updated []lock
+	if err := json.Unmarshal(body, &updated); err != nil {
+		return false, fmt.Errorf("failed to decode lock: %w", err)
+	}
+	if len(updated) == 1 {
+		return true, nil
+	}
+
+	// nothing was updated, either someone holds the lease or the lock is new
+	_, err = s.db.Insert(locksTable, lock{Name: job.Name, Owner: s.owner, LockedUntil: until})
+	if errors.Is(err, store.ErrConflict) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to create lock: %w", err)
+	}
+	return true, nil
+}
+
+// the condition matching the job's lock while this scheduler holds it
+func (s *Scheduler) held(job Job) string {
+	return postgrest.New().Eq("name", job.Name).Eq("owner", s.owner).String()
+}
+
+func now() string {
+	return time.Now().UTC().Format(timeLayout)
+}
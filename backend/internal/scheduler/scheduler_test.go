@@ -0,0 +1,136 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/store"
+)
+
+func TestOnlyOneServerRunsAJobPerInterval(t *testing.T) {
+	db := store.NewMemory()
+	var runs atomic.Int32
+	job := Job{Name: "count", Every: time.Hour, Run: func(ctx context.Context) error {
+		runs.Add(1)
+		return nil
+	}}
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := New(db).RunDue(context.Background(), job); err != nil {
+				t.Errorf("RunDue failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if runs.Load() != 1 {
+		t.Errorf("Expected the job to run once, ran %d times", runs.Load())
+	}
+}
+
+func TestJobRunsAgainOnceItsLeaseRunsOut(t *testing.T) {
+	db := store.NewMemory()
+	failed := errors.New("upstream down")
+	job := Job{Name: "flaky", Every: -time.Second, Run: func(ctx context.Context) error {
+		return failed
+	}}
+
+	a, b := New(db), New(db)
+	if ran, err := a.RunDue(context.Background(), job); !ran || !errors.Is(err, failed) {
+		t.Fatalf("Expected the first run to fail, got %v %v", ran, err)
+	}
+	job.Run = func(ctx context.Context) error { return nil }
+	if ran, err := b.RunDue(context.Background(), job); !ran || err != nil {
+		t.Fatalf("Expected another server to take over, got %v %v", ran, err)
+	}
+
+	body, err := db.Query(locksTable, "name=eq.flaky")
+	if err != nil {
+		t.Fatalf("Failed to read lock: %v", err)
+	}
+	var locks []lock
+	if err := json.Unmarshal(body, &locks); err != nil || len(locks) != 1 {
+		t.Fatalf("Expected one lock, got %s", body)
+	}
+	if locks[0].Owner != b.owner || locks[0].LastError != "" || locks[0].LastRunAt == "" {
+		t.Errorf("Expected the lock to record the second server's clean run, got %+v", locks[0])
+	}
+}
+
+func TestLeaseIsRenewedWhileAJobRuns(t *testing.T) {
+	db := store.NewMemory()
+	a, b := New(db), New(db)
+	started := make(chan struct{})
+	job := Job{Name: "slow", Every: 90 * time.Millisecond, Run: func(ctx context.Context) error {
+		close(started)
+		time.Sleep(300 * time.Millisecond)
+		return ctx.Err()
+	}}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := a.RunDue(context.Background(), job)
+		done <- err
+	}()
+	<-started
+
+	// well past the first lease, but the run is still going
+	time.Sleep(150 * time.Millisecond)
+	if ran, err := b.RunDue(context.Background(), job); ran || err != nil {
+		t.Errorf("Expected the running job's lease to hold, got %v %v", ran, err)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("Expected the run to finish, got %v", err)
+	}
+}
+
+func TestJobStopsWhenItsLeaseIsTakenOver(t *testing.T) {
+	db := store.NewMemory()
+	steal := func() {
+		if _, err := db.Update(locksTable, "name=eq.refunds", map[string]any{"owner": "other"}); err != nil {
+			t.Fatalf("Failed to take lock: %v", err)
+		}
+	}
+
+	// checked before each step
+	job := Job{Name: "refunds", Every: time.Hour, Run: func(ctx context.Context) error {
+		if err := Renew(ctx); err != nil {
+			return err
+		}
+		steal()
+		return Renew(ctx)
+	}}
+	if ran, err := New(db).RunDue(context.Background(), job); !ran || !errors.Is(err, ErrLeaseLost) {
+		t.Errorf("Expected the job to find its lease taken, got %v %v", ran, err)
+	}
+
+	// or noticed by the renewals while it runs
+	if _, err := db.Update(locksTable, "name=eq.refunds", map[string]any{"locked_until": "2020-01-01T00:00:00.000000Z"}); err != nil {
+		t.Fatalf("Failed to expire lock: %v", err)
+	}
+	job = Job{Name: "refunds", Every: 30 * time.Millisecond, Run: func(ctx context.Context) error {
+		steal()
+		select {
+		case <-ctx.Done():
+			return context.Cause(ctx)
+		case <-time.After(time.Second):
+			return nil
+		}
+	}}
+	if ran, err := New(db).RunDue(context.Background(), job); !ran || !errors.Is(err, ErrLeaseLost) {
+		t.Errorf("Expected the job to be cancelled once its lease was taken, got %v %v", ran, err)
+	}
+
+	if err := Renew(context.Background()); err != nil {
+		t.Errorf("Expected Renew outside a job to do nothing, got %v", err)
+	}
+}
@@ -0,0 +1,437 @@
+// Package search is an in-process full-text index. Documents are made of
+// named text fields, each weighted by how much a match in it counts.
+// Queries are words that all have to match, where a word ending in * matches
+// any word it starts and "quoted words" have to appear together in order.
+// Results are ranked by relevance and come with the matches highlighted.
+package search
+
+import (
+	"cmp"
+	"errors"
+	"html"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+var ErrEmptyQuery = errors.New("the search has no words in it")
+
+// how many words either side of the first match a snippet shows
+const snippetContext = 8
+
+// Field is a field of the documents and how much a match in it counts
+type Field struct {
+	Name   string
+	Weight float64
+}
+
+// Document is the text of one thing to search, by field name
+type Document struct {
+	ID     int64
+	Fields map[string]string
+}
+
+// Hit is a document matching a search
+type Hit struct {
+	ID    int64
+	Score float64
+	// the matching fields with the matched words in <mark> tags and the
+	// rest HTML escaped, cut down to the text around the first match
+	Highlights map[string]string
+}
+
+// a word of a field and where it is in the field's text
+type token struct {
+	word       string
+	start, end int
+}
+
+type document struct {
+	fields map[string]string
+	tokens map[string][]token
+}
+
+// an occurrence of a word
+type posting struct {
+	field string
+	pos   int
+}
+
+// Index holds the documents and which words are in which of them, it's
+// safe to use from several goroutines
+type Index struct {
+	fields []Field
+
+	loading sync.Mutex // held while documents are read for a refresh
+
+	mu      sync.RWMutex
+	docs    map[int64]document
+	words   map[string]map[int64][]posting
+	vocab   []string // the words sorted, for prefixes, rebuilt by each write that changes them
+	loaded  time.Time
+	changed map[int64]time.Time // when documents were last put or removed
+}
+
+// creates an empty index of documents with the fields
+func New(fields ...Field) *Index {
+	return &Index{
+		fields:  fields,
+		docs:    make(map[int64]document),
+		words:   make(map[string]map[int64][]posting),
+		changed: make(map[int64]time.Time),
+	}
+}
+
+// adds the document, replacing any earlier one with its id
+func (x *Index) Put(doc Document) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.put(doc)
+	x.changed[doc.ID] = time.Now()
+	x.sortVocab()
+}
+
+// removes the document with the id if there is one
+func (x *Index) Remove(id int64) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.remove(id)
+	x.changed[id] = time.Now()
+	x.sortVocab()
+}
+
+// reloads every document with load if they were last loaded longer ago
+// than maxAge, or never have been, a maxAge of 0 always reloads. Documents
+// put or removed while load runs are kept as they are.
+func (x *Index) Refresh(maxAge time.Duration, load func() ([]Document, error)) error {
+	if !x.stale(maxAge) {
+		return nil
+	}
+	x.loading.Lock()
+	defer x.loading.Unlock()
+	// someone else may have reloaded while this waited
+	if !x.stale(maxAge) {
+		return nil
+	}
+
+	started := time.Now()
+	docs, err := load()
+	if err != nil {
+		return err
+	}
+	x.replace(docs, started)
+	return nil
+}
+
+func (x *Index) stale(maxAge time.Duration) bool {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return x.loaded.IsZero() || time.Since(x.loaded) > maxAge
+}
+
+// replaces every document with the ones read at started, keeping the
+// documents put or removed since then as they are now
+func (x *Index) replace(docs []Document, started time.Time) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	kept := make(map[int64]document)
+	for id, at := range x.changed {
+		if at.Before(started) {
+			delete(x.changed, id)
+		} else if doc, ok := x.docs[id]; ok {
+			kept[id] = doc
+		}
+	}
+
+	x.docs = make(map[int64]document)
+	x.words = make(map[string]map[int64][]posting)
+	x.vocab = nil
+	for _, doc := range docs {
+		if _, ok := x.changed[doc.ID]; !ok {
+			x.put(doc)
+		}
+	}
+	for id, doc := range kept {
+		x.put(Document{ID: id, Fields: doc.fields})
+	}
+	x.sortVocab()
+	x.loaded = started
+}
+
+// checks whether the documents have been loaded since the index was created
+func (x *Index) Loaded() bool {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return !x.loaded.IsZero()
+}
+
+func (x *Index) put(doc Document) {
+	x.remove(doc.ID)
+	d := document{fields: make(map[string]string), tokens: make(map[string][]token)}
+	for _, f := range x.fields {
+		text := doc.Fields[f.Name]
+		d.fields[f.Name] = text
+		d.tokens[f.Name] = tokenize(text)
+		for pos, t := range d.tokens[f.Name] {
+			if x.words[t.word] == nil {
+				x.words[t.word] = make(map[int64][]posting)
+				x.vocab = nil
+			}
+			x.words[t.word][doc.ID] = append(x.words[t.word][doc.ID], posting{field: f.Name, pos: pos})
+		}
+	}
+	x.docs[doc.ID] = d
+}
+
+func (x *Index) remove(id int64) {
+	d, ok := x.docs[id]
+	if !ok {
+		return
+	}
+	for _, tokens := range d.tokens {
+		for _, t := range tokens {
+			delete(x.words[t.word], id)
+			if len(x.words[t.word]) == 0 {
+				delete(x.words, t.word)
+				x.vocab = nil
+			}
+		}
+	}
+	delete(x.docs, id)
+}
+
+// a word, prefix or phrase of a query
+type clause struct {
+	words  []string // more than one for a phrase
+	prefix bool
+}
+
+// finds the documents matching every clause of the query, best first, and at
+// most limit of them, or all of them for a limit of 0
+func (x *Index) Search(query string, limit int) ([]Hit, error) {
+	clauses := parse(query)
+	if len(clauses) == 0 {
+		return nil, ErrEmptyQuery
+	}
+
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	weights := make(map[string]float64, len(x.fields))
+	for _, f := range x.fields {
+		weights[f.Name] = f.Weight
+	}
+
+	var scores map[int64]float64
+	marks := make(map[int64]map[string]map[int]bool) // doc, field, word positions
+	for _, c := range clauses {
+		matches := x.match(c)
+		if scores == nil {
+			scores = make(map[int64]float64, len(matches))
+			for id := range matches {
+				scores[id] = 0
+			}
+		}
+
+		// rarer clauses count for more, and repeats count for less each
+		idf := math.Log(1 + float64(len(x.docs))/float64(len(matches)+1))
+		for id := range scores {
+			found, ok := matches[id]
+			if !ok {
+				delete(scores, id)
+				continue
+			}
+			for field, starts := range found {
+				scores[id] += idf * weights[field] * (1 + math.Log(float64(len(starts))))
+				if marks[id] == nil {
+					marks[id] = make(map[string]map[int]bool)
+				}
+				if marks[id][field] == nil {
+					marks[id][field] = make(map[int]bool)
+				}
+				for _, start := range starts {
+					for i := range len(c.words) {
+						marks[id][field][start+i] = true
+					}
+				}
+			}
+		}
+	}
+
+	hits := make([]Hit, 0, len(scores))
+	for id, score := range scores {
+		hits = append(hits, Hit{ID: id, Score: score})
+	}
+	slices.SortFunc(hits, func(a, b Hit) int {
+		if c := cmp.Compare(b.Score, a.Score); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.ID, b.ID)
+	})
+	if limit > 0 && len(hits) > limit {
+		hits = hits[:limit]
+	}
+
+	for i := range hits {
+		id := hits[i].ID
+		hits[i].Highlights = make(map[string]string)
+		for field, positions := range marks[id] {
+			hits[i].Highlights[field] = snippet(x.docs[id].fields[field], x.docs[id].tokens[field], positions)
+		}
+	}
+	return hits, nil
+}
+
+// finds the documents the clause matches, with the positions of the first
+// word of each match by field
+func (x *Index) match(c clause) map[int64]map[string][]int {
+	found := make(map[int64]map[string][]int)
+	add := func(id int64, field string, pos int) {
+		if found[id] == nil {
+			found[id] = make(map[string][]int)
+		}
+		found[id][field] = append(found[id][field], pos)
+	}
+
+	first := []string{c.words[0]}
+	if c.prefix {
+		first = x.withPrefix(c.words[0])
+	}
+	for _, w := range first {
+		for id, postings := range x.words[w] {
+			for _, p := range postings {
+				if x.followedBy(id, p, c.words[1:]) {
+					add(id, p.field, p.pos)
+				}
+			}
+		}
+	}
+	return found
+}
+
+// checks that the words come straight after the posting, in order
+func (x *Index) followedBy(id int64, p posting, words []string) bool {
+	tokens := x.docs[id].tokens[p.field]
+	for i, w := range words {
+		at := p.pos + 1 + i
+		if at >= len(tokens) || tokens[at].word != w {
+			return false
+		}
+	}
+	return true
+}
+
+// sorts the indexed words again if a write added or removed any, so
+// searches only ever read them
+func (x *Index) sortVocab() {
+	if x.vocab != nil {
+		return
+	}
+	x.vocab = make([]string, 0, len(x.words))
+	for w := range x.words {
+		x.vocab = append(x.vocab, w)
+	}
+	sort.Strings(x.vocab)
+}
+
+// gets the indexed words that start with the prefix
+func (x *Index) withPrefix(prefix string) []string {
+	i := sort.SearchStrings(x.vocab, prefix)
+	var words []string
+	for ; i < len(x.vocab) && strings.HasPrefix(x.vocab[i], prefix); i++ {
+		words = append(words, x.vocab[i])
+	}
+	return words
+}
+
+// parses a query into its clauses, ignoring anything that isn't a word
+func parse(query string) []clause {
+	var clauses []clause
+	for i, part := range strings.Split(query, `"`) {
+		// the odd parts were between quotes
+		if i%2 == 1 {
+			var words []string
+			for _, t := range tokenize(part) {
+				words = append(words, t.word)
+			}
+			if len(words) > 0 {
+				clauses = append(clauses, clause{words: words})
+			}
+			continue
+		}
+		for field := range strings.FieldsSeq(part) {
+			// a prefix like "solar-pan*" is the words before it then the prefix
+			tokens := tokenize(field)
+			for j, t := range tokens {
+				last := j == len(tokens)-1
+				clauses = append(clauses, clause{words: []string{t.word}, prefix: last && strings.HasSuffix(field, "*")})
+			}
+		}
+	}
+	return clauses
+}
+
+// splits the text into lower case words of letters and digits
+func tokenize(text string) []token {
+	var tokens []token
+	start := -1
+	for i, r := range text {
+		word := unicode.IsLetter(r) || unicode.IsDigit(r)
+		switch {
+		case word && start < 0:
+			start = i
+		case !word && start >= 0:
+			tokens = append(tokens, token{word: strings.ToLower(text[start:i]), start: start, end: i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, token{word: strings.ToLower(text[start:]), start: start, end: len(text)})
+	}
+	return tokens
+}
+
+// cuts the text down to the words around the first marked one, marking
+// every marked word and escaping the rest
+func snippet(text string, tokens []token, marked map[int]bool) string {
+	first := len(tokens)
+	for pos := range marked {
+		first = min(first, pos)
+	}
+	from := max(0, first-snippetContext)
+	to := min(len(tokens), first+snippetContext*2)
+
+	var b strings.Builder
+	start := 0
+	if from > 0 {
+		b.WriteString("…")
+		start = tokens[from].start
+	}
+	end := len(text)
+	if to < len(tokens) {
+		end = tokens[to-1].end
+	}
+
+	at := start
+	for pos := from; pos < to; pos++ {
+		t := tokens[pos]
+		if !marked[pos] {
+			continue
+		}
+		b.WriteString(html.EscapeString(text[at:t.start]))
+		b.WriteString("<mark>")
+		b.WriteString(html.EscapeString(text[t.start:t.end]))
+		b.WriteString("</mark>")
+		at = t.end
+	}
+	b.WriteString(html.EscapeString(text[at:end]))
+	if end < len(text) {
+		b.WriteString("…")
+	}
+	return b.String()
+}
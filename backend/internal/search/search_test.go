@@ -0,0 +1,159 @@
+package search_test
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/search"
+)
+
+func new_index() *search.Index {
+	x := search.New(search.Field{Name: "title", Weight: 3}, search.Field{Name: "body", Weight: 1})
+	docs := []search.Document{
+		{ID: 1, Fields: map[string]string{"title": "Solar farm", "body": "Panels on every roof in the valley."}},
+		{ID: 2, Fields: map[string]string{"title": "Wind turbines", "body": "Cheaper than solar panels, and quieter."}},
+		{ID: 3, Fields: map[string]string{"title": "Roof gardens", "body": "Panels of moss, solar powered pumps & <b>bees</b>."}},
+		{ID: 4, Fields: map[string]string{"title": "Solarium", "body": "A glass room for winter."}},
+	}
+	if err := x.Refresh(time.Minute, func() ([]search.Document, error) { return docs, nil }); err != nil {
+		panic(err)
+	}
+	return x
+}
+
+func ids(hits []search.Hit) []int64 {
+	var out []int64
+	for _, h := range hits {
+		out = append(out, h.ID)
+	}
+	return out
+}
+
+func TestSearches(t *testing.T) {
+	x := new_index()
+	tests := []struct {
+		query string
+		want  []int64
+	}{
+		// a title match counts for more than one in the body
+		{"solar", []int64{1, 2, 3}},
+		{"SOLAR!", []int64{1, 2, 3}},
+		{"sol*", []int64{1, 4, 2, 3}},
+		{"solar panels", []int64{1, 2, 3}},
+		{`"solar panels"`, []int64{2}},
+		{`"panels solar"`, nil},
+		{"roof", []int64{3, 1}},
+		{"room glass", []int64{4}},
+		{"solar hydrogen", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			hits, err := x.Search(tt.query, 10)
+			if err != nil {
+				t.Fatalf("Search failed: %v", err)
+			}
+			if got := ids(hits); !slices.Equal(got, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+
+	if hits, _ := x.Search("panels", 2); len(hits) != 2 {
+		t.Errorf("Expected the limit to cut the hits to 2, got %d", len(hits))
+	}
+	if _, err := x.Search(`* "" !`, 10); !errors.Is(err, search.ErrEmptyQuery) {
+		t.Errorf("Expected ErrEmptyQuery, got %v", err)
+	}
+}
+
+func TestHighlights(t *testing.T) {
+	x := new_index()
+	hits, err := x.Search(`"solar powered" bee*`, 10)
+	if err != nil || len(hits) != 1 {
+		t.Fatalf("Expected one hit, got %v (%v)", hits, err)
+	}
+	want := "Panels of moss, <mark>solar</mark> <mark>powered</mark> pumps &amp; &lt;b&gt;<mark>bees</mark>&lt;/b&gt;."
+	if got := hits[0].Highlights["body"]; got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+	if _, ok := hits[0].Highlights["title"]; ok {
+		t.Error("Expected no highlight for a field without a match")
+	}
+
+	x.Put(search.Document{ID: 5, Fields: map[string]string{"body": "one two three four five six seven eight nine ten eleven twelve solar thirteen"}})
+	hits, _ = x.Search("twelve", 10)
+	want = "…four five six seven eight nine ten eleven <mark>twelve</mark> solar thirteen"
+	if got := hits[0].Highlights["body"]; got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
+
+func TestKeepsUpWithChanges(t *testing.T) {
+	x := new_index()
+	x.Put(search.Document{ID: 2, Fields: map[string]string{"title": "Tidal power"}})
+	if hits, _ := x.Search("wind", 10); len(hits) != 0 {
+		t.Errorf("Expected the old text of a replaced document to be gone, got %v", ids(hits))
+	}
+
+	// a fresh index isn't reloaded
+	loads := 0
+	fail := func() ([]search.Document, error) {
+		loads++
+		return nil, errors.New("unreachable")
+	}
+	if err := x.Refresh(time.Minute, fail); err != nil || loads != 0 {
+		t.Errorf("Expected no reload of a fresh index, got %d (%v)", loads, err)
+	}
+
+	// changes made while a reload reads the documents aren't undone by it
+	err := x.Refresh(0, func() ([]search.Document, error) {
+		x.Put(search.Document{ID: 7, Fields: map[string]string{"title": "Tidal barrage"}})
+		x.Remove(4)
+		return []search.Document{
+			{ID: 4, Fields: map[string]string{"title": "Solarium"}},
+			{ID: 6, Fields: map[string]string{"title": "Tidal lagoon"}},
+		}, nil
+	})
+	if err != nil {
+		t.Fatalf("Refresh failed: %v", err)
+	}
+	if hits, _ := x.Search("tidal", 10); !slices.Equal(ids(hits), []int64{6, 7}) {
+		t.Errorf("Expected 6 and 7 after the reload, got %v", ids(hits))
+	}
+	if hits, _ := x.Search("solarium", 10); len(hits) != 0 {
+		t.Errorf("Expected the removed document to stay removed, got %v", ids(hits))
+	}
+
+	fresh := search.New()
+	if err := fresh.Refresh(time.Minute, fail); err == nil || fresh.Loaded() {
+		t.Error("Expected an index that was never loaded to load, and pass on its error")
+	}
+	if !x.Loaded() {
+		t.Error("Expected the reloaded index to be loaded")
+	}
+}
+
+func TestSearchesWhileDocumentsChange(t *testing.T) {
+	x := new_index()
+	var wg sync.WaitGroup
+	for i := range 20 {
+		wg.Go(func() {
+			x.Put(search.Document{ID: int64(10 + i), Fields: map[string]string{"title": fmt.Sprintf("Solar roof %d", i)}})
+		})
+		wg.Go(func() {
+			if _, err := x.Search("sol*", 0); err != nil {
+				t.Errorf("Search failed: %v", err)
+			}
+		})
+	}
+	wg.Wait()
+
+	// a limit of 0 returns every match
+	if hits, _ := x.Search("sol*", 0); len(hits) != 24 {
+		t.Errorf("Expected all 24 matches, got %d", len(hits))
+	}
+}
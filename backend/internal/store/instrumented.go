@@ -0,0 +1,79 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// Instrumented wraps a Store, reporting how long each call took and whether
+// it failed, e.g. to the metrics registry
+type Instrumented struct {
+	Store
+	observe func(table string, operation string, took time.Duration, err error)
+}
+
+// wraps s so every call is passed to observe once it returns
+func Instrument(s Store, observe func(table string, operation string, took time.Duration, err error)) *Instrumented {
+	return &Instrumented{Store: s, observe: observe}
+}
+
+// gets a copy whose calls to the wrapped store run under ctx
+func (s *Instrumented) WithContext(ctx context.Context) Store {
+	return Instrument(WithContext(ctx, s.Store), s.observe)
+}
+
+func (s *Instrumented) Insert(table string, data any) ([]byte, error) {
+	start := time.Now()
+	body, err := s.Store.Insert(table, data)
+	s.observe(table, "insert", time.Since(start), err)
+	return body, err
+}
+
+func (s *Instrumented) GetByID(table string, id string) ([]byte, error) {
+	start := time.Now()
+	body, err := s.Store.GetByID(table, id)
+	s.observe(table, "get", time.Since(start), err)
+	return body, err
+}
+
+func (s *Instrumented) Query(table string, query string) ([]byte, error) {
+	start := time.Now()
+	body, err := s.Store.Query(table, query)
+	s.observe(table, "query", time.Since(start), err)
+	return body, err
+}
+
+func (s *Instrumented) Count(table string, query string) (int, error) {
+	start := time.Now()
+	n, err := s.Store.Count(table, query)
+	s.observe(table, "count", time.Since(start), err)
+	return n, err
+}
+
+func (s *Instrumented) UpdateByID(table string, id string, data any) ([]byte, error) {
+	start := time.Now()
+	body, err := s.Store.UpdateByID(table, id, data)
+	s.observe(table, "update", time.Since(start), err)
+	return body, err
+}
+
+func (s *Instrumented) Update(table string, query string, data any) ([]byte, error) {
+	start := time.Now()
+	body, err := s.Store.Update(table, query, data)
+	s.observe(table, "update", time.Since(start), err)
+	return body, err
+}
+
+func (s *Instrumented) DeleteByID(table string, id string) error {
+	start := time.Now()
+	err := s.Store.DeleteByID(table, id)
+	s.observe(table, "delete", time.Since(start), err)
+	return err
+}
+
+func (s *Instrumented) DeleteByQuery(table string, query string) error {
+	start := time.Now()
+	err := s.Store.DeleteByQuery(table, query)
+	s.observe(table, "delete", time.Since(start), err)
+	return err
+}
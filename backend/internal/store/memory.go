@@ -0,0 +1,650 @@
+package store
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"slices"
+)
+
+// tables whose primary key is a uuid in the supabase schema
+var uuidKeyed = map[string]bool{
+	"bank_account": true,
+}
+
+// unique constraints in the supabase schema, nulls never conflict
+var uniqueKeys = map[string][][]string{
+	"audit_log":            {{"seq"}},
+	"distribution_runs":    {{"profit_id"}},
+	"profit_distributions": {{"profit_id", "investment_id"}},
+	"idempotency_keys":     {{"key"}},
+	"investments":          {{"outbox_id"}},
+	"job_locks":            {{"name"}},
+	"ledger_entries":       {{"account", "seq"}, {"account", "reference"}},
+	"pitch_reservations":   {{"reference"}, {"pitch_id", "version"}},
+}
+
+type row = map[string]any
+
+// Memory is an in-process Store that understands the subset of PostgREST
+// filters the routes use. It is meant for tests and local development.
+type Memory struct {
+	mu     sync.Mutex
+	tables map[string][]row
+	nextID map[string]int64
+}
+
+// creates an empty in-memory store
+func NewMemory() *Memory {
+	return &Memory{
+		tables: make(map[string][]row),
+		nextID: make(map[string]int64),
+	}
+}
+
+// inserts data into a table
+func (m *Memory) Insert(table string, data any) ([]byte, error) {
+	rows, err := decodeRows(data)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, r := range rows {
+		if err := m.checkUnique(table, r, rows[:i]); err != nil {
+			return nil, err
+		}
+	}
+
+	now := timestamp()
+	for _, r := range rows {
+		if r["id"] == nil || r["id"] == "" {
+			r["id"] = m.newID(table)
+		}
+		if _, ok := r["created_at"]; !ok {
+			r["created_at"] = now
+		}
+		resolveNow(r, now)
+		m.tables[table] = append(m.tables[table], r)
+	}
+	return json.Marshal(rows)
+}
+
+// gets data by ID from a table
+func (m *Memory) GetByID(table string, id string) ([]byte, error) {
+	return m.Query(table, byID(id))
+}
+
+// gets data by query from a table
+func (m *Memory) Query(table string, query string) ([]byte, error) {
+	q, err := parseQuery(query)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rows, err := m.selected(table, q)
+	if err != nil {
+		return nil, err
+	}
+	shaped := []row{}
+	for _, r := range q.apply(rows) {
+		out, _, err := m.project(table, r, q.sel, q.embedded, "")
+		if err != nil {
+			return nil, err
+		}
+		shaped = append(shaped, out)
+	}
+	return json.Marshal(shaped)
+}
+
+// counts the rows matching the query
+func (m *Memory) Count(table string, query string) (int, error) {
+	q, err := parseQuery(query)
+	if err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rows, err := m.selected(table, q)
+	return len(rows), err
+}
+
+// updates data by ID from a table
+func (m *Memory) UpdateByID(table string, id string, data any) ([]byte, error) {
+	return m.Update(table, byID(id), data)
+}
+
+// updates every row matching the query in a table, the whole update happens
+// under the lock so conditional updates behave like a single statement
+func (m *Memory) Update(table string, query string, data any) ([]byte, error) {
+	q, err := parseQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	changes, err := decodeRows(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(changes) != 1 {
+		return nil, fmt.Errorf("failed to update: expected a single object")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := timestamp()
+	updated := []row{}
+	for _, r := range m.matching(table, q) {
+		for k, v := range changes[0] {
+			r[k] = v
+		}
+		resolveNow(r, now)
+		updated = append(updated, r)
+	}
+	return json.Marshal(updated)
+}
+
+// deletes data by ID from a table
+func (m *Memory) DeleteByID(table string, id string) error {
+	return m.DeleteByQuery(table, byID(id))
+}
+
+// deletes every row matching the query from a table
+func (m *Memory) DeleteByQuery(table string, query string) error {
+	q, err := parseQuery(query)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	kept := m.tables[table][:0]
+	for _, r := range m.tables[table] {
+		if !q.matches(r) {
+			kept = append(kept, r)
+		}
+	}
+	m.tables[table] = kept
+	return nil
+}
+
+// returns the rows of the table matching the query filters
+func (m *Memory) matching(table string, q query) []row {
+	var rows []row
+	for _, r := range m.tables[table] {
+		if q.matches(r) {
+			rows = append(rows, r)
+		}
+	}
+	return rows
+}
+
+// returns the rows matching the query filters that have a match for each
+// inner embed of the select
+func (m *Memory) selected(table string, q query) ([]row, error) {
+	var rows []row
+	for _, r := range m.matching(table, q) {
+		_, ok, err := m.project(table, r, q.sel, q.embedded, "")
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			rows = append(rows, r)
+		}
+	}
+	return rows, nil
+}
+
+// fails if the row duplicates a unique key of a stored or pending row
+func (m *Memory) checkUnique(table string, r row, pending []row) error {
+	for _, cols := range uniqueKeys[table] {
+		key, ok := uniqueValue(r, cols)
+		if !ok {
+			continue
+		}
+		for _, rows := range [][]row{m.tables[table], pending} {
+			for _, other := range rows {
+				if otherKey, ok := uniqueValue(other, cols); ok && otherKey == key {
+					return fmt.Errorf("failed to insert: %w: duplicate %s on %s", ErrConflict, strings.Join(cols, ", "), table)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// joins the row's values for the columns, reporting false if any is null
+func uniqueValue(r row, cols []string) (string, bool) {
+	parts := make([]string, len(cols))
+	for i, c := range cols {
+		if r[c] == nil {
+			return "", false
+		}
+		parts[i] = text(r[c])
+	}
+	return strings.Join(parts, "\x00"), true
+}
+
+// generates the next primary key for the table
+func (m *Memory) newID(table string) any {
+	if uuidKeyed[table] {
+		b := make([]byte, 16)
+		_, _ = rand.Read(b)
+		b[6] = (b[6] & 0x0f) | 0x40
+		b[8] = (b[8] & 0x3f) | 0x80
+		return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+	}
+	m.nextID[table]++
+	return json.Number(strconv.FormatInt(m.nextID[table], 10))
+}
+
+// decodes a struct, map or slice into rows
+func decodeRows(data any) ([]row, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+
+	switch t := v.(type) {
+	case map[string]any:
+		return []row{t}, nil
+	case []any:
+		rows := make([]row, 0, len(t))
+		for _, item := range t {
+			r, ok := item.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("expected an object, got %T", item)
+			}
+			rows = append(rows, r)
+		}
+		return rows, nil
+	default:
+		return nil, fmt.Errorf("expected an object, got %T", v)
+	}
+}
+
+// replaces "now()" values with the current timestamp like postgres would
+func resolveNow(r row, now string) {
+	for k, v := range r {
+		if s, ok := v.(string); ok && s == "now()" {
+			r[k] = now
+		}
+	}
+}
+
+func timestamp() string {
+	return time.Now().UTC().Format(time.RFC3339Nano)
+}
+
+type filter struct {
+	column string
+	op     string
+	value  string
+	negate bool
+}
+
+type ordering struct {
+	column     string
+	desc       bool
+	nullsFirst bool
+}
+
+type query struct {
+	filters  []filter
+	anyOf    [][][]filter // or=(...) groups, a row matches every filter of one term in each
+	order    []ordering
+	limit    int
+	offset   int
+	sel      selection
+	embedded map[string]query // filters and ordering of embedded tables by their path
+}
+
+// parses a PostgREST query string
+func parseQuery(raw string) (query, error) {
+	q := query{limit: -1, sel: selection{all: true}, embedded: map[string]query{}}
+	values, err := url.ParseQuery(raw)
+	if err != nil {
+		return q, fmt.Errorf("invalid query %q: %w", raw, err)
+	}
+	embedded := map[string]url.Values{}
+
+	for key, vals := range values {
+		for _, val := range vals {
+			switch key {
+			case "select":
+				if q.sel, err = parseSelect(val); err != nil {
+					return q, err
+				}
+			case "limit":
+				if q.limit, err = strconv.Atoi(val); err != nil {
+					return q, fmt.Errorf("invalid limit %q", val)
+				}
+			case "offset":
+				if q.offset, err = strconv.Atoi(val); err != nil {
+					return q, fmt.Errorf("invalid offset %q", val)
+				}
+			case "or":
+				var group [][]filter
+				for _, term := range splitList(strings.TrimSuffix(strings.TrimPrefix(val, "("), ")")) {
+					all, err := parseTerm(term)
+					if err != nil {
+						return q, err
+					}
+					group = append(group, all)
+				}
+				q.anyOf = append(q.anyOf, group)
+			case "order":
+				for term := range strings.SplitSeq(val, ",") {
+					parts := strings.Split(term, ".")
+					o := ordering{column: parts[0]}
+					if len(parts) > 1 && parts[1] == "desc" {
+						o.desc = true
+					}
+					// like postgres, nulls go last ascending and first descending
+					o.nullsFirst = o.desc
+					if len(parts) > 2 {
+						o.nullsFirst = parts[2] == "nullsfirst"
+					}
+					q.order = append(q.order, o)
+				}
+			default:
+				if path, param, ok := cutLast(key, "."); ok {
+					if embedded[path] == nil {
+						embedded[path] = url.Values{}
+					}
+					embedded[path].Add(param, val)
+					continue
+				}
+				f, err := parseFilter(key, val)
+				if err != nil {
+					return q, err
+				}
+				q.filters = append(q.filters, f)
+			}
+		}
+	}
+
+	for path, params := range embedded {
+		if q.embedded[path], err = parseQuery(params.Encode()); err != nil {
+			return q, err
+		}
+	}
+	return q, nil
+}
+
+// cuts s around the last instance of sep
+func cutLast(s string, sep string) (string, string, bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
+
+// parses a term of an or group, a filter such as "id.eq.5" or an and(...)
+// group of them
+func parseTerm(term string) ([]filter, error) {
+	if inner, ok := strings.CutPrefix(term, "and("); ok && strings.HasSuffix(inner, ")") {
+		var all []filter
+		for _, t := range splitList(strings.TrimSuffix(inner, ")")) {
+			fs, err := parseTerm(t)
+			if err != nil {
+				return nil, err
+			}
+			all = append(all, fs...)
+		}
+		return all, nil
+	}
+
+	column, rest, _ := strings.Cut(term, ".")
+	f, err := parseFilter(column, rest)
+	if err != nil {
+		return nil, err
+	}
+	if f.op != "in" {
+		f.value = unquote(f.value)
+	}
+	return []filter{f}, nil
+}
+
+// parses a filter such as "eq.5" or "not.is.null" on the column
+func parseFilter(column string, val string) (filter, error) {
+	f := filter{column: column}
+	if rest, ok := strings.CutPrefix(val, "not."); ok {
+		f.negate = true
+		val = rest
+	}
+	op, value, ok := strings.Cut(val, ".")
+	if !ok {
+		return f, fmt.Errorf("invalid filter %s=%s", column, val)
+	}
+	f.op, f.value = op, value
+	return f, nil
+}
+
+// checks a row against every filter and or group
+func (q query) matches(r row) bool {
+	if !matchesAll(q.filters, r) {
+		return false
+	}
+	for _, group := range q.anyOf {
+		if !slices.ContainsFunc(group, func(all []filter) bool { return matchesAll(all, r) }) {
+			return false
+		}
+	}
+	return true
+}
+
+// checks a row against every filter of an and group
+func matchesAll(all []filter, r row) bool {
+	for _, f := range all {
+		if f.matches(r[f.column]) == f.negate {
+			return false
+		}
+	}
+	return true
+}
+
+// orders and paginates the matching rows
+func (q query) apply(rows []row) []row {
+	if len(q.order) > 0 {
+		sort.SliceStable(rows, func(i, j int) bool {
+			for _, o := range q.order {
+				a, b := rows[i][o.column], rows[j][o.column]
+				if (a == nil) != (b == nil) {
+					return (a == nil) == o.nullsFirst
+				}
+				c := compare(a, b)
+				if c == 0 {
+					continue
+				}
+				if o.desc {
+					return c > 0
+				}
+				return c < 0
+			}
+			return false
+		})
+	}
+
+	if q.offset > 0 {
+		if q.offset >= len(rows) {
+			return nil
+		}
+		rows = rows[q.offset:]
+	}
+	if q.limit >= 0 && q.limit < len(rows) {
+		rows = rows[:q.limit]
+	}
+	return rows
+}
+
+func (f filter) matches(v any) bool {
+	switch f.op {
+	case "eq":
+		return v != nil && compare(v, f.value) == 0
+	case "neq":
+		return v != nil && compare(v, f.value) != 0
+	case "gt":
+		return v != nil && compare(v, f.value) > 0
+	case "gte":
+		return v != nil && compare(v, f.value) >= 0
+	case "lt":
+		return v != nil && compare(v, f.value) < 0
+	case "lte":
+		return v != nil && compare(v, f.value) <= 0
+	case "like", "ilike":
+		if v == nil {
+			return false
+		}
+		pattern := "^" + likePattern(f.value) + "$"
+		if f.op == "ilike" {
+			pattern = "(?i)" + pattern
+		}
+		ok, _ := regexp.MatchString(pattern, text(v))
+		return ok
+	case "in":
+		list := strings.TrimSuffix(strings.TrimPrefix(f.value, "("), ")")
+		for _, item := range splitList(list) {
+			if v != nil && text(v) == unquote(item) {
+				return true
+			}
+		}
+		return false
+	case "is":
+		switch f.value {
+		case "null":
+			return v == nil
+		case "true":
+			return v == true
+		case "false":
+			return v == false
+		}
+	}
+	return false
+}
+
+// converts a like pattern to a regexp, * and % match anything, _ matches one
+// character and a backslash makes the next character literal
+func likePattern(pattern string) string {
+	var b strings.Builder
+	escaped := false
+	for _, r := range pattern {
+		switch {
+		case escaped:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '*' || r == '%':
+			b.WriteString(".*")
+		case r == '_':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	return b.String()
+}
+
+// splits a list on the commas outside double quotes and parentheses, e.g.
+// `a,"b,c",d.in.(e,f)`
+func splitList(s string) []string {
+	var items []string
+	depth, quoted, escaped, start := 0, false, false, 0
+	for i, r := range s {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\' && quoted:
+			escaped = true
+		case r == '"':
+			quoted = !quoted
+		case quoted:
+		case r == '(':
+			depth++
+		case r == ')':
+			depth--
+		case r == ',' && depth == 0:
+			items = append(items, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(items, s[start:])
+}
+
+// removes the double quotes around a list item and its escapes
+func unquote(s string) string {
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return s
+	}
+	var b strings.Builder
+	escaped := false
+	for _, r := range s[1 : len(s)-1] {
+		if r == '\\' && !escaped {
+			escaped = true
+			continue
+		}
+		escaped = false
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// formats a column value the way it appears in a query string
+func text(v any) string {
+	switch t := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return t
+	case json.Number:
+		return t.String()
+	case bool:
+		return strconv.FormatBool(t)
+	default:
+		b, _ := json.Marshal(t)
+		return string(b)
+	}
+}
+
+// compares two values numerically when both are numbers, otherwise as text
+func compare(a any, b any) int {
+	as, bs := text(a), text(b)
+	af, aErr := strconv.ParseFloat(as, 64)
+	bf, bErr := strconv.ParseFloat(bs, 64)
+	if aErr == nil && bErr == nil {
+		switch {
+		case af < bf:
+			return -1
+		case af > bf:
+			return 1
+		default:
+			return 0
+		}
+	}
+	return strings.Compare(as, bs)
+}
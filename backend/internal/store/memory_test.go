@@ -0,0 +1,236 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+type test_row struct {
+	ID       int64  `json:"id"`
+	PitchID  int64  `json:"pitch_id"`
+	Name     string `json:"name"`
+	Refunded bool   `json:"refunded"`
+}
+
+func decode_rows(t *testing.T, body []byte) []test_row {
+	t.Helper()
+	var rows []test_row
+	if err := json.Unmarshal(body, &rows); err != nil {
+		t.Fatalf("Failed to decode rows: %v, body: %s", err, string(body))
+	}
+	return rows
+}
+
+func TestMemoryCRUD(t *testing.T) {
+	db := NewMemory()
+
+	for _, name := range []string{"Bronze", "Silver", "Gold"} {
+		if _, err := db.Insert("investment_tier", map[string]any{"pitch_id": 1, "name": name, "refunded": name == "Gold"}); err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+	}
+	if _, err := db.Insert("investment_tier", map[string]any{"pitch_id": 2, "name": "Other"}); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+
+	body, err := db.GetByID("investment_tier", "2")
+	if err != nil {
+		t.Fatalf("GetByID failed: %v", err)
+	}
+	if rows := decode_rows(t, body); len(rows) != 1 || rows[0].Name != "Silver" {
+		t.Errorf("Expected Silver for id 2, got %v", rows)
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"pitch_id=eq.1", []string{"Bronze", "Silver", "Gold"}},
+		{"pitch_id=eq.1&refunded=is.false", []string{"Bronze", "Silver"}},
+		{"name=ilike.*LV*", []string{"Silver"}},
+		{"id=in.(1,4)", []string{"Bronze", "Other"}},
+		{"pitch_id=eq.1&order=name.desc", []string{"Silver", "Gold", "Bronze"}},
+		{"order=id.asc&limit=2&offset=1", []string{"Silver", "Gold"}},
+		// Other has no refunded, nulls go last ascending and first descending
+		{"order=refunded.asc,id.asc", []string{"Bronze", "Silver", "Gold", "Other"}},
+		{"order=refunded.desc,id.asc", []string{"Other", "Gold", "Bronze", "Silver"}},
+		{"order=refunded.asc.nullsfirst,id.asc", []string{"Other", "Bronze", "Silver", "Gold"}},
+		{"name=not.eq.Gold&pitch_id=lte.1", []string{"Bronze", "Silver"}},
+	}
+	for _, tt := range tests {
+		body, err := db.Query("investment_tier", tt.query)
+		if err != nil {
+			t.Fatalf("Query %q failed: %v", tt.query, err)
+		}
+		rows := decode_rows(t, body)
+		if len(rows) != len(tt.want) {
+			t.Errorf("Query %q: expected %v, got %v", tt.query, tt.want, rows)
+			continue
+		}
+		for i, name := range tt.want {
+			if rows[i].Name != name {
+				t.Errorf("Query %q: expected %v, got %v", tt.query, tt.want, rows)
+				break
+			}
+		}
+	}
+
+	count, err := db.Count("investment_tier", "pitch_id=eq.1&limit=1")
+	if err != nil || count != 3 {
+		t.Errorf("Expected count 3 ignoring limit, got %d (%v)", count, err)
+	}
+
+	body, err = db.UpdateByID("investment_tier", "1", map[string]any{"name": "Copper"})
+	if err != nil {
+		t.Fatalf("UpdateByID failed: %v", err)
+	}
+	if rows := decode_rows(t, body); len(rows) != 1 || rows[0].Name != "Copper" || rows[0].PitchID != 1 {
+		t.Errorf("Expected updated row to keep other columns, got %v", rows)
+	}
+
+	if err := db.DeleteByQuery("investment_tier", "pitch_id=eq.1"); err != nil {
+		t.Fatalf("DeleteByQuery failed: %v", err)
+	}
+	body, _ = db.Query("investment_tier", "")
+	if rows := decode_rows(t, body); len(rows) != 1 || rows[0].Name != "Other" {
+		t.Errorf("Expected only Other after delete, got %v", rows)
+	}
+}
+
+func TestMemoryUUIDKeys(t *testing.T) {
+	db := NewMemory()
+	body, err := db.Insert("bank_account", map[string]any{"user_id": "abc"})
+	if err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	var rows []struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(body, &rows); err != nil || len(rows) != 1 || len(rows[0].ID) != 36 {
+		t.Errorf("Expected a uuid id, got %s", string(body))
+	}
+}
+
+func TestMemoryUniqueKeys(t *testing.T) {
+	db := NewMemory()
+	if _, err := db.Insert("pitch_reservations", map[string]any{"pitch_id": 1, "version": 1, "reference": "a"}); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+
+	_, err := db.Insert("pitch_reservations", map[string]any{"pitch_id": 1, "version": 1, "reference": "b"})
+	if !errors.Is(err, ErrConflict) {
+		t.Errorf("Expected ErrConflict for a duplicate (pitch_id, version), got %v", err)
+	}
+	if _, err := db.Insert("pitch_reservations", map[string]any{"pitch_id": 1, "version": 2, "reference": "b"}); err != nil {
+		t.Errorf("Expected a different version to insert, got %v", err)
+	}
+
+	// nulls never conflict
+	for range 2 {
+		if _, err := db.Insert("investments", map[string]any{"amount": 10}); err != nil {
+			t.Errorf("Expected rows without outbox_id to insert, got %v", err)
+		}
+	}
+}
+
+func TestMemoryOrFilters(t *testing.T) {
+	db := NewMemory()
+	for _, name := range []string{"Alpha Ltd", "Beta", "alphabet"} {
+		if _, err := db.Insert("items", map[string]any{"pitch_id": 1, "name": name}); err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+	}
+
+	body, err := db.Query("items", "or=(name.ilike.*alpha*,id.eq.2)&order=id.asc")
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if rows := decode_rows(t, body); len(rows) != 3 {
+		t.Errorf("Expected every row to match one filter, got %d", len(rows))
+	}
+
+	body, err = db.Query("items", "or=(name.eq.Beta,name.eq.Gamma)&pitch_id=eq.1")
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if rows := decode_rows(t, body); len(rows) != 1 || rows[0].Name != "Beta" {
+		t.Errorf("Expected only Beta, got %+v", rows)
+	}
+}
+
+func TestMemoryEmbeds(t *testing.T) {
+	db := NewMemory()
+	seed := []struct {
+		table string
+		data  map[string]any
+	}{
+		{"pitch", map[string]any{"title": "Solar", "user_id": "business-1"}},
+		{"pitch", map[string]any{"title": "Wind", "user_id": "business-1"}},
+		{"investment_tier", map[string]any{"pitch_id": 1, "name": "Bronze"}},
+		{"investment_tier", map[string]any{"pitch_id": 1, "name": "Gold"}},
+		{"tags", map[string]any{"name": "Energy"}},
+		{"pitch_tags", map[string]any{"pitch_id": 1, "tag_id": 1}},
+		{"investments", map[string]any{"pitch_id": 1, "tier_id": 2, "investor_id": "investor-1", "amount": 100}},
+	}
+	for _, s := range seed {
+		if _, err := db.Insert(s.table, s.data); err != nil {
+			t.Fatalf("Failed to seed %s: %v", s.table, err)
+		}
+	}
+
+	body, err := db.Query("pitch", "select=id,title,investment_tier(name),tags(name)&investment_tier.name=eq.Gold&order=id.asc")
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	var pitches []struct {
+		ID    int64            `json:"id"`
+		Title string           `json:"title"`
+		User  *string          `json:"user_id"`
+		Tiers []map[string]any `json:"investment_tier"`
+		Tags  []map[string]any `json:"tags"`
+	}
+	if err := json.Unmarshal(body, &pitches); err != nil {
+		t.Fatalf("Failed to decode: %v, body: %s", err, string(body))
+	}
+	if len(pitches) != 2 || pitches[0].User != nil {
+		t.Fatalf("Expected both pitches with only the selected columns, got %s", string(body))
+	}
+	if len(pitches[0].Tiers) != 1 || pitches[0].Tiers[0]["name"] != "Gold" {
+		t.Errorf("Expected the embedded tiers to be filtered to Gold, got %v", pitches[0].Tiers)
+	}
+	if len(pitches[0].Tags) != 1 || pitches[0].Tags[0]["name"] != "Energy" {
+		t.Errorf("Expected tags embedded through pitch_tags, got %v", pitches[0].Tags)
+	}
+	if pitches[1].Tiers == nil || len(pitches[1].Tiers) != 0 {
+		t.Errorf("Expected an empty array for a pitch without tiers, got %v", pitches[1].Tiers)
+	}
+
+	body, err = db.Query("investments", "select=amount,pitch:pitch(title),tier:investment_tier(name)")
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	var investments []struct {
+		Pitch struct {
+			Title string `json:"title"`
+		} `json:"pitch"`
+		Tier struct {
+			Name string `json:"name"`
+		} `json:"tier"`
+	}
+	if err := json.Unmarshal(body, &investments); err != nil || len(investments) != 1 {
+		t.Fatalf("Failed to decode: %v, body: %s", err, string(body))
+	}
+	if investments[0].Pitch.Title != "Solar" || investments[0].Tier.Name != "Gold" {
+		t.Errorf("Expected aliased to-one embeds, got %s", string(body))
+	}
+
+	count, err := db.Count("pitch", "select=id,investment_tier!inner(id)")
+	if err != nil || count != 1 {
+		t.Errorf("Expected an inner embed to leave out the pitch without tiers, got %d (%v)", count, err)
+	}
+
+	if _, err := db.Query("pitch", "select=*,bank_account(*)"); err == nil {
+		t.Error("Expected an error embedding an unrelated table")
+	}
+}
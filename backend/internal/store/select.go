@@ -0,0 +1,219 @@
+package store
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// foreign keys in the supabase schema, column to referenced table, used to
+// embed related rows
+var foreignKeys = map[string]map[string]string{
+	"distribution_runs":    {"profit_id": "profits", "pitch_id": "pitch"},
+	"investment_tier":      {"pitch_id": "pitch"},
+	"investments":          {"pitch_id": "pitch", "tier_id": "investment_tier", "investor_id": "profile"},
+	"pitch":                {"user_id": "profile"},
+	"pitch_media":          {"pitch_id": "pitch"},
+	"pitch_reservations":   {"pitch_id": "pitch"},
+	"pitch_tags":           {"pitch_id": "pitch", "tag_id": "tags"},
+	"profit_distributions": {"profit_id": "profits", "investment_id": "investments", "investor_id": "profile", "run_id": "distribution_runs"},
+	"profits":              {"pitch_id": "pitch"},
+}
+
+// selection is a parsed select=..., e.g. "id,tier:investment_tier(name)"
+type selection struct {
+	all     bool     // "*", or no select at all
+	columns []column // columns picked by name
+	embeds  []embed
+}
+
+type column struct {
+	name  string // key in the result, the alias if there is one
+	field string
+}
+
+// embed is a related table nested in each row under name
+type embed struct {
+	name  string // key in the result, the alias if there is one
+	table string
+	inner bool // !inner, rows without a match are left out
+	sel   selection
+}
+
+// parses the value of select, embedded tables are written table(columns)
+// and can be aliased alias:table(columns)
+func parseSelect(raw string) (selection, error) {
+	var sel selection
+	for _, item := range splitTopLevel(raw) {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			return sel, fmt.Errorf("invalid select %q", raw)
+		}
+		if item == "*" {
+			sel.all = true
+			continue
+		}
+
+		open := strings.Index(item, "(")
+		if open < 0 {
+			alias, field, ok := strings.Cut(item, ":")
+			if !ok {
+				field = alias
+			}
+			sel.columns = append(sel.columns, column{name: alias, field: field})
+			continue
+		}
+		if !strings.HasSuffix(item, ")") {
+			return sel, fmt.Errorf("invalid select %q", raw)
+		}
+
+		head := item[:open]
+		alias, table, ok := strings.Cut(head, ":")
+		if !ok {
+			table = alias
+		}
+		table, hint, _ := strings.Cut(table, "!")
+		if !ok {
+			alias = table
+		}
+		inner, err := parseSelect(item[open+1 : len(item)-1])
+		if err != nil {
+			return sel, err
+		}
+		sel.embeds = append(sel.embeds, embed{name: alias, table: table, inner: hint == "inner", sel: inner})
+	}
+	return sel, nil
+}
+
+// splits on the commas that are not inside parentheses
+func splitTopLevel(s string) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i, c := range s {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// shapes a row of the table as the selection asks, embedding its related
+// rows. Queries on embedded tables are keyed by their path, e.g.
+// "profit_distributions" or "pitch.pitch_media". Reports false if an inner
+// embed has no matching rows.
+func (m *Memory) project(table string, r row, sel selection, embedded map[string]query, path string) (row, bool, error) {
+	out := row{}
+	if sel.all {
+		for k, v := range r {
+			out[k] = v
+		}
+	}
+	for _, c := range sel.columns {
+		out[c.name] = r[c.field]
+	}
+
+	for _, e := range sel.embeds {
+		key := e.name
+		if path != "" {
+			key = path + "." + e.name
+		}
+		related, single, err := m.related(table, r, e.table)
+		if err != nil {
+			return nil, false, err
+		}
+
+		q, ok := embedded[key]
+		if !ok {
+			q = query{limit: -1}
+		}
+		var matched []row
+		for _, other := range related {
+			if q.matches(other) {
+				matched = append(matched, other)
+			}
+		}
+
+		var shaped []row
+		for _, other := range q.apply(matched) {
+			nested, ok, err := m.project(e.table, other, e.sel, embedded, key)
+			if err != nil {
+				return nil, false, err
+			}
+			if ok {
+				shaped = append(shaped, nested)
+			}
+		}
+		if e.inner && len(shaped) == 0 {
+			return nil, false, nil
+		}
+
+		switch {
+		case single && len(shaped) == 0:
+			out[e.name] = nil
+		case single:
+			out[e.name] = shaped[0]
+		case shaped == nil:
+			out[e.name] = []row{}
+		default:
+			out[e.name] = shaped
+		}
+	}
+	return out, true, nil
+}
+
+// gets the rows of other related to the row of table, through a foreign key
+// on either side or a join table with keys to both, and reports whether the
+// relationship is to one row
+func (m *Memory) related(table string, r row, other string) ([]row, bool, error) {
+	if col, ok := referencing(table, other); ok {
+		if r[col] == nil {
+			return nil, true, nil
+		}
+		return m.matching(other, query{filters: []filter{{column: "id", op: "eq", value: text(r[col])}}}), true, nil
+	}
+	if col, ok := referencing(other, table); ok {
+		return m.matching(other, query{filters: []filter{{column: col, op: "eq", value: text(r["id"])}}}), false, nil
+	}
+
+	for _, join := range slices.Sorted(maps.Keys(foreignKeys)) {
+		from, ok := referencing(join, table)
+		if !ok {
+			continue
+		}
+		to, ok := referencing(join, other)
+		if !ok {
+			continue
+		}
+		var ids []string
+		for _, link := range m.matching(join, query{filters: []filter{{column: from, op: "eq", value: text(r["id"])}}}) {
+			if link[to] != nil {
+				ids = append(ids, text(link[to]))
+			}
+		}
+		if len(ids) == 0 {
+			return nil, false, nil
+		}
+		return m.matching(other, query{filters: []filter{{column: "id", op: "in", value: "(" + strings.Join(ids, ",") + ")"}}}), false, nil
+	}
+	return nil, false, fmt.Errorf("no relationship between %s and %s", table, other)
+}
+
+// gets the column of table that references other
+func referencing(table string, other string) (string, bool) {
+	keys := foreignKeys[table]
+	for _, col := range slices.Sorted(maps.Keys(keys)) {
+		if keys[col] == other {
+			return col, true
+		}
+	}
+	return "", false
+}
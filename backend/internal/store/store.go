@@ -0,0 +1,56 @@
+package store
+
+import (
+	"context"
+	"errors"
+
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/postgrest"
+)
+
+// ErrConflict is returned when an insert would break a unique constraint
+var ErrConflict = errors.New("row conflicts with an existing row")
+
+// Store is the data layer the routes talk to. Tables and queries use the
+// PostgREST conventions (e.g. "pitch_id=eq.4&refunded=is.false") and every
+// read returns the matching rows as a JSON array.
+type Store interface {
+	// inserts a row and returns the inserted rows, failing with ErrConflict
+	// if it duplicates a unique key
+	Insert(table string, data any) ([]byte, error)
+	// gets the rows whose id matches
+	GetByID(table string, id string) ([]byte, error)
+	// gets the rows matching a query, an empty query returns every row
+	Query(table string, query string) ([]byte, error)
+	// counts the rows matching a query, ignoring limit and offset
+	Count(table string, query string) (int, error)
+	// updates the row whose id matches and returns the updated rows
+	UpdateByID(table string, id string, data any) ([]byte, error)
+	// updates every row matching a query and returns the updated rows, an
+	// empty array means nothing matched
+	Update(table string, query string, data any) ([]byte, error)
+	// deletes the row whose id matches
+	DeleteByID(table string, id string) error
+	// deletes every row matching a query
+	DeleteByQuery(table string, query string) error
+}
+
+// ContextStore is a Store whose calls can be bound to a context, so they are
+// cancelled along with it and carry its deadline and values
+type ContextStore interface {
+	Store
+	// gets a copy of the store whose calls run under ctx
+	WithContext(ctx context.Context) Store
+}
+
+// gets s with its calls bound to ctx, or s itself if it can't be bound
+func WithContext(ctx context.Context, s Store) Store {
+	if cs, ok := s.(ContextStore); ok {
+		return cs.WithContext(ctx)
+	}
+	return s
+}
+
+// gets the query for the row whose id matches, escaping the id
+func byID(id string) string {
+	return postgrest.New().Eq("id", id).String()
+}
@@ -0,0 +1,200 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/tracing"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/upstream"
+)
+
+// Supabase is the Store backed by a Supabase project's PostgREST API
+type Supabase struct {
+	url    string
+	key    string
+	client *upstream.Client
+	ctx    context.Context
+}
+
+// creates a store for the Supabase project at url using the service role key,
+// calling it through the shared upstream client
+func NewSupabase(url string, key string, client *upstream.Client) *Supabase {
+	return &Supabase{
+		url:    strings.TrimSuffix(url, "/"),
+		key:    key,
+		client: client,
+		ctx:    context.Background(),
+	}
+}
+
+// gets a copy of the store whose requests are cancelled along with ctx
+func (s *Supabase) WithContext(ctx context.Context) Store {
+	scoped := *s
+	scoped.ctx = ctx
+	return &scoped
+}
+
+// the operation each method performs, for tracing
+var operations = map[string]string{
+	"GET":    "select",
+	"POST":   "insert",
+	"PATCH":  "update",
+	"DELETE": "delete",
+}
+
+// sends a request to the PostgREST endpoint for the table, in a span named
+// for the table and operation
+func (s *Supabase) do(method string, table string, query string, data any, prefer string) (resp *http.Response, respBody []byte, err error) {
+	ctx, span := tracing.Start(s.ctx, "postgrest "+operations[method]+" "+table,
+		semconv.DBSystemNameKey.String("postgresql"),
+		semconv.DBCollectionName(table),
+		semconv.DBOperationName(operations[method]),
+	)
+	defer func() { tracing.EndResponse(span, resp, err) }()
+
+	url := s.url + "/rest/v1/" + table // SUPABASE_URL/rest/v1/table?query
+	if query != "" {
+		url += "?" + query
+	}
+
+	var body io.Reader
+	if data != nil {
+		jsonData, err := json.Marshal(data)
+		if err != nil {
+			return nil, nil, err
+		}
+		body = bytes.NewBuffer(jsonData)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	req.Header.Set("apikey", s.key)
+	req.Header.Set("Authorization", "Bearer "+s.key)
+	req.Header.Set("Content-Type", "application/json")
+	if prefer != "" {
+		req.Header.Set("Prefer", prefer)
+	}
+
+	resp, err = s.client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, _ = io.ReadAll(resp.Body)
+	return resp, respBody, nil
+}
+
+// inserts data into a table
+func (s *Supabase) Insert(table string, data any) ([]byte, error) {
+	resp, body, err := s.do("POST", table, "", data, "return=representation") // returns inserted rows
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusConflict {
+		return nil, fmt.Errorf("failed to insert: %w: %s", ErrConflict, string(body))
+	}
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to insert: status %d, body: %s", resp.StatusCode, string(body))
+	}
+	return body, nil
+}
+
+// gets data by ID from a table
+func (s *Supabase) GetByID(table string, id string) ([]byte, error) {
+	resp, body, err := s.do("GET", table, byID(id), nil, "")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch by ID: status %d, body: %s", resp.StatusCode, string(body))
+	}
+	return body, nil
+}
+
+// gets data by query from a table
+func (s *Supabase) Query(table string, query string) ([]byte, error) {
+	resp, body, err := s.do("GET", table, query, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch data: status %d, body: %s", resp.StatusCode, string(body))
+	}
+	return body, nil
+}
+
+// gets the row count for the query from the Content-Range header
+func (s *Supabase) Count(table string, query string) (int, error) {
+	resp, body, err := s.do("GET", table, query, nil, "count=exact")
+	if err != nil {
+		return 0, err
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		return 0, fmt.Errorf("failed to count: status %d, body: %s", resp.StatusCode, string(body))
+	}
+
+	contentRange := resp.Header.Get("Content-Range")
+	if contentRange == "" {
+		return 0, fmt.Errorf("missing Content-Range header")
+	}
+
+	parts := strings.Split(contentRange, "/")
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("invalid Content-Range header: %s", contentRange)
+	}
+
+	return strconv.Atoi(parts[1])
+}
+
+// updates data by ID from a table
+func (s *Supabase) UpdateByID(table string, id string, data any) ([]byte, error) {
+	resp, body, err := s.do("PATCH", table, byID(id), data, "return=representation") // return updated row
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to update by ID: status %d, body: %s", resp.StatusCode, string(body))
+	}
+	return body, nil
+}
+
+// updates every row matching the query in a table
+func (s *Supabase) Update(table string, query string, data any) ([]byte, error) {
+	resp, body, err := s.do("PATCH", table, query, data, "return=representation") // return updated rows
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to update: status %d, body: %s", resp.StatusCode, string(body))
+	}
+	return body, nil
+}
+
+// deletes data by ID from a table
+func (s *Supabase) DeleteByID(table string, id string) error {
+	return s.DeleteByQuery(table, byID(id))
+}
+
+// deletes every row matching the query from a table
+func (s *Supabase) DeleteByQuery(table string, query string) error {
+	resp, body, err := s.do("DELETE", table, query, nil, "")
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("failed to delete: status %d, body: %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/upstream"
+)
+
+func TestSupabaseCallsFollowTheirContext(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("apikey") != "key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Query().Get("slow") != "" {
+			<-r.Context().Done()
+			return
+		}
+		w.Write([]byte(`[]`))
+	}))
+	defer server.Close()
+
+	var observed []string
+	db := Instrument(NewSupabase(server.URL, "key", upstream.New(upstream.Options{})), func(table string, operation string, took time.Duration, err error) {
+		observed = append(observed, table+" "+operation)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	scoped := WithContext(ctx, db)
+	if _, err := scoped.Query("pitch", "slow=1"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the call to end with its context, got %v", err)
+	}
+
+	// the unbound store is unaffected
+	if _, err := db.Query("pitch", ""); err != nil {
+		t.Errorf("Expected the unbound store to work, got %v", err)
+	}
+
+	// the bound store is still instrumented
+	if len(observed) != 2 || observed[0] != "pitch query" {
+		t.Errorf("Expected both calls to be observed, got %v", observed)
+	}
+}
@@ -0,0 +1,491 @@
+// Package supabasetest runs an in-process stand-in for a Supabase project, so
+// the integration tests run offline and don't share rows with anyone. It
+// serves the parts of the PostgREST, Storage and Auth APIs the backend calls,
+// with the tables kept in a store.Memory.
+package supabasetest
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/config"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/store"
+)
+
+// the bucket pitch media is uploaded to, created with every server
+const PitchFilesBucket = "pitch_files"
+
+// Server is a stand-in Supabase project listening on a local port
+type Server struct {
+	URL            string
+	ServiceRoleKey string
+	AnonKey        string
+	JWTSecret      string
+
+	// the tables behind the PostgREST API, tests can seed them directly
+	DB *store.Memory
+
+	server   *httptest.Server
+	requests atomic.Int64
+	mu       sync.Mutex
+	users    map[string]user // by email
+	buckets  map[string]map[string]object
+}
+
+type user struct {
+	id       string
+	email    string
+	password string
+}
+
+type object struct {
+	contentType string
+	data        []byte
+}
+
+// starts a server with an empty database and the pitch files bucket, it
+// must be closed when the test is done
+func New() *Server {
+	s := &Server{
+		ServiceRoleKey: "service-role-key",
+		AnonKey:        "anon-key",
+		JWTSecret:      "supabasetest-jwt-secret",
+		DB:             store.NewMemory(),
+		users:          make(map[string]user),
+		buckets:        map[string]map[string]object{PitchFilesBucket: {}},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /rest/v1/{table}", s.select_rows)
+	mux.HandleFunc("POST /rest/v1/{table}", s.insert_rows)
+	mux.HandleFunc("PATCH /rest/v1/{table}", s.update_rows)
+	mux.HandleFunc("DELETE /rest/v1/{table}", s.delete_rows)
+
+	mux.HandleFunc("GET /storage/v1/bucket/{bucket}", s.get_bucket)
+	mux.HandleFunc("POST /storage/v1/object/{bucket}/{name...}", s.upload_object)
+	mux.HandleFunc("DELETE /storage/v1/object/{bucket}/{name...}", s.delete_object)
+	mux.HandleFunc("GET /storage/v1/object/public/{bucket}/{name...}", s.download_object)
+
+	mux.HandleFunc("POST /auth/v1/token", s.token)
+	mux.HandleFunc("GET /auth/v1/user", s.current_user)
+	mux.HandleFunc("GET /auth/v1/admin/users/{id}", s.admin_user)
+
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.requests.Add(1)
+		mux.ServeHTTP(w, r)
+	}))
+	s.URL = s.server.URL
+	return s
+}
+
+// stops the server
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// the number of requests the server has had, so tests can count round trips
+func (s *Server) Requests() int64 {
+	return s.requests.Load()
+}
+
+// gets a config pointing the backend at the server
+func (s *Server) Config() *config.Config {
+	cfg := config.Default()
+	cfg.Supabase = config.Supabase{
+		URL:            s.URL,
+		ServiceRoleKey: s.ServiceRoleKey,
+		AnonKey:        s.AnonKey,
+		JWTSecret:      s.JWTSecret,
+		S3URL:          s.URL + "/storage/v1/s3",
+	}
+	return cfg
+}
+
+// creates an auth user who can sign in with the password, and their profile
+// row with the given columns like the signup trigger would. Returns the
+// user's id.
+func (s *Server) CreateUser(email string, password string, profile map[string]any) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[email]; ok {
+		return "", fmt.Errorf("user %s already exists", email)
+	}
+	u := user{id: new_uuid(), email: email, password: password}
+
+	row := map[string]any{"id": u.id, "email": email}
+	for k, v := range profile {
+		row[k] = v
+	}
+	if _, err := s.DB.Insert("profile", row); err != nil {
+		return "", err
+	}
+	s.users[email] = u
+	return u.id, nil
+}
+
+// gets an object from a bucket
+func (s *Server) Object(bucket string, name string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	obj, ok := s.buckets[bucket][name]
+	return obj.data, ok
+}
+
+// gets the rows matching the query, with Prefer: count=exact the total goes
+// in the Content-Range header
+func (s *Server) select_rows(w http.ResponseWriter, r *http.Request) {
+	if !s.has_api_key(w, r) {
+		return
+	}
+	table, query := r.PathValue("table"), r.URL.RawQuery
+
+	body, err := s.DB.Query(table, query)
+	if err != nil {
+		write_error(w, http.StatusBadRequest, "PGRST100", err.Error())
+		return
+	}
+
+	if prefers(r, "count=exact") {
+		total, err := s.DB.Count(table, query)
+		if err != nil {
+			write_error(w, http.StatusBadRequest, "PGRST100", err.Error())
+			return
+		}
+		var rows []json.RawMessage
+		_ = json.Unmarshal(body, &rows)
+		w.Header().Set("Content-Range", content_range(query, len(rows), total))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
+// inserts the posted row or rows
+func (s *Server) insert_rows(w http.ResponseWriter, r *http.Request) {
+	if !s.has_api_key(w, r) {
+		return
+	}
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		write_error(w, http.StatusBadRequest, "PGRST102", err.Error())
+		return
+	}
+
+	body, err := s.DB.Insert(r.PathValue("table"), json.RawMessage(data))
+	if errors.Is(err, store.ErrConflict) {
+		write_error(w, http.StatusConflict, "23505", err.Error())
+		return
+	}
+	if err != nil {
+		write_error(w, http.StatusBadRequest, "PGRST102", err.Error())
+		return
+	}
+	write_representation(w, r, http.StatusCreated, body)
+}
+
+// updates the rows matching the query with the patched columns
+func (s *Server) update_rows(w http.ResponseWriter, r *http.Request) {
+	if !s.has_api_key(w, r) {
+		return
+	}
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		write_error(w, http.StatusBadRequest, "PGRST102", err.Error())
+		return
+	}
+
+	body, err := s.DB.Update(r.PathValue("table"), r.URL.RawQuery, json.RawMessage(data))
+	if err != nil {
+		write_error(w, http.StatusBadRequest, "PGRST100", err.Error())
+		return
+	}
+	write_representation(w, r, http.StatusOK, body)
+}
+
+// deletes the rows matching the query
+func (s *Server) delete_rows(w http.ResponseWriter, r *http.Request) {
+	if !s.has_api_key(w, r) {
+		return
+	}
+	if err := s.DB.DeleteByQuery(r.PathValue("table"), r.URL.RawQuery); err != nil {
+		write_error(w, http.StatusBadRequest, "PGRST100", err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// gets a bucket's details
+func (s *Server) get_bucket(w http.ResponseWriter, r *http.Request) {
+	if !s.is_service_role(w, r) {
+		return
+	}
+	bucket := r.PathValue("bucket")
+
+	s.mu.Lock()
+	_, ok := s.buckets[bucket]
+	s.mu.Unlock()
+	if !ok {
+		write_storage_error(w, http.StatusNotFound, "Bucket not found")
+		return
+	}
+	write_json(w, http.StatusOK, map[string]any{"id": bucket, "name": bucket, "public": true})
+}
+
+// stores the request body as an object, refusing to overwrite one unless
+// x-upsert is true
+func (s *Server) upload_object(w http.ResponseWriter, r *http.Request) {
+	if !s.is_service_role(w, r) {
+		return
+	}
+	bucket, name := r.PathValue("bucket"), r.PathValue("name")
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		write_storage_error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	objects, ok := s.buckets[bucket]
+	if !ok {
+		write_storage_error(w, http.StatusNotFound, "Bucket not found")
+		return
+	}
+	if _, exists := objects[name]; exists && r.Header.Get("x-upsert") != "true" {
+		write_storage_error(w, http.StatusConflict, "The resource already exists")
+		return
+	}
+	objects[name] = object{contentType: r.Header.Get("Content-Type"), data: data}
+	write_json(w, http.StatusOK, map[string]string{"Key": bucket + "/" + name})
+}
+
+// removes an object
+func (s *Server) delete_object(w http.ResponseWriter, r *http.Request) {
+	if !s.is_service_role(w, r) {
+		return
+	}
+	bucket, name := r.PathValue("bucket"), r.PathValue("name")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.buckets[bucket][name]; !ok {
+		write_storage_error(w, http.StatusNotFound, "Object not found")
+		return
+	}
+	delete(s.buckets[bucket], name)
+	write_json(w, http.StatusOK, map[string]string{"message": "Successfully deleted"})
+}
+
+// serves an object by its public URL
+func (s *Server) download_object(w http.ResponseWriter, r *http.Request) {
+	bucket, name := r.PathValue("bucket"), r.PathValue("name")
+
+	s.mu.Lock()
+	obj, ok := s.buckets[bucket][name]
+	s.mu.Unlock()
+	if !ok {
+		write_storage_error(w, http.StatusNotFound, "Object not found")
+		return
+	}
+	if obj.contentType != "" {
+		w.Header().Set("Content-Type", obj.contentType)
+	}
+	w.Write(obj.data)
+}
+
+// signs a user in with their email and password, returning an access token
+// signed with the JWT secret
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	if !s.has_api_key(w, r) {
+		return
+	}
+	if grant := r.URL.Query().Get("grant_type"); grant != "password" {
+		write_auth_error(w, http.StatusBadRequest, "unsupported_grant_type", "grant_type "+grant+" is not supported")
+		return
+	}
+
+	var credentials struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&credentials); err != nil {
+		write_auth_error(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	u, ok := s.users[credentials.Email]
+	s.mu.Unlock()
+	if !ok || u.password != credentials.Password {
+		write_auth_error(w, http.StatusBadRequest, "invalid_grant", "Invalid login credentials")
+		return
+	}
+
+	token, err := s.sign(u)
+	if err != nil {
+		write_auth_error(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+	write_json(w, http.StatusOK, map[string]any{
+		"access_token":  token,
+		"token_type":    "bearer",
+		"expires_in":    int(time.Hour.Seconds()),
+		"refresh_token": new_uuid(),
+		"user":          map[string]string{"id": u.id, "email": u.email},
+	})
+}
+
+// gets the user the bearer token was issued to
+func (s *Server) current_user(w http.ResponseWriter, r *http.Request) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(bearer(r), claims, func(*jwt.Token) (any, error) {
+		return []byte(s.JWTSecret), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil {
+		write_auth_error(w, http.StatusUnauthorized, "bad_jwt", err.Error())
+		return
+	}
+	sub, _ := claims["sub"].(string)
+	s.write_user(w, sub)
+}
+
+// gets a user by id with the service role key
+func (s *Server) admin_user(w http.ResponseWriter, r *http.Request) {
+	if !s.is_service_role(w, r) {
+		return
+	}
+	s.write_user(w, r.PathValue("id"))
+}
+
+func (s *Server) write_user(w http.ResponseWriter, id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, u := range s.users {
+		if u.id == id {
+			write_json(w, http.StatusOK, map[string]string{"id": u.id, "email": u.email})
+			return
+		}
+	}
+	write_auth_error(w, http.StatusNotFound, "user_not_found", "User not found")
+}
+
+// signs a token like Supabase Auth issues, which the backend accepts once
+// it's configured with the server's URL and JWT secret
+func (s *Server) sign(u user) (string, error) {
+	now := time.Now()
+	tok := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub":   u.id,
+		"email": u.email,
+		"iss":   s.URL + "/auth/v1",
+		"aud":   "authenticated",
+		"role":  "authenticated",
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	return tok.SignedString([]byte(s.JWTSecret))
+}
+
+// checks the request carries one of the project's API keys
+func (s *Server) has_api_key(w http.ResponseWriter, r *http.Request) bool {
+	key := r.Header.Get("apikey")
+	if key != s.ServiceRoleKey && key != s.AnonKey {
+		write_json(w, http.StatusUnauthorized, map[string]string{"message": "Invalid API key"})
+		return false
+	}
+	return true
+}
+
+// checks the request is authorized with the service role key
+func (s *Server) is_service_role(w http.ResponseWriter, r *http.Request) bool {
+	if !s.has_api_key(w, r) {
+		return false
+	}
+	if bearer(r) != s.ServiceRoleKey {
+		write_storage_error(w, http.StatusForbidden, "service role key required")
+		return false
+	}
+	return true
+}
+
+func bearer(r *http.Request) string {
+	return strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+}
+
+// reports whether the Prefer header asks for the preference
+func prefers(r *http.Request, preference string) bool {
+	for _, header := range r.Header.Values("Prefer") {
+		for p := range strings.SplitSeq(header, ",") {
+			if strings.TrimSpace(p) == preference {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// formats the Content-Range of a page of rows, e.g. 0-9/42 or */0
+func content_range(query string, rows int, total int) string {
+	if rows == 0 {
+		return fmt.Sprintf("*/%d", total)
+	}
+	values, _ := url.ParseQuery(query)
+	offset, _ := strconv.Atoi(values.Get("offset"))
+	return fmt.Sprintf("%d-%d/%d", offset, offset+rows-1, total)
+}
+
+// writes the rows if the request asked for return=representation
+func write_representation(w http.ResponseWriter, r *http.Request, status int, body []byte) {
+	if !prefers(r, "return=representation") {
+		if status == http.StatusOK {
+			status = http.StatusNoContent
+		}
+		w.WriteHeader(status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// writes an error in the shape PostgREST uses
+func write_error(w http.ResponseWriter, status int, code string, message string) {
+	write_json(w, status, map[string]any{"code": code, "message": message, "details": nil, "hint": nil})
+}
+
+// writes an error in the shape Storage uses
+func write_storage_error(w http.ResponseWriter, status int, message string) {
+	write_json(w, status, map[string]string{"statusCode": strconv.Itoa(status), "error": http.StatusText(status), "message": message})
+}
+
+// writes an error in the shape Auth uses
+func write_auth_error(w http.ResponseWriter, status int, code string, description string) {
+	write_json(w, status, map[string]string{"error": code, "error_description": description})
+}
+
+func write_json(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func new_uuid() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
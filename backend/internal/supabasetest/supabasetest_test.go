@@ -0,0 +1,127 @@
+package supabasetest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/store"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/upstream"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/utils"
+)
+
+func TestServesPostgREST(t *testing.T) {
+	s := New()
+	defer s.Close()
+	db := store.NewSupabase(s.URL, s.ServiceRoleKey, upstream.New(upstream.Options{}))
+
+	body, err := db.Insert("pitch", map[string]any{"title": "Solar", "user_id": "business-1"})
+	if err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	var pitches []struct {
+		ID int64 `json:"id"`
+	}
+	if err := json.Unmarshal(body, &pitches); err != nil || len(pitches) != 1 || pitches[0].ID != 1 {
+		t.Fatalf("Expected the inserted pitch back, got %s", string(body))
+	}
+	for _, name := range []string{"Bronze", "Silver", "Gold"} {
+		if _, err := db.Insert("investment_tier", map[string]any{"pitch_id": 1, "name": name}); err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+	}
+
+	body, err = db.Query("pitch", "select=title,investment_tier(name)&investment_tier.order=id.asc")
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	var embedded []struct {
+		Title string `json:"title"`
+		Tiers []struct {
+			Name string `json:"name"`
+		} `json:"investment_tier"`
+	}
+	if err := json.Unmarshal(body, &embedded); err != nil || len(embedded) != 1 || len(embedded[0].Tiers) != 3 {
+		t.Errorf("Expected the pitch with its tiers embedded, got %s", string(body))
+	}
+
+	count, err := db.Count("investment_tier", "name=ilike.*l*&limit=1")
+	if err != nil || count != 2 {
+		t.Errorf("Expected an exact count of 2, got %d (%v)", count, err)
+	}
+
+	body, err = db.Update("investment_tier", "name=in.(Bronze,Gold)", map[string]any{"name": "Copper"})
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	var updated []map[string]any
+	if err := json.Unmarshal(body, &updated); err != nil || len(updated) != 2 {
+		t.Errorf("Expected two updated rows, got %s", string(body))
+	}
+
+	if err := db.DeleteByQuery("investment_tier", "name=eq.Copper"); err != nil {
+		t.Fatalf("DeleteByQuery failed: %v", err)
+	}
+	if count, _ := db.Count("investment_tier", ""); count != 1 {
+		t.Errorf("Expected one tier left after delete, got %d", count)
+	}
+
+	if _, err := db.Insert("job_locks", map[string]any{"name": "deadline"}); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	if _, err := db.Insert("job_locks", map[string]any{"name": "deadline"}); !errors.Is(err, store.ErrConflict) {
+		t.Errorf("Expected ErrConflict for a duplicate key, got %v", err)
+	}
+
+	if _, err := store.NewSupabase(s.URL, "wrong-key", upstream.New(upstream.Options{})).Query("pitch", ""); err == nil {
+		t.Error("Expected a wrong API key to be refused")
+	}
+}
+
+func TestIssuesTokensTheBackendAccepts(t *testing.T) {
+	s := New()
+	defer s.Close()
+	id, err := s.CreateUser("investor@example.com", "secret", map[string]any{"role": "investor"})
+	if err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+	cfg := s.Config()
+	verifier := utils.NewJWTHS256(cfg.Supabase.JWTIssuer(), cfg.Supabase.JWTSecret)
+
+	sign_in := func(password string) *http.Response {
+		body, _ := json.Marshal(map[string]string{"email": "investor@example.com", "password": password})
+		req, _ := http.NewRequest("POST", s.URL+"/auth/v1/token?grant_type=password", bytes.NewReader(body))
+		req.Header.Set("apikey", s.AnonKey)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Sign in failed: %v", err)
+		}
+		return resp
+	}
+
+	resp := sign_in("wrong")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a wrong password, got %d", resp.StatusCode)
+	}
+
+	resp = sign_in("secret")
+	defer resp.Body.Close()
+	var session struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&session); err != nil {
+		t.Fatalf("Failed to decode session: %v", err)
+	}
+	sub, err := verifier.Verify(session.AccessToken)
+	if err != nil || sub != id {
+		t.Errorf("Expected a token for %s, got %q (%v)", id, sub, err)
+	}
+
+	profiles, err := s.DB.GetByID("profile", id)
+	if err != nil || !bytes.Contains(profiles, []byte(`"role":"investor"`)) {
+		t.Errorf("Expected the user's profile row, got %s (%v)", string(profiles), err)
+	}
+}
@@ -0,0 +1,174 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/logging"
+)
+
+// the exporters spans can be sent to
+const (
+	ExporterNone   = "none"   // spans are dropped, tracing costs next to nothing
+	ExporterStdout = "stdout" // spans are written as JSON, for running without a collector
+	ExporterOTLP   = "otlp"   // spans are sent to a collector over OTLP/HTTP
+)
+
+const tracer_name = "github.com/EmmaMartin123/Industrial_Project/backend"
+
+// Options says where spans go
+type Options struct {
+	Exporter     string
+	OTLPEndpoint string // e.g. http://localhost:4318, the exporter's default if empty
+	ServiceName  string
+	SampleRatio  float64
+	Stdout       io.Writer // where the stdout exporter writes, os.Stdout if nil
+}
+
+// installs the global tracer provider and trace context propagation. The
+// returned function flushes any spans still buffered and must be called on
+// shutdown.
+func Setup(ctx context.Context, opts Options) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch opts.Exporter {
+	case "", ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case ExporterStdout:
+		var stdout []stdouttrace.Option
+		if opts.Stdout != nil {
+			stdout = append(stdout, stdouttrace.WithWriter(opts.Stdout))
+		}
+		exporter, err = stdouttrace.New(stdout...)
+	case ExporterOTLP:
+		var otlp []otlptracehttp.Option
+		if opts.OTLPEndpoint != "" {
+			otlp = append(otlp, otlptracehttp.WithEndpointURL(opts.OTLPEndpoint))
+		}
+		exporter, err = otlptracehttp.New(ctx, otlp...)
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", opts.Exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s trace exporter: %w", opts.Exporter, err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(opts.SampleRatio))),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(opts.ServiceName))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// starts a span as a child of the one in ctx, e.g. for a phase of a handler
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracer_name).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// starts a span for a call to another service and adds its trace context to
+// the request headers so the service can continue the trace
+func StartClient(req *http.Request, name string, attrs ...attribute.KeyValue) (*http.Request, trace.Span) {
+	attrs = append(attrs,
+		semconv.HTTPRequestMethodKey.String(req.Method),
+		semconv.ServerAddress(req.URL.Hostname()),
+		semconv.URLPath(req.URL.Path),
+	)
+	ctx, span := otel.Tracer(tracer_name).Start(req.Context(), name,
+		trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+	req = req.WithContext(ctx)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+	return req, span
+}
+
+// ends the span, marking it failed if err is set
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// ends the span for a call to another service, marking it failed if the call
+// failed or the service answered with a 5xx
+func EndResponse(span trace.Span, resp *http.Response, err error) {
+	if err == nil && resp != nil {
+		span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+		if resp.StatusCode >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, strings.ToLower(http.StatusText(resp.StatusCode)))
+		}
+	}
+	End(span, err)
+}
+
+// starts a span for each request served by the route, continuing the
+// caller's trace if it sent one. Route is the pattern it is registered under.
+func Middleware(route string) func(http.Handler) http.Handler {
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+			ctx, span := otel.Tracer(tracer_name).Start(ctx, r.Method+" "+route,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(
+					semconv.HTTPRequestMethodKey.String(r.Method),
+					semconv.HTTPRoute(route),
+					semconv.URLPath(r.URL.Path),
+				))
+			defer span.End()
+			if id := span.SpanContext().TraceID(); id.IsValid() {
+				ctx = logging.With(ctx, "trace_id", id.String())
+			}
+
+			rec := &status_recorder{ResponseWriter: w, status: http.StatusOK}
+			handler.ServeHTTP(rec, r.WithContext(ctx))
+
+			span.SetAttributes(semconv.HTTPResponseStatusCode(rec.status))
+			if rec.status >= http.StatusInternalServerError {
+				span.SetStatus(codes.Error, strings.ToLower(http.StatusText(rec.status)))
+			}
+		})
+	}
+}
+
+// passes the response through while keeping its status
+type status_recorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (r *status_recorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *status_recorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	return r.ResponseWriter.Write(b)
+}
+
+// lets http.ResponseController reach the underlying writer
+func (r *status_recorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
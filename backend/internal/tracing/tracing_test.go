@@ -0,0 +1,134 @@
+package tracing_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/store"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/tracing"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/upstream"
+)
+
+// installs a provider that keeps spans in memory for the test
+func record_spans(t *testing.T) *tracetest.InMemoryExporter {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		provider.Shutdown(t.Context())
+		otel.SetTracerProvider(previous)
+	})
+	return exporter
+}
+
+func find_span(t *testing.T, spans tracetest.SpanStubs, name string) tracetest.SpanStub {
+	t.Helper()
+	for _, span := range spans {
+		if span.Name == name {
+			return span
+		}
+	}
+	t.Fatalf("no span named %q in %d spans", name, len(spans))
+	return tracetest.SpanStub{}
+}
+
+func attribute_value(span tracetest.SpanStub, key attribute.Key) string {
+	for _, kv := range span.Attributes {
+		if kv.Key == key {
+			return kv.Value.Emit()
+		}
+	}
+	return ""
+}
+
+func TestRequestSpanParentsSupabaseCalls(t *testing.T) {
+	exporter := record_spans(t)
+
+	var traceparent string
+	supabase := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		w.Write([]byte("[]"))
+	}))
+	defer supabase.Close()
+	db := store.NewSupabase(supabase.URL, "key", upstream.New(upstream.Options{}))
+
+	route := tracing.Middleware("/api/pitch")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := store.WithContext(r.Context(), db).Query("pitch", "select=*"); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}))
+	rec := httptest.NewRecorder()
+	route.ServeHTTP(rec, httptest.NewRequest("GET", "/api/pitch?id=1", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	spans := exporter.GetSpans()
+	server := find_span(t, spans, "GET /api/pitch")
+	query := find_span(t, spans, "postgrest select pitch")
+	client := find_span(t, spans, "HTTP GET")
+
+	if query.Parent.SpanID() != server.SpanContext.SpanID() {
+		t.Error("expected the PostgREST span to be a child of the request span")
+	}
+	if client.Parent.SpanID() != query.SpanContext.SpanID() {
+		t.Error("expected the HTTP span to be a child of the PostgREST span")
+	}
+	if got := attribute_value(query, "db.collection.name"); got != "pitch" {
+		t.Errorf("expected db.collection.name pitch, got %q", got)
+	}
+	if got := attribute_value(query, "db.operation.name"); got != "select" {
+		t.Errorf("expected db.operation.name select, got %q", got)
+	}
+	if got := attribute_value(client, "upstream.service"); got == "" {
+		t.Error("expected the HTTP span to name the upstream service")
+	}
+	if want := client.SpanContext.TraceID().String(); traceparent == "" || traceparent[3:35] != want {
+		t.Errorf("expected Supabase to receive trace %s, got traceparent %q", want, traceparent)
+	}
+}
+
+func TestRequestSpanContinuesCallerTrace(t *testing.T) {
+	exporter := record_spans(t)
+
+	route := tracing.Middleware("/api/pitch")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "boom", http.StatusInternalServerError)
+	}))
+	req := httptest.NewRequest("GET", "/api/pitch", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	route.ServeHTTP(httptest.NewRecorder(), req)
+
+	server := find_span(t, exporter.GetSpans(), "GET /api/pitch")
+	if got := server.SpanContext.TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("expected the caller's trace id, got %s", got)
+	}
+	if server.Status.Code != codes.Error {
+		t.Errorf("expected a 500 to mark the span failed, got %v", server.Status.Code)
+	}
+	if got := attribute_value(server, "http.response.status_code"); got != "500" {
+		t.Errorf("expected status code 500, got %q", got)
+	}
+}
+
+func TestSetupWithoutExporterIsANoOp(t *testing.T) {
+	shutdown, err := tracing.Setup(t.Context(), tracing.Options{Exporter: tracing.ExporterNone})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := shutdown(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tracing.Setup(t.Context(), tracing.Options{Exporter: "zipkin"}); err == nil {
+		t.Error("expected an unknown exporter to be rejected")
+	}
+}
@@ -0,0 +1,259 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/tracing"
+)
+
+// ErrCircuitOpen is returned without calling the service while its breaker is
+// open after repeated failures
+var ErrCircuitOpen = errors.New("upstream service unavailable, circuit open")
+
+// Options tunes a Client, zero fields other than Retries take the defaults
+type Options struct {
+	// how long one attempt can take, including reading the response body
+	Timeout time.Duration
+	// how many times a failed GET or HEAD is retried
+	Retries int
+	// the first retry waits up to BaseBackoff, doubling each time up to MaxBackoff
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	// how many failures in a row open a service's breaker
+	BreakerThreshold int
+	// how long an open breaker fails fast before letting a trial call through
+	BreakerCooldown time.Duration
+}
+
+// Client is the HTTP client for calls to Supabase. It bounds every attempt
+// with a deadline, retries idempotent requests that failed or got a 5xx or
+// 429, and keeps a circuit breaker for each service (rest, storage, auth) so
+// a service that is down fails fast instead of tying up requests.
+type Client struct {
+	http     *http.Client
+	opts     Options
+	mu       sync.Mutex
+	breakers map[string]*breaker
+	now      func() time.Time
+	sleep    func(ctx context.Context, d time.Duration) error
+}
+
+// creates a client, sharing one connection pool across every call
+func New(opts Options) *Client {
+	if opts.Timeout <= 0 {
+		opts.Timeout = 30 * time.Second
+	}
+	if opts.Retries < 0 {
+		opts.Retries = 0
+	}
+	if opts.BaseBackoff <= 0 {
+		opts.BaseBackoff = 100 * time.Millisecond
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = 2 * time.Second
+	}
+	if opts.BreakerThreshold <= 0 {
+		opts.BreakerThreshold = 5
+	}
+	if opts.BreakerCooldown <= 0 {
+		opts.BreakerCooldown = 30 * time.Second
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = 100
+	transport.MaxIdleConnsPerHost = 32
+	transport.IdleConnTimeout = 90 * time.Second
+	transport.ResponseHeaderTimeout = opts.Timeout
+
+	return &Client{
+		http:     &http.Client{Transport: transport},
+		opts:     opts,
+		breakers: make(map[string]*breaker),
+		now:      time.Now,
+		sleep:    sleep,
+	}
+}
+
+// sends the request, which is cancelled along with its context, e.g. when
+// the caller of the route that made it disconnects. The response body must
+// be closed as it holds the attempt's deadline.
+func (c *Client) Do(req *http.Request) (resp *http.Response, err error) {
+	b := c.breaker(req.URL)
+	retries := 0
+	if req.Method == http.MethodGet || req.Method == http.MethodHead {
+		retries = c.opts.Retries
+	}
+
+	// one span covers every attempt, the trace context goes out with each
+	req, span := tracing.StartClient(req, "HTTP "+req.Method, attribute.String("upstream.service", b.name))
+	attempt := 0
+	defer func() {
+		span.SetAttributes(attribute.Int("upstream.attempts", attempt+1))
+		tracing.EndResponse(span, resp, err)
+	}()
+
+	for ; ; attempt++ {
+		if err := b.allow(c.now()); err != nil {
+			return nil, fmt.Errorf("%s %s: %w", req.Method, b.name, err)
+		}
+
+		resp, err = c.attempt(req)
+		if req.Context().Err() != nil {
+			// the caller gave up, which says nothing about the service
+			b.release()
+			if resp != nil {
+				resp.Body.Close()
+			}
+			return nil, req.Context().Err()
+		}
+		b.record(err == nil && resp.StatusCode < 500, c.now())
+
+		if !retryable(resp, err) || attempt >= retries {
+			return resp, err
+		}
+
+		wait := c.backoff(attempt, resp)
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		if err := c.sleep(req.Context(), wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// makes one attempt under the client's timeout
+func (c *Client) attempt(req *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(req.Context(), c.opts.Timeout)
+	resp, err := c.http.Do(req.Clone(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = &cancel_body{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// gets how long to wait before the retry after the attempt, full jitter on
+// an exponential backoff or what a 429's Retry-After asks for
+func (c *Client) backoff(attempt int, resp *http.Response) time.Duration {
+	if resp != nil && resp.StatusCode == http.StatusTooManyRequests {
+		if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && secs >= 0 {
+			return min(time.Duration(secs)*time.Second, c.opts.MaxBackoff)
+		}
+	}
+	ceiling := min(c.opts.BaseBackoff<<attempt, c.opts.MaxBackoff)
+	return rand.N(ceiling) + 1
+}
+
+// gets the breaker for the service the URL is on, e.g. rest for /rest/v1/pitch
+func (c *Client) breaker(u *url.URL) *breaker {
+	service, _, _ := strings.Cut(strings.TrimPrefix(u.Path, "/"), "/")
+	name := u.Host + "/" + service
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	b, ok := c.breakers[name]
+	if !ok {
+		b = &breaker{name: name, threshold: c.opts.BreakerThreshold, cooldown: c.opts.BreakerCooldown}
+		c.breakers[name] = b
+	}
+	return b
+}
+
+// reports whether a failed attempt is worth repeating
+func retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		var netErr net.Error
+		return errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, context.DeadlineExceeded)
+	}
+	return resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// releases the attempt's deadline once the body has been read
+type cancel_body struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancel_body) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// breaker opens after threshold failures in a row, fails fast for the
+// cooldown, then lets one trial call through: its success closes the breaker
+// and its failure opens it again
+type breaker struct {
+	name      string
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	failures int
+	open     bool
+	opened   time.Time
+	trial    bool // a trial call is in flight
+}
+
+func (b *breaker) allow(now time.Time) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.open {
+		return nil
+	}
+	if b.trial || now.Sub(b.opened) < b.cooldown {
+		return ErrCircuitOpen
+	}
+	b.trial = true
+	return nil
+}
+
+func (b *breaker) record(ok bool, now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trial = false
+	if ok {
+		b.failures = 0
+		b.open = false
+		return
+	}
+	b.failures++
+	if b.open || b.failures >= b.threshold {
+		b.open = true
+		b.opened = now
+	}
+}
+
+// lets another trial through after one that ended without a verdict
+func (b *breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trial = false
+}
@@ -0,0 +1,128 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// creates a client that doesn't wait between retries and whose clock the test moves
+func new_test_client(opts Options) (*Client, *time.Time) {
+	c := New(opts)
+	now := time.Now()
+	c.now = func() time.Time { return now }
+	c.sleep = func(ctx context.Context, d time.Duration) error { return ctx.Err() }
+	return c, &now
+}
+
+func get(t *testing.T, c *Client, url string) (int, error) {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	resp, err := c.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+func TestRetriesIdempotentRequests(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	c, _ := new_test_client(Options{Retries: 3})
+
+	if code, err := get(t, c, server.URL+"/rest/v1/pitch"); err != nil || code != http.StatusOK {
+		t.Fatalf("Expected the third attempt to succeed, got %d %v", code, err)
+	}
+	if calls.Load() != 3 {
+		t.Errorf("Expected 3 attempts, got %d", calls.Load())
+	}
+
+	// a POST isn't retried as it may have been applied
+	calls.Store(0)
+	req, _ := http.NewRequest(http.MethodPost, server.URL+"/rest/v1/pitch", nil)
+	resp, err := c.Do(req)
+	if err != nil || resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("Expected the failed POST to be returned, got %v", err)
+	}
+	resp.Body.Close()
+	if calls.Load() != 1 {
+		t.Errorf("Expected 1 attempt for a POST, got %d", calls.Load())
+	}
+}
+
+func TestBreakerFailsFastUntilCooldown(t *testing.T) {
+	var down atomic.Bool
+	down.Store(true)
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if down.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	c, now := new_test_client(Options{BreakerThreshold: 2, BreakerCooldown: time.Minute})
+
+	get(t, c, server.URL+"/rest/v1/pitch")
+	get(t, c, server.URL+"/rest/v1/pitch")
+	if _, err := get(t, c, server.URL+"/rest/v1/pitch"); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Expected the breaker to be open, got %v", err)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("Expected the open breaker not to call the service, got %d calls", calls.Load())
+	}
+
+	// other services keep their own breaker
+	if code, err := get(t, c, server.URL+"/storage/v1/bucket"); err != nil || code != http.StatusInternalServerError {
+		t.Errorf("Expected storage to still be called, got %d %v", code, err)
+	}
+
+	// after the cooldown a trial call closes it again
+	down.Store(false)
+	*now = now.Add(time.Minute)
+	if code, err := get(t, c, server.URL+"/rest/v1/pitch"); err != nil || code != http.StatusOK {
+		t.Fatalf("Expected the trial call to succeed, got %d %v", code, err)
+	}
+	if code, err := get(t, c, server.URL+"/rest/v1/pitch"); err != nil || code != http.StatusOK {
+		t.Errorf("Expected the breaker to be closed, got %d %v", code, err)
+	}
+}
+
+func TestCallerCancellationStopsTheCall(t *testing.T) {
+	started := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+	c, _ := new_test_client(Options{Retries: 3, BreakerThreshold: 1})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/rest/v1/pitch", nil)
+	if _, err := c.Do(req); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected the call to be cancelled, got %v", err)
+	}
+
+	// the cancelled call isn't held against the service
+	if b := c.breaker(req.URL); b.open || b.failures != 0 {
+		t.Errorf("Expected the breaker to be untouched, got %+v", b)
+	}
+}
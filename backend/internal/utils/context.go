@@ -16,3 +16,14 @@ func UserIDFromCtx(ctx context.Context) (string, bool) {
 	uid, ok := ctx.Value(UserIDKey).(string)
 	return uid, ok
 }
+
+const RequestIDKey ctxKey = "request_id"
+
+func CtxWithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, RequestIDKey, id)
+}
+
+func RequestIDFromCtx(ctx context.Context) string {
+	id, _ := ctx.Value(RequestIDKey).(string)
+	return id
+}
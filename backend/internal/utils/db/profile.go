@@ -6,13 +6,14 @@ import (
 	"net/http"
 
 	model "github.com/EmmaMartin123/Industrial_Project/backend/internal/model/common"
-	"github.com/EmmaMartin123/Industrial_Project/backend/internal/utils"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/postgrest"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/store"
 )
 
 // gets the user profile
-func GetUserProfile(userID string) (model.Profile, error) {
-	profileQuery := fmt.Sprintf("id=eq.%s", userID)
-	profileResult, err := utils.GetDataByQuery("profile", profileQuery)
+func GetUserProfile(db store.Store, userID string) (model.Profile, error) {
+	profileQuery := postgrest.New().Eq("id", userID)
+	profileResult, err := db.Query("profile", profileQuery.String())
 	if err != nil {
 		return model.Profile{}, fmt.Errorf("error fetching user profile: %w", err)
 	}
@@ -31,8 +32,8 @@ func GetUserProfile(userID string) (model.Profile, error) {
 
 // CheckUserRole verifies if a user has the required role and handles error responses
 // Returns true if the user has the required role and the user's profile
-func CheckUserRole(w http.ResponseWriter, userID string, requiredRole string) (bool, model.Profile) {
-	profile, err := GetUserProfile(userID)
+func CheckUserRole(w http.ResponseWriter, db store.Store, userID string, requiredRole string) (bool, model.Profile) {
+	profile, err := GetUserProfile(db, userID)
 	if err != nil {
 		if err.Error() == "user profile not found" {
 			http.Error(w, "User profile not found", http.StatusNotFound)
@@ -4,21 +4,9 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
-	"os"
 	"strings"
 )
 
-// gets the CORS allowlist
-func CORSAllowlist() map[string]bool {
-	allowlist := make(map[string]bool)
-	if origins := os.Getenv("CORS_ALLOWLIST"); origins != "" {
-		for origin := range strings.SplitSeq(origins, ",") {
-			allowlist[strings.TrimSpace(origin)] = true
-		}
-	}
-	return allowlist
-}
-
 // writes an error to the response
 func WriteError(w http.ResponseWriter, err error, code int64) {
 	w.Header().Set("Content-Type", "application/json")
@@ -2,33 +2,40 @@ package utils
 
 import (
 	"errors"
-	"os"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
-var (
+// JWTVerifier checks HS256 tokens against the issuer and secret they must be
+// signed with
+type JWTVerifier struct {
 	issuer  string
 	hmacKey []byte
-)
+}
 
-// initializes the JWT HS256
-func InitJWTHS256(issuerURL string) error {
+// creates the JWT HS256 verifier for tokens from the issuer signed with the
+// secret
+func NewJWTHS256(issuerURL string, secret string) *JWTVerifier {
+	v := &JWTVerifier{issuer: issuerURL}
+	if secret != "" {
+		v.hmacKey = []byte(secret)
+	}
+	return v
+}
 
-	issuer = issuerURL
-	secret := os.Getenv("SUPABASE_JWT_SECRET")
-	if secret == "" {
-		return errors.New("SUPABASE_JWT_SECRET must be set for HS256 setup")
+// checks the verifier has the secret tokens are verified with
+func (v *JWTVerifier) Configured() error {
+	if v == nil || v.hmacKey == nil {
+		return errors.New("JWT secret not configured")
 	}
-	hmacKey = []byte(secret)
 	return nil
 }
 
-// verifies the JWT HS256
-func VerifyJWTHS256(tokenStr string) (string, error) {
-	if hmacKey == nil {
-		return "", errors.New("JWT secret not configured")
+// verifies the JWT HS256, returning the user it was issued to
+func (v *JWTVerifier) Verify(tokenStr string) (string, error) {
+	if err := v.Configured(); err != nil {
+		return "", err
 	}
 
 	claims := jwt.MapClaims{}
@@ -39,9 +46,9 @@ func VerifyJWTHS256(tokenStr string) (string, error) {
 			if t.Method != jwt.SigningMethodHS256 {
 				return nil, errors.New("unexpected signing method")
 			}
-			return hmacKey, nil
+			return v.hmacKey, nil
 		},
-		jwt.WithIssuer(issuer),
+		jwt.WithIssuer(v.issuer),
 		jwt.WithLeeway(30*time.Second),
 	)
 	if err != nil || !tok.Valid {
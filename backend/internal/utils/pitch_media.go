@@ -7,21 +7,21 @@ import (
 	"github.com/EmmaMartin123/Industrial_Project/backend/internal/model/database"
 	"github.com/EmmaMartin123/Industrial_Project/backend/internal/model/frontend"
 	mapping "github.com/EmmaMartin123/Industrial_Project/backend/internal/model/mapping"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/postgrest"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/store"
 )
 
 // gets the pitch media
-func GetPitchMedia(pitchID int64) ([]frontend.PitchMedia, error) {
-	query := fmt.Sprintf("pitch_id=eq.%d", pitchID)
-	body, err := GetDataByQuery("pitch_media", query)
+func GetPitchMedia(db store.Store, pitchID int64) ([]frontend.PitchMedia, error) {
+	query := postgrest.New().Eq("pitch_id", pitchID)
+	body, err := db.Query("pitch_media", query.String())
 	if err != nil {
-		fmt.Printf("error fetching pitch media from Supabase: %v\n", err)
-		return nil, err
+		return nil, fmt.Errorf("failed to fetch pitch media: %w", err)
 	}
 
 	var dbMedia []database.PitchMedia
 	if err = json.Unmarshal([]byte(body), &dbMedia); err != nil {
-		fmt.Printf("error unmarshaling pitch media: %v\nbody: %s\n", err, string(body))
-		return nil, err
+		return nil, fmt.Errorf("failed to decode pitch media: %w", err)
 	}
 
 	frontendMedia := make([]frontend.PitchMedia, len(dbMedia))
@@ -2,15 +2,21 @@ package utils
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"mime/multipart"
 	"net/http"
-	"os"
 	"path/filepath"
 	"strings"
 	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/config"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/tracing"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/upstream"
 )
 
 const (
@@ -18,18 +24,18 @@ const (
 )
 
 // uploads a file to S3
-func UploadFileToS3(file multipart.File, fileName string, mediaType string) (string, error) {
-	storageURL := strings.TrimSuffix(os.Getenv("SUPABASE_S3_URL"), "/")
-	projectURL := strings.TrimSuffix(os.Getenv("SUPABASE_URL"), "/")
-	serviceKey := os.Getenv("SUPABASE_SERVICE_ROLE_KEY")
-	apiKey := os.Getenv("SUPABASE_ANON_KEY")
+func UploadFileToS3(ctx context.Context, client *upstream.Client, cfg config.Supabase, file multipart.File, fileName string, mediaType string) (url string, err error) {
+	ctx, span := tracing.Start(ctx, "storage upload", storage_attributes("upload", fileName)...)
+	defer func() { tracing.End(span, err) }()
+
+	storageURL := cfg.S3URL
+	projectURL := cfg.URL
+	serviceKey := cfg.ServiceRoleKey
+	apiKey := cfg.StorageAPIKey()
 
 	if storageURL == "" || projectURL == "" || serviceKey == "" {
 		return "", errors.New("missing Supabase configuration")
 	}
-	if apiKey == "" {
-		apiKey = serviceKey
-	}
 
 	fileBytes, err := io.ReadAll(file)
 	if err != nil {
@@ -41,7 +47,7 @@ func UploadFileToS3(file multipart.File, fileName string, mediaType string) (str
 		uploadURL = fmt.Sprintf("%s/storage/v1", uploadURL)
 	}
 
-	req, err := http.NewRequest(
+	req, err := http.NewRequestWithContext(ctx, 
 		"POST",
 		fmt.Sprintf("%s/object/%s/%s", uploadURL, bucketName, fileName),
 		bytes.NewReader(fileBytes),
@@ -59,7 +65,6 @@ func UploadFileToS3(file multipart.File, fileName string, mediaType string) (str
 	req.Header.Set("apikey", apiKey)
 	req.Header.Set("x-upsert", "false")
 
-	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
 		return "", err
@@ -75,17 +80,17 @@ func UploadFileToS3(file multipart.File, fileName string, mediaType string) (str
 }
 
 // deletes a file from S3
-func DeleteFileFromS3(fileURL string) error {
-	storageURL := strings.TrimSuffix(os.Getenv("SUPABASE_S3_URL"), "/")
-	serviceKey := os.Getenv("SUPABASE_SERVICE_ROLE_KEY")
-	apiKey := os.Getenv("SUPABASE_ANON_KEY")
+func DeleteFileFromS3(ctx context.Context, client *upstream.Client, cfg config.Supabase, fileURL string) (err error) {
+	ctx, span := tracing.Start(ctx, "storage delete", storage_attributes("delete", filepath.Base(fileURL))...)
+	defer func() { tracing.End(span, err) }()
+
+	storageURL := cfg.S3URL
+	serviceKey := cfg.ServiceRoleKey
+	apiKey := cfg.StorageAPIKey()
 
 	if storageURL == "" || serviceKey == "" {
 		return errors.New("missing Supabase configuration")
 	}
-	if apiKey == "" {
-		apiKey = serviceKey
-	}
 
 	fileName := filepath.Base(fileURL)
 	if fileName == "" {
@@ -97,7 +102,7 @@ func DeleteFileFromS3(fileURL string) error {
 		uploadURL = fmt.Sprintf("%s/storage/v1", uploadURL)
 	}
 
-	req, err := http.NewRequest("DELETE", fmt.Sprintf("%s/object/%s/%s", uploadURL, bucketName, fileName), nil)
+	req, err := http.NewRequestWithContext(ctx, "DELETE", fmt.Sprintf("%s/object/%s/%s", uploadURL, bucketName, fileName), nil)
 	if err != nil {
 		return err
 	}
@@ -105,7 +110,6 @@ func DeleteFileFromS3(fileURL string) error {
 	req.Header.Set("Authorization", "Bearer "+serviceKey)
 	req.Header.Set("apikey", apiKey)
 
-	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
 		return err
@@ -120,6 +124,52 @@ func DeleteFileFromS3(fileURL string) error {
 	return nil
 }
 
+// checks the storage API can be reached and the pitch files bucket exists
+func PingStorage(ctx context.Context, client *upstream.Client, cfg config.Supabase) error {
+	storageURL := cfg.S3URL
+	serviceKey := cfg.ServiceRoleKey
+	apiKey := cfg.StorageAPIKey()
+
+	if storageURL == "" || serviceKey == "" {
+		return errors.New("missing Supabase configuration")
+	}
+
+	bucketURL := strings.TrimSuffix(storageURL, "/storage/v1/s3")
+	if !strings.Contains(bucketURL, "/storage/v1") {
+		bucketURL = fmt.Sprintf("%s/storage/v1", bucketURL)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s/bucket/%s", bucketURL, bucketName), nil)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+serviceKey)
+	req.Header.Set("apikey", apiKey)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("failed to reach storage: status %d, body: %s", resp.StatusCode, string(body))
+	}
+
+	return nil
+}
+
+// describes a storage call on an object in the pitch files bucket
+func storage_attributes(operation string, object string) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("storage.operation", operation),
+		attribute.String("storage.bucket", bucketName),
+		attribute.String("storage.object", object),
+	}
+}
+
 // generates a unique file name
 func GenerateUniqueFileName(prefix, extension string) string {
 	return fmt.Sprintf("%s_%d%s", prefix, time.Now().UTC().UnixNano(), extension)
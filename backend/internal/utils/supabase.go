@@ -1,212 +1,15 @@
 package utils
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
-	"os"
-)
-
-// inserts data into a table
-func InsertData(data any, table string) (string, error) {
-	SUPABASE_URL := os.Getenv("SUPABASE_URL")
-	SUPABASE_KEY := os.Getenv("SUPABASE_SERVICE_ROLE_KEY")
-
-	url := SUPABASE_URL + "/rest/v1/" + table
-
-	jsonData, err := json.Marshal(data)
-	if err != nil {
-		return "", err
-	}
-
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return "", err
-	}
-
-	req.Header.Set("apikey", SUPABASE_KEY)
-	req.Header.Set("Authorization", "Bearer "+SUPABASE_KEY)
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Prefer", "return=representation") // returns inserted rows
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-
-	body, _ := io.ReadAll(resp.Body)
-	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("failed to insert: status %d, body: %s", resp.StatusCode, string(body))
-	}
-
-	return string(body), err
-}
-
-// gets all data from a table
-func GetAllData(table string) ([]byte, error) {
-	SUPABASE_URL := os.Getenv("SUPABASE_URL")
-	SUPABASE_KEY := os.Getenv("SUPABASE_SERVICE_ROLE_KEY")
-
-	url := SUPABASE_URL + "/rest/v1/" + table
-
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	req.Header.Set("apikey", SUPABASE_KEY)
-	req.Header.Set("Authorization", "Bearer "+SUPABASE_KEY)
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	body, _ := io.ReadAll(resp.Body)
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to fetch data: status %d, body: %s", resp.StatusCode, string(body))
-	}
-
-	return body, nil
-}
-
-// gets data by ID from a table
-func GetDataByID(table string, id string) ([]byte, error) {
-	SUPABASE_URL := os.Getenv("SUPABASE_URL")
-	SUPABASE_KEY := os.Getenv("SUPABASE_SERVICE_ROLE_KEY")
-
-	url := fmt.Sprintf("%s/rest/v1/%s?id=eq.%s", SUPABASE_URL, table, id) // SUPABASE_URL/rest/v1/table?id=eq.id
-
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	req.Header.Set("apikey", SUPABASE_KEY)
-	req.Header.Set("Authorization", "Bearer "+SUPABASE_KEY)
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	body, _ := io.ReadAll(resp.Body)
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to fetch by ID: status %d, body: %s", resp.StatusCode, string(body))
-	}
-
-	return body, nil
-}
-
-// deletes data by ID from a table
-func DeleteByID(table string, id string) error {
-	SUPABASE_URL := os.Getenv("SUPABASE_URL")
-	SUPABASE_KEY := os.Getenv("SUPABASE_SERVICE_ROLE_KEY")
-
-	url := fmt.Sprintf("%s/rest/v1/%s?id=eq.%s", SUPABASE_URL, table, id)
 
-	req, err := http.NewRequest("DELETE", url, nil)
-	if err != nil {
-		return err
-	}
-
-	req.Header.Set("apikey", SUPABASE_KEY)
-	req.Header.Set("Authorization", "Bearer "+SUPABASE_KEY)
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusNoContent {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("failed to delete: status %d, body: %s", resp.StatusCode, string(body))
-	}
-
-	return nil
-}
-
-// gets data by query from a table
-func GetDataByQuery(table string, query string) ([]byte, error) {
-	SUPABASE_URL := os.Getenv("SUPABASE_URL")
-	SUPABASE_KEY := os.Getenv("SUPABASE_SERVICE_ROLE_KEY")
-
-	url := fmt.Sprintf("%s/rest/v1/%s?%s", SUPABASE_URL, table, query) // SUPABASE_URL/rest/v1/table?query
-	//fmt.Println("URL: ", url)
-
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	req.Header.Set("apikey", SUPABASE_KEY)
-	req.Header.Set("Authorization", "Bearer "+SUPABASE_KEY)
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	body, _ := io.ReadAll(resp.Body)
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to fetch by ID: status %d, body: %s", resp.StatusCode, string(body))
-	}
-
-	return body, nil
-}
-
-// updates data by ID from a table
-func UpdateByID(table string, id string, data any) ([]byte, error) {
-	SUPABASE_URL := os.Getenv("SUPABASE_URL")
-	SUPABASE_KEY := os.Getenv("SUPABASE_SERVICE_ROLE_KEY")
-
-	url := fmt.Sprintf("%s/rest/v1/%s?id=eq.%s", SUPABASE_URL, table, id)
-
-	jsonData, err := json.Marshal(data)
-	if err != nil {
-		return nil, err
-	}
-
-	req, err := http.NewRequest("PATCH", url, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return nil, err
-	}
-
-	req.Header.Set("apikey", SUPABASE_KEY)
-	req.Header.Set("Authorization", "Bearer "+SUPABASE_KEY)
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Prefer", "return=representation") // return updated row
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	body, _ := io.ReadAll(resp.Body)
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to update by ID: status %d, body: %s", resp.StatusCode, string(body))
-	}
-
-	return body, nil
-}
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/config"
+	"github.com/EmmaMartin123/Industrial_Project/backend/internal/upstream"
+)
 
 type AuthUser struct {
 	ID    string `json:"id"`
@@ -214,16 +17,16 @@ type AuthUser struct {
 }
 
 // gets the auth user email
-func GetAuthUserEmail(userID string) (string, error) {
-	SUPABASE_URL := os.Getenv("SUPABASE_URL")
-	SUPABASE_KEY := os.Getenv("SUPABASE_SERVICE_ROLE_KEY")
+func GetAuthUserEmail(ctx context.Context, client *upstream.Client, cfg config.Supabase, userID string) (string, error) {
+	SUPABASE_URL := cfg.URL
+	SUPABASE_KEY := cfg.ServiceRoleKey
 	if SUPABASE_URL == "" || SUPABASE_KEY == "" {
 		return "", fmt.Errorf("SUPABASE_URL or SUPABASE_SERVICE_ROLE_KEY not set")
 	}
 
 	url := fmt.Sprintf("%s/auth/v1/admin/users/%s", SUPABASE_URL, userID)
 
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return "", err
 	}
@@ -231,7 +34,6 @@ func GetAuthUserEmail(userID string) (string, error) {
 	req.Header.Set("Authorization", "Bearer "+SUPABASE_KEY)
 	req.Header.Set("Content-Type", "application/json")
 
-	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
 		return "", err
@@ -255,27 +57,3 @@ func GetAuthUserEmail(userID string) (string, error) {
 
 	return user.Email, nil
 }
-
-// deletes pitch tags
-func DeletePitchTags(pitchID int64) error {
-	query := fmt.Sprintf("pitch_id=eq.%d", pitchID)
-	url := fmt.Sprintf("%s/rest/v1/pitch_tags?%s", os.Getenv("SUPABASE_URL"), query)
-	req, err := http.NewRequest("DELETE", url, nil)
-	if err != nil {
-		return err
-	}
-	key := os.Getenv("SUPABASE_SERVICE_ROLE_KEY")
-	req.Header.Set("apikey", key)
-	req.Header.Set("Authorization", "Bearer "+key)
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusNoContent {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("delete pitch_tags failed: %d, body: %s", resp.StatusCode, string(body))
-	}
-	return nil
-}
@@ -0,0 +1,15 @@
+-- double-entry wallet ledger, every transaction writes a wallet entry and a
+-- contra entry (bank, pitch or profit account) whose amounts sum to zero
+create table if not exists ledger_entries (
+    id             bigint generated by default as identity primary key,
+    transaction_id text        not null,
+    account        text        not null,
+    kind           text        not null check (kind in ('deposit', 'withdraw', 'investment', 'refund', 'distribution', 'distribution_debit')),
+    amount         bigint      not null,
+    balance_after  bigint,
+    reference      text,
+    created_at     timestamptz not null default now()
+);
+
+create index if not exists ledger_entries_account_idx on ledger_entries (account, created_at desc);
+create index if not exists ledger_entries_transaction_idx on ledger_entries (transaction_id);
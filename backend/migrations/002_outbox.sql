@@ -0,0 +1,19 @@
+-- saga outbox, one row per multi-step operation so the worker can retry or
+-- roll back anything a crash or restart left half done
+create table if not exists outbox (
+    id           bigint generated by default as identity primary key,
+    kind         text        not null,
+    payload      jsonb       not null,
+    status       text        not null check (status in ('pending', 'compensating', 'completed', 'compensated', 'failed')),
+    step         integer     not null default 0,
+    attempts     integer     not null default 0,
+    last_error   text,
+    locked_until timestamptz not null default now(),
+    created_at   timestamptz not null default now(),
+    updated_at   timestamptz not null default now()
+);
+
+create index if not exists outbox_due_idx on outbox (locked_until) where status in ('pending', 'compensating');
+
+-- links an investment to the saga that created it so the step is idempotent
+alter table investments add column if not exists outbox_id bigint unique references outbox (id);
@@ -0,0 +1,13 @@
+-- first response for each Idempotency-Key, scoped to user, method and route;
+-- status is 0 while the first request is still running
+create table if not exists idempotency_keys (
+    key         text        primary key,
+    fingerprint text        not null,
+    status      integer     not null default 0,
+    header      jsonb,
+    body        text,
+    expires_at  timestamptz not null,
+    created_at  timestamptz not null default now()
+);
+
+create index if not exists idempotency_keys_expires_idx on idempotency_keys (expires_at);
@@ -0,0 +1,14 @@
+-- every change to a pitch's raised_amount claims the pitch's next version
+-- here first, the unique (pitch_id, version) key lets only one change claim
+-- each version so concurrent investments can't oversubscribe the target
+alter table pitch add column if not exists version bigint not null default 0;
+
+create table if not exists pitch_reservations (
+    id         bigint generated by default as identity primary key,
+    pitch_id   bigint      not null references pitch (id) on delete cascade,
+    version    bigint      not null,
+    reference  text        not null unique,
+    amount     bigint      not null,
+    created_at timestamptz not null default now(),
+    unique (pitch_id, version)
+);
@@ -0,0 +1,19 @@
+-- one run per profit distribution, its payouts are the profit_distributions
+-- rows with the run's id so a run that stopped part way can be resumed
+create table if not exists distribution_runs (
+    id             bigint generated by default as identity primary key,
+    profit_id      bigint      not null unique references profits (id),
+    pitch_id       bigint      not null references pitch (id),
+    business_id    uuid        not null,
+    status         text        not null check (status in ('pending', 'in_progress', 'completed', 'failed')),
+    total_amount   bigint      not null,
+    investor_count integer     not null default 0,
+    paid_count     integer     not null default 0,
+    last_error     text,
+    locked_until   timestamptz not null default now(),
+    created_at     timestamptz not null default now(),
+    updated_at     timestamptz not null default now()
+);
+
+alter table profit_distributions add column if not exists run_id bigint references distribution_runs (id);
+create unique index if not exists profit_distributions_profit_investment_idx on profit_distributions (profit_id, investment_id);
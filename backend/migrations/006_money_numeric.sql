@@ -0,0 +1,15 @@
+-- amounts are exact pounds and pence, the API sends them as decimals such as
+-- 12.34 so every money column holds two decimal places
+alter table investments          alter column amount               type numeric(14, 2);
+alter table investment_tier      alter column min_amount           type numeric(14, 2);
+alter table pitch                alter column target_amount        type numeric(14, 2);
+alter table pitch                alter column raised_amount        type numeric(14, 2);
+alter table profile              alter column dashboard_balance    type numeric(14, 2);
+alter table bank_account         alter column balance              type numeric(14, 2);
+alter table profits              alter column total_profit         type numeric(14, 2);
+alter table profits              alter column distributable_amount type numeric(14, 2);
+alter table profit_distributions alter column amount               type numeric(14, 2);
+alter table ledger_entries       alter column amount               type numeric(14, 2);
+alter table ledger_entries       alter column balance_after        type numeric(14, 2);
+alter table pitch_reservations   alter column amount               type numeric(14, 2);
+alter table distribution_runs    alter column total_amount         type numeric(14, 2);
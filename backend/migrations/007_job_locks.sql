@@ -0,0 +1,9 @@
+-- one row per scheduled job, a server runs the job only while its lease in
+-- locked_until is held so running several servers never doubles a job
+create table if not exists job_locks (
+    name         text        primary key,
+    owner        text        not null,
+    locked_until timestamptz not null,
+    last_run_at  timestamptz,
+    last_error   text        not null default ''
+);
@@ -0,0 +1,19 @@
+-- one row per admin action, written once and never updated
+create table if not exists audit_log (
+    id          bigint generated by default as identity primary key,
+    actor_id    uuid        not null,
+    action      text        not null,
+    target_type text        not null,
+    target_id   text        not null,
+    reason      text,
+    details     jsonb,
+    created_at  timestamptz not null default now()
+);
+create index if not exists audit_log_target_idx on audit_log (target_type, target_id);
+
+-- a frozen wallet can still receive refunds and payouts but can't move money out
+alter table profile add column if not exists wallet_frozen boolean not null default false;
+
+-- a suspended pitch remembers the status it goes back to and why it was suspended
+alter table pitch add column if not exists suspended_from   text;
+alter table pitch add column if not exists suspended_reason text;
@@ -0,0 +1,70 @@
+-- every state-changing request is audited, not just admin actions. Entries
+-- are hash-chained: hash covers the entry and prev_hash, the hash of the entry
+-- at seq - 1, so an edited or removed entry breaks the chain after it
+alter table audit_log add column if not exists seq        bigint;
+alter table audit_log add column if not exists before     jsonb;
+alter table audit_log add column if not exists after      jsonb;
+alter table audit_log add column if not exists request_id text;
+alter table audit_log add column if not exists prev_hash  text not null default '';
+alter table audit_log add column if not exists hash       text;
+
+-- entries written before the chain existed are chained in the order they
+-- were written, hashed the way audit.Entry.digest hashes them. Their details
+-- column is kept but isn't covered by the hash.
+do $$
+declare
+    r       record;
+    n       bigint;
+    prev    text;
+    created text;
+    frac    text;
+    fields  text[];
+    f       text;
+    payload text;
+    digest  text;
+begin
+    select coalesce(max(seq), 0) into n from audit_log;
+    select coalesce((select hash from audit_log where seq = n), '') into prev;
+
+    for r in select * from audit_log where seq is null order by created_at, id loop
+        n := n + 1;
+        -- RFC 3339 in UTC with trailing zeros dropped, as Go formats it
+        created := to_char(r.created_at at time zone 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS');
+        frac := rtrim(to_char(r.created_at at time zone 'UTC', 'US'), '0');
+        if frac <> '' then
+            created := created || '.' || frac;
+        end if;
+        created := created || 'Z';
+
+        fields := array[
+            n::text, prev, r.actor_id::text, r.action, r.target_type, r.target_id,
+            coalesce(r.reason, ''), '', '', '', created
+        ];
+        payload := '';
+        foreach f in array fields loop
+            payload := payload || octet_length(f) || ':' || f || ';';
+        end loop;
+
+        digest := encode(sha256(convert_to(payload, 'UTF8')), 'hex');
+        update audit_log set seq = n, prev_hash = prev, hash = digest where id = r.id;
+        prev := digest;
+    end loop;
+end;
+$$;
+
+alter table audit_log alter column seq set not null;
+alter table audit_log alter column hash set not null;
+alter table audit_log alter column created_at drop default;
+create unique index if not exists audit_log_seq_idx on audit_log (seq);
+create index if not exists audit_log_actor_idx on audit_log (actor_id);
+
+-- the log is append only
+create or replace function audit_log_append_only() returns trigger as $$
+begin
+    raise exception 'audit_log is append only';
+end;
+$$ language plpgsql;
+
+drop trigger if exists audit_log_append_only on audit_log;
+create trigger audit_log_append_only before update or delete on audit_log
+    for each row execute function audit_log_append_only();
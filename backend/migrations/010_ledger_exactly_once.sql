@@ -0,0 +1,41 @@
+-- wallet entries are numbered per account and carry the balance after them,
+-- so the latest entry is the wallet's balance. The unique (account, seq) key
+-- lets only one posting follow each entry, which makes the insert of both
+-- entries the compare-and-swap, and the unique (account, reference) key lets
+-- each reference be posted once however many callers try at the same time.
+-- profile.dashboard_balance is kept as a copy of the latest balance_after.
+alter table ledger_entries add column if not exists seq bigint;
+alter table profile add column if not exists ledger_seq bigint;
+
+with numbered as (
+    select id, row_number() over (partition by account order by id) as seq
+    from ledger_entries
+    where account like 'wallet:%'
+)
+update ledger_entries e set seq = numbered.seq
+from numbered
+where e.id = numbered.id;
+
+-- a balance moved without its entries (a crash between the two under the
+-- old order) never happened as far as the ledger is concerned, so profiles
+-- take the balance of their latest entry
+update profile p set dashboard_balance = latest.balance_after, ledger_seq = latest.seq
+from (
+    select distinct on (account) account, seq, balance_after
+    from ledger_entries
+    where seq is not null
+    order by account, seq desc
+) latest
+where latest.account = 'wallet:' || p.id;
+
+create unique index if not exists ledger_entries_seq_idx on ledger_entries (account, seq);
+
+-- reversals of failed withdrawals were all posted under the reference
+-- 'reversal', each takes the id of its own transaction instead so the
+-- reference index below can be built
+update ledger_entries set reference = 'withdrawal:' || transaction_id || ':reversal'
+where reference = 'reversal';
+
+-- fails if a reference was already posted twice, those postings have to be
+-- reversed by hand first
+create unique index if not exists ledger_entries_reference_idx on ledger_entries (account, reference);
@@ -0,0 +1,4 @@
+-- whoever claims a distribution run's lease writes a token here, renewals and
+-- progress are conditional on it so a resume that lost the lease stops instead
+-- of paying alongside the one that took it over
+alter table distribution_runs add column if not exists locked_by text;